@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+)
+
+// historyCommand prints the metadata changes of a class, an issuer or a JoyID account, run it with
+// `syncer history -type cota -key <cota id>` or `-type issuer|joy_id -key <lock hash>`
+type historyCommand struct {
+	historyUsecase *biz.MetadataHistoryUsecase
+}
+
+func newHistoryCommand(historyUsecase *biz.MetadataHistoryUsecase) *historyCommand {
+	return &historyCommand{
+		historyUsecase: historyUsecase,
+	}
+}
+
+func (c *historyCommand) run(args []string) error {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	metaType := flags.String("type", biz.MetadataHistoryClass, "metadata type: issuer, cota or joy_id")
+	key := flags.String("key", "", "cota id of the class or lock hash of the issuer or JoyID account")
+	asJson := flags.Bool("json", false, "print the history as json")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *key == "" {
+		return fmt.Errorf("usage: syncer history -type issuer|cota|joy_id -key <hex> [-json]")
+	}
+	history, err := c.historyUsecase.History(context.Background(), *metaType, strings.TrimPrefix(*key, "0x"))
+	if err != nil {
+		return err
+	}
+	if *asJson {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(history)
+	}
+	if history.KeptFrom > 0 {
+		fmt.Printf("the versions before block %d were pruned\n", history.KeptFrom)
+	}
+	for _, change := range history.Changes {
+		line := fmt.Sprintf("block %d tx %d %s", change.BlockNumber, change.TxIndex, change.Action)
+		if change.SubKey != "" {
+			line += " sub key " + change.SubKey
+		}
+		fmt.Println(line)
+		for _, field := range change.Fields {
+			fmt.Printf("  %s: %q -> %q\n", field.Field, field.Old, field.New)
+		}
+	}
+	return nil
+}
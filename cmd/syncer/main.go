@@ -13,12 +13,12 @@ import (
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-func newApp(logger *logger.Logger, blockSyncSvc *service.BlockSyncService, checkInfoCleanerSvc *service.CheckInfoCleanerService, metadataSyncSvc *service.MetadataSyncService, invalidDataCleanerSvc *service.InvalidDataCleaner, withdrawExtraInfoService *service.WithdrawExtraInfoService, registerLockService *service.RegisterLockService, m *data.DBMigration) *app.App {
+func newApp(logger *logger.Logger, blockSyncSvc *service.BlockSyncService, checkInfoCleanerSvc *service.CheckInfoCleanerService, metadataSyncSvc *service.MetadataSyncService, invalidDataCleanerSvc *service.InvalidDataCleaner, withdrawExtraInfoService *service.WithdrawExtraInfoService, registerLockService *service.RegisterLockService, querySvc *service.QueryService, webhookDispatcher *service.WebhookDispatcher, eventSinkSvc *service.EventSinkService, versionPrunerSvc *service.VersionPrunerService, outboxPrunerSvc *service.OutboxPrunerService, localizationFetcherSvc *service.LocalizationFetcherService, m *data.DBMigration) *app.App {
 	return app.NewApp(
 		app.Name("cota-syncer"),
 		app.Version("0.0.1"),
 		app.Logger(logger),
-		app.Services(blockSyncSvc, checkInfoCleanerSvc, metadataSyncSvc, invalidDataCleanerSvc, withdrawExtraInfoService, registerLockService), app.Migration(m))
+		app.Services(blockSyncSvc, checkInfoCleanerSvc, metadataSyncSvc, invalidDataCleanerSvc, withdrawExtraInfoService, registerLockService, querySvc, webhookDispatcher, eventSinkSvc, versionPrunerSvc, outboxPrunerSvc, localizationFetcherSvc), app.Migration(m))
 }
 
 func main() {
@@ -38,6 +38,38 @@ func main() {
 	if err != nil {
 		log.Fatalf("init.setupCkbNodeConfig err: %v", err)
 	}
+	apiConf, err := setupApiConf(conf)
+	if err != nil {
+		log.Fatalf("init.setupApiConfig err: %v", err)
+	}
+	webhookConf, err := setupWebhookConf(conf)
+	if err != nil {
+		log.Fatalf("init.setupWebhookConfig err: %v", err)
+	}
+	sinkConf, err := setupSinkConf(conf)
+	if err != nil {
+		log.Fatalf("init.setupSinkConfig err: %v", err)
+	}
+	syncConf, err := setupSyncConf(conf)
+	if err != nil {
+		log.Fatalf("init.setupSyncConfig err: %v", err)
+	}
+	retentionConf, err := setupRetentionConf(conf)
+	if err != nil {
+		log.Fatalf("init.setupRetentionConfig err: %v", err)
+	}
+	metadataConf, err := setupMetadataConf(conf)
+	if err != nil {
+		log.Fatalf("init.setupMetadataConfig err: %v", err)
+	}
+	localizationConf, err := setupLocalizationConf(conf)
+	if err != nil {
+		log.Fatalf("init.setupLocalizationConfig err: %v", err)
+	}
+	mediaConf, err := setupMediaConf(conf)
+	if err != nil {
+		log.Fatalf("init.setupMediaConfig err: %v", err)
+	}
 	logger := logger.NewLogger(&lumberjack.Logger{
 		Filename:   fmt.Sprintf("%s/%s%s", appConf.LogSavePath, appConf.LogFileName, appConf.LogFileExt),
 		MaxSize:    600,
@@ -46,7 +78,92 @@ func main() {
 		LocalTime:  true,
 	}, "", log.LstdFlags)
 
-	app, cleanup, err := initApp(&dataConf.Database, ckbNodeConf, logger)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "requeue":
+			requeue, cleanup, err := initRequeue(&dataConf.Database, ckbNodeConf, metadataConf, mediaConf, logger)
+			if err != nil {
+				panic(err)
+			}
+			defer cleanup()
+			if err := requeue.run(os.Args[2:]); err != nil {
+				panic(err)
+			}
+			return
+		case "timeline":
+			timeline, cleanup, err := initTimeline(&dataConf.Database, ckbNodeConf, metadataConf, mediaConf, logger)
+			if err != nil {
+				panic(err)
+			}
+			defer cleanup()
+			if err := timeline.run(os.Args[2:]); err != nil {
+				panic(err)
+			}
+			return
+		case "snapshot":
+			snapshot, cleanup, err := initSnapshot(&dataConf.Database, metadataConf, mediaConf, logger)
+			if err != nil {
+				panic(err)
+			}
+			defer cleanup()
+			if err := snapshot.run(os.Args[2:]); err != nil {
+				panic(err)
+			}
+			return
+		case "history":
+			history, cleanup, err := initHistory(&dataConf.Database, logger)
+			if err != nil {
+				panic(err)
+			}
+			defer cleanup()
+			if err := history.run(os.Args[2:]); err != nil {
+				panic(err)
+			}
+			return
+		case "traits":
+			traits, cleanup, err := initTraits(&dataConf.Database, logger)
+			if err != nil {
+				panic(err)
+			}
+			defer cleanup()
+			if err := traits.run(os.Args[2:]); err != nil {
+				panic(err)
+			}
+			return
+		case "search":
+			search, cleanup, err := initSearch(&dataConf.Database, logger)
+			if err != nil {
+				panic(err)
+			}
+			defer cleanup()
+			if err := search.run(os.Args[2:]); err != nil {
+				panic(err)
+			}
+			return
+		case "social":
+			social, cleanup, err := initSocial(&dataConf.Database, logger)
+			if err != nil {
+				panic(err)
+			}
+			defer cleanup()
+			if err := social.run(os.Args[2:]); err != nil {
+				panic(err)
+			}
+			return
+		case "media":
+			media, cleanup, err := initMedia(&dataConf.Database, mediaConf, logger)
+			if err != nil {
+				panic(err)
+			}
+			defer cleanup()
+			if err := media.run(os.Args[2:]); err != nil {
+				panic(err)
+			}
+			return
+		}
+	}
+
+	app, cleanup, err := initApp(&dataConf.Database, ckbNodeConf, apiConf, webhookConf, sinkConf, syncConf, retentionConf, metadataConf, localizationConf, mediaConf, logger)
 	if err != nil {
 		panic(err)
 	}
@@ -74,3 +191,51 @@ func setupCkbNodeConf(conf *config.Config) (*config.CkbNode, error) {
 	err := conf.ReadSection("ckb_node", &ckbNodeConf)
 	return ckbNodeConf, err
 }
+
+func setupApiConf(conf *config.Config) (*config.Api, error) {
+	apiConf := &config.Api{}
+	err := conf.ReadSection("api", apiConf)
+	return apiConf, err
+}
+
+func setupWebhookConf(conf *config.Config) (*config.Webhook, error) {
+	webhookConf := &config.Webhook{}
+	err := conf.ReadSection("webhook", webhookConf)
+	return webhookConf, err
+}
+
+func setupSinkConf(conf *config.Config) (*config.Sink, error) {
+	sinkConf := &config.Sink{}
+	err := conf.ReadSection("sink", sinkConf)
+	return sinkConf, err
+}
+
+func setupSyncConf(conf *config.Config) (*config.Sync, error) {
+	syncConf := &config.Sync{}
+	err := conf.ReadSection("sync", syncConf)
+	return syncConf, err
+}
+
+func setupRetentionConf(conf *config.Config) (*config.Retention, error) {
+	retentionConf := &config.Retention{}
+	err := conf.ReadSection("retention", retentionConf)
+	return retentionConf, err
+}
+
+func setupMetadataConf(conf *config.Config) (*config.Metadata, error) {
+	metadataConf := &config.Metadata{}
+	err := conf.ReadSection("metadata", metadataConf)
+	return metadataConf, err
+}
+
+func setupLocalizationConf(conf *config.Config) (*config.Localization, error) {
+	localizationConf := &config.Localization{}
+	err := conf.ReadSection("localization", localizationConf)
+	return localizationConf, err
+}
+
+func setupMediaConf(conf *config.Config) (*config.Media, error) {
+	mediaConf := &config.Media{}
+	err := conf.ReadSection("media", mediaConf)
+	return mediaConf, err
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/data"
+)
+
+// mediaCommand normalizes the media urls of the stored classes, run it with `syncer media backfill`
+// after the gateways are changed or the normalization is fixed
+type mediaCommand struct {
+	migration    *data.DBMigration
+	mediaUsecase *biz.MediaUsecase
+}
+
+func newMediaCommand(m *data.DBMigration, mediaUsecase *biz.MediaUsecase) *mediaCommand {
+	return &mediaCommand{
+		migration:    m,
+		mediaUsecase: mediaUsecase,
+	}
+}
+
+func (c *mediaCommand) run(args []string) error {
+	if len(args) == 0 || args[0] != "backfill" {
+		return errors.New("usage: syncer media backfill [-batch size]")
+	}
+	flags := flag.NewFlagSet("media backfill", flag.ExitOnError)
+	batch := flags.Int("batch", 1000, "rows normalized per transaction")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *batch <= 0 {
+		return fmt.Errorf("batch must be positive: %d", *batch)
+	}
+	if err := c.migration.Up(); err != nil {
+		return err
+	}
+	classes, audios, err := c.mediaUsecase.Backfill(context.Background(), *batch)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("normalized the media of %d class infos and %d audios\n", classes, audios)
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/data"
+	"github.com/nervina-labs/cota-syncer/internal/service"
+)
+
+// requeueCommand parses the quarantined entries again, run it with `syncer requeue [-all]` after a
+// parser fix has bumped biz.ParserVersion. It rolls the syncers back to the first requeued block, stop
+// the syncer before running it, the syncer parses the blocks again once it is started.
+type requeueCommand struct {
+	migration  *data.DBMigration
+	requeueSvc *service.RequeueService
+}
+
+func newRequeueCommand(m *data.DBMigration, requeueSvc *service.RequeueService) *requeueCommand {
+	return &requeueCommand{
+		migration:  m,
+		requeueSvc: requeueSvc,
+	}
+}
+
+func (c *requeueCommand) run(args []string) error {
+	flags := flag.NewFlagSet("requeue", flag.ExitOnError)
+	all := flags.Bool("all", false, "requeue every quarantined entry instead of those of an older parser version")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := c.migration.Up(); err != nil {
+		return err
+	}
+	result, err := c.requeueSvc.Requeue(context.Background(), *all)
+	if err != nil {
+		return err
+	}
+	if result.Entries == 0 {
+		fmt.Println("no quarantined entries to requeue")
+		return nil
+	}
+	fmt.Printf("requeued %d quarantined entries\n", result.Entries)
+	for _, checkType := range []biz.CheckType{biz.SyncBlock, biz.SyncMetadata} {
+		if height, ok := result.Heights[checkType]; ok {
+			fmt.Printf("%s rolled back to block %d, start the syncer to parse the blocks after it again\n", checkType.String(), height)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/data"
+)
+
+// searchCommand indexes every class and issuer again, run it with `syncer search rebuild` to fill the
+// search index of the metadata synced before it was indexed
+type searchCommand struct {
+	migration     *data.DBMigration
+	searchUsecase *biz.MetadataSearchUsecase
+}
+
+func newSearchCommand(m *data.DBMigration, searchUsecase *biz.MetadataSearchUsecase) *searchCommand {
+	return &searchCommand{
+		migration:     m,
+		searchUsecase: searchUsecase,
+	}
+}
+
+func (c *searchCommand) run(args []string) error {
+	if len(args) == 0 || args[0] != "rebuild" {
+		return errors.New("usage: syncer search rebuild [-batch size]")
+	}
+	flags := flag.NewFlagSet("search rebuild", flag.ExitOnError)
+	batch := flags.Int("batch", 500, "classes or issuers indexed per transaction")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if err := c.migration.Up(); err != nil {
+		return err
+	}
+	classes, issuers, err := c.searchUsecase.Rebuild(context.Background(), *batch)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("indexed %d classes and %d issuers\n", classes, issuers)
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+)
+
+// snapshotCommand exports the synced state at a height into an archive and imports it into an empty
+// database, run it with `syncer snapshot export [--height N --rewind] --file F` and `syncer snapshot import --file F`
+type snapshotCommand struct {
+	snapshotUsecase *biz.SnapshotUsecase
+}
+
+func newSnapshotCommand(snapshotUsecase *biz.SnapshotUsecase) *snapshotCommand {
+	return &snapshotCommand{
+		snapshotUsecase: snapshotUsecase,
+	}
+}
+
+func (c *snapshotCommand) run(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: syncer snapshot export|import [flags]")
+	}
+	flags := flag.NewFlagSet("snapshot "+args[0], flag.ExitOnError)
+	file := flags.String("file", "cota-snapshot.tar.gz", "path of the snapshot archive")
+	switch args[0] {
+	case "export":
+		height := flags.Uint64("height", 0, "block height of the snapshot, 0 for the tip")
+		rewind := flags.Bool("rewind", false, "roll the blocks after the height back in the export, only with the syncers stopped")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		return c.export(*height, *rewind, *file)
+	case "import":
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		return c.load(*file)
+	default:
+		return fmt.Errorf("unknown snapshot command %q, want export or import", args[0])
+	}
+}
+
+// export writes the archive next to the file first, so that a failed export leaves no partial archive
+func (c *snapshotCommand) export(height uint64, rewind bool, file string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	manifest, err := c.snapshotUsecase.Export(context.Background(), height, rewind, tmp)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), file); err != nil {
+		return err
+	}
+	fmt.Printf("exported %d tables at height %d to %s\n", len(manifest.Tables), manifest.Height, file)
+	return nil
+}
+
+func (c *snapshotCommand) load(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	manifest, err := c.snapshotUsecase.Import(context.Background(), f)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("imported %d tables at height %d from %s, the syncers resume after their check infos\n", len(manifest.Tables), manifest.Height, file)
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/data"
+)
+
+// socialCommand maintains the guardians of the social recoveries, run `syncer social rebuild` to fill
+// the guardians of the social recoveries synced before they were indexed and `syncer social check` to
+// list the configurations the contract would reject
+type socialCommand struct {
+	migration     *data.DBMigration
+	socialUsecase *biz.SocialRecoveryUsecase
+}
+
+func newSocialCommand(m *data.DBMigration, socialUsecase *biz.SocialRecoveryUsecase) *socialCommand {
+	return &socialCommand{
+		migration:     m,
+		socialUsecase: socialUsecase,
+	}
+}
+
+func (c *socialCommand) run(args []string) error {
+	usage := errors.New("usage: syncer social rebuild [-batch size] | syncer social check [-batch size] [-json]")
+	if len(args) == 0 {
+		return usage
+	}
+	flags := flag.NewFlagSet("social "+args[0], flag.ExitOnError)
+	batch := flags.Int("batch", 500, "social recoveries read per batch")
+	switch args[0] {
+	case "rebuild":
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if err := c.migration.Up(); err != nil {
+			return err
+		}
+		rebuilt, err := c.socialUsecase.Rebuild(context.Background(), *batch)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("indexed the guardians of %d social recoveries\n", rebuilt)
+		return nil
+	case "check":
+		asJson := flags.Bool("json", false, "print the inconsistent configurations as json")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		configs, err := c.socialUsecase.Check(context.Background(), *batch)
+		if err != nil {
+			return err
+		}
+		if *asJson {
+			if configs == nil {
+				configs = []biz.SocialConfig{}
+			}
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(configs)
+		}
+		for _, config := range configs {
+			fmt.Printf("%s block %d must %d total %d signers %d: %v\n", config.LockHash, config.BlockNumber, config.Must, config.Total, len(config.Guardians), config.Issues)
+		}
+		fmt.Printf("%d inconsistent social recoveries\n", len(configs))
+		return nil
+	}
+	return usage
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/nervina-labs/cota-syncer/internal/data"
+	"github.com/nervina-labs/cota-syncer/internal/service"
+)
+
+// timelineCommand fills the tx of the withdrawals and claims synced before migration 25, run it with
+// `syncer timeline backfill` once after the upgrade. The token timeline refuses the tokens it has not
+// filled yet.
+type timelineCommand struct {
+	migration   *data.DBMigration
+	backfillSvc *service.TimelineBackfillService
+}
+
+func newTimelineCommand(m *data.DBMigration, backfillSvc *service.TimelineBackfillService) *timelineCommand {
+	return &timelineCommand{
+		migration:   m,
+		backfillSvc: backfillSvc,
+	}
+}
+
+func (c *timelineCommand) run(args []string) error {
+	if len(args) == 0 || args[0] != "backfill" {
+		return errors.New("usage: syncer timeline backfill [-batch size]")
+	}
+	flags := flag.NewFlagSet("timeline backfill", flag.ExitOnError)
+	batch := flags.Int("batch", 100, "blocks read per query")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if err := c.migration.Up(); err != nil {
+		return err
+	}
+	blocks, rows, err := c.backfillSvc.Backfill(context.Background(), *batch)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("parsed %d blocks again and filled the tx of %d withdrawals and claims\n", blocks, rows)
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/data"
+)
+
+// traitsCommand decodes the traits of every token again, run it with `syncer traits rebuild` to fill
+// the traits of the tokens synced before they were decoded
+type traitsCommand struct {
+	migration    *data.DBMigration
+	traitUsecase *biz.TraitUsecase
+}
+
+func newTraitsCommand(m *data.DBMigration, traitUsecase *biz.TraitUsecase) *traitsCommand {
+	return &traitsCommand{
+		migration:    m,
+		traitUsecase: traitUsecase,
+	}
+}
+
+func (c *traitsCommand) run(args []string) error {
+	if len(args) == 0 || args[0] != "rebuild" {
+		return errors.New("usage: syncer traits rebuild [-batch size]")
+	}
+	flags := flag.NewFlagSet("traits rebuild", flag.ExitOnError)
+	batch := flags.Int("batch", 100, "classes rebuilt per transaction")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if err := c.migration.Up(); err != nil {
+		return err
+	}
+	classes, err := c.traitUsecase.Rebuild(context.Background(), *batch)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("rebuilt the traits of %d classes\n", classes)
+	return nil
+}
@@ -13,6 +13,38 @@ import (
 	"github.com/nervina-labs/cota-syncer/internal/service"
 )
 
-func initApp(*config.Database, *config.CkbNode, *logger.Logger) (*app.App, func(), error) {
+func initApp(*config.Database, *config.CkbNode, *config.Api, *config.Webhook, *config.Sink, *config.Sync, *config.Retention, *config.Metadata, *config.Localization, *config.Media, *logger.Logger) (*app.App, func(), error) {
 	panic(wire.Build(data.ProviderSet, biz.ProviderSet, service.ProviderSet, newApp))
 }
+
+func initRequeue(*config.Database, *config.CkbNode, *config.Metadata, *config.Media, *logger.Logger) (*requeueCommand, func(), error) {
+	panic(wire.Build(data.ProviderSet, biz.ProviderSet, service.ProviderSet, newRequeueCommand))
+}
+
+func initTimeline(*config.Database, *config.CkbNode, *config.Metadata, *config.Media, *logger.Logger) (*timelineCommand, func(), error) {
+	panic(wire.Build(data.ProviderSet, biz.ProviderSet, service.ProviderSet, newTimelineCommand))
+}
+
+func initSnapshot(*config.Database, *config.Metadata, *config.Media, *logger.Logger) (*snapshotCommand, func(), error) {
+	panic(wire.Build(data.ProviderSet, biz.ProviderSet, newSnapshotCommand))
+}
+
+func initMedia(*config.Database, *config.Media, *logger.Logger) (*mediaCommand, func(), error) {
+	panic(wire.Build(data.ProviderSet, biz.ProviderSet, newMediaCommand))
+}
+
+func initHistory(*config.Database, *logger.Logger) (*historyCommand, func(), error) {
+	panic(wire.Build(data.ProviderSet, biz.ProviderSet, newHistoryCommand))
+}
+
+func initTraits(*config.Database, *logger.Logger) (*traitsCommand, func(), error) {
+	panic(wire.Build(data.ProviderSet, biz.ProviderSet, newTraitsCommand))
+}
+
+func initSearch(*config.Database, *logger.Logger) (*searchCommand, func(), error) {
+	panic(wire.Build(data.ProviderSet, biz.ProviderSet, newSearchCommand))
+}
+
+func initSocial(*config.Database, *logger.Logger) (*socialCommand, func(), error) {
+	panic(wire.Build(data.ProviderSet, biz.ProviderSet, newSocialCommand))
+}
@@ -17,7 +17,7 @@ import (
 
 // Injectors from wire.go:
 
-func initApp(database *config.Database, ckbNode *config.CkbNode, loggerLogger *logger.Logger) (*app.App, func(), error) {
+func initApp(database *config.Database, ckbNode *config.CkbNode, api *config.Api, webhook *config.Webhook, sink *config.Sink, sync *config.Sync, retention *config.Retention, metadata *config.Metadata, localization *config.Localization, media *config.Media, loggerLogger *logger.Logger) (*app.App, func(), error) {
 	dataData, cleanup, err := data.NewData(database, loggerLogger)
 	if err != nil {
 		return nil, nil, err
@@ -41,26 +41,33 @@ func initApp(database *config.Database, ckbNode *config.CkbNode, loggerLogger *l
 	withdrawCotaNftKvPairRepo := data.NewWithdrawCotaNftKvPairRepo(dataData, loggerLogger)
 	withdrawCotaNftKvPairUsecase := biz.NewWithdrawCotaNftKvPairUsecase(withdrawCotaNftKvPairRepo, loggerLogger)
 	cotaWitnessArgsParser := data.NewCotaWitnessArgsParser(ckbNodeClient)
-	kvPairRepo := data.NewKvPairRepo(dataData, loggerLogger)
-	syncKvPairUsecase := biz.NewSyncKvPairUsecase(kvPairRepo, loggerLogger)
-	mintCotaKvPairRepo := data.NewMintCotaKvPairRepo(dataData, loggerLogger)
-	mintCotaKvPairUsecase := biz.NewMintCotaKvPairUsecase(mintCotaKvPairRepo, loggerLogger)
-	transferCotaKvPairRepo := data.NewTransferCotaKvPairRepo(dataData, loggerLogger)
-	transferCotaKvPairUsecase := biz.NewTransferCotaKvPairUsecase(transferCotaKvPairRepo, loggerLogger)
 	issuerInfoRepo := data.NewIssuerInfoRepo(dataData, loggerLogger)
 	issuerInfoUsecase := biz.NewIssuerInfoUsecase(issuerInfoRepo, loggerLogger)
 	classInfoRepo := data.NewClassInfoRepo(dataData, loggerLogger)
 	classInfoUsecase := biz.NewClassInfoUsecase(classInfoRepo, loggerLogger)
 	joyIDInfoRepo := data.NewJoyIDInfoRepo(dataData, loggerLogger)
 	joyIDInfoUsecase := biz.NewJoyIDInfoUsecase(joyIDInfoRepo, loggerLogger)
+	mediaNormalizer := data.NewMediaNormalizer(media)
+	metadataHandlers := data.NewMetadataHandlers(issuerInfoUsecase, classInfoUsecase, joyIDInfoUsecase, mediaNormalizer)
+	metadataRegistry, err := data.NewMetadataRegistry(metadataHandlers, metadata)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	kvPairRepo := data.NewKvPairRepo(dataData, metadataRegistry, loggerLogger)
+	syncKvPairUsecase := biz.NewSyncKvPairUsecase(kvPairRepo, loggerLogger)
+	mintCotaKvPairRepo := data.NewMintCotaKvPairRepo(dataData, loggerLogger)
+	mintCotaKvPairUsecase := biz.NewMintCotaKvPairUsecase(mintCotaKvPairRepo, loggerLogger)
+	transferCotaKvPairRepo := data.NewTransferCotaKvPairRepo(dataData, loggerLogger)
+	transferCotaKvPairUsecase := biz.NewTransferCotaKvPairUsecase(transferCotaKvPairRepo, loggerLogger)
 	extensionPairRepo := data.NewExtensionKvPairRepo(dataData, loggerLogger)
 	extensionPairUsecase := biz.NewExtensionPairUsecase(extensionPairRepo, loggerLogger)
 	subKeyPairRepo := data.NewSubKeyKvPairRepo(dataData, loggerLogger)
 	subKeyPairRepoUsecase := biz.NewSubKeyPairRepoUsecase(subKeyPairRepo, loggerLogger)
 	blockSyncer := data.NewBlockSyncer(claimedCotaNftKvPairUsecase, defineCotaNftKvPairUsecase, holdCotaNftKvPairUsecase, registerCotaKvPairUsecase, withdrawCotaNftKvPairUsecase, cotaWitnessArgsParser, syncKvPairUsecase, mintCotaKvPairUsecase, transferCotaKvPairUsecase, issuerInfoUsecase, classInfoUsecase, joyIDInfoUsecase, extensionPairUsecase, subKeyPairRepoUsecase)
-	blockSyncService := service.NewBlockSyncService(checkInfoUsecase, loggerLogger, ckbNodeClient, systemScripts, blockSyncer)
+	blockSyncService := service.NewBlockSyncService(checkInfoUsecase, loggerLogger, ckbNodeClient, systemScripts, blockSyncer, sync)
 	checkInfoCleanerService := service.NewCheckInfoService(checkInfoUsecase, loggerLogger, ckbNodeClient)
-	metadataSyncer := data.NewMetadataSyncer(syncKvPairUsecase, cotaWitnessArgsParser, issuerInfoUsecase, classInfoUsecase, joyIDInfoUsecase)
+	metadataSyncer := data.NewMetadataSyncer(syncKvPairUsecase, cotaWitnessArgsParser, metadataRegistry)
 	metadataSyncService := service.NewMetadataSyncService(checkInfoUsecase, loggerLogger, ckbNodeClient, systemScripts, metadataSyncer)
 	invalidDataRepo := data.NewInvalidDateRepo(dataData, loggerLogger)
 	invalidDataUsecase := biz.NewInvalidDataUsecase(invalidDataRepo, loggerLogger)
@@ -71,9 +78,255 @@ func initApp(database *config.Database, ckbNode *config.CkbNode, loggerLogger *l
 	registerLockScriptRepo := data.NewRegisterLockScriptRepo(dataData, loggerLogger)
 	registerLockScriptUsecase := biz.NewRegisterLockScriptUsecase(registerLockScriptRepo, loggerLogger)
 	registerLockService := service.NewRegisterLockService(registerLockScriptUsecase, loggerLogger, ckbNodeClient)
+	tokenTimelineRepo := data.NewTokenTimelineRepo(dataData, loggerLogger)
+	tokenTimelineUsecase := biz.NewTokenTimelineUsecase(tokenTimelineRepo, loggerLogger)
+	cotaEventRepo := data.NewCotaEventRepo(dataData, loggerLogger)
+	cotaEventUsecase := biz.NewCotaEventUsecase(cotaEventRepo, loggerLogger)
+	localizationRepo := data.NewLocalizationRepo(dataData, loggerLogger)
+	localizationFetcher := data.NewLocalizationFetcher(localization, mediaNormalizer)
+	localizationUsecase := biz.NewLocalizationUsecase(localizationRepo, localizationFetcher, loggerLogger)
+	metadataHistoryRepo := data.NewMetadataHistoryRepo(dataData, loggerLogger)
+	metadataHistoryUsecase := biz.NewMetadataHistoryUsecase(metadataHistoryRepo, loggerLogger)
+	traitRepo := data.NewTraitRepo(dataData, loggerLogger)
+	traitUsecase := biz.NewTraitUsecase(traitRepo, loggerLogger)
+	metadataSearchRepo := data.NewMetadataSearchRepo(dataData, loggerLogger)
+	metadataSearchUsecase := biz.NewMetadataSearchUsecase(metadataSearchRepo, loggerLogger)
+	joyIDDeviceRepo := data.NewJoyIDDeviceRepo(dataData, loggerLogger)
+	joyIDDeviceUsecase := biz.NewJoyIDDeviceUsecase(joyIDDeviceRepo, loggerLogger)
+	socialRecoveryRepo := data.NewSocialRecoveryRepo(dataData, loggerLogger)
+	socialRecoveryUsecase := biz.NewSocialRecoveryUsecase(socialRecoveryRepo, loggerLogger)
+	queryService := service.NewQueryService(tokenTimelineUsecase, cotaEventUsecase, localizationUsecase, metadataHistoryUsecase, traitUsecase, metadataSearchUsecase, joyIDDeviceUsecase, socialRecoveryUsecase, loggerLogger, api)
+	eventOutboxRepo := data.NewEventOutboxRepo(dataData, loggerLogger)
+	eventOutboxUsecase := biz.NewEventOutboxUsecase(eventOutboxRepo, loggerLogger)
+	webhookDispatcher := service.NewWebhookDispatcher(eventOutboxUsecase, loggerLogger, webhook)
+	eventSink, cleanup2, err := data.NewEventSink(sink, loggerLogger)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	eventSinkService := service.NewEventSinkService(eventOutboxUsecase, loggerLogger, eventSink, sink)
+	versionRetentionRepo := data.NewVersionRetentionRepo(dataData, loggerLogger)
+	versionRetentionUsecase := biz.NewVersionRetentionUsecase(versionRetentionRepo, loggerLogger)
+	versionPrunerService := service.NewVersionPrunerService(versionRetentionUsecase, loggerLogger, retention)
+	outboxPrunerService := service.NewOutboxPrunerService(eventOutboxUsecase, loggerLogger, retention, webhook, sink)
+	localizationFetcherService := service.NewLocalizationFetcherService(localizationUsecase, loggerLogger, localization)
 	dbMigration := data.NewDBMigration(dataData, loggerLogger)
-	appApp := newApp(loggerLogger, blockSyncService, checkInfoCleanerService, metadataSyncService, invalidDataCleaner, withdrawExtraInfoService, registerLockService, dbMigration)
+	appApp := newApp(loggerLogger, blockSyncService, checkInfoCleanerService, metadataSyncService, invalidDataCleaner, withdrawExtraInfoService, registerLockService, queryService, webhookDispatcher, eventSinkService, versionPrunerService, outboxPrunerService, localizationFetcherService, dbMigration)
 	return appApp, func() {
+		cleanup2()
+		cleanup()
+	}, nil
+}
+
+func initRequeue(database *config.Database, ckbNode *config.CkbNode, metadata *config.Metadata, media *config.Media, loggerLogger *logger.Logger) (*requeueCommand, func(), error) {
+	dataData, cleanup, err := data.NewData(database, loggerLogger)
+	if err != nil {
+		return nil, nil, err
+	}
+	dbMigration := data.NewDBMigration(dataData, loggerLogger)
+	quarantinedEntryRepo := data.NewQuarantinedEntryRepo(dataData, loggerLogger)
+	quarantinedEntryUsecase := biz.NewQuarantinedEntryUsecase(quarantinedEntryRepo, loggerLogger)
+	checkInfoRepo := data.NewCheckInfoRepo(dataData, loggerLogger)
+	checkInfoUsecase := biz.NewCheckInfoUsecase(checkInfoRepo, loggerLogger)
+	versionRetentionRepo := data.NewVersionRetentionRepo(dataData, loggerLogger)
+	versionRetentionUsecase := biz.NewVersionRetentionUsecase(versionRetentionRepo, loggerLogger)
+	claimedCotaNftKvPairRepo := data.NewClaimedCotaNftKvPairRepo(dataData, loggerLogger)
+	claimedCotaNftKvPairUsecase := biz.NewClaimedCotaNftKvPairUsecase(claimedCotaNftKvPairRepo, loggerLogger)
+	defineCotaNftKvPairRepo := data.NewDefineCotaNftKvPairRepo(dataData, loggerLogger)
+	defineCotaNftKvPairUsecase := biz.NewDefineCotaNftKvPairUsecase(defineCotaNftKvPairRepo, loggerLogger)
+	holdCotaNftKvPairRepo := data.NewHoldCotaNftKvPairRepo(dataData, loggerLogger)
+	holdCotaNftKvPairUsecase := biz.NewHoldCotaNftKvPairUsecase(holdCotaNftKvPairRepo, loggerLogger)
+	registerCotaKvPairRepo := data.NewRegisterCotaKvPairRepo(dataData, loggerLogger)
+	registerCotaKvPairUsecase := biz.NewRegisterCotaKvPairUsecase(registerCotaKvPairRepo, loggerLogger)
+	withdrawCotaNftKvPairRepo := data.NewWithdrawCotaNftKvPairRepo(dataData, loggerLogger)
+	withdrawCotaNftKvPairUsecase := biz.NewWithdrawCotaNftKvPairUsecase(withdrawCotaNftKvPairRepo, loggerLogger)
+	ckbNodeClient, err := data.NewCkbNodeClient(ckbNode, loggerLogger)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	cotaWitnessArgsParser := data.NewCotaWitnessArgsParser(ckbNodeClient)
+	issuerInfoRepo := data.NewIssuerInfoRepo(dataData, loggerLogger)
+	issuerInfoUsecase := biz.NewIssuerInfoUsecase(issuerInfoRepo, loggerLogger)
+	classInfoRepo := data.NewClassInfoRepo(dataData, loggerLogger)
+	classInfoUsecase := biz.NewClassInfoUsecase(classInfoRepo, loggerLogger)
+	joyIDInfoRepo := data.NewJoyIDInfoRepo(dataData, loggerLogger)
+	joyIDInfoUsecase := biz.NewJoyIDInfoUsecase(joyIDInfoRepo, loggerLogger)
+	mediaNormalizer := data.NewMediaNormalizer(media)
+	metadataHandlers := data.NewMetadataHandlers(issuerInfoUsecase, classInfoUsecase, joyIDInfoUsecase, mediaNormalizer)
+	metadataRegistry, err := data.NewMetadataRegistry(metadataHandlers, metadata)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	kvPairRepo := data.NewKvPairRepo(dataData, metadataRegistry, loggerLogger)
+	syncKvPairUsecase := biz.NewSyncKvPairUsecase(kvPairRepo, loggerLogger)
+	mintCotaKvPairRepo := data.NewMintCotaKvPairRepo(dataData, loggerLogger)
+	mintCotaKvPairUsecase := biz.NewMintCotaKvPairUsecase(mintCotaKvPairRepo, loggerLogger)
+	transferCotaKvPairRepo := data.NewTransferCotaKvPairRepo(dataData, loggerLogger)
+	transferCotaKvPairUsecase := biz.NewTransferCotaKvPairUsecase(transferCotaKvPairRepo, loggerLogger)
+	extensionPairRepo := data.NewExtensionKvPairRepo(dataData, loggerLogger)
+	extensionPairUsecase := biz.NewExtensionPairUsecase(extensionPairRepo, loggerLogger)
+	subKeyPairRepo := data.NewSubKeyKvPairRepo(dataData, loggerLogger)
+	subKeyPairRepoUsecase := biz.NewSubKeyPairRepoUsecase(subKeyPairRepo, loggerLogger)
+	blockSyncer := data.NewBlockSyncer(claimedCotaNftKvPairUsecase, defineCotaNftKvPairUsecase, holdCotaNftKvPairUsecase, registerCotaKvPairUsecase, withdrawCotaNftKvPairUsecase, cotaWitnessArgsParser, syncKvPairUsecase, mintCotaKvPairUsecase, transferCotaKvPairUsecase, issuerInfoUsecase, classInfoUsecase, joyIDInfoUsecase, extensionPairUsecase, subKeyPairRepoUsecase)
+	metadataSyncer := data.NewMetadataSyncer(syncKvPairUsecase, cotaWitnessArgsParser, metadataRegistry)
+	requeueService := service.NewRequeueService(quarantinedEntryUsecase, checkInfoUsecase, versionRetentionUsecase, loggerLogger, blockSyncer, metadataSyncer)
+	mainRequeueCommand := newRequeueCommand(dbMigration, requeueService)
+	return mainRequeueCommand, func() {
+		cleanup()
+	}, nil
+}
+
+func initTimeline(database *config.Database, ckbNode *config.CkbNode, metadata *config.Metadata, media *config.Media, loggerLogger *logger.Logger) (*timelineCommand, func(), error) {
+	dataData, cleanup, err := data.NewData(database, loggerLogger)
+	if err != nil {
+		return nil, nil, err
+	}
+	dbMigration := data.NewDBMigration(dataData, loggerLogger)
+	tokenTimelineRepo := data.NewTokenTimelineRepo(dataData, loggerLogger)
+	tokenTimelineUsecase := biz.NewTokenTimelineUsecase(tokenTimelineRepo, loggerLogger)
+	ckbNodeClient, err := data.NewCkbNodeClient(ckbNode, loggerLogger)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	systemScripts := data.NewSystemScripts(ckbNodeClient, loggerLogger)
+	claimedCotaNftKvPairRepo := data.NewClaimedCotaNftKvPairRepo(dataData, loggerLogger)
+	claimedCotaNftKvPairUsecase := biz.NewClaimedCotaNftKvPairUsecase(claimedCotaNftKvPairRepo, loggerLogger)
+	defineCotaNftKvPairRepo := data.NewDefineCotaNftKvPairRepo(dataData, loggerLogger)
+	defineCotaNftKvPairUsecase := biz.NewDefineCotaNftKvPairUsecase(defineCotaNftKvPairRepo, loggerLogger)
+	holdCotaNftKvPairRepo := data.NewHoldCotaNftKvPairRepo(dataData, loggerLogger)
+	holdCotaNftKvPairUsecase := biz.NewHoldCotaNftKvPairUsecase(holdCotaNftKvPairRepo, loggerLogger)
+	registerCotaKvPairRepo := data.NewRegisterCotaKvPairRepo(dataData, loggerLogger)
+	registerCotaKvPairUsecase := biz.NewRegisterCotaKvPairUsecase(registerCotaKvPairRepo, loggerLogger)
+	withdrawCotaNftKvPairRepo := data.NewWithdrawCotaNftKvPairRepo(dataData, loggerLogger)
+	withdrawCotaNftKvPairUsecase := biz.NewWithdrawCotaNftKvPairUsecase(withdrawCotaNftKvPairRepo, loggerLogger)
+	cotaWitnessArgsParser := data.NewCotaWitnessArgsParser(ckbNodeClient)
+	issuerInfoRepo := data.NewIssuerInfoRepo(dataData, loggerLogger)
+	issuerInfoUsecase := biz.NewIssuerInfoUsecase(issuerInfoRepo, loggerLogger)
+	classInfoRepo := data.NewClassInfoRepo(dataData, loggerLogger)
+	classInfoUsecase := biz.NewClassInfoUsecase(classInfoRepo, loggerLogger)
+	joyIDInfoRepo := data.NewJoyIDInfoRepo(dataData, loggerLogger)
+	joyIDInfoUsecase := biz.NewJoyIDInfoUsecase(joyIDInfoRepo, loggerLogger)
+	mediaNormalizer := data.NewMediaNormalizer(media)
+	metadataHandlers := data.NewMetadataHandlers(issuerInfoUsecase, classInfoUsecase, joyIDInfoUsecase, mediaNormalizer)
+	metadataRegistry, err := data.NewMetadataRegistry(metadataHandlers, metadata)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	kvPairRepo := data.NewKvPairRepo(dataData, metadataRegistry, loggerLogger)
+	syncKvPairUsecase := biz.NewSyncKvPairUsecase(kvPairRepo, loggerLogger)
+	mintCotaKvPairRepo := data.NewMintCotaKvPairRepo(dataData, loggerLogger)
+	mintCotaKvPairUsecase := biz.NewMintCotaKvPairUsecase(mintCotaKvPairRepo, loggerLogger)
+	transferCotaKvPairRepo := data.NewTransferCotaKvPairRepo(dataData, loggerLogger)
+	transferCotaKvPairUsecase := biz.NewTransferCotaKvPairUsecase(transferCotaKvPairRepo, loggerLogger)
+	extensionPairRepo := data.NewExtensionKvPairRepo(dataData, loggerLogger)
+	extensionPairUsecase := biz.NewExtensionPairUsecase(extensionPairRepo, loggerLogger)
+	subKeyPairRepo := data.NewSubKeyKvPairRepo(dataData, loggerLogger)
+	subKeyPairRepoUsecase := biz.NewSubKeyPairRepoUsecase(subKeyPairRepo, loggerLogger)
+	blockSyncer := data.NewBlockSyncer(claimedCotaNftKvPairUsecase, defineCotaNftKvPairUsecase, holdCotaNftKvPairUsecase, registerCotaKvPairUsecase, withdrawCotaNftKvPairUsecase, cotaWitnessArgsParser, syncKvPairUsecase, mintCotaKvPairUsecase, transferCotaKvPairUsecase, issuerInfoUsecase, classInfoUsecase, joyIDInfoUsecase, extensionPairUsecase, subKeyPairRepoUsecase)
+	timelineBackfillService := service.NewTimelineBackfillService(tokenTimelineUsecase, loggerLogger, ckbNodeClient, systemScripts, blockSyncer)
+	mainTimelineCommand := newTimelineCommand(dbMigration, timelineBackfillService)
+	return mainTimelineCommand, func() {
+		cleanup()
+	}, nil
+}
+
+func initSnapshot(database *config.Database, metadata *config.Metadata, media *config.Media, loggerLogger *logger.Logger) (*snapshotCommand, func(), error) {
+	dataData, cleanup, err := data.NewData(database, loggerLogger)
+	if err != nil {
+		return nil, nil, err
+	}
+	dbMigration := data.NewDBMigration(dataData, loggerLogger)
+	issuerInfoRepo := data.NewIssuerInfoRepo(dataData, loggerLogger)
+	issuerInfoUsecase := biz.NewIssuerInfoUsecase(issuerInfoRepo, loggerLogger)
+	classInfoRepo := data.NewClassInfoRepo(dataData, loggerLogger)
+	classInfoUsecase := biz.NewClassInfoUsecase(classInfoRepo, loggerLogger)
+	joyIDInfoRepo := data.NewJoyIDInfoRepo(dataData, loggerLogger)
+	joyIDInfoUsecase := biz.NewJoyIDInfoUsecase(joyIDInfoRepo, loggerLogger)
+	mediaNormalizer := data.NewMediaNormalizer(media)
+	metadataHandlers := data.NewMetadataHandlers(issuerInfoUsecase, classInfoUsecase, joyIDInfoUsecase, mediaNormalizer)
+	metadataRegistry, err := data.NewMetadataRegistry(metadataHandlers, metadata)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	snapshotRepo := data.NewSnapshotRepo(dataData, dbMigration, metadataRegistry, loggerLogger)
+	snapshotUsecase := biz.NewSnapshotUsecase(snapshotRepo, loggerLogger)
+	mainSnapshotCommand := newSnapshotCommand(snapshotUsecase)
+	return mainSnapshotCommand, func() {
+		cleanup()
+	}, nil
+}
+
+func initMedia(database *config.Database, media *config.Media, loggerLogger *logger.Logger) (*mediaCommand, func(), error) {
+	dataData, cleanup, err := data.NewData(database, loggerLogger)
+	if err != nil {
+		return nil, nil, err
+	}
+	dbMigration := data.NewDBMigration(dataData, loggerLogger)
+	mediaNormalizer := data.NewMediaNormalizer(media)
+	mediaRepo := data.NewMediaRepo(dataData, mediaNormalizer, loggerLogger)
+	mediaUsecase := biz.NewMediaUsecase(mediaRepo, loggerLogger)
+	mainMediaCommand := newMediaCommand(dbMigration, mediaUsecase)
+	return mainMediaCommand, func() {
+		cleanup()
+	}, nil
+}
+
+func initHistory(database *config.Database, loggerLogger *logger.Logger) (*historyCommand, func(), error) {
+	dataData, cleanup, err := data.NewData(database, loggerLogger)
+	if err != nil {
+		return nil, nil, err
+	}
+	metadataHistoryRepo := data.NewMetadataHistoryRepo(dataData, loggerLogger)
+	metadataHistoryUsecase := biz.NewMetadataHistoryUsecase(metadataHistoryRepo, loggerLogger)
+	mainHistoryCommand := newHistoryCommand(metadataHistoryUsecase)
+	return mainHistoryCommand, func() {
+		cleanup()
+	}, nil
+}
+
+func initTraits(database *config.Database, loggerLogger *logger.Logger) (*traitsCommand, func(), error) {
+	dataData, cleanup, err := data.NewData(database, loggerLogger)
+	if err != nil {
+		return nil, nil, err
+	}
+	dbMigration := data.NewDBMigration(dataData, loggerLogger)
+	traitRepo := data.NewTraitRepo(dataData, loggerLogger)
+	traitUsecase := biz.NewTraitUsecase(traitRepo, loggerLogger)
+	mainTraitsCommand := newTraitsCommand(dbMigration, traitUsecase)
+	return mainTraitsCommand, func() {
+		cleanup()
+	}, nil
+}
+
+func initSearch(database *config.Database, loggerLogger *logger.Logger) (*searchCommand, func(), error) {
+	dataData, cleanup, err := data.NewData(database, loggerLogger)
+	if err != nil {
+		return nil, nil, err
+	}
+	dbMigration := data.NewDBMigration(dataData, loggerLogger)
+	metadataSearchRepo := data.NewMetadataSearchRepo(dataData, loggerLogger)
+	metadataSearchUsecase := biz.NewMetadataSearchUsecase(metadataSearchRepo, loggerLogger)
+	mainSearchCommand := newSearchCommand(dbMigration, metadataSearchUsecase)
+	return mainSearchCommand, func() {
+		cleanup()
+	}, nil
+}
+
+func initSocial(database *config.Database, loggerLogger *logger.Logger) (*socialCommand, func(), error) {
+	dataData, cleanup, err := data.NewData(database, loggerLogger)
+	if err != nil {
+		return nil, nil, err
+	}
+	dbMigration := data.NewDBMigration(dataData, loggerLogger)
+	socialRecoveryRepo := data.NewSocialRecoveryRepo(dataData, loggerLogger)
+	socialRecoveryUsecase := biz.NewSocialRecoveryUsecase(socialRecoveryRepo, loggerLogger)
+	mainSocialCommand := newSocialCommand(dbMigration, socialRecoveryUsecase)
+	return mainSocialCommand, func() {
 		cleanup()
 	}, nil
 }
@@ -9,13 +9,15 @@ var ProviderSet = wire.NewSet(NewCheckInfoUsecase, NewRegisterCotaKvPairUsecase,
 	NewHoldCotaNftKvPairUsecase, NewWithdrawCotaNftKvPairUsecase, NewClaimedCotaNftKvPairUsecase, NewSyncKvPairUsecase,
 	NewMintCotaKvPairUsecase, NewTransferCotaKvPairUsecase, NewIssuerInfoUsecase, NewClassInfoUsecase, NewJoyIDInfoUsecase,
 	NewInvalidDataUsecase, NewWithdrawExtraInfoUsecase, NewExtensionPairUsecase, NewRegisterLockScriptUsecase, NewSubKeyPairRepoUsecase,
-	NewSocialPairRepoUsecase)
+	NewSocialPairRepoUsecase, NewTokenTimelineUsecase, NewCotaEventUsecase, NewEventOutboxUsecase, NewQuarantinedEntryUsecase, NewSnapshotUsecase, NewVersionRetentionUsecase,
+	NewLocalizationUsecase, NewMediaUsecase, NewMetadataHistoryUsecase, NewTraitUsecase, NewMetadataSearchUsecase, NewJoyIDDeviceUsecase, NewSocialRecoveryUsecase)
 
 type Entry struct {
 	InputType  []byte
 	OutputType []byte
 	LockScript *ckbTypes.Script
 	TxIndex    uint32
+	EntryIndex uint32
 	Version    uint8
 	TxHash     ckbTypes.Hash
 	ExtraWitness []byte
@@ -14,6 +14,8 @@ type ClaimedCotaNftKvPair struct {
 	OutPointCrc uint32
 	LockHash    string
 	LockHashCrc uint32
+	TxHash      string
+	TxIndex     uint32
 }
 
 type ClaimedCotaNftKvPairRepo interface {
@@ -0,0 +1,101 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+type CotaEventType string
+
+const (
+	CotaEventRegister  CotaEventType = "register"
+	CotaEventDefine    CotaEventType = "define"
+	CotaEventMint      CotaEventType = "mint"
+	CotaEventWithdraw  CotaEventType = "withdraw"
+	CotaEventClaim     CotaEventType = "claim"
+	CotaEventUpdate    CotaEventType = "update"
+	CotaEventExtension CotaEventType = "extension"
+	CotaEventIssuer    CotaEventType = "issuer_info"
+	CotaEventClassInfo CotaEventType = "class_info"
+	CotaEventJoyID     CotaEventType = "joy_id_info"
+)
+
+// CotaEvent is one entry of the event log written together with the state tables.
+// An event is identified by its block number, tx index, entry index and event index,
+// ActionCode is the InputType[0] code of the cota entry (0 for registry and metadata events).
+// Source tells which syncer wrote the event so that a rollback of one syncer does
+// not remove the events of the other.
+type CotaEvent struct {
+	Id                   uint64        `json:"-"`
+	BlockNumber          uint64        `json:"block_number"`
+	TxIndex              uint32        `json:"tx_index"`
+	TxHash               string        `json:"tx_hash"`
+	Source               CheckType     `json:"-"`
+	EventType            CotaEventType `json:"event_type"`
+	LockHash             string        `json:"lock_hash"`
+	CounterpartyLockHash string        `json:"counterparty_lock_hash,omitempty"`
+	CotaId               string        `json:"cota_id,omitempty"`
+	TokenIndex           *uint32       `json:"token_index,omitempty"`
+	EntryIndex           uint32        `json:"entry_index"`
+	EventIndex           uint32        `json:"event_index"`
+	ActionCode           uint8         `json:"action_code"`
+}
+
+// Direction tells whether the event was initiated by the lock or received by it
+func (e CotaEvent) Direction(lockHash string) string {
+	if e.LockHash == lockHash {
+		return "out"
+	}
+	return "in"
+}
+
+// CotaEventCursor points at the last event of a page; the next page starts strictly after it.
+type CotaEventCursor struct {
+	BlockNumber uint64
+	TxIndex     uint32
+	Id          uint64
+}
+
+func (c CotaEventCursor) String() string {
+	return fmt.Sprintf("%d-%d-%d", c.BlockNumber, c.TxIndex, c.Id)
+}
+
+func ParseCotaEventCursor(s string) (*CotaEventCursor, error) {
+	var c CotaEventCursor
+	if _, err := fmt.Sscanf(s, "%d-%d-%d", &c.BlockNumber, &c.TxIndex, &c.Id); err != nil {
+		return nil, fmt.Errorf("invalid cursor %q: %w", s, err)
+	}
+	return &c, nil
+}
+
+type CotaEventRepo interface {
+	FindAccountEvents(ctx context.Context, lockHash string, cursor *CotaEventCursor, limit int) ([]CotaEvent, error)
+}
+
+type CotaEventUsecase struct {
+	repo   CotaEventRepo
+	logger *logger.Logger
+}
+
+func NewCotaEventUsecase(repo CotaEventRepo, logger *logger.Logger) *CotaEventUsecase {
+	return &CotaEventUsecase{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// AccountFeed returns the events affecting the lock hash from newest to oldest, and the
+// cursor of the next page when there may be more events.
+func (uc *CotaEventUsecase) AccountFeed(ctx context.Context, lockHash string, cursor *CotaEventCursor, limit int) ([]CotaEvent, *CotaEventCursor, error) {
+	events, err := uc.repo.FindAccountEvents(ctx, lockHash, cursor, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(events) < limit {
+		return events, nil, nil
+	}
+	last := events[len(events)-1]
+	return events, &CotaEventCursor{BlockNumber: last.BlockNumber, TxIndex: last.TxIndex, Id: last.Id}, nil
+}
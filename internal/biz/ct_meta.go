@@ -2,7 +2,6 @@ package biz
 
 import (
 	"encoding/json"
-	"errors"
 )
 
 type CTMeta struct {
@@ -86,14 +85,77 @@ type JoyIDInfoJson struct {
 
 type MetaType int
 
+// MetadataPair is the metadata of a type without a field in KvPair, Value is what the handler of the
+// type parsed and is written by the same handler
+type MetadataPair struct {
+	BlockNumber uint64
+	TxIndex     uint32
+	Type        string
+	Value       any
+}
+
+// RawMetadata is the metadata of an unregistered type, kept as it is when storing unknown types is on
+type RawMetadata struct {
+	BlockNumber uint64
+	TxIndex     uint32
+	LockHash    string
+	Type        string
+	Target      string
+	Data        string
+}
+
+// SchemaError is a field of metadata that does not match the schema of its type, Path is the dotted
+// path of the field in the data, with [i] for array items
+type SchemaError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e SchemaError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// MetadataWarning records the schema errors of an entry stored by lenient validation
+type MetadataWarning struct {
+	BlockNumber uint64
+	TxIndex     uint32
+	EntryIndex  uint32
+	LockHash    string
+	Type        string
+	Schema      string
+	Errors      []SchemaError
+}
+
+const (
+	// MetadataConflictSameTx is a document superseded by a later document of the same transaction
+	MetadataConflictSameTx = "same_tx"
+	// MetadataConflictSameBlock is a document superseded by a document of a later transaction of the block
+	MetadataConflictSameBlock = "same_block"
+)
+
+// MetadataConflict records a metadata document of a block that is not applied because a later document
+// of the block has the same type and target. Key is the lock hash or the cota id of the target, Data
+// is the document as it appeared on chain.
+type MetadataConflict struct {
+	BlockNumber      uint64
+	TxIndex          uint32
+	EntryIndex       uint32
+	LockHash         string
+	Type             string
+	Key              string
+	WinnerTxIndex    uint32
+	WinnerEntryIndex uint32
+	Reason           string
+	Data             string
+}
+
+// ParseMetadata decodes the metadata of a witness, the errors match ErrMalformedEntry. A failed
+// decode returns no metadata, json.Unmarshal fills the fields it read before the error. The meta
+// type is checked by the metadata registry of the syncer.
 func ParseMetadata(meta []byte) (CTMeta, error) {
 	var ctMeta CTMeta
 	if err := json.Unmarshal(meta, &ctMeta); err != nil {
-		return ctMeta, err
-	}
-	metaType := ctMeta.Metadata.Type
-	if metaType != "issuer" && metaType != "cota" && metaType != "joy_id" {
-		return ctMeta, errors.New("invalid meta type")
+		return CTMeta{}, NewMalformedEntryError("metadata json: %v", err)
 	}
 	return ctMeta, nil
 }
@@ -0,0 +1,110 @@
+package biz
+
+import (
+	"context"
+	"math"
+
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+type OutboxStatus string
+
+const (
+	OutboxApplied  OutboxStatus = "applied"
+	OutboxReverted OutboxStatus = "reverted"
+)
+
+// OutboxEvent is a committed change of the event log. An applied row is written together with
+// the event, and a reverted row is written by the rollback that removes the event. Sequence is
+// allocated after the row is committed and orders the delivery, the cursors hold sequences.
+type OutboxEvent struct {
+	Id       uint64
+	Sequence uint64
+	Status   OutboxStatus
+	Event    CotaEvent
+}
+
+type DeadLetter struct {
+	Endpoint  string
+	OutboxId  uint64
+	Payload   string
+	LastError string
+	Attempts  int
+}
+
+type EventOutboxRepo interface {
+	FindOutboxEvents(ctx context.Context, afterSequence uint64, limit int) ([]OutboxEvent, error)
+	FindDeliveryCursor(ctx context.Context, endpoint string) (uint64, error)
+	SaveDeliveryCursor(ctx context.Context, endpoint string, sequence uint64) error
+	CreateDeadLetter(ctx context.Context, letter *DeadLetter) error
+	FindSinkCursor(ctx context.Context, sink string) (uint64, error)
+	SaveSinkCursor(ctx context.Context, sink string, sequence uint64) error
+	DeleteOutboxEvents(ctx context.Context, throughSequence uint64, batchSize int) (int64, error)
+}
+
+type EventOutboxUsecase struct {
+	repo   EventOutboxRepo
+	logger *logger.Logger
+}
+
+func NewEventOutboxUsecase(repo EventOutboxRepo, logger *logger.Logger) *EventOutboxUsecase {
+	return &EventOutboxUsecase{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+func (uc *EventOutboxUsecase) FindOutboxEvents(ctx context.Context, afterSequence uint64, limit int) ([]OutboxEvent, error) {
+	return uc.repo.FindOutboxEvents(ctx, afterSequence, limit)
+}
+
+func (uc *EventOutboxUsecase) DeliveryCursor(ctx context.Context, endpoint string) (uint64, error) {
+	return uc.repo.FindDeliveryCursor(ctx, endpoint)
+}
+
+func (uc *EventOutboxUsecase) SaveDeliveryCursor(ctx context.Context, endpoint string, sequence uint64) error {
+	return uc.repo.SaveDeliveryCursor(ctx, endpoint, sequence)
+}
+
+func (uc *EventOutboxUsecase) CreateDeadLetter(ctx context.Context, letter *DeadLetter) error {
+	return uc.repo.CreateDeadLetter(ctx, letter)
+}
+
+func (uc *EventOutboxUsecase) SinkCursor(ctx context.Context, sink string) (uint64, error) {
+	return uc.repo.FindSinkCursor(ctx, sink)
+}
+
+func (uc *EventOutboxUsecase) SaveSinkCursor(ctx context.Context, sink string, sequence uint64) error {
+	return uc.repo.SaveSinkCursor(ctx, sink, sequence)
+}
+
+// Prune deletes the outbox rows up to the slowest cursor of the endpoints and the sinks, every one of
+// them has handled those rows. Nothing is pruned without a consumer, or while one has no cursor yet.
+func (uc *EventOutboxUsecase) Prune(ctx context.Context, endpoints, sinks []string, batchSize int) (int64, error) {
+	if len(endpoints)+len(sinks) == 0 {
+		return 0, nil
+	}
+	slowest := uint64(math.MaxUint64)
+	for _, endpoint := range endpoints {
+		cursor, err := uc.repo.FindDeliveryCursor(ctx, endpoint)
+		if err != nil {
+			return 0, err
+		}
+		if cursor < slowest {
+			slowest = cursor
+		}
+	}
+	for _, sink := range sinks {
+		cursor, err := uc.repo.FindSinkCursor(ctx, sink)
+		if err != nil {
+			return 0, err
+		}
+		if cursor < slowest {
+			slowest = cursor
+		}
+	}
+	if slowest == 0 {
+		return 0, nil
+	}
+	return uc.repo.DeleteOutboxEvents(ctx, slowest, batchSize)
+}
@@ -0,0 +1,49 @@
+package biz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// SinkMessage is one CoTA event published to a message broker. Key identifies the event by its
+// position in the chain and stays the same when a sink re-delivers it; a nil Value is a tombstone
+// telling consumers that the event with this key was reverted by a reorg.
+type SinkMessage struct {
+	Key     string
+	Value   []byte
+	Headers map[string]string
+}
+
+func (m SinkMessage) IsTombstone() bool {
+	return m.Value == nil
+}
+
+type EventSink interface {
+	Publish(ctx context.Context, messages []SinkMessage) error
+}
+
+// Key returns the idempotent key of the event
+func (e CotaEvent) Key() string {
+	return fmt.Sprintf("%d-%d-%d-%d-%s", e.BlockNumber, e.TxIndex, e.EntryIndex, e.EventIndex, e.EventType)
+}
+
+func NewSinkMessage(event OutboxEvent) (SinkMessage, error) {
+	message := SinkMessage{
+		Key: event.Event.Key(),
+		Headers: map[string]string{
+			"Cota-Outbox-Id": strconv.FormatUint(event.Id, 10),
+			"Cota-Status":    string(event.Status),
+		},
+	}
+	if event.Status == OutboxReverted {
+		return message, nil
+	}
+	value, err := json.Marshal(event.Event)
+	if err != nil {
+		return message, err
+	}
+	message.Value = value
+	return message, nil
+}
@@ -0,0 +1,191 @@
+package biz
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"sort"
+
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+	"github.com/nervosnetwork/ckb-sdk-go/crypto/blake2b"
+)
+
+type DeviceStatus string
+
+const (
+	// DeviceMain is the main key of a JoyID account, authorized by the lock itself
+	DeviceMain DeviceStatus = "main"
+	// DeviceRegistered is a sub key of the metadata whose pubkey hash is in the sub key SMT
+	DeviceRegistered DeviceStatus = "registered"
+	// DeviceNotOnChain is a sub key of the metadata whose pubkey hash is missing from the sub key SMT,
+	// it cannot unlock the account
+	DeviceNotOnChain DeviceStatus = "not_on_chain"
+	// DeviceNoMetadata is an entry of the sub key SMT without a sub key in the metadata
+	DeviceNoMetadata DeviceStatus = "no_metadata"
+)
+
+var ErrJoyIDNotFound = errors.New("JoyID account not found")
+
+// JoyIDDevice is a key of a JoyID account. The device fields come from the metadata, ExtData,
+// AlgIndex and SmtBlockNumber from the entry of the sub key SMT with the same pubkey hash.
+type JoyIDDevice struct {
+	Status               DeviceStatus `json:"status"`
+	PubKey               string       `json:"pub_key,omitempty"`
+	PubkeyHash           string       `json:"pubkey_hash"`
+	CredentialId         string       `json:"credential_id,omitempty"`
+	Alg                  string       `json:"alg,omitempty"`
+	FrontEnd             string       `json:"front_end,omitempty"`
+	DeviceName           string       `json:"device_name,omitempty"`
+	DeviceType           string       `json:"device_type,omitempty"`
+	DerivationCId        string       `json:"derivation_credential_id,omitempty"`
+	DerivationCommitment string       `json:"derivation_commitment,omitempty"`
+	MetadataBlockNumber  uint64       `json:"metadata_block_number,omitempty"`
+	ExtData              *uint32      `json:"ext_data,omitempty"`
+	AlgIndex             *uint16      `json:"alg_index,omitempty"`
+	SmtBlockNumber       uint64       `json:"smt_block_number,omitempty"`
+}
+
+// DeviceRegistry is the main key and the sub keys of a JoyID account. NotOnChain counts the sub keys
+// of the metadata missing from the sub key SMT.
+type DeviceRegistry struct {
+	LockHash   string        `json:"lock_hash"`
+	Devices    []JoyIDDevice `json:"devices"`
+	NotOnChain int           `json:"not_on_chain"`
+}
+
+// SubKeyAuthorization answers whether a pubkey hash is in the sub key SMT of a lock at a block. A nil
+// BlockNumber asks for the latest synced state. ExtData, AlgIndex and Since are the entry authorizing
+// it and the block the entry was written at.
+type SubKeyAuthorization struct {
+	LockHash    string  `json:"lock_hash"`
+	PubkeyHash  string  `json:"pubkey_hash"`
+	BlockNumber *uint64 `json:"block_number,omitempty"`
+	Authorized  bool    `json:"authorized"`
+	ExtData     *uint32 `json:"ext_data,omitempty"`
+	AlgIndex    *uint16 `json:"alg_index,omitempty"`
+	Since       uint64  `json:"since,omitempty"`
+}
+
+// SubKeyPubkeyHash returns the pubkey hash of a sub key in the SMT, the blake160 of its pub key
+func SubKeyPubkeyHash(pubKey string) (string, error) {
+	raw, err := hex.DecodeString(pubKey)
+	if err != nil {
+		return "", err
+	}
+	hash, err := blake2b.Blake160(raw)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash), nil
+}
+
+type JoyIDDeviceRepo interface {
+	FindJoyIDInfo(ctx context.Context, lockHash string) (*JoyIDInfo, error)
+	FindSubKeyPairs(ctx context.Context, lockHash string) ([]SubKeyPair, error)
+	FindSubKeyPairAt(ctx context.Context, lockHash string, pubkeyHash string, blockNumber *uint64) (*SubKeyPair, error)
+}
+
+type JoyIDDeviceUsecase struct {
+	repo   JoyIDDeviceRepo
+	logger *logger.Logger
+}
+
+func NewJoyIDDeviceUsecase(repo JoyIDDeviceRepo, logger *logger.Logger) *JoyIDDeviceUsecase {
+	return &JoyIDDeviceUsecase{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Registry joins the keys of the JoyID metadata of a lock with its sub key SMT by pubkey hash. The
+// main key comes first, then the sub keys of the metadata in their order, then the SMT entries without
+// metadata in the order of their ext data.
+func (uc *JoyIDDeviceUsecase) Registry(ctx context.Context, lockHash string) (*DeviceRegistry, error) {
+	info, err := uc.repo.FindJoyIDInfo(ctx, lockHash)
+	if err != nil {
+		return nil, err
+	}
+	pairs, err := uc.repo.FindSubKeyPairs(ctx, lockHash)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil && len(pairs) == 0 {
+		return nil, ErrJoyIDNotFound
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].ExtData < pairs[j].ExtData })
+	registry := &DeviceRegistry{LockHash: lockHash, Devices: []JoyIDDevice{}}
+	matched := make([]bool, len(pairs))
+	if info != nil {
+		main := JoyIDDevice{
+			Status:               DeviceMain,
+			PubKey:               info.PubKey,
+			CredentialId:         info.CredentialId,
+			Alg:                  info.Alg,
+			FrontEnd:             info.FrontEnd,
+			DeviceName:           info.DeviceName,
+			DeviceType:           info.DeviceType,
+			DerivationCId:        info.DerivationCId,
+			DerivationCommitment: info.DerivationCommitment,
+			MetadataBlockNumber:  info.BlockNumber,
+		}
+		main.PubkeyHash, _ = SubKeyPubkeyHash(info.PubKey)
+		registry.Devices = append(registry.Devices, main)
+		for _, subKey := range info.SubKeys {
+			device := JoyIDDevice{
+				Status:               DeviceNotOnChain,
+				PubKey:               subKey.PubKey,
+				CredentialId:         subKey.CredentialId,
+				Alg:                  subKey.Alg,
+				FrontEnd:             subKey.FrontEnd,
+				DeviceName:           subKey.DeviceName,
+				DeviceType:           subKey.DeviceType,
+				DerivationCId:        subKey.DerivationCId,
+				DerivationCommitment: subKey.DerivationCommitment,
+				MetadataBlockNumber:  subKey.BlockNumber,
+			}
+			// a pub key that is not hex cannot be in the SMT
+			device.PubkeyHash, _ = SubKeyPubkeyHash(subKey.PubKey)
+			for i, pair := range pairs {
+				if device.PubkeyHash != "" && pair.PubkeyHash == device.PubkeyHash {
+					matched[i] = true
+					device.Status = DeviceRegistered
+					device.ExtData, device.AlgIndex, device.SmtBlockNumber = &pairs[i].ExtData, &pairs[i].AlgIndex, pair.BlockNumber
+					break
+				}
+			}
+			if device.Status == DeviceNotOnChain {
+				registry.NotOnChain++
+			}
+			registry.Devices = append(registry.Devices, device)
+		}
+	}
+	for i, pair := range pairs {
+		if matched[i] {
+			continue
+		}
+		registry.Devices = append(registry.Devices, JoyIDDevice{
+			Status:         DeviceNoMetadata,
+			PubkeyHash:     pair.PubkeyHash,
+			ExtData:        &pairs[i].ExtData,
+			AlgIndex:       &pairs[i].AlgIndex,
+			SmtBlockNumber: pair.BlockNumber,
+		})
+	}
+	return registry, nil
+}
+
+// Authorization returns whether the pubkey hash is in the sub key SMT of the lock at the block, or in
+// the latest synced state for a nil blockNumber. A block below the retained versions of the block
+// syncer returns ErrQueryBeyondRetention.
+func (uc *JoyIDDeviceUsecase) Authorization(ctx context.Context, lockHash string, pubkeyHash string, blockNumber *uint64) (*SubKeyAuthorization, error) {
+	pair, err := uc.repo.FindSubKeyPairAt(ctx, lockHash, pubkeyHash, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	authorization := &SubKeyAuthorization{LockHash: lockHash, PubkeyHash: pubkeyHash, BlockNumber: blockNumber}
+	if pair != nil {
+		authorization.Authorized = true
+		authorization.ExtData, authorization.AlgIndex, authorization.Since = &pair.ExtData, &pair.AlgIndex, pair.BlockNumber
+	}
+	return authorization, nil
+}
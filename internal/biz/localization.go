@@ -0,0 +1,259 @@
+package biz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+const (
+	LocalizedIssuer = "issuer"
+	LocalizedClass  = "cota"
+	// LocalePlaceholder is replaced with the locale in the localization uri
+	LocalePlaceholder = "{locale}"
+)
+
+// ErrInfoNotFound is returned by the query of an issuer or a class without metadata
+var ErrInfoNotFound = errors.New("metadata info not found")
+
+// LocalizationSource is an issuer or a class info with a localization, Key is the lock hash of an
+// issuer or the cota id of a class
+type LocalizationSource struct {
+	Id           uint64
+	MetaType     string
+	Key          string
+	Localization string
+}
+
+// LocalizedMetadata is the name and description of an issuer or a class in one locale, fetched for
+// the localization json of the info. Error is the reason the fetch failed.
+type LocalizedMetadata struct {
+	MetaType     string
+	Key          string
+	Locale       string
+	Uri          string
+	Localization string
+	Name         string
+	Description  string
+	Error        string
+	UpdatedAt    time.Time
+}
+
+type LocalizedIssuerInfo struct {
+	LockHash     string `json:"lock_hash"`
+	Locale       string `json:"locale"`
+	Version      string `json:"version"`
+	Name         string `json:"name"`
+	Avatar       string `json:"avatar"`
+	Description  string `json:"description"`
+	Localization string `json:"localization,omitempty"`
+}
+
+type LocalizedClassInfo struct {
+	CotaId         string `json:"cota_id"`
+	Locale         string `json:"locale"`
+	Version        string `json:"version"`
+	Name           string `json:"name"`
+	Symbol         string `json:"symbol"`
+	Description    string `json:"description"`
+	Image          string `json:"image"`
+	Audio          string `json:"audio"`
+	Video          string `json:"video"`
+	Model          string `json:"model"`
+	Characteristic string `json:"characteristic"`
+	Properties     string `json:"properties"`
+	Localization   string `json:"localization,omitempty"`
+}
+
+// localizedDocument is the json served at a localization uri
+type localizedDocument struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// LocalizationFetcher reads the document at a localization uri
+type LocalizationFetcher interface {
+	Fetch(ctx context.Context, uri string) ([]byte, error)
+}
+
+type LocalizationRepo interface {
+	FindLocalizationSources(ctx context.Context, metaType string, afterId uint64, limit int) ([]LocalizationSource, error)
+	FindLocalizedMetadata(ctx context.Context, metaType string, key string) ([]LocalizedMetadata, error)
+	SaveLocalizedMetadata(ctx context.Context, metadata LocalizedMetadata) error
+	FindIssuerInfo(ctx context.Context, lockHash string) (LocalizedIssuerInfo, error)
+	FindClassInfo(ctx context.Context, cotaId string) (LocalizedClassInfo, error)
+}
+
+type LocalizationUsecase struct {
+	repo    LocalizationRepo
+	fetcher LocalizationFetcher
+	logger  *logger.Logger
+}
+
+func NewLocalizationUsecase(repo LocalizationRepo, fetcher LocalizationFetcher, logger *logger.Logger) *LocalizationUsecase {
+	return &LocalizationUsecase{
+		repo:    repo,
+		fetcher: fetcher,
+		logger:  logger,
+	}
+}
+
+// Refresh fetches the missing and outdated locales of the infos after afterId, at most limit documents.
+// A failed fetch is tried again after retry. It returns the id to continue from, 0 after the last info,
+// and the number of documents fetched.
+func (uc *LocalizationUsecase) Refresh(ctx context.Context, metaType string, afterId uint64, limit int, retry time.Duration) (uint64, int, error) {
+	fetched := 0
+	for fetched < limit {
+		sources, err := uc.repo.FindLocalizationSources(ctx, metaType, afterId, limit)
+		if err != nil {
+			return afterId, fetched, err
+		}
+		if len(sources) == 0 {
+			return 0, fetched, nil
+		}
+		for _, source := range sources {
+			n, err := uc.refreshSource(ctx, source, limit-fetched, retry)
+			fetched += n
+			if err != nil {
+				return afterId, fetched, err
+			}
+			if fetched >= limit {
+				break
+			}
+			afterId = source.Id
+		}
+	}
+	return afterId, fetched, nil
+}
+
+func (uc *LocalizationUsecase) refreshSource(ctx context.Context, source LocalizationSource, limit int, retry time.Duration) (int, error) {
+	var localization Localization
+	if err := json.Unmarshal([]byte(source.Localization), &localization); err != nil || localization.Uri == "" {
+		return 0, nil
+	}
+	existing, err := uc.repo.FindLocalizedMetadata(ctx, source.MetaType, source.Key)
+	if err != nil {
+		return 0, err
+	}
+	cached := make(map[string]LocalizedMetadata, len(existing))
+	for _, metadata := range existing {
+		cached[metadata.Locale] = metadata
+	}
+	fetched := 0
+	for _, locale := range localization.locales() {
+		if fetched >= limit {
+			break
+		}
+		if metadata, ok := cached[locale]; ok && metadata.Localization == source.Localization &&
+			(metadata.Error == "" || time.Since(metadata.UpdatedAt) < retry) {
+			continue
+		}
+		metadata := uc.fetch(ctx, source, localization.Uri, locale)
+		fetched++
+		if err = uc.repo.SaveLocalizedMetadata(ctx, metadata); err != nil {
+			return fetched, err
+		}
+	}
+	return fetched, nil
+}
+
+func (uc *LocalizationUsecase) fetch(ctx context.Context, source LocalizationSource, uri string, locale string) LocalizedMetadata {
+	metadata := LocalizedMetadata{
+		MetaType:     source.MetaType,
+		Key:          source.Key,
+		Locale:       locale,
+		Uri:          strings.ReplaceAll(uri, LocalePlaceholder, url.PathEscape(locale)),
+		Localization: source.Localization,
+	}
+	body, err := uc.fetcher.Fetch(ctx, metadata.Uri)
+	if err == nil {
+		var document localizedDocument
+		if err = json.Unmarshal(body, &document); err == nil {
+			metadata.Name = document.Name
+			metadata.Description = document.Description
+			return metadata
+		}
+		err = fmt.Errorf("localized document: %w", err)
+	}
+	uc.logger.Errorf(ctx, "fetch the %s localization of %s %s error: %v", locale, source.MetaType, source.Key, err)
+	metadata.Error = err.Error()
+	return metadata
+}
+
+// locales returns the listed locales and the default locale, each once
+func (l Localization) locales() []string {
+	locales := make([]string, 0, len(l.Locales)+1)
+	seen := make(map[string]bool, len(l.Locales)+1)
+	for _, locale := range append(l.Locales, l.Default) {
+		if locale != "" && !seen[locale] {
+			seen[locale] = true
+			locales = append(locales, locale)
+		}
+	}
+	return locales
+}
+
+// IssuerInfo returns the issuer info in the locale, falling back to the default locale of its
+// localization and then to the fields on chain. Locale is the locale served, empty for the chain.
+func (uc *LocalizationUsecase) IssuerInfo(ctx context.Context, lockHash string, locale string) (LocalizedIssuerInfo, error) {
+	info, err := uc.repo.FindIssuerInfo(ctx, lockHash)
+	if err != nil {
+		return info, err
+	}
+	metadata, err := uc.localized(ctx, LocalizedIssuer, lockHash, info.Localization, locale)
+	if err != nil || metadata == nil {
+		return info, err
+	}
+	info.Locale = metadata.Locale
+	info.Name, info.Description = localizedText(info.Name, metadata.Name), localizedText(info.Description, metadata.Description)
+	return info, nil
+}
+
+// ClassInfo returns the class info in the locale with the fallback of IssuerInfo
+func (uc *LocalizationUsecase) ClassInfo(ctx context.Context, cotaId string, locale string) (LocalizedClassInfo, error) {
+	info, err := uc.repo.FindClassInfo(ctx, cotaId)
+	if err != nil {
+		return info, err
+	}
+	metadata, err := uc.localized(ctx, LocalizedClass, cotaId, info.Localization, locale)
+	if err != nil || metadata == nil {
+		return info, err
+	}
+	info.Locale = metadata.Locale
+	info.Name, info.Description = localizedText(info.Name, metadata.Name), localizedText(info.Description, metadata.Description)
+	return info, nil
+}
+
+// localized returns the cached metadata of the locale or of the default locale, nil when neither was
+// fetched for the current localization of the info
+func (uc *LocalizationUsecase) localized(ctx context.Context, metaType string, key string, localizationJson string, locale string) (*LocalizedMetadata, error) {
+	var localization Localization
+	if localizationJson == "" || json.Unmarshal([]byte(localizationJson), &localization) != nil {
+		return nil, nil
+	}
+	existing, err := uc.repo.FindLocalizedMetadata(ctx, metaType, key)
+	if err != nil {
+		return nil, err
+	}
+	for _, candidate := range []string{locale, localization.Default} {
+		for i, metadata := range existing {
+			if candidate != "" && metadata.Locale == candidate && metadata.Localization == localizationJson && metadata.Error == "" {
+				return &existing[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func localizedText(chain string, localized string) string {
+	if localized == "" {
+		return chain
+	}
+	return localized
+}
@@ -0,0 +1,51 @@
+package biz
+
+import (
+	"context"
+
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+type MediaKind string
+
+const (
+	MediaNone    MediaKind = ""
+	MediaIpfs    MediaKind = "ipfs"
+	MediaArweave MediaKind = "arweave"
+	MediaHttp    MediaKind = "http"
+	MediaData    MediaKind = "data"
+	MediaUnknown MediaKind = "unknown"
+)
+
+// MediaRef is a classified media url of class metadata. ContentId is the CID of ipfs or the tx id of
+// Arweave, Ref is the content-addressed form ipfs://<cid>/<path> or ar://<tx id>/<path>, empty for
+// other kinds. Url is the url to fetch the media from, on the configured gateway for ipfs and Arweave.
+type MediaRef struct {
+	Raw       string
+	Kind      MediaKind
+	ContentId string
+	Ref       string
+	Url       string
+}
+
+type MediaRepo interface {
+	BackfillMedia(ctx context.Context, batchSize int) (int64, int64, error)
+}
+
+type MediaUsecase struct {
+	repo   MediaRepo
+	logger *logger.Logger
+}
+
+func NewMediaUsecase(repo MediaRepo, logger *logger.Logger) *MediaUsecase {
+	return &MediaUsecase{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Backfill normalizes the media urls of the class infos and token class audios again, batchSize rows at
+// a time, and returns the number of class infos and audios changed
+func (uc *MediaUsecase) Backfill(ctx context.Context, batchSize int) (int64, int64, error) {
+	return uc.repo.BackfillMedia(ctx, batchSize)
+}
@@ -0,0 +1,137 @@
+package biz
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+const (
+	MetadataHistoryIssuer = "issuer"
+	MetadataHistoryClass  = "cota"
+	MetadataHistoryJoyID  = "joy_id"
+)
+
+// ErrUnknownMetadataType is returned by the history of a metadata type without version tables
+var ErrUnknownMetadataType = errors.New("unknown metadata type")
+
+type MetadataAction string
+
+const (
+	MetadataCreate MetadataAction = "create"
+	MetadataUpdate MetadataAction = "update"
+	MetadataDelete MetadataAction = "delete"
+)
+
+// MetadataFieldChange is a field of the metadata with its value before and after a version, Old is
+// empty on create
+type MetadataFieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// MetadataVersion is a version row of an issuer, a class or a JoyID account. Fields holds every field
+// the row keeps, SubKey is the pub key of the JoyID sub key the row belongs to.
+type MetadataVersion struct {
+	BlockNumber uint64
+	TxIndex     uint32
+	ActionType  uint8
+	SubKey      string
+	Fields      []MetadataFieldChange
+}
+
+// MetadataChange is a version of the metadata with the fields it changed
+type MetadataChange struct {
+	BlockNumber uint64                `json:"block_number"`
+	TxIndex     uint32                `json:"tx_index"`
+	Action      MetadataAction        `json:"action"`
+	SubKey      string                `json:"sub_key,omitempty"`
+	Fields      []MetadataFieldChange `json:"fields"`
+}
+
+// MetadataHistory is the log of the metadata of a key. KeptFrom is the lowest block whose versions are
+// kept, the changes before it were pruned by the retention, 0 when nothing was pruned.
+type MetadataHistory struct {
+	Type     string           `json:"type"`
+	Key      string           `json:"key"`
+	KeptFrom uint64           `json:"kept_from"`
+	Changes  []MetadataChange `json:"changes"`
+}
+
+type MetadataHistoryRepo interface {
+	FindMetadataVersions(ctx context.Context, metaType string, key string) ([]MetadataVersion, error)
+	FindPruneHeight(ctx context.Context) (uint64, error)
+}
+
+type MetadataHistoryUsecase struct {
+	repo   MetadataHistoryRepo
+	logger *logger.Logger
+}
+
+func NewMetadataHistoryUsecase(repo MetadataHistoryRepo, logger *logger.Logger) *MetadataHistoryUsecase {
+	return &MetadataHistoryUsecase{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// History returns the changes of the issuer or JoyID account of a lock hash or of the class of a cota id
+// in chronological order. A version that changed no field is left out. The versions pruned by the
+// retention are gone from the history, KeptFrom tells from which block it is complete.
+func (uc *MetadataHistoryUsecase) History(ctx context.Context, metaType string, key string) (*MetadataHistory, error) {
+	switch metaType {
+	case MetadataHistoryIssuer, MetadataHistoryClass, MetadataHistoryJoyID:
+	default:
+		return nil, ErrUnknownMetadataType
+	}
+	// the prune height is read first, versions pruned after it are still in the history
+	keptFrom, err := uc.repo.FindPruneHeight(ctx)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := uc.repo.FindMetadataVersions(ctx, metaType, key)
+	if err != nil {
+		return nil, err
+	}
+	// the main key of a JoyID account comes before its sub keys in the same transaction
+	sort.SliceStable(versions, func(i, j int) bool {
+		if versions[i].BlockNumber != versions[j].BlockNumber {
+			return versions[i].BlockNumber < versions[j].BlockNumber
+		}
+		return versions[i].TxIndex < versions[j].TxIndex
+	})
+	history := &MetadataHistory{Type: metaType, Key: key, KeptFrom: keptFrom, Changes: []MetadataChange{}}
+	for _, version := range versions {
+		var fields []MetadataFieldChange
+		for _, field := range version.Fields {
+			if field.Old != field.New {
+				fields = append(fields, field)
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		history.Changes = append(history.Changes, MetadataChange{
+			BlockNumber: version.BlockNumber,
+			TxIndex:     version.TxIndex,
+			Action:      metadataAction(version.ActionType),
+			SubKey:      version.SubKey,
+			Fields:      fields,
+		})
+	}
+	return history, nil
+}
+
+func metadataAction(actionType uint8) MetadataAction {
+	switch actionType {
+	case 0:
+		return MetadataCreate
+	case 1:
+		return MetadataUpdate
+	default:
+		return MetadataDelete
+	}
+}
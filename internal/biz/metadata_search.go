@@ -0,0 +1,210 @@
+package biz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+const (
+	SearchClass  = "cota"
+	SearchIssuer = "issuer"
+	// the weights of the fields a term is found in, a term matched exactly counts twice
+	SearchWeightName        = 4
+	SearchWeightSymbol      = 3
+	SearchWeightDescription = 1
+	// MaxSearchTermSize bounds the bytes of an indexed term, longer words are cut at a rune boundary
+	MaxSearchTermSize = 64
+	// maxSearchQueryTerms bounds the terms of a query, the rest of the query is ignored
+	maxSearchQueryTerms = 8
+)
+
+var (
+	ErrEmptySearchQuery    = errors.New("search query without terms")
+	ErrUnknownSearchType   = errors.New("unknown search type")
+	ErrInvalidSearchCursor = errors.New("invalid search cursor")
+)
+
+// SearchTerm is a term of the name, symbol or description of a class or an issuer with the weight of
+// the heaviest field it is found in
+type SearchTerm struct {
+	Term   string
+	Weight int
+}
+
+// SearchResult is a class or an issuer matching every term of a query. Key is the cota id of a class
+// or the lock hash of an issuer, Score is the integer rank of the search index of the database.
+type SearchResult struct {
+	Type        string `json:"type"`
+	Key         string `json:"key"`
+	Name        string `json:"name"`
+	Symbol      string `json:"symbol,omitempty"`
+	Description string `json:"description"`
+	Image       string `json:"image,omitempty"`
+	Score       int    `json:"score"`
+}
+
+// SearchCursor points at the last result of a page, the next page starts strictly after it in the
+// order of score descending, then type and key
+type SearchCursor struct {
+	Score int
+	Type  string
+	Key   string
+}
+
+func (c SearchCursor) String() string {
+	return fmt.Sprintf("%d-%s-%s", c.Score, c.Type, c.Key)
+}
+
+func ParseSearchCursor(s string) (*SearchCursor, error) {
+	parts := strings.SplitN(s, "-", 3)
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("%w %q", ErrInvalidSearchCursor, s)
+	}
+	score, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %v", ErrInvalidSearchCursor, s, err)
+	}
+	return &SearchCursor{Score: score, Type: parts[1], Key: parts[2]}, nil
+}
+
+// SearchTerms splits text into lower case terms. Letters and digits form a term, every other rune
+// separates terms, and each Han, kana or Hangul rune is a term of its own since those scripts are
+// written without spaces. A term is returned once.
+func SearchTerms(text string) []string {
+	var (
+		terms []string
+		seen  = make(map[string]bool)
+		word  strings.Builder
+	)
+	flush := func() {
+		if word.Len() == 0 {
+			return
+		}
+		term := truncateTerm(word.String())
+		word.Reset()
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			flush()
+			word.WriteRune(r)
+			flush()
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return terms
+}
+
+func truncateTerm(term string) string {
+	if len(term) <= MaxSearchTermSize {
+		return term
+	}
+	end := MaxSearchTermSize
+	for end > 0 && !utf8.RuneStart(term[end]) {
+		end--
+	}
+	return term[:end]
+}
+
+// ClassSearchTerms returns the terms indexed for a class
+func ClassSearchTerms(name, symbol, description string) []SearchTerm {
+	return weighTerms(
+		weightedText{name, SearchWeightName},
+		weightedText{symbol, SearchWeightSymbol},
+		weightedText{description, SearchWeightDescription},
+	)
+}
+
+// IssuerSearchTerms returns the terms indexed for an issuer
+func IssuerSearchTerms(name, description string) []SearchTerm {
+	return weighTerms(
+		weightedText{name, SearchWeightName},
+		weightedText{description, SearchWeightDescription},
+	)
+}
+
+type weightedText struct {
+	text   string
+	weight int
+}
+
+func weighTerms(fields ...weightedText) []SearchTerm {
+	var terms []SearchTerm
+	index := make(map[string]int)
+	for _, field := range fields {
+		for _, term := range SearchTerms(field.text) {
+			if i, ok := index[term]; ok {
+				if terms[i].Weight < field.weight {
+					terms[i].Weight = field.weight
+				}
+				continue
+			}
+			index[term] = len(terms)
+			terms = append(terms, SearchTerm{Term: term, Weight: field.weight})
+		}
+	}
+	return terms
+}
+
+type MetadataSearchRepo interface {
+	SearchMetadata(ctx context.Context, terms []string, metaType string, cursor *SearchCursor, limit int) ([]SearchResult, error)
+	RebuildSearch(ctx context.Context, batchSize int) (int64, int64, error)
+}
+
+type MetadataSearchUsecase struct {
+	repo   MetadataSearchRepo
+	logger *logger.Logger
+}
+
+func NewMetadataSearchUsecase(repo MetadataSearchRepo, logger *logger.Logger) *MetadataSearchUsecase {
+	return &MetadataSearchUsecase{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Search returns the classes and issuers whose name, symbol or description matches every term of the
+// query in the search index of the database, from the best score down, and the cursor of the next page when there may
+// be more results. An empty metaType searches both.
+func (uc *MetadataSearchUsecase) Search(ctx context.Context, query string, metaType string, cursor *SearchCursor, limit int) ([]SearchResult, *SearchCursor, error) {
+	if metaType != "" && metaType != SearchClass && metaType != SearchIssuer {
+		return nil, nil, fmt.Errorf("%w: %q", ErrUnknownSearchType, metaType)
+	}
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil, ErrEmptySearchQuery
+	}
+	if len(terms) > maxSearchQueryTerms {
+		terms = terms[:maxSearchQueryTerms]
+	}
+	results, err := uc.repo.SearchMetadata(ctx, terms, metaType, cursor, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(results) < limit {
+		return results, nil, nil
+	}
+	last := results[len(results)-1]
+	return results, &SearchCursor{Score: last.Score, Type: last.Type, Key: last.Key}, nil
+}
+
+// Rebuild indexes every class and issuer again, batchSize rows at a time, and returns the number of
+// classes and issuers indexed
+func (uc *MetadataSearchUsecase) Rebuild(ctx context.Context, batchSize int) (int64, int64, error) {
+	return uc.repo.RebuildSearch(ctx, batchSize)
+}
@@ -0,0 +1,80 @@
+package biz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+// ParserVersion is kept with every quarantined entry. Bump it together with a parser fix, the requeue
+// command parses the entries quarantined by an older parser again.
+const ParserVersion uint32 = 1
+
+// ErrMalformedEntry is returned by the parsers for a witness or an entry that cannot be decoded,
+// the syncer quarantines the entry and goes on with the block instead of aborting it.
+var ErrMalformedEntry = errors.New("malformed cota entry")
+
+// MalformedEntryError tells why an entry is malformed, it matches ErrMalformedEntry with errors.Is
+type MalformedEntryError struct {
+	Reason string
+}
+
+func NewMalformedEntryError(format string, args ...any) MalformedEntryError {
+	return MalformedEntryError{Reason: fmt.Sprintf(format, args...)}
+}
+
+func (e MalformedEntryError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrMalformedEntry, e.Reason)
+}
+
+func (e MalformedEntryError) Unwrap() error {
+	return ErrMalformedEntry
+}
+
+// QuarantinedEntry is a rejected entry kept with its raw bytes so that it can be looked at and requeued.
+// Action is the InputType[0] code of the entry, 0 when the whole witness could not be decoded.
+type QuarantinedEntry struct {
+	Id            uint64
+	BlockNumber   uint64
+	TxIndex       uint32
+	TxHash        string
+	EntryIndex    uint32
+	Source        CheckType
+	Action        uint8
+	Raw           string
+	Reason        string
+	ParserVersion uint32
+}
+
+// IsTx tells whether the whole transaction was quarantined by the block syncer instead of one entry
+func (e QuarantinedEntry) IsTx() bool {
+	return e.Source == SyncBlock && e.Action == 0
+}
+
+type QuarantinedEntryRepo interface {
+	FindQuarantinedEntries(ctx context.Context, beforeVersion uint32) ([]QuarantinedEntry, error)
+}
+
+type QuarantinedEntryUsecase struct {
+	repo   QuarantinedEntryRepo
+	logger *logger.Logger
+}
+
+func NewQuarantinedEntryUsecase(repo QuarantinedEntryRepo, logger *logger.Logger) *QuarantinedEntryUsecase {
+	return &QuarantinedEntryUsecase{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// FindRequeueEntries returns the entries quarantined by an older parser version in block order, or
+// every quarantined entry when all is set
+func (uc *QuarantinedEntryUsecase) FindRequeueEntries(ctx context.Context, all bool) ([]QuarantinedEntry, error) {
+	beforeVersion := ParserVersion
+	if all {
+		beforeVersion++
+	}
+	return uc.repo.FindQuarantinedEntries(ctx, beforeVersion)
+}
@@ -0,0 +1,65 @@
+package biz
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+// SnapshotFormatVersion is the layout version of a snapshot archive, an archive of another version
+// is refused by the import
+const SnapshotFormatVersion = 1
+
+var (
+	ErrSnapshotNotEmpty = errors.New("snapshot import needs an empty database")
+	ErrSnapshotChecksum = errors.New("snapshot checksum mismatch")
+	ErrSnapshotRewind   = errors.New("snapshot below the tip needs the syncers stopped and rewind")
+)
+
+// SnapshotManifest describes a snapshot archive. Height is the lower block of the block and the
+// metadata syncer, each syncer resumes after its own check info. The tables are in the json lines
+// encoding of the models.
+type SnapshotManifest struct {
+	FormatVersion    int             `json:"format_version"`
+	Height           uint64          `json:"height"`
+	MigrationVersion uint            `json:"migration_version"`
+	CreatedAt        time.Time       `json:"created_at"`
+	Tables           []SnapshotTable `json:"tables"`
+}
+
+type SnapshotTable struct {
+	Name   string `json:"name"`
+	Rows   int64  `json:"rows"`
+	Sha256 string `json:"sha256"`
+}
+
+type SnapshotRepo interface {
+	ExportSnapshot(ctx context.Context, height uint64, rewind bool, w io.Writer) (SnapshotManifest, error)
+	ImportSnapshot(ctx context.Context, r io.Reader) (SnapshotManifest, error)
+}
+
+type SnapshotUsecase struct {
+	repo   SnapshotRepo
+	logger *logger.Logger
+}
+
+func NewSnapshotUsecase(repo SnapshotRepo, logger *logger.Logger) *SnapshotUsecase {
+	return &SnapshotUsecase{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Export writes the state at the height to w, 0 is the tip. A height below the tip of a syncer rolls
+// the later blocks back in the export transaction, which needs rewind and the syncers stopped.
+func (uc *SnapshotUsecase) Export(ctx context.Context, height uint64, rewind bool, w io.Writer) (SnapshotManifest, error) {
+	return uc.repo.ExportSnapshot(ctx, height, rewind, w)
+}
+
+// Import loads a snapshot into an empty database, the syncers resume after the height of the snapshot
+func (uc *SnapshotUsecase) Import(ctx context.Context, r io.Reader) (SnapshotManifest, error) {
+	return uc.repo.ImportSnapshot(ctx, r)
+}
@@ -15,6 +15,7 @@ type SocialKvPair struct {
 	Must         uint8
 	Total        uint8
 	Signers      string
+	TxIndex      uint32
 	UpdatedAt    time.Time
 }
 
@@ -0,0 +1,192 @@
+package biz
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+	"github.com/nervosnetwork/ckb-sdk-go/crypto/blake2b"
+)
+
+// SocialIssue is an inconsistency of a social recovery configuration, the contract would reject an
+// unlock with it
+type SocialIssue string
+
+const (
+	SocialMustAboveTotal      SocialIssue = "must_above_total"
+	SocialSignerCountMismatch SocialIssue = "signer_count_mismatch"
+)
+
+var ErrSocialNotFound = errors.New("social recovery configuration not found")
+
+// Guardian is a signer of the social recovery of an account. Signer is the serialized lock script as
+// stored in the social entry and SignerLockHash its script hash.
+type Guardian struct {
+	LockHash       string `json:"lock_hash"`
+	Position       int    `json:"position"`
+	Signer         string `json:"signer"`
+	SignerLockHash string `json:"signer_lock_hash"`
+	BlockNumber    uint64 `json:"block_number"`
+}
+
+// SocialConfig is the social recovery of an account with the issues of its threshold
+type SocialConfig struct {
+	Id           uint64        `json:"-"`
+	LockHash     string        `json:"lock_hash"`
+	BlockNumber  uint64        `json:"block_number"`
+	RecoveryMode uint8         `json:"recovery_mode"`
+	Must         uint8         `json:"must"`
+	Total        uint8         `json:"total"`
+	Guardians    []Guardian    `json:"guardians"`
+	Issues       []SocialIssue `json:"issues"`
+}
+
+// SocialHistory is the log of the social recovery of an account. KeptFrom is the lowest block whose
+// versions are kept, the changes before it were pruned by the retention, 0 when nothing was pruned.
+type SocialHistory struct {
+	KeptFrom uint64         `json:"kept_from"`
+	Changes  []SocialChange `json:"changes"`
+}
+
+// SocialChange is a version of the social recovery of an account, the old fields are empty for a create
+type SocialChange struct {
+	BlockNumber     uint64         `json:"block_number"`
+	Action          MetadataAction `json:"action"`
+	OldRecoveryMode uint8          `json:"old_recovery_mode"`
+	RecoveryMode    uint8          `json:"recovery_mode"`
+	OldMust         uint8          `json:"old_must"`
+	Must            uint8          `json:"must"`
+	OldTotal        uint8          `json:"old_total"`
+	Total           uint8          `json:"total"`
+	OldSigners      []string       `json:"old_signers"`
+	Signers         []string       `json:"signers"`
+	Issues          []SocialIssue  `json:"issues"`
+}
+
+// SplitSigners splits the comma joined signers of a social entry
+func SplitSigners(signers string) []string {
+	if signers == "" {
+		return []string{}
+	}
+	return strings.Split(signers, ",")
+}
+
+// GuardianLockHash returns the script hash of a serialized signer lock script, the blake256 of its bytes
+func GuardianLockHash(signer string) (string, error) {
+	raw, err := hex.DecodeString(signer)
+	if err != nil {
+		return "", err
+	}
+	hash, err := blake2b.Blake256(raw)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash), nil
+}
+
+// CheckSocialConfig returns the issues of a threshold: must above total, or a signer count other than total
+func CheckSocialConfig(must, total uint8, signers int) []SocialIssue {
+	issues := []SocialIssue{}
+	if must > total {
+		issues = append(issues, SocialMustAboveTotal)
+	}
+	if signers != int(total) {
+		issues = append(issues, SocialSignerCountMismatch)
+	}
+	return issues
+}
+
+type SocialRecoveryRepo interface {
+	FindSocialConfigs(ctx context.Context, lockHashes []string, afterId uint64, limit int) ([]SocialConfig, error)
+	FindSocialChanges(ctx context.Context, lockHash string) ([]SocialChange, error)
+	FindPruneHeight(ctx context.Context) (uint64, error)
+	FindGuardedAccounts(ctx context.Context, signerLockHash string, afterLockHash string, limit int) ([]Guardian, error)
+	RebuildGuardians(ctx context.Context, batchSize int) (int64, error)
+}
+
+type SocialRecoveryUsecase struct {
+	repo   SocialRecoveryRepo
+	logger *logger.Logger
+}
+
+func NewSocialRecoveryUsecase(repo SocialRecoveryRepo, logger *logger.Logger) *SocialRecoveryUsecase {
+	return &SocialRecoveryUsecase{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Config returns the social recovery of an account with its guardians and issues
+func (uc *SocialRecoveryUsecase) Config(ctx context.Context, lockHash string) (*SocialConfig, error) {
+	configs, err := uc.repo.FindSocialConfigs(ctx, []string{lockHash}, 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(configs) == 0 {
+		return nil, ErrSocialNotFound
+	}
+	config := configs[0]
+	config.Issues = CheckSocialConfig(config.Must, config.Total, len(config.Guardians))
+	return &config, nil
+}
+
+// History returns the versions of the social recovery of an account in chronological order, each with
+// the issues of its new threshold. Versions pruned by the retention are missing, KeptFrom tells from
+// which block the history is complete.
+func (uc *SocialRecoveryUsecase) History(ctx context.Context, lockHash string) (*SocialHistory, error) {
+	// the prune height is read first, versions pruned after it are still in the history
+	keptFrom, err := uc.repo.FindPruneHeight(ctx)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := uc.repo.FindSocialChanges(ctx, lockHash)
+	if err != nil {
+		return nil, err
+	}
+	for i := range changes {
+		changes[i].Issues = CheckSocialConfig(changes[i].Must, changes[i].Total, len(changes[i].Signers))
+	}
+	return &SocialHistory{KeptFrom: keptFrom, Changes: changes}, nil
+}
+
+// GuardedAccounts returns the guardians entries of the accounts listing the signer lock hash, in the
+// order of the account lock hashes after afterLockHash
+func (uc *SocialRecoveryUsecase) GuardedAccounts(ctx context.Context, signerLockHash string, afterLockHash string, limit int) ([]Guardian, error) {
+	return uc.repo.FindGuardedAccounts(ctx, signerLockHash, afterLockHash, limit)
+}
+
+// Check returns the social recovery configurations with issues, batchSize configurations read at a time
+func (uc *SocialRecoveryUsecase) Check(ctx context.Context, batchSize int) ([]SocialConfig, error) {
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("batch size must be positive: %d", batchSize)
+	}
+	var (
+		inconsistent []SocialConfig
+		afterId      uint64
+	)
+	for {
+		configs, err := uc.repo.FindSocialConfigs(ctx, nil, afterId, batchSize)
+		if err != nil {
+			return inconsistent, err
+		}
+		for _, config := range configs {
+			config.Issues = CheckSocialConfig(config.Must, config.Total, len(config.Guardians))
+			if len(config.Issues) > 0 {
+				inconsistent = append(inconsistent, config)
+			}
+		}
+		if len(configs) < batchSize {
+			return inconsistent, nil
+		}
+		afterId = configs[len(configs)-1].Id
+	}
+}
+
+// Rebuild fills the guardians of every social recovery again, batchSize accounts at a time, and returns
+// the number of accounts rebuilt
+func (uc *SocialRecoveryUsecase) Rebuild(ctx context.Context, batchSize int) (int64, error) {
+	return uc.repo.RebuildGuardians(ctx, batchSize)
+}
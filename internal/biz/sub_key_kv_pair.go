@@ -13,6 +13,7 @@ type SubKeyPair struct {
 	ExtData     uint32
 	AlgIndex    uint16
 	PubkeyHash  string
+	TxIndex     uint32
 	UpdatedAt   time.Time
 }
 
@@ -2,6 +2,7 @@ package biz
 
 import (
 	"context"
+	"sort"
 
 	"github.com/nervina-labs/cota-syncer/internal/logger"
 )
@@ -17,12 +18,17 @@ type KvPair struct {
 	IssuerInfos           []IssuerInfo
 	ClassInfos            []ClassInfo
 	JoyIDInfos            []JoyIDInfo
+	Metadata              []MetadataPair
+	MetadataWarnings      []MetadataWarning
+	MetadataConflicts     []MetadataConflict
 	ExtensionPairs        []ExtensionPair
 	UpdatedExtensionPairs []ExtensionPair
 	SubKeyPairs           []SubKeyPair
 	UpdatedSubKeyPairs    []SubKeyPair
 	SocialPairs           []SocialKvPair
 	UpdatedSocialPairs    []SocialKvPair
+	Events                []CotaEvent
+	Quarantines           []QuarantinedEntry
 }
 
 func (p KvPair) HasRegisters() bool {
@@ -49,6 +55,18 @@ func (p KvPair) HasClaimedCotas() bool {
 	return len(p.ClaimedCotas) > 0
 }
 
+func (p KvPair) HasMetadata() bool {
+	return len(p.Metadata) > 0
+}
+
+func (p KvPair) HasMetadataWarnings() bool {
+	return len(p.MetadataWarnings) > 0
+}
+
+func (p KvPair) HasMetadataConflicts() bool {
+	return len(p.MetadataConflicts) > 0
+}
+
 func (p KvPair) HasIssuerInfos() bool {
 	return len(p.IssuerInfos) > 0
 }
@@ -85,8 +103,113 @@ func (p KvPair) HasUpdatedSocialPairs() bool {
 	return len(p.UpdatedSocialPairs) > 0
 }
 
+func (p KvPair) HasEvents() bool {
+	return len(p.Events) > 0
+}
+
+func (p KvPair) HasQuarantines() bool {
+	return len(p.Quarantines) > 0
+}
+
+// Append adds the pairs of other after the pairs of p
+func (p *KvPair) Append(other KvPair) {
+	p.Registers = append(p.Registers, other.Registers...)
+	p.DefineCotas = append(p.DefineCotas, other.DefineCotas...)
+	p.UpdatedDefineCotas = append(p.UpdatedDefineCotas, other.UpdatedDefineCotas...)
+	p.HoldCotas = append(p.HoldCotas, other.HoldCotas...)
+	p.UpdatedHoldCotas = append(p.UpdatedHoldCotas, other.UpdatedHoldCotas...)
+	p.WithdrawCotas = append(p.WithdrawCotas, other.WithdrawCotas...)
+	p.ClaimedCotas = append(p.ClaimedCotas, other.ClaimedCotas...)
+	p.IssuerInfos = append(p.IssuerInfos, other.IssuerInfos...)
+	p.ClassInfos = append(p.ClassInfos, other.ClassInfos...)
+	p.JoyIDInfos = append(p.JoyIDInfos, other.JoyIDInfos...)
+	p.Metadata = append(p.Metadata, other.Metadata...)
+	p.MetadataWarnings = append(p.MetadataWarnings, other.MetadataWarnings...)
+	p.MetadataConflicts = append(p.MetadataConflicts, other.MetadataConflicts...)
+	p.ExtensionPairs = append(p.ExtensionPairs, other.ExtensionPairs...)
+	p.UpdatedExtensionPairs = append(p.UpdatedExtensionPairs, other.UpdatedExtensionPairs...)
+	p.SubKeyPairs = append(p.SubKeyPairs, other.SubKeyPairs...)
+	p.UpdatedSubKeyPairs = append(p.UpdatedSubKeyPairs, other.UpdatedSubKeyPairs...)
+	p.SocialPairs = append(p.SocialPairs, other.SocialPairs...)
+	p.UpdatedSocialPairs = append(p.UpdatedSocialPairs, other.UpdatedSocialPairs...)
+	p.Events = append(p.Events, other.Events...)
+	p.Quarantines = append(p.Quarantines, other.Quarantines...)
+}
+
+// TxGroups splits the entry pairs of a block by transaction in tx order, a later transaction may
+// withdraw or update a token claimed earlier in the same block. Registers, events and quarantined
+// entries are left out, they are written once for the block.
+func (p KvPair) TxGroups() []KvPair {
+	groups := make(map[uint32]*KvPair)
+	group := func(txIndex uint32) *KvPair {
+		if groups[txIndex] == nil {
+			groups[txIndex] = &KvPair{}
+		}
+		return groups[txIndex]
+	}
+	for _, pair := range p.DefineCotas {
+		g := group(pair.TxIndex)
+		g.DefineCotas = append(g.DefineCotas, pair)
+	}
+	for _, pair := range p.UpdatedDefineCotas {
+		g := group(pair.TxIndex)
+		g.UpdatedDefineCotas = append(g.UpdatedDefineCotas, pair)
+	}
+	for _, pair := range p.HoldCotas {
+		g := group(pair.TxIndex)
+		g.HoldCotas = append(g.HoldCotas, pair)
+	}
+	for _, pair := range p.UpdatedHoldCotas {
+		g := group(pair.TxIndex)
+		g.UpdatedHoldCotas = append(g.UpdatedHoldCotas, pair)
+	}
+	for _, pair := range p.WithdrawCotas {
+		g := group(pair.TxIndex)
+		g.WithdrawCotas = append(g.WithdrawCotas, pair)
+	}
+	for _, pair := range p.ClaimedCotas {
+		g := group(pair.TxIndex)
+		g.ClaimedCotas = append(g.ClaimedCotas, pair)
+	}
+	for _, pair := range p.ExtensionPairs {
+		g := group(pair.TxIndex)
+		g.ExtensionPairs = append(g.ExtensionPairs, pair)
+	}
+	for _, pair := range p.UpdatedExtensionPairs {
+		g := group(pair.TxIndex)
+		g.UpdatedExtensionPairs = append(g.UpdatedExtensionPairs, pair)
+	}
+	for _, pair := range p.SubKeyPairs {
+		g := group(pair.TxIndex)
+		g.SubKeyPairs = append(g.SubKeyPairs, pair)
+	}
+	for _, pair := range p.UpdatedSubKeyPairs {
+		g := group(pair.TxIndex)
+		g.UpdatedSubKeyPairs = append(g.UpdatedSubKeyPairs, pair)
+	}
+	for _, pair := range p.SocialPairs {
+		g := group(pair.TxIndex)
+		g.SocialPairs = append(g.SocialPairs, pair)
+	}
+	for _, pair := range p.UpdatedSocialPairs {
+		g := group(pair.TxIndex)
+		g.UpdatedSocialPairs = append(g.UpdatedSocialPairs, pair)
+	}
+	txIndexes := make([]uint32, 0, len(groups))
+	for txIndex := range groups {
+		txIndexes = append(txIndexes, txIndex)
+	}
+	sort.Slice(txIndexes, func(i, j int) bool { return txIndexes[i] < txIndexes[j] })
+	result := make([]KvPair, len(txIndexes))
+	for i, txIndex := range txIndexes {
+		result[i] = *groups[txIndex]
+	}
+	return result
+}
+
 type KvPairRepo interface {
 	CreateCotaEntryKvPairs(ctx context.Context, checkInfo CheckInfo, kvPair *KvPair) error
+	CreateCotaEntryBlocks(ctx context.Context, checkInfos []CheckInfo, kvPairs []KvPair) error
 	RestoreCotaEntryKvPairs(ctx context.Context, blockNumber uint64) error
 	CreateMetadataKvPairs(ctx context.Context, checkInfo CheckInfo, kvPair *KvPair) error
 	RestoreMetadataKvPairs(ctx context.Context, blockNumber uint64) error
@@ -108,6 +231,12 @@ func (uc SyncKvPairUsecase) CreateCotaEntryKvPairs(ctx context.Context, checkInf
 	return uc.repo.CreateCotaEntryKvPairs(ctx, checkInfo, kvPair)
 }
 
+// CreateCotaEntryBlocks writes the pairs of consecutive blocks in one transaction, kvPairs[i] is the
+// block of checkInfos[i]
+func (uc SyncKvPairUsecase) CreateCotaEntryBlocks(ctx context.Context, checkInfos []CheckInfo, kvPairs []KvPair) error {
+	return uc.repo.CreateCotaEntryBlocks(ctx, checkInfos, kvPairs)
+}
+
 func (uc SyncKvPairUsecase) RestoreCotaEntryKvPairs(ctx context.Context, blockNumber uint64) error {
 	return uc.repo.RestoreCotaEntryKvPairs(ctx, blockNumber)
 }
@@ -0,0 +1,181 @@
+package biz
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+type TokenEventType string
+
+const (
+	TokenEventDefine   TokenEventType = "define"
+	TokenEventMint     TokenEventType = "mint"
+	TokenEventWithdraw TokenEventType = "withdraw"
+	TokenEventTransfer TokenEventType = "transfer"
+	TokenEventClaim    TokenEventType = "claim"
+	TokenEventUpdate   TokenEventType = "update"
+)
+
+// rank orders events that share the same transaction: a define always comes first,
+// a transfer claims the token before withdrawing it again and an update is applied
+// to the token held by the lock.
+func (t TokenEventType) rank() int {
+	switch t {
+	case TokenEventDefine:
+		return 0
+	case TokenEventClaim:
+		return 1
+	case TokenEventUpdate:
+		return 2
+	default:
+		return 3
+	}
+}
+
+type TokenLockScript struct {
+	CodeHash string `json:"code_hash"`
+	HashType string `json:"hash_type"`
+	Args     string `json:"args"`
+}
+
+type TokenEvent struct {
+	Type               TokenEventType   `json:"type"`
+	BlockNumber        uint64           `json:"block_number"`
+	TxIndex            uint32           `json:"tx_index"`
+	TxHash             string           `json:"tx_hash"`
+	LockHash           string           `json:"lock_hash"`
+	SenderLockScript   *TokenLockScript `json:"sender_lock_script,omitempty"`
+	ReceiverLockScript *TokenLockScript `json:"receiver_lock_script,omitempty"`
+	OutPoint           string           `json:"out_point,omitempty"`
+	OldState           uint8            `json:"old_state"`
+	State              uint8            `json:"state"`
+	OldCharacteristic  string           `json:"old_characteristic,omitempty"`
+	Characteristic     string           `json:"characteristic,omitempty"`
+}
+
+// TokenTimeline is the lifecycle of one NFT. The define and update events are read from the version
+// tables, KeptFrom is the lowest block whose versions are kept and those events before it were pruned
+// by the retention, 0 when nothing was pruned.
+type TokenTimeline struct {
+	CotaId     string       `json:"cota_id"`
+	TokenIndex uint32       `json:"token_index"`
+	KeptFrom   uint64       `json:"kept_from"`
+	Events     []TokenEvent `json:"events"`
+}
+
+// ErrTimelineNotBackfilled is returned for a token with withdraw or claim rows synced before their tx
+// index and hash were kept. A CoTA transaction is never the cellbase, so a tx index of 0 marks them.
+var ErrTimelineNotBackfilled = errors.New("token timeline is not backfilled, run `syncer timeline backfill`")
+
+type TokenTimelineRepo interface {
+	FindDefineEvents(ctx context.Context, cotaId string) ([]TokenEvent, error)
+	FindWithdrawEvents(ctx context.Context, cotaId string, tokenIndex uint32) ([]TokenEvent, error)
+	FindClaimEvents(ctx context.Context, cotaId string, tokenIndex uint32) ([]TokenEvent, error)
+	FindUpdateEvents(ctx context.Context, cotaId string, tokenIndex uint32) ([]TokenEvent, error)
+	FindPruneHeight(ctx context.Context) (uint64, error)
+	HasUnfilledTxs(ctx context.Context, cotaId string, tokenIndex uint32) (bool, error)
+	FindUnfilledBlocks(ctx context.Context, afterBlock uint64, limit int) ([]uint64, error)
+	FillTxs(ctx context.Context, withdrawals []WithdrawCotaNftKvPair, claims []ClaimedCotaNftKvPair) (int64, error)
+}
+
+type TokenTimelineUsecase struct {
+	repo   TokenTimelineRepo
+	logger *logger.Logger
+}
+
+func NewTokenTimelineUsecase(repo TokenTimelineRepo, logger *logger.Logger) *TokenTimelineUsecase {
+	return &TokenTimelineUsecase{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Timeline assembles the lifecycle of one NFT in chronological order. The first withdrawal
+// of a token is its mint, and a withdrawal sharing its transaction with a claim of the same
+// token is a transfer.
+func (uc *TokenTimelineUsecase) Timeline(ctx context.Context, cotaId string, tokenIndex uint32) (*TokenTimeline, error) {
+	// without the tx of its withdrawals and claims the order and the transfers of a token are wrong
+	unfilled, err := uc.repo.HasUnfilledTxs(ctx, cotaId, tokenIndex)
+	if err != nil {
+		return nil, err
+	}
+	if unfilled {
+		return nil, ErrTimelineNotBackfilled
+	}
+	// the prune height is read first, versions pruned after it are still in the timeline
+	keptFrom, err := uc.repo.FindPruneHeight(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defines, err := uc.repo.FindDefineEvents(ctx, cotaId)
+	if err != nil {
+		return nil, err
+	}
+	withdrawals, err := uc.repo.FindWithdrawEvents(ctx, cotaId, tokenIndex)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := uc.repo.FindClaimEvents(ctx, cotaId, tokenIndex)
+	if err != nil {
+		return nil, err
+	}
+	updates, err := uc.repo.FindUpdateEvents(ctx, cotaId, tokenIndex)
+	if err != nil {
+		return nil, err
+	}
+	claimTxs := make(map[string]struct{}, len(claims))
+	for _, claim := range claims {
+		if claim.TxHash != "" {
+			claimTxs[claim.TxHash] = struct{}{}
+		}
+	}
+	sortTokenEvents(withdrawals)
+	for i := range withdrawals {
+		withdrawals[i].Type = TokenEventWithdraw
+		if i == 0 {
+			withdrawals[i].Type = TokenEventMint
+			continue
+		}
+		if _, ok := claimTxs[withdrawals[i].TxHash]; ok {
+			withdrawals[i].Type = TokenEventTransfer
+		}
+	}
+	events := make([]TokenEvent, 0, len(defines)+len(withdrawals)+len(claims)+len(updates))
+	events = append(events, defines...)
+	events = append(events, withdrawals...)
+	events = append(events, claims...)
+	events = append(events, updates...)
+	sortTokenEvents(events)
+	return &TokenTimeline{
+		CotaId:     cotaId,
+		TokenIndex: tokenIndex,
+		KeptFrom:   keptFrom,
+		Events:     events,
+	}, nil
+}
+
+// UnfilledBlocks returns up to limit blocks above afterBlock with withdraw or claim rows without their tx
+func (uc *TokenTimelineUsecase) UnfilledBlocks(ctx context.Context, afterBlock uint64, limit int) ([]uint64, error) {
+	return uc.repo.FindUnfilledBlocks(ctx, afterBlock, limit)
+}
+
+// FillTxs sets the tx index and hash of the unfilled rows from the pairs of their block parsed again,
+// and returns the number of rows filled
+func (uc *TokenTimelineUsecase) FillTxs(ctx context.Context, withdrawals []WithdrawCotaNftKvPair, claims []ClaimedCotaNftKvPair) (int64, error) {
+	return uc.repo.FillTxs(ctx, withdrawals, claims)
+}
+
+func sortTokenEvents(events []TokenEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].BlockNumber != events[j].BlockNumber {
+			return events[i].BlockNumber < events[j].BlockNumber
+		}
+		if events[i].TxIndex != events[j].TxIndex {
+			return events[i].TxIndex < events[j].TxIndex
+		}
+		return events[i].Type.rank() < events[j].Type.rank()
+	})
+}
@@ -0,0 +1,234 @@
+package biz
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+const (
+	// CharacteristicLen is the length in bytes of the characteristic of a token
+	CharacteristicLen = 20
+	maxTraitNameLen   = 255
+)
+
+const (
+	TraitUint   = "uint"
+	TraitHex    = "hex"
+	TraitString = "string"
+	TraitBool   = "bool"
+)
+
+var ErrInvalidCharacteristicSchema = errors.New("invalid characteristic schema")
+
+// CharacteristicTrait is an entry [name, size] or [name, size, type] of the characteristic of a class.
+// The traits take Size bytes of the token characteristic one after another, a trait without a type is
+// an unsigned big endian integer up to 8 bytes and hex above.
+type CharacteristicTrait struct {
+	Name string
+	Size int
+	Type string
+}
+
+type CharacteristicSchema []CharacteristicTrait
+
+// ParseCharacteristicSchema parses the characteristic json of a class info, an empty characteristic is
+// an empty schema
+func ParseCharacteristicSchema(characteristic string) (CharacteristicSchema, error) {
+	if characteristic == "" {
+		return nil, nil
+	}
+	var entries [][]any
+	if err := json.Unmarshal([]byte(characteristic), &entries); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCharacteristicSchema, err)
+	}
+	schema := make(CharacteristicSchema, 0, len(entries))
+	names := make(map[string]bool, len(entries))
+	total := 0
+	for i, entry := range entries {
+		trait, err := parseCharacteristicTrait(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%w: trait %d: %v", ErrInvalidCharacteristicSchema, i, err)
+		}
+		if names[trait.Name] {
+			return nil, fmt.Errorf("%w: trait %q repeated", ErrInvalidCharacteristicSchema, trait.Name)
+		}
+		names[trait.Name] = true
+		if total += trait.Size; total > CharacteristicLen {
+			return nil, fmt.Errorf("%w: traits over %d bytes", ErrInvalidCharacteristicSchema, CharacteristicLen)
+		}
+		schema = append(schema, trait)
+	}
+	return schema, nil
+}
+
+func parseCharacteristicTrait(entry []any) (CharacteristicTrait, error) {
+	if len(entry) != 2 && len(entry) != 3 {
+		return CharacteristicTrait{}, errors.New("want [name, size] or [name, size, type]")
+	}
+	name, ok := entry[0].(string)
+	if !ok || name == "" || len(name) > maxTraitNameLen {
+		return CharacteristicTrait{}, fmt.Errorf("name is not a string of 1 to %d bytes", maxTraitNameLen)
+	}
+	var size int
+	switch value := entry[1].(type) {
+	case float64:
+		size = int(value)
+		if float64(size) != value {
+			return CharacteristicTrait{}, fmt.Errorf("size %v is not an integer", value)
+		}
+	case string:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return CharacteristicTrait{}, fmt.Errorf("size %q is not an integer", value)
+		}
+		size = n
+	default:
+		return CharacteristicTrait{}, errors.New("size is not a number")
+	}
+	if size <= 0 {
+		return CharacteristicTrait{}, fmt.Errorf("size %d is not positive", size)
+	}
+	trait := CharacteristicTrait{Name: name, Size: size, Type: TraitUint}
+	if size > 8 {
+		trait.Type = TraitHex
+	}
+	if len(entry) == 3 {
+		if trait.Type, ok = entry[2].(string); !ok {
+			return CharacteristicTrait{}, errors.New("type is not a string")
+		}
+	}
+	switch trait.Type {
+	case TraitUint:
+		if size > 8 {
+			return CharacteristicTrait{}, fmt.Errorf("uint of %d bytes", size)
+		}
+	case TraitBool:
+		if size != 1 {
+			return CharacteristicTrait{}, fmt.Errorf("bool of %d bytes", size)
+		}
+	case TraitHex, TraitString:
+	default:
+		return CharacteristicTrait{}, fmt.Errorf("unknown type %q", trait.Type)
+	}
+	return trait, nil
+}
+
+// TokenTrait is a trait value of a token decoded from its characteristic
+type TokenTrait struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Decode splits the hex characteristic of a token into the values of the traits
+func (s CharacteristicSchema) Decode(characteristic string) ([]TokenTrait, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	data, err := hex.DecodeString(strings.TrimPrefix(characteristic, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("characteristic: %w", err)
+	}
+	traits := make([]TokenTrait, len(s))
+	offset := 0
+	for i, trait := range s {
+		if offset+trait.Size > len(data) {
+			return nil, fmt.Errorf("characteristic of %d bytes is too short for trait %q", len(data), trait.Name)
+		}
+		value := data[offset : offset+trait.Size]
+		offset += trait.Size
+		traits[i] = TokenTrait{Name: trait.Name, Value: traitValue(trait.Type, value)}
+	}
+	return traits, nil
+}
+
+func traitValue(traitType string, value []byte) string {
+	switch traitType {
+	case TraitUint:
+		padded := make([]byte, 8)
+		copy(padded[8-len(value):], value)
+		return strconv.FormatUint(binary.BigEndian.Uint64(padded), 10)
+	case TraitBool:
+		return strconv.FormatBool(value[0] != 0)
+	case TraitString:
+		// the bytes are on-chain input, a value the databases cannot store as text is kept as hex
+		if text := strings.TrimRight(string(value), "\x00"); utf8.ValidString(text) && !strings.ContainsRune(text, 0) {
+			return text
+		}
+		return hex.EncodeToString(value)
+	default:
+		return hex.EncodeToString(value)
+	}
+}
+
+// TraitCount is the number of tokens of a class with a trait value, Rarity is its share of the tokens
+// with traits
+type TraitCount struct {
+	Name   string  `json:"name"`
+	Value  string  `json:"value"`
+	Count  int64   `json:"count"`
+	Rarity float64 `json:"rarity"`
+}
+
+type ClassTraits struct {
+	CotaId string       `json:"cota_id"`
+	Tokens int64        `json:"tokens"`
+	Traits []TraitCount `json:"traits"`
+}
+
+type TraitRepo interface {
+	CountTraitTokens(ctx context.Context, cotaId string) (int64, error)
+	FindTraitCounts(ctx context.Context, cotaId string) ([]TraitCount, error)
+	FindTokensByTraits(ctx context.Context, cotaId string, traits []TokenTrait, afterIndex int64, limit int) ([]uint32, error)
+	RebuildTraits(ctx context.Context, batchSize int) (int64, error)
+}
+
+type TraitUsecase struct {
+	repo   TraitRepo
+	logger *logger.Logger
+}
+
+func NewTraitUsecase(repo TraitRepo, logger *logger.Logger) *TraitUsecase {
+	return &TraitUsecase{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// ClassTraits returns the trait values of the tokens of a class with their counts and rarity
+func (uc *TraitUsecase) ClassTraits(ctx context.Context, cotaId string) (*ClassTraits, error) {
+	tokens, err := uc.repo.CountTraitTokens(ctx, cotaId)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := uc.repo.FindTraitCounts(ctx, cotaId)
+	if err != nil {
+		return nil, err
+	}
+	for i := range counts {
+		if tokens > 0 {
+			counts[i].Rarity = float64(counts[i].Count) / float64(tokens)
+		}
+	}
+	return &ClassTraits{CotaId: cotaId, Tokens: tokens, Traits: counts}, nil
+}
+
+// TokensByTraits returns the token indexes of a class after afterIndex that have all the trait values,
+// afterIndex -1 starts from the first token
+func (uc *TraitUsecase) TokensByTraits(ctx context.Context, cotaId string, traits []TokenTrait, afterIndex int64, limit int) ([]uint32, error) {
+	return uc.repo.FindTokensByTraits(ctx, cotaId, traits, afterIndex, limit)
+}
+
+// Rebuild decodes the traits of every token again, batchSize classes at a time, and returns the number
+// of classes rebuilt
+func (uc *TraitUsecase) Rebuild(ctx context.Context, batchSize int) (int64, error) {
+	return uc.repo.RebuildTraits(ctx, batchSize)
+}
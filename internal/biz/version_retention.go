@@ -0,0 +1,44 @@
+package biz
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+var (
+	// ErrRollbackBeyondRetention is returned by the rollback of a block whose version rows were pruned,
+	// restoring it would leave the state of the block in place
+	ErrRollbackBeyondRetention = errors.New("rollback beyond the retained version history")
+	// ErrQueryBeyondRetention is returned by a query of the state at a block whose version rows were pruned
+	ErrQueryBeyondRetention = errors.New("query beyond the retained version history")
+)
+
+type VersionRetentionRepo interface {
+	PruneVersions(ctx context.Context, checkType CheckType, keepBlocks uint64, batchSize int) (int64, error)
+	FindPruneHeight(ctx context.Context, checkType CheckType) (uint64, error)
+}
+
+type VersionRetentionUsecase struct {
+	repo   VersionRetentionRepo
+	logger *logger.Logger
+}
+
+func NewVersionRetentionUsecase(repo VersionRetentionRepo, logger *logger.Logger) *VersionRetentionUsecase {
+	return &VersionRetentionUsecase{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Prune deletes the version rows of the syncer older than keepBlocks blocks before its synced height,
+// batchSize rows at a time, and returns the number of rows deleted
+func (uc *VersionRetentionUsecase) Prune(ctx context.Context, checkType CheckType, keepBlocks uint64, batchSize int) (int64, error) {
+	return uc.repo.PruneVersions(ctx, checkType, keepBlocks, batchSize)
+}
+
+// PruneHeight returns the lowest block the syncer can still roll back, 0 when nothing was pruned
+func (uc *VersionRetentionUsecase) PruneHeight(ctx context.Context, checkType CheckType) (uint64, error) {
+	return uc.repo.FindPruneHeight(ctx, checkType)
+}
@@ -14,10 +14,12 @@ type WithdrawCotaNftKvPair struct {
 	OutPoint             string
 	OutPointCrc          uint32
 	TxHash               string
+	TxIndex              uint32
 	State                uint8
 	Configure            uint8
 	Characteristic       string
 	ReceiverLockScriptId uint
+	ReceiverLockHash     string
 	LockHash             string
 	LockHashCrc          uint32
 	LockScriptId         uint
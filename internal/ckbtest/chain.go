@@ -0,0 +1,136 @@
+// Package ckbtest serves a scripted CKB chain over JSON-RPC, so tests can drive the syncer services
+// through the real rpc.Client, including reorgs and node outages.
+package ckbtest
+
+import (
+	"encoding/binary"
+	"math/big"
+	"sync"
+
+	"github.com/nervosnetwork/ckb-sdk-go/crypto/blake2b"
+	ckbTypes "github.com/nervosnetwork/ckb-sdk-go/types"
+)
+
+// Chain is the canonical chain of the fake node, it starts with a genesis block
+type Chain struct {
+	mu     sync.Mutex
+	name   string
+	blocks []*ckbTypes.Block
+	// txs maps the transactions of the canonical chain to their block hash
+	txs map[ckbTypes.Hash]committedTx
+	// forks makes a block built after a fork differ from the block it replaces
+	forks uint64
+	down  bool
+}
+
+type committedTx struct {
+	tx        *ckbTypes.Transaction
+	blockHash ckbTypes.Hash
+}
+
+// NewChain returns a chain with only the genesis block, the name is reported by get_blockchain_info,
+// "ckb" is the mainnet and "ckb_testnet" the testnet
+func NewChain(name string) *Chain {
+	c := &Chain{name: name, txs: make(map[ckbTypes.Hash]committedTx)}
+	c.AddBlock()
+	return c
+}
+
+// AddBlock appends a block with the transactions to the tip. A transaction without a hash gets its
+// computed hash.
+func (c *Chain) AddBlock(txs ...*ckbTypes.Transaction) *ckbTypes.Block {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	header := &ckbTypes.Header{Number: uint64(len(c.blocks)), Nonce: big.NewInt(0), Timestamp: uint64(len(c.blocks)) * 1000}
+	if len(c.blocks) > 0 {
+		header.ParentHash = c.blocks[len(c.blocks)-1].Header.Hash
+	}
+	preimage := append(header.ParentHash.Bytes(), make([]byte, 16)...)
+	binary.LittleEndian.PutUint64(preimage[32:], header.Number)
+	binary.LittleEndian.PutUint64(preimage[40:], c.forks)
+	for _, tx := range txs {
+		if tx.Hash == (ckbTypes.Hash{}) {
+			hash, err := tx.ComputeHash()
+			if err != nil {
+				panic(err)
+			}
+			tx.Hash = hash
+		}
+		preimage = append(preimage, tx.Hash.Bytes()...)
+	}
+	hash, err := blake2b.Blake256(preimage)
+	if err != nil {
+		panic(err)
+	}
+	header.Hash = ckbTypes.BytesToHash(hash)
+	block := &ckbTypes.Block{Header: header, Transactions: txs}
+	for _, tx := range txs {
+		c.txs[tx.Hash] = committedTx{tx: tx, blockHash: header.Hash}
+	}
+	c.blocks = append(c.blocks, block)
+	return block
+}
+
+// Fork drops the blocks after the number, the blocks added next replace them with new hashes
+func (c *Chain) Fork(number uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if number+1 >= uint64(len(c.blocks)) {
+		return
+	}
+	for _, block := range c.blocks[number+1:] {
+		for _, tx := range block.Transactions {
+			delete(c.txs, tx.Hash)
+		}
+	}
+	c.blocks = c.blocks[:number+1]
+	c.forks++
+}
+
+// Tip returns the tip block number
+func (c *Chain) Tip() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return uint64(len(c.blocks) - 1)
+}
+
+// Block returns the canonical block of the number, or nil after the tip
+func (c *Chain) Block(number uint64) *ckbTypes.Block {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if number >= uint64(len(c.blocks)) {
+		return nil
+	}
+	return c.blocks[number]
+}
+
+// SetDown makes every call fail until the node is up again
+func (c *Chain) SetDown(down bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.down = down
+}
+
+func (c *Chain) isDown() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.down
+}
+
+func (c *Chain) transaction(hash ckbTypes.Hash) (committedTx, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tx, ok := c.txs[hash]
+	return tx, ok
+}
+
+func (c *Chain) header(hash ckbTypes.Hash) *ckbTypes.Header {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, block := range c.blocks {
+		if block.Header.Hash == hash {
+			return block.Header
+		}
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package ckbtest
+
+import (
+	"encoding/json"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ckbTypes "github.com/nervosnetwork/ckb-sdk-go/types"
+)
+
+// MarshalTransaction encodes the transaction the way the node returns it from get_transaction, so
+// transactions fetched from a real node and built in tests share one format
+func MarshalTransaction(tx *ckbTypes.Transaction) ([]byte, error) {
+	return json.MarshalIndent(toTransaction(tx), "", "  ")
+}
+
+// UnmarshalTransaction decodes a transaction in the json encoding of the node
+func UnmarshalTransaction(data []byte) (*ckbTypes.Transaction, error) {
+	var tx transaction
+	if err := json.Unmarshal(data, &tx); err != nil {
+		return nil, err
+	}
+	return fromTransaction(tx), nil
+}
+
+// the json encoding of the ckb rpc, the rpc package of the sdk keeps its own types unexported
+
+type header struct {
+	CompactTarget    hexutil.Uint   `json:"compact_target"`
+	Dao              ckbTypes.Hash  `json:"dao"`
+	Epoch            hexutil.Uint64 `json:"epoch"`
+	Hash             ckbTypes.Hash  `json:"hash"`
+	Nonce            *hexutil.Big   `json:"nonce"`
+	Number           hexutil.Uint64 `json:"number"`
+	ParentHash       ckbTypes.Hash  `json:"parent_hash"`
+	ProposalsHash    ckbTypes.Hash  `json:"proposals_hash"`
+	Timestamp        hexutil.Uint64 `json:"timestamp"`
+	TransactionsRoot ckbTypes.Hash  `json:"transactions_root"`
+	ExtraHash        ckbTypes.Hash  `json:"extra_hash"`
+	Version          hexutil.Uint   `json:"version"`
+}
+
+type outPoint struct {
+	TxHash ckbTypes.Hash `json:"tx_hash"`
+	Index  hexutil.Uint  `json:"index"`
+}
+
+type cellDep struct {
+	OutPoint outPoint         `json:"out_point"`
+	DepType  ckbTypes.DepType `json:"dep_type"`
+}
+
+type cellInput struct {
+	Since          hexutil.Uint64 `json:"since"`
+	PreviousOutput outPoint       `json:"previous_output"`
+}
+
+type script struct {
+	CodeHash ckbTypes.Hash           `json:"code_hash"`
+	HashType ckbTypes.ScriptHashType `json:"hash_type"`
+	Args     hexutil.Bytes           `json:"args"`
+}
+
+type cellOutput struct {
+	Capacity hexutil.Uint64 `json:"capacity"`
+	Lock     *script        `json:"lock"`
+	Type     *script        `json:"type"`
+}
+
+type transaction struct {
+	Version     hexutil.Uint    `json:"version"`
+	Hash        ckbTypes.Hash   `json:"hash"`
+	CellDeps    []cellDep       `json:"cell_deps"`
+	HeaderDeps  []ckbTypes.Hash `json:"header_deps"`
+	Inputs      []cellInput     `json:"inputs"`
+	Outputs     []cellOutput    `json:"outputs"`
+	OutputsData []hexutil.Bytes `json:"outputs_data"`
+	Witnesses   []hexutil.Bytes `json:"witnesses"`
+}
+
+type block struct {
+	Header       header        `json:"header"`
+	Proposals    []string      `json:"proposals"`
+	Transactions []transaction `json:"transactions"`
+	Uncles       []any         `json:"uncles"`
+}
+
+type transactionWithStatus struct {
+	Transaction transaction `json:"transaction"`
+	TxStatus    struct {
+		BlockHash *ckbTypes.Hash             `json:"block_hash"`
+		Status    ckbTypes.TransactionStatus `json:"status"`
+	} `json:"tx_status"`
+}
+
+type blockchainInfo struct {
+	Alerts                 []any          `json:"alerts"`
+	Chain                  string         `json:"chain"`
+	Difficulty             *hexutil.Big   `json:"difficulty"`
+	Epoch                  hexutil.Uint64 `json:"epoch"`
+	IsInitialBlockDownload bool           `json:"is_initial_block_download"`
+	MedianTime             hexutil.Uint64 `json:"median_time"`
+}
+
+func toHeader(h *ckbTypes.Header) header {
+	nonce := h.Nonce
+	if nonce == nil {
+		nonce = big.NewInt(0)
+	}
+	return header{
+		CompactTarget:    hexutil.Uint(h.CompactTarget),
+		Dao:              h.Dao,
+		Epoch:            hexutil.Uint64(h.Epoch),
+		Hash:             h.Hash,
+		Nonce:            (*hexutil.Big)(nonce),
+		Number:           hexutil.Uint64(h.Number),
+		ParentHash:       h.ParentHash,
+		ProposalsHash:    h.ProposalsHash,
+		Timestamp:        hexutil.Uint64(h.Timestamp),
+		TransactionsRoot: h.TransactionsRoot,
+		ExtraHash:        h.ExtraHash,
+		Version:          hexutil.Uint(h.Version),
+	}
+}
+
+func toScript(s *ckbTypes.Script) *script {
+	if s == nil {
+		return nil
+	}
+	return &script{CodeHash: s.CodeHash, HashType: s.HashType, Args: s.Args}
+}
+
+func toOutPoint(o *ckbTypes.OutPoint) outPoint {
+	if o == nil {
+		return outPoint{}
+	}
+	return outPoint{TxHash: o.TxHash, Index: hexutil.Uint(o.Index)}
+}
+
+func toBytes(values [][]byte) []hexutil.Bytes {
+	result := make([]hexutil.Bytes, len(values))
+	for i, value := range values {
+		result[i] = value
+	}
+	return result
+}
+
+func toTransaction(tx *ckbTypes.Transaction) transaction {
+	result := transaction{
+		Version:     hexutil.Uint(tx.Version),
+		Hash:        tx.Hash,
+		CellDeps:    make([]cellDep, len(tx.CellDeps)),
+		HeaderDeps:  append([]ckbTypes.Hash{}, tx.HeaderDeps...),
+		Inputs:      make([]cellInput, len(tx.Inputs)),
+		Outputs:     make([]cellOutput, len(tx.Outputs)),
+		OutputsData: toBytes(tx.OutputsData),
+		Witnesses:   toBytes(tx.Witnesses),
+	}
+	for i, dep := range tx.CellDeps {
+		result.CellDeps[i] = cellDep{OutPoint: toOutPoint(dep.OutPoint), DepType: dep.DepType}
+	}
+	for i, input := range tx.Inputs {
+		result.Inputs[i] = cellInput{Since: hexutil.Uint64(input.Since), PreviousOutput: toOutPoint(input.PreviousOutput)}
+	}
+	for i, output := range tx.Outputs {
+		result.Outputs[i] = cellOutput{Capacity: hexutil.Uint64(output.Capacity), Lock: toScript(output.Lock), Type: toScript(output.Type)}
+	}
+	return result
+}
+
+func toBlock(b *ckbTypes.Block) block {
+	result := block{
+		Header:       toHeader(b.Header),
+		Proposals:    append([]string{}, b.Proposals...),
+		Transactions: make([]transaction, len(b.Transactions)),
+		Uncles:       []any{},
+	}
+	for i, tx := range b.Transactions {
+		result.Transactions[i] = toTransaction(tx)
+	}
+	return result
+}
+
+func fromScript(s *script) *ckbTypes.Script {
+	if s == nil {
+		return nil
+	}
+	return &ckbTypes.Script{CodeHash: s.CodeHash, HashType: s.HashType, Args: s.Args}
+}
+
+func fromOutPoint(o outPoint) *ckbTypes.OutPoint {
+	return &ckbTypes.OutPoint{TxHash: o.TxHash, Index: uint(o.Index)}
+}
+
+func fromBytes(values []hexutil.Bytes) [][]byte {
+	result := make([][]byte, len(values))
+	for i, value := range values {
+		result[i] = value
+	}
+	return result
+}
+
+func fromTransaction(tx transaction) *ckbTypes.Transaction {
+	result := &ckbTypes.Transaction{
+		Version:     uint(tx.Version),
+		Hash:        tx.Hash,
+		CellDeps:    make([]*ckbTypes.CellDep, len(tx.CellDeps)),
+		HeaderDeps:  append([]ckbTypes.Hash{}, tx.HeaderDeps...),
+		Inputs:      make([]*ckbTypes.CellInput, len(tx.Inputs)),
+		Outputs:     make([]*ckbTypes.CellOutput, len(tx.Outputs)),
+		OutputsData: fromBytes(tx.OutputsData),
+		Witnesses:   fromBytes(tx.Witnesses),
+	}
+	for i, dep := range tx.CellDeps {
+		result.CellDeps[i] = &ckbTypes.CellDep{OutPoint: fromOutPoint(dep.OutPoint), DepType: dep.DepType}
+	}
+	for i, input := range tx.Inputs {
+		result.Inputs[i] = &ckbTypes.CellInput{Since: uint64(input.Since), PreviousOutput: fromOutPoint(input.PreviousOutput)}
+	}
+	for i, output := range tx.Outputs {
+		result.Outputs[i] = &ckbTypes.CellOutput{Capacity: uint64(output.Capacity), Lock: fromScript(output.Lock), Type: fromScript(output.Type)}
+	}
+	return result
+}
@@ -0,0 +1,26 @@
+package ckbtest
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMarshalTransaction(t *testing.T) {
+	tx := testTx(1)
+	hash, err := tx.ComputeHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Hash = hash
+	data, err := MarshalTransaction(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := UnmarshalTransaction(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, tx) {
+		t.Errorf("UnmarshalTransaction() = %+v, want %+v", decoded, tx)
+	}
+}
@@ -0,0 +1,124 @@
+package ckbtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ckbTypes "github.com/nervosnetwork/ckb-sdk-go/types"
+)
+
+// Server is an in-process CKB node serving the chain. It implements the RPCs used by the syncer:
+// get_tip_block_number, get_block_by_number, get_transaction, get_blockchain_info and get_header.
+type Server struct {
+	URL    string
+	chain  *Chain
+	server *httptest.Server
+}
+
+// NewServer starts serving the chain, dial Server.URL with rpc.Dial
+func NewServer(chain *Chain) *Server {
+	s := &Server{chain: chain}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL
+	return s
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+type request struct {
+	Version string            `json:"jsonrpc"`
+	Id      json.RawMessage   `json:"id"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type response struct {
+	Version string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Result  any             `json:"result"`
+	Error   *responseError  `json:"error,omitempty"`
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.chain.isDown() {
+		http.Error(w, "ckb node is down", http.StatusServiceUnavailable)
+		return
+	}
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res := response{Version: "2.0", Id: req.Id}
+	result, err := s.call(req.Method, req.Params)
+	if err != nil {
+		res.Error = err
+	} else {
+		res.Result = result
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func (s *Server) call(method string, params []json.RawMessage) (any, *responseError) {
+	switch method {
+	case "get_tip_block_number":
+		return hexutil.Uint64(s.chain.Tip()), nil
+	case "get_block_by_number":
+		var number hexutil.Uint64
+		if err := decodeParam(params, &number); err != nil {
+			return nil, err
+		}
+		if block := s.chain.Block(uint64(number)); block != nil {
+			return toBlock(block), nil
+		}
+		return nil, nil
+	case "get_transaction":
+		var hash ckbTypes.Hash
+		if err := decodeParam(params, &hash); err != nil {
+			return nil, err
+		}
+		committed, ok := s.chain.transaction(hash)
+		if !ok {
+			return nil, nil
+		}
+		result := transactionWithStatus{Transaction: toTransaction(committed.tx)}
+		result.TxStatus.BlockHash = &committed.blockHash
+		result.TxStatus.Status = ckbTypes.TransactionStatusCommitted
+		return result, nil
+	case "get_blockchain_info":
+		return blockchainInfo{Alerts: []any{}, Chain: s.chain.name, Difficulty: (*hexutil.Big)(big.NewInt(0)), Epoch: 0, MedianTime: 0}, nil
+	case "get_header":
+		var hash ckbTypes.Hash
+		if err := decodeParam(params, &hash); err != nil {
+			return nil, err
+		}
+		if h := s.chain.header(hash); h != nil {
+			return toHeader(h), nil
+		}
+		return nil, nil
+	default:
+		return nil, &responseError{Code: -32601, Message: fmt.Sprintf("method %s not found", method)}
+	}
+}
+
+func decodeParam(params []json.RawMessage, v any) *responseError {
+	if len(params) == 0 {
+		return &responseError{Code: -32602, Message: "missing params"}
+	}
+	if err := json.Unmarshal(params[0], v); err != nil {
+		return &responseError{Code: -32602, Message: err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package ckbtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nervosnetwork/ckb-sdk-go/rpc"
+	ckbTypes "github.com/nervosnetwork/ckb-sdk-go/types"
+)
+
+func testTx(args byte) *ckbTypes.Transaction {
+	lock := &ckbTypes.Script{CodeHash: ckbTypes.HexToHash("0x01"), HashType: ckbTypes.HashTypeType, Args: []byte{args}}
+	return &ckbTypes.Transaction{
+		Version:     0,
+		CellDeps:    []*ckbTypes.CellDep{{OutPoint: &ckbTypes.OutPoint{TxHash: ckbTypes.HexToHash("0x02"), Index: 1}, DepType: ckbTypes.DepTypeDepGroup}},
+		HeaderDeps:  []ckbTypes.Hash{},
+		Inputs:      []*ckbTypes.CellInput{{PreviousOutput: &ckbTypes.OutPoint{TxHash: ckbTypes.HexToHash("0x03"), Index: 0}}},
+		Outputs:     []*ckbTypes.CellOutput{{Capacity: 100, Lock: lock}},
+		OutputsData: [][]byte{{args}},
+		Witnesses:   [][]byte{{0x55}},
+	}
+}
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+	chain := NewChain("ckb_testnet")
+	server := NewServer(chain)
+	defer server.Close()
+	client, err := rpc.Dial(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := testTx(1)
+	chain.AddBlock(tx)
+	chain.AddBlock()
+	if tip, err := client.GetTipBlockNumber(ctx); err != nil || tip != 2 {
+		t.Fatalf("tip = %d, %v, want 2", tip, err)
+	}
+	info, err := client.GetBlockchainInfo(ctx)
+	if err != nil || info.Chain != "ckb_testnet" {
+		t.Fatalf("blockchain info = %+v, %v", info, err)
+	}
+
+	block, err := client.GetBlockByNumber(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Header.Hash != chain.Block(1).Header.Hash || block.Header.ParentHash != chain.Block(0).Header.Hash {
+		t.Errorf("block 1 header = %+v", block.Header)
+	}
+	if len(block.Transactions) != 1 || block.Transactions[0].Hash != tx.Hash || !block.Transactions[0].Outputs[0].Lock.Equals(tx.Outputs[0].Lock) {
+		t.Errorf("block 1 transactions = %+v", block.Transactions)
+	}
+	if hash, err := block.Transactions[0].ComputeHash(); err != nil || hash != tx.Hash {
+		t.Errorf("the transaction hash changed over rpc: %s, %v", hash, err)
+	}
+	if _, err = client.GetBlockByNumber(ctx, 3); !errors.Is(err, rpc.NotFound) {
+		t.Errorf("block after the tip error = %v, want not found", err)
+	}
+
+	committed, err := client.GetTransaction(ctx, tx.Hash)
+	if err != nil || committed.TxStatus.Status != ckbTypes.TransactionStatusCommitted || *committed.TxStatus.BlockHash != block.Header.Hash {
+		t.Fatalf("transaction = %+v, %v", committed, err)
+	}
+	header, err := client.GetHeader(ctx, block.Header.Hash)
+	if err != nil || header.Number != 1 {
+		t.Fatalf("header = %+v, %v", header, err)
+	}
+
+	// a fork at block 0 replaces block 1 and drops its transaction
+	chain.Fork(0)
+	chain.AddBlock()
+	forked, err := client.GetBlockByNumber(ctx, 1)
+	if err != nil || forked.Header.Hash == block.Header.Hash || forked.Header.ParentHash != block.Header.ParentHash {
+		t.Fatalf("forked block 1 = %+v, %v", forked, err)
+	}
+	if tip, err := client.GetTipBlockNumber(ctx); err != nil || tip != 1 {
+		t.Errorf("tip after fork = %d, %v, want 1", tip, err)
+	}
+	// the node answers null for unknown hashes, which the client decodes into zero values
+	if committed, err = client.GetTransaction(ctx, tx.Hash); err == nil && committed.Transaction.Hash == tx.Hash {
+		t.Errorf("transaction of the dropped block = %+v", committed)
+	}
+	if header, err = client.GetHeader(ctx, block.Header.Hash); err == nil && header.Hash == block.Header.Hash {
+		t.Errorf("header of the dropped block = %+v", header)
+	}
+
+	chain.SetDown(true)
+	if _, err = client.GetTipBlockNumber(ctx); err == nil {
+		t.Error("tip while the node is down, want an error")
+	}
+	chain.SetDown(false)
+	if _, err = client.GetTipBlockNumber(ctx); err != nil {
+		t.Errorf("tip after the node is up again: %v", err)
+	}
+}
@@ -29,6 +29,77 @@ type CkbNode struct {
 	Mode   string `mapstructure:"mode"`
 }
 
+type Api struct {
+	Addr string `mapstructure:"addr"`
+}
+
+type Webhook struct {
+	PollInterval time.Duration     `mapstructure:"poll_interval"`
+	MaxAttempts  int               `mapstructure:"max_attempts"`
+	Endpoints    []WebhookEndpoint `mapstructure:"endpoints"`
+}
+
+type WebhookEndpoint struct {
+	Name       string   `mapstructure:"name"`
+	Url        string   `mapstructure:"url"`
+	Secret     string   `mapstructure:"secret"`
+	EventTypes []string `mapstructure:"event_types"`
+	CotaIds    []string `mapstructure:"cota_ids"`
+	LockHashes []string `mapstructure:"lock_hashes"`
+}
+
+type Sink struct {
+	Driver       string        `mapstructure:"driver"`
+	Name         string        `mapstructure:"name"`
+	Url          string        `mapstructure:"url"`
+	Subject      string        `mapstructure:"subject"`
+	BatchSize    int           `mapstructure:"batch_size"`
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+}
+
+// Sync switches the block syncer to bulk mode while it is more than bulk_threshold blocks behind the
+// tip, bulk mode commits bulk_blocks blocks per transaction. A zero threshold disables bulk mode.
+type Sync struct {
+	BulkThreshold uint64 `mapstructure:"bulk_threshold"`
+	BulkBlocks    int    `mapstructure:"bulk_blocks"`
+}
+
+// Retention is archive to keep all version history, or prune to delete the version rows older than
+// keep_blocks blocks before the synced height
+type Retention struct {
+	Mode       string        `mapstructure:"mode"`
+	KeepBlocks uint64        `mapstructure:"keep_blocks"`
+	BatchSize  int           `mapstructure:"batch_size"`
+	Interval   time.Duration `mapstructure:"interval"`
+}
+
+// Metadata stores the CTMeta metadata of the types without a handler in raw_metadata when store_unknown
+// is on, they are quarantined otherwise. Validation is strict to quarantine metadata that does not
+// match the schema of its type, or lenient to store it with a warning.
+type Metadata struct {
+	StoreUnknown bool   `mapstructure:"store_unknown"`
+	Validation   string `mapstructure:"validation"`
+}
+
+// Localization fetches the localized name and description of the issuers and classes from their
+// localization uri every interval when enabled, a failed fetch is tried again after retry_interval.
+// Only public http and https hosts are fetched unless allow_private_networks is set.
+type Localization struct {
+	Enabled              bool          `mapstructure:"enabled"`
+	Interval             time.Duration `mapstructure:"interval"`
+	BatchSize            int           `mapstructure:"batch_size"`
+	Timeout              time.Duration `mapstructure:"timeout"`
+	RetryInterval        time.Duration `mapstructure:"retry_interval"`
+	AllowPrivateNetworks bool          `mapstructure:"allow_private_networks"`
+}
+
+// Media rewrites the ipfs and Arweave media urls of the classes to the gateways, https://ipfs.io/ipfs/
+// and https://arweave.net/ when empty
+type Media struct {
+	IpfsGateway    string `mapstructure:"ipfs_gateway"`
+	ArweaveGateway string `mapstructure:"arweave_gateway"`
+}
+
 type Config struct {
 	vp *viper.Viper
 }
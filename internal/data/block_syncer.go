@@ -2,6 +2,7 @@ package data
 
 import (
 	"context"
+	"errors"
 
 	"github.com/nervina-labs/cota-syncer/internal/biz"
 	ckbTypes "github.com/nervosnetwork/ckb-sdk-go/types"
@@ -49,40 +50,75 @@ func NewBlockSyncer(claimedCotaUsecase *biz.ClaimedCotaNftKvPairUsecase, defineC
 }
 
 func (bp BlockSyncer) Sync(ctx context.Context, block *ckbTypes.Block, checkInfo biz.CheckInfo, systemScripts SystemScripts) error {
+	pairs, err := bp.parseTxs(ctx, block.Header.Number, block.Transactions, 0, systemScripts)
+	if err != nil {
+		return err
+	}
+	err = bp.kvPairUsecase.CreateCotaEntryKvPairs(ctx, checkInfo, &pairs)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SyncBlocks parses consecutive blocks and writes them in one transaction, checkInfos[i] is the check
+// info of blocks[i]. The parsers only read the scripts table, so a block can be parsed before the
+// blocks ahead of it are written.
+func (bp BlockSyncer) SyncBlocks(ctx context.Context, blocks []*ckbTypes.Block, checkInfos []biz.CheckInfo, systemScripts SystemScripts) error {
+	kvPairs := make([]biz.KvPair, len(blocks))
+	for i, block := range blocks {
+		pairs, err := bp.parseTxs(ctx, block.Header.Number, block.Transactions, 0, systemScripts)
+		if err != nil {
+			return err
+		}
+		kvPairs[i] = pairs
+	}
+	return bp.kvPairUsecase.CreateCotaEntryBlocks(ctx, checkInfos, kvPairs)
+}
+
+// parseTxs parses the registers and the cota entries of the transactions, firstIndex is the index of
+// the first transaction in its block
+func (bp BlockSyncer) parseTxs(ctx context.Context, blockNumber uint64, txs []*ckbTypes.Transaction, firstIndex uint32, systemScripts SystemScripts) (biz.KvPair, error) {
 	var entryVec []biz.Entry
 	kvPair := biz.KvPair{}
-	for index, tx := range block.Transactions {
-		if bp.hasCotaRegistryCell(tx.Outputs, systemScripts.CotaRegistryType) && bp.isUpdateCotaRegistryTx(tx.Witnesses[0]) {
-			registers, err := bp.registerCotaUsecase.ParseRegistryEntries(ctx, block.Header.Number, tx)
+	for i, tx := range txs {
+		index := firstIndex + uint32(i)
+		if bp.hasCotaRegistryCell(tx.Outputs, systemScripts.CotaRegistryType) && bp.isUpdateCotaRegistryTx(tx.Witnesses) {
+			registers, err := bp.registerCotaUsecase.ParseRegistryEntries(ctx, blockNumber, tx)
 			if err != nil && err.Error() == "No data" {
 				continue
+			} else if errors.Is(err, biz.ErrMalformedEntry) {
+				kvPair.Quarantines = append(kvPair.Quarantines, quarantineTx(blockNumber, index, tx, err))
+				continue
 			} else if err != nil {
-				return err
+				return kvPair, err
 			}
 			kvPair.Registers = append(kvPair.Registers, registers...)
+			kvPair.Events = append(kvPair.Events, registerEvents(blockNumber, index, tx.Hash, registers)...)
 		}
-		entries, err := bp.cotaWitnessArgsParser.Parse(tx, uint32(index), systemScripts.CotaType)
+		entries, err := bp.cotaWitnessArgsParser.Parse(tx, index, systemScripts.CotaType)
 		if err != nil && err.Error() == "No data" {
 			continue
+		} else if errors.Is(err, biz.ErrMalformedEntry) {
+			kvPair.Quarantines = append(kvPair.Quarantines, quarantineTx(blockNumber, index, tx, err))
+			continue
 		} else if err != nil {
-			return err
+			return kvPair, err
 		}
 		entryVec = append(entryVec, entries...)
 	}
-	pairs, err := bp.parseCotaEntries(block.Header.Number, entryVec)
+	pairs, err := bp.parseCotaEntries(blockNumber, entryVec)
 	if err != nil {
-		return err
+		return pairs, err
 	}
 	pairs.Registers = kvPair.Registers
-	err = bp.kvPairUsecase.CreateCotaEntryKvPairs(ctx, checkInfo, &pairs)
-	if err != nil {
-		return err
-	}
-	return nil
+	pairs.Quarantines = append(kvPair.Quarantines, pairs.Quarantines...)
+	pairs.Events = append(kvPair.Events, pairs.Events...)
+	return pairs, nil
 }
 
-func (bp BlockSyncer) isUpdateCotaRegistryTx(firstWitness []byte) bool {
-	return len(firstWitness) != 0
+func (bp BlockSyncer) isUpdateCotaRegistryTx(witnesses [][]byte) bool {
+	return len(witnesses) > 0 && len(witnesses[0]) != 0
 }
 
 func (bp BlockSyncer) isCotaRegistryCell(output *ckbTypes.CellOutput, registryType SystemScript) bool {
@@ -101,6 +137,12 @@ func (bp BlockSyncer) hasCotaRegistryCell(outputs []*ckbTypes.CellOutput, regist
 	return result
 }
 
+// ParseBlock parses the pairs of a block without writing them, the timeline backfill reads the tx of the
+// withdrawals and claims synced before it was kept
+func (bp BlockSyncer) ParseBlock(ctx context.Context, block *ckbTypes.Block, systemScripts SystemScripts) (biz.KvPair, error) {
+	return bp.parseTxs(ctx, block.Header.Number, block.Transactions, 0, systemScripts)
+}
+
 func (bp BlockSyncer) Rollback(ctx context.Context, blockNumber uint64) error {
 	return bp.kvPairUsecase.RestoreCotaEntryKvPairs(ctx, blockNumber)
 }
@@ -109,92 +151,121 @@ func (bp BlockSyncer) parseCotaEntries(blockNumber uint64, entries []biz.Entry)
 	var kvPair biz.KvPair
 	for _, entry := range entries {
 		if len(entry.InputType) > 0 {
-			switch entry.InputType[0] {
-			//	Define: Create DefineCota Kv pairs
-			case 1:
-				defineCotas, err := bp.defineCotaUsecase.ParseDefineCotaEntries(blockNumber, entry)
-				if err != nil {
-					return kvPair, err
-				}
-				kvPair.DefineCotas = append(kvPair.DefineCotas, defineCotas...)
-			//	Mint:  Update DefineCota Kv pairs and create withdrawCota kv pairs
-			case 2:
-				updatedDefineCotas, withdrawCotas, err := bp.mintCotaUsecase.ParseMintCotaEntries(blockNumber, entry)
-				if err != nil {
-					return kvPair, err
-				}
-				kvPair.UpdatedDefineCotas = append(kvPair.UpdatedDefineCotas, updatedDefineCotas...)
-				kvPair.WithdrawCotas = append(kvPair.WithdrawCotas, withdrawCotas...)
-			//	Withdraw: Delete HoldCota kv pairs and create withdrawCota kv pairs
-			case 3:
-				withdrawCotas, err := bp.withdrawCotaUsecase.ParseWithdrawCotaEntries(blockNumber, entry)
-				if err != nil {
-					return kvPair, err
-				}
-				kvPair.WithdrawCotas = append(kvPair.WithdrawCotas, withdrawCotas...)
-			//	Claim: Create HoldCota kv pairs and claimedCota kv pairs
-			case 4:
-				holdCotas, claimedCotas, err := bp.claimedCotaUsecase.ParseClaimedCotaEntries(blockNumber, entry)
-				if err != nil {
-					return kvPair, err
-				}
-				kvPair.ClaimedCotas = append(kvPair.ClaimedCotas, claimedCotas...)
-				kvPair.HoldCotas = append(kvPair.HoldCotas, holdCotas...)
-			//	Update: Update HoldCota kv pairs
-			case 5:
-				holdCotas, err := bp.holdCotaUsecase.ParseHoldCotaEntries(blockNumber, entry)
-				if err != nil {
-					return kvPair, err
-				}
-				kvPair.UpdatedHoldCotas = append(kvPair.HoldCotas, holdCotas...)
-			//	Transfer: Create claimedCota kv pairs and withdrawCota kv pairs
-			case 6:
-				claimedCotas, withdrawCotas, err := bp.transferCotaUsecase.ParseTransferCotaEntries(blockNumber, entry)
-				if err != nil {
-					return kvPair, err
-				}
-				kvPair.ClaimedCotas = append(kvPair.ClaimedCotas, claimedCotas...)
-				kvPair.WithdrawCotas = append(kvPair.WithdrawCotas, withdrawCotas...)
-			//	Claim and Update:  Create HoldCota kv pairs and claimedCota kv pairs
-			case 7:
-				holdCotas, claimedCotas, err := bp.claimedCotaUsecase.ParseClaimedUpdateCotaEntries(blockNumber, entry)
-				if err != nil {
-					return kvPair, err
-				}
-				kvPair.ClaimedCotas = append(kvPair.ClaimedCotas, claimedCotas...)
-				kvPair.HoldCotas = append(kvPair.HoldCotas, holdCotas...)
-			//	Transfer and Update: Create claimedCota kv pairs and withdrawCota kv pairs
-			case 8:
-				claimedCotas, withdrawCotas, err := bp.transferCotaUsecase.ParseTransferUpdateCotaEntries(blockNumber, entry)
-				if err != nil {
-					return kvPair, err
-				}
-				kvPair.ClaimedCotas = append(kvPair.ClaimedCotas, claimedCotas...)
-				kvPair.WithdrawCotas = append(kvPair.WithdrawCotas, withdrawCotas...)
-			// Extension: Create extension pairs
-			case 0xF0:
-				extensionPairs, err := bp.extensionPairUsecase.ParseExtensionPair(blockNumber, entry)
-				if err != nil {
-					return kvPair, err
-				}
-				kvPair.ExtensionPairs = append(kvPair.ExtensionPairs, extensionPairs.Extensions...)
-				kvPair.SubKeyPairs = append(kvPair.SubKeyPairs, extensionPairs.SubKeys...)
-				kvPair.SocialPairs = append(kvPair.SocialPairs, extensionPairs.Socials...)
-			// Extension: Update extension pairs
-			case 0xF1:
-				extensionPairs, err := bp.extensionPairUsecase.ParseExtensionPair(blockNumber, entry)
-				if err != nil {
-					return kvPair, err
-				}
-				kvPair.UpdatedExtensionPairs = append(kvPair.UpdatedExtensionPairs, extensionPairs.Extensions...)
-				kvPair.UpdatedSubKeyPairs = append(kvPair.UpdatedSubKeyPairs, extensionPairs.SubKeys...)
-				kvPair.UpdatedSocialPairs = append(kvPair.UpdatedSocialPairs, extensionPairs.Socials...)
+			events, err := bp.parseCotaEntry(blockNumber, entry, &kvPair)
+			if errors.Is(err, biz.ErrMalformedEntry) {
+				kvPair.Quarantines = append(kvPair.Quarantines, quarantineEntry(blockNumber, entry, biz.SyncBlock, err))
+				continue
+			} else if err != nil {
+				return kvPair, err
 			}
+			kvPair.Events = append(kvPair.Events, entryEvents(blockNumber, entry, biz.SyncBlock, entry.InputType[0], events)...)
 		}
 	}
 	return kvPair, nil
 }
 
+// parseCotaEntry adds the pairs of the entry to kvPair and returns its events, nothing is added when
+// the entry fails to parse
+func (bp BlockSyncer) parseCotaEntry(blockNumber uint64, entry biz.Entry, kvPair *biz.KvPair) ([]biz.CotaEvent, error) {
+	var events []biz.CotaEvent
+	switch entry.InputType[0] {
+	//	Define: Create DefineCota Kv pairs
+	case 1:
+		defineCotas, err := bp.defineCotaUsecase.ParseDefineCotaEntries(blockNumber, entry)
+		if err != nil {
+			return nil, err
+		}
+		kvPair.DefineCotas = append(kvPair.DefineCotas, defineCotas...)
+		events = defineEvents(defineCotas)
+	//	Mint:  Update DefineCota Kv pairs and create withdrawCota kv pairs
+	case 2:
+		updatedDefineCotas, withdrawCotas, err := bp.mintCotaUsecase.ParseMintCotaEntries(blockNumber, entry)
+		if err != nil {
+			return nil, err
+		}
+		kvPair.UpdatedDefineCotas = append(kvPair.UpdatedDefineCotas, updatedDefineCotas...)
+		kvPair.WithdrawCotas = append(kvPair.WithdrawCotas, withdrawCotas...)
+		events = withdrawEvents(biz.CotaEventMint, withdrawCotas)
+	//	Withdraw: Delete HoldCota kv pairs and create withdrawCota kv pairs
+	case 3:
+		withdrawCotas, err := bp.withdrawCotaUsecase.ParseWithdrawCotaEntries(blockNumber, entry)
+		if err != nil {
+			return nil, err
+		}
+		kvPair.WithdrawCotas = append(kvPair.WithdrawCotas, withdrawCotas...)
+		events = withdrawEvents(biz.CotaEventWithdraw, withdrawCotas)
+	//	Claim: Create HoldCota kv pairs and claimedCota kv pairs
+	case 4:
+		holdCotas, claimedCotas, err := bp.claimedCotaUsecase.ParseClaimedCotaEntries(blockNumber, entry)
+		if err != nil {
+			return nil, err
+		}
+		kvPair.ClaimedCotas = append(kvPair.ClaimedCotas, claimedCotas...)
+		kvPair.HoldCotas = append(kvPair.HoldCotas, holdCotas...)
+		events = claimEvents(claimedCotas)
+	//	Update: Update HoldCota kv pairs
+	case 5:
+		holdCotas, err := bp.holdCotaUsecase.ParseHoldCotaEntries(blockNumber, entry)
+		if err != nil {
+			return nil, err
+		}
+		kvPair.UpdatedHoldCotas = append(kvPair.UpdatedHoldCotas, holdCotas...)
+		events = updateEvents(holdCotas)
+	//	Transfer: Create claimedCota kv pairs and withdrawCota kv pairs
+	case 6:
+		claimedCotas, withdrawCotas, err := bp.transferCotaUsecase.ParseTransferCotaEntries(blockNumber, entry)
+		if err != nil {
+			return nil, err
+		}
+		kvPair.ClaimedCotas = append(kvPair.ClaimedCotas, claimedCotas...)
+		kvPair.WithdrawCotas = append(kvPair.WithdrawCotas, withdrawCotas...)
+		events = append(claimEvents(claimedCotas), withdrawEvents(biz.CotaEventWithdraw, withdrawCotas)...)
+	//	Claim and Update:  Create HoldCota kv pairs and claimedCota kv pairs
+	case 7:
+		holdCotas, claimedCotas, err := bp.claimedCotaUsecase.ParseClaimedUpdateCotaEntries(blockNumber, entry)
+		if err != nil {
+			return nil, err
+		}
+		kvPair.ClaimedCotas = append(kvPair.ClaimedCotas, claimedCotas...)
+		kvPair.HoldCotas = append(kvPair.HoldCotas, holdCotas...)
+		events = claimEvents(claimedCotas)
+	//	Transfer and Update: Create claimedCota kv pairs and withdrawCota kv pairs
+	case 8:
+		claimedCotas, withdrawCotas, err := bp.transferCotaUsecase.ParseTransferUpdateCotaEntries(blockNumber, entry)
+		if err != nil {
+			return nil, err
+		}
+		kvPair.ClaimedCotas = append(kvPair.ClaimedCotas, claimedCotas...)
+		kvPair.WithdrawCotas = append(kvPair.WithdrawCotas, withdrawCotas...)
+		events = append(claimEvents(claimedCotas), withdrawEvents(biz.CotaEventWithdraw, withdrawCotas)...)
+	// Extension: Create extension pairs
+	case 0xF0:
+		extensionPairs, err := bp.extensionPairUsecase.ParseExtensionPair(blockNumber, entry)
+		if err != nil {
+			return nil, err
+		}
+		if events, err = extensionEvents(entry); err != nil {
+			return nil, err
+		}
+		kvPair.ExtensionPairs = append(kvPair.ExtensionPairs, extensionPairs.Extensions...)
+		kvPair.SubKeyPairs = append(kvPair.SubKeyPairs, extensionPairs.SubKeys...)
+		kvPair.SocialPairs = append(kvPair.SocialPairs, extensionPairs.Socials...)
+	// Extension: Update extension pairs
+	case 0xF1:
+		extensionPairs, err := bp.extensionPairUsecase.ParseExtensionPair(blockNumber, entry)
+		if err != nil {
+			return nil, err
+		}
+		if events, err = extensionEvents(entry); err != nil {
+			return nil, err
+		}
+		kvPair.UpdatedExtensionPairs = append(kvPair.UpdatedExtensionPairs, extensionPairs.Extensions...)
+		kvPair.UpdatedSubKeyPairs = append(kvPair.UpdatedSubKeyPairs, extensionPairs.SubKeys...)
+		kvPair.UpdatedSocialPairs = append(kvPair.UpdatedSocialPairs, extensionPairs.Socials...)
+	}
+	return events, nil
+}
+
 func argsEq(args1, args2 []byte) bool {
 	if args1 == nil || args2 == nil {
 		return false
@@ -0,0 +1,134 @@
+package data
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/data/blockchain"
+	ckbTypes "github.com/nervosnetwork/ckb-sdk-go/types"
+)
+
+// FuzzBlockSyncer_parseCotaEntries runs the action parsers on fuzzed input types, the malformed
+// entries are quarantined and never abort the block
+func FuzzBlockSyncer_parseCotaEntries(f *testing.F) {
+	fixture, tx, previous := loadGoldenFixture(f, filepath.Join("testdata", "golden", "mint_v2.json"))
+	for _, inputType := range goldenInputTypes(f) {
+		for _, version := range []byte{0, 1, 2} {
+			f.Add(inputType, version)
+		}
+	}
+	s := newFixtureSyncer(f, "fuzz_cota_entries", fixture.Chain, previous)
+
+	f.Fuzz(func(t *testing.T, inputType []byte, version byte) {
+		if len(inputType) == 0 {
+			return
+		}
+		entry := biz.Entry{InputType: inputType, LockScript: tx.Outputs[0].Lock, TxIndex: fixture.TxIndex, Version: version, TxHash: tx.Hash}
+		kvPair, err := s.syncer.parseCotaEntries(fixture.BlockNumber, []biz.Entry{entry})
+		if err != nil {
+			t.Fatalf("parse the entry: %v, want it quarantined", err)
+		}
+		for _, quarantined := range kvPair.Quarantines {
+			if quarantined.Action != inputType[0] || quarantined.Raw == "" {
+				t.Errorf("quarantined entry = %+v", quarantined)
+			}
+		}
+	})
+}
+
+// witnessTx copies the transaction with a witness args of the input type
+func witnessTx(tx *ckbTypes.Transaction, inputType []byte) *ckbTypes.Transaction {
+	bytes := make([]byte, 4, 4+len(inputType))
+	binary.LittleEndian.PutUint32(bytes, uint32(len(inputType)))
+	witness := blockchain.NewWitnessArgsBuilder().
+		InputType(blockchain.NewBytesOptBuilder().Set(*blockchain.BytesFromSliceUnchecked(append(bytes, inputType...))).Build()).
+		Build()
+	copied := *tx
+	copied.Witnesses = [][]byte{witness.AsSlice()}
+	return &copied
+}
+
+func TestBlockSyncer_Sync_malformed(t *testing.T) {
+	ctx := context.Background()
+	fixture, tx, previous := loadGoldenFixture(t, filepath.Join("testdata", "golden", "define_v2.json"))
+	s := newFixtureSyncer(t, "sync_malformed", fixture.Chain, previous)
+
+	brokenWitness := *tx
+	brokenWitness.Witnesses = [][]byte{{0x01, 0x02}}
+	block := &ckbTypes.Block{
+		Header: &ckbTypes.Header{Number: fixture.BlockNumber, Hash: ckbTypes.HexToHash(fmt.Sprintf("%x", fixture.BlockNumber))},
+		// a valid define between a witness that is not witness args and a truncated define entry
+		Transactions: []*ckbTypes.Transaction{&brokenWitness, tx, witnessTx(tx, []byte{0x01, 0x01})},
+	}
+	checkInfo := biz.CheckInfo{BlockNumber: fixture.BlockNumber, BlockHash: block.Header.Hash.String()[2:], CheckType: biz.SyncBlock}
+	if err := s.syncer.Sync(ctx, block, checkInfo, s.systemScripts); err != nil {
+		t.Fatalf("sync a block with malformed entries: %v", err)
+	}
+
+	var quarantined []QuarantinedEntry
+	if err := s.data.db.Order("tx_index").Find(&quarantined).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(quarantined) != 2 || quarantined[0].TxIndex != 0 || quarantined[0].Action != 0 || quarantined[1].TxIndex != 2 || quarantined[1].Action != 1 || quarantined[1].Raw != "0101" {
+		t.Fatalf("quarantined entries = %+v, want the broken witness and the truncated define", quarantined)
+	}
+	var defines []DefineCotaNftKvPair
+	if err := s.data.db.Find(&defines).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(defines) != 1 {
+		t.Errorf("defines = %+v, want the valid define synced", defines)
+	}
+
+	if err := s.syncer.Rollback(ctx, fixture.BlockNumber); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	if err := s.data.db.Model(QuarantinedEntry{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("%d quarantined entries after the rollback, want 0", count)
+	}
+}
+
+func Test_malformedEntry(t *testing.T) {
+	err := malformedEntry("define entries has %d keys and %d values", 1, 2)
+	if !errors.Is(err, biz.ErrMalformedEntry) {
+		t.Errorf("errors.Is(%v, ErrMalformedEntry) = false", err)
+	}
+	var malformed biz.MalformedEntryError
+	if !errors.As(err, &malformed) || malformed.Reason != "define entries has 1 keys and 2 values" {
+		t.Errorf("errors.As(%v) = %+v", err, malformed)
+	}
+}
+
+func TestQuarantinedEntryRepo_FindQuarantinedEntries(t *testing.T) {
+	ctx := context.Background()
+	fixture, tx, previous := loadGoldenFixture(t, filepath.Join("testdata", "golden", "define_v2.json"))
+	s := newFixtureSyncer(t, "requeue", fixture.Chain, previous)
+	repo := NewQuarantinedEntryRepo(s.data, nil)
+
+	brokenWitness := *tx
+	brokenWitness.Witnesses = [][]byte{{0x01, 0x02}}
+	block := &ckbTypes.Block{
+		Header:       &ckbTypes.Header{Number: fixture.BlockNumber, Hash: ckbTypes.HexToHash(fmt.Sprintf("%x", fixture.BlockNumber))},
+		Transactions: []*ckbTypes.Transaction{&brokenWitness, witnessTx(tx, []byte{0x01, 0x01})},
+	}
+	checkInfo := biz.CheckInfo{BlockNumber: fixture.BlockNumber, BlockHash: block.Header.Hash.String()[2:], CheckType: biz.SyncBlock}
+	if err := s.syncer.Sync(ctx, block, checkInfo, s.systemScripts); err != nil {
+		t.Fatal(err)
+	}
+	if stale, err := repo.FindQuarantinedEntries(ctx, biz.ParserVersion); err != nil || len(stale) != 0 {
+		t.Fatalf("entries of an older parser = %+v, %v, want none", stale, err)
+	}
+	quarantined, err := repo.FindQuarantinedEntries(ctx, biz.ParserVersion+1)
+	if err != nil || len(quarantined) != 2 || !quarantined[0].IsTx() || quarantined[1].IsTx() || quarantined[1].ParserVersion != biz.ParserVersion {
+		t.Fatalf("quarantined entries = %+v, %v, want the broken witness and the truncated define", quarantined, err)
+	}
+}
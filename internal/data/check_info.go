@@ -42,7 +42,7 @@ func (rp checkInfoRepo) FindLastCheckInfo(ctx context.Context, info *biz.CheckIn
 }
 
 func (rp checkInfoRepo) CreateCheckInfo(ctx context.Context, info *biz.CheckInfo) error {
-	if err := rp.data.db.WithContext(ctx).Create(CheckInfo{
+	if err := rp.data.db.WithContext(ctx).Create(&CheckInfo{
 		BlockNumber: info.BlockNumber,
 		BlockHash:   info.BlockHash,
 		CheckType:   info.CheckType,
@@ -24,6 +24,8 @@ type ClaimedCotaNftKvPair struct {
 	OutPointCrc uint32
 	LockHash    string
 	LockHashCrc uint32
+	TxHash      string
+	TxIndex     uint32
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 }
@@ -62,12 +64,18 @@ func (rp claimedCotaNftKvPairRepo) ParseClaimedCotaEntries(blockNumber uint64, e
 	)
 
 	if entry.Version == 0 {
-		entries := smt.ClaimCotaNFTEntriesFromSliceUnchecked(entry.InputType[1:])
+		var entries *smt.ClaimCotaNFTEntries
+		if entries, err = decodeMolecule("claim entries", entry.InputType[1:], smt.ClaimCotaNFTEntriesFromSlice); err != nil {
+			return
+		}
 		holdCotaKeyVec = entries.HoldKeys()
 		holdCotaValueVec = entries.HoldValues()
 		claimedCotaKeyVec = entries.ClaimKeys()
 	} else {
-		entries := smt.ClaimCotaNFTV2EntriesFromSliceUnchecked(entry.InputType[1:])
+		var entries *smt.ClaimCotaNFTV2Entries
+		if entries, err = decodeMolecule("claim entries", entry.InputType[1:], smt.ClaimCotaNFTV2EntriesFromSlice); err != nil {
+			return
+		}
 		holdCotaKeyVec = entries.HoldKeys()
 		holdCotaValueVec = entries.HoldValues()
 		claimedCotaKeyVec = entries.ClaimKeys()
@@ -78,6 +86,9 @@ func (rp claimedCotaNftKvPairRepo) ParseClaimedCotaEntries(blockNumber uint64, e
 	}
 	lockHashStr := lockHash.String()[2:]
 	lockHashCRC32 := crc32.ChecksumIEEE([]byte(lockHashStr))
+	if err = checkPairs("hold entries", holdCotaKeyVec.Len(), holdCotaValueVec.Len()); err != nil {
+		return
+	}
 	for i := uint(0); i < holdCotaKeyVec.Len(); i++ {
 		key := holdCotaKeyVec.Get(i)
 		value := holdCotaValueVec.Get(i)
@@ -90,6 +101,7 @@ func (rp claimedCotaNftKvPairRepo) ParseClaimedCotaEntries(blockNumber uint64, e
 			Characteristic: hex.EncodeToString(value.Characteristic().RawData()),
 			LockHash:       lockHashStr,
 			LockHashCRC:    lockHashCRC32,
+			TxIndex:        entry.TxIndex,
 		})
 	}
 	for i := uint(0); i < claimedCotaKeyVec.Len(); i++ {
@@ -105,6 +117,8 @@ func (rp claimedCotaNftKvPairRepo) ParseClaimedCotaEntries(blockNumber uint64, e
 			OutPointCrc: crc32.ChecksumIEEE([]byte(outpointStr)),
 			LockHash:    lockHashStr,
 			LockHashCrc: lockHashCRC32,
+			TxHash:      entry.TxHash.String()[2:],
+			TxIndex:     entry.TxIndex,
 		})
 	}
 	return
@@ -117,12 +131,18 @@ func (rp claimedCotaNftKvPairRepo) ParseClaimedUpdateCotaEntries(blockNumber uin
 		claimedCotaKeyVec *smt.ClaimCotaNFTKeyVec
 	)
 	if entry.Version == 0 {
-		entries := smt.ClaimUpdateCotaNFTEntriesFromSliceUnchecked(entry.InputType[1:])
+		var entries *smt.ClaimUpdateCotaNFTEntries
+		if entries, err = decodeMolecule("claim update entries", entry.InputType[1:], smt.ClaimUpdateCotaNFTEntriesFromSlice); err != nil {
+			return
+		}
 		holdCotaKeyVec = entries.HoldKeys()
 		holdCotaValueVec = entries.HoldValues()
 		claimedCotaKeyVec = entries.ClaimKeys()
 	} else {
-		entries := smt.ClaimUpdateCotaNFTV2EntriesFromSliceUnchecked(entry.InputType[1:])
+		var entries *smt.ClaimUpdateCotaNFTV2Entries
+		if entries, err = decodeMolecule("claim update entries", entry.InputType[1:], smt.ClaimUpdateCotaNFTV2EntriesFromSlice); err != nil {
+			return
+		}
 		holdCotaKeyVec = entries.HoldKeys()
 		holdCotaValueVec = entries.HoldValues()
 		claimedCotaKeyVec = entries.ClaimKeys()
@@ -134,6 +154,9 @@ func (rp claimedCotaNftKvPairRepo) ParseClaimedUpdateCotaEntries(blockNumber uin
 	}
 	lockHashStr := lockHash.String()[2:]
 	lockHashCRC32 := crc32.ChecksumIEEE([]byte(lockHashStr))
+	if err = checkPairs("hold entries", holdCotaKeyVec.Len(), holdCotaValueVec.Len()); err != nil {
+		return
+	}
 	for i := uint(0); i < holdCotaKeyVec.Len(); i++ {
 		key := holdCotaKeyVec.Get(i)
 		value := holdCotaValueVec.Get(i)
@@ -146,6 +169,7 @@ func (rp claimedCotaNftKvPairRepo) ParseClaimedUpdateCotaEntries(blockNumber uin
 			Characteristic: hex.EncodeToString(value.Characteristic().RawData()),
 			LockHash:       lockHashStr,
 			LockHashCRC:    lockHashCRC32,
+			TxIndex:        entry.TxIndex,
 		})
 	}
 	for i := uint(0); i < claimedCotaKeyVec.Len(); i++ {
@@ -161,6 +185,8 @@ func (rp claimedCotaNftKvPairRepo) ParseClaimedUpdateCotaEntries(blockNumber uin
 			OutPointCrc: crc32.ChecksumIEEE([]byte(outpointStr)),
 			LockHash:    lockHashStr,
 			LockHashCrc: lockHashCRC32,
+			TxHash:      entry.TxHash.String()[2:],
+			TxIndex:     entry.TxIndex,
 		})
 	}
 	return
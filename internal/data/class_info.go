@@ -19,13 +19,15 @@ var ErrInvalidClassInfo = errors.New("class info is invalid")
 const CotaIdLen = 42
 
 type TokenClassAudio struct {
-	ID        uint `gorm:"primaryKey"`
-	Url       string
-	Name      string
-	CotaId    string
-	Idx       uint32
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID            uint `gorm:"primaryKey"`
+	Url           string
+	UrlNormalized string
+	UrlRef        string
+	Name          string
+	CotaId        string
+	Idx           uint32
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
 }
 
 type ClassInfo struct {
@@ -43,8 +45,17 @@ type ClassInfo struct {
 	Characteristic string
 	Properties     string
 	Localization   string
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
+	// the media urls normalized by MediaNormalizer, derived from the raw urls above
+	ImageNormalized string
+	ImageRef        string
+	AudioNormalized string
+	AudioRef        string
+	VideoNormalized string
+	VideoRef        string
+	ModelNormalized string
+	ModelRef        string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
 }
 
 type ClassInfoVersion struct {
@@ -113,6 +124,7 @@ func (repo classInfoRepo) ParseClassInfo(blockNumber uint64, txIndex uint32, cla
 	var classInfo biz.ClassInfoJson
 	err = mapstructure.Decode(classMeta, &classInfo)
 	if err != nil {
+		err = malformedEntry("class info: %v", err)
 		return
 	}
 	characteristic, err := json.Marshal(classInfo.Characteristic)
@@ -0,0 +1,250 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+	ckbTypes "github.com/nervosnetwork/ckb-sdk-go/types"
+	"gorm.io/gorm"
+)
+
+var _ biz.CotaEventRepo = (*cotaEventRepo)(nil)
+
+type CotaEvent struct {
+	ID                   uint `gorm:"primaryKey"`
+	BlockNumber          uint64
+	TxIndex              uint32
+	TxHash               string
+	Source               biz.CheckType
+	EventType            string
+	LockHash             string
+	CounterpartyLockHash string
+	CotaId               string
+	TokenIndex           *uint32
+	EntryIndex           uint32
+	EventIndex           uint32
+	ActionCode           uint8
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+}
+
+type cotaEventRepo struct {
+	data   *Data
+	logger *logger.Logger
+}
+
+func NewCotaEventRepo(data *Data, logger *logger.Logger) biz.CotaEventRepo {
+	return &cotaEventRepo{
+		data:   data,
+		logger: logger,
+	}
+}
+
+func (rp cotaEventRepo) FindAccountEvents(ctx context.Context, lockHash string, cursor *biz.CotaEventCursor, limit int) ([]biz.CotaEvent, error) {
+	var events []CotaEvent
+	db := rp.data.db.WithContext(ctx).Where("lock_hash = ? or counterparty_lock_hash = ?", lockHash, lockHash)
+	if cursor != nil {
+		db = db.Where("block_number < ? or (block_number = ? and tx_index < ?) or (block_number = ? and tx_index = ? and id < ?)",
+			cursor.BlockNumber, cursor.BlockNumber, cursor.TxIndex, cursor.BlockNumber, cursor.TxIndex, cursor.Id)
+	}
+	if err := db.Order("block_number desc, tx_index desc, id desc").Limit(limit).Find(&events).Error; err != nil {
+		return nil, err
+	}
+	result := make([]biz.CotaEvent, len(events))
+	for i, event := range events {
+		result[i] = event.toBiz()
+	}
+	return result, nil
+}
+
+func createCotaEvents(ctx context.Context, tx *gorm.DB, events []biz.CotaEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	cotaEvents := make([]CotaEvent, len(events))
+	for i, event := range events {
+		cotaEvents[i] = CotaEvent{
+			BlockNumber:          event.BlockNumber,
+			TxIndex:              event.TxIndex,
+			TxHash:               event.TxHash,
+			Source:               event.Source,
+			EventType:            string(event.EventType),
+			LockHash:             event.LockHash,
+			CounterpartyLockHash: event.CounterpartyLockHash,
+			CotaId:               event.CotaId,
+			TokenIndex:           event.TokenIndex,
+			EntryIndex:           event.EntryIndex,
+			EventIndex:           event.EventIndex,
+			ActionCode:           event.ActionCode,
+		}
+	}
+	if err := tx.Model(CotaEvent{}).WithContext(ctx).Create(&cotaEvents).Error; err != nil {
+		return err
+	}
+	return createOutboxEvents(ctx, tx, biz.OutboxApplied, events)
+}
+
+// deleteCotaEvents removes the events of a rolled back block and records a reverted outbox row for
+// each of them a consumer may have received, newest first, so that consumers can compensate it.
+func deleteCotaEvents(ctx context.Context, tx *gorm.DB, blockNumber uint64, source biz.CheckType) error {
+	var cotaEvents []CotaEvent
+	if err := tx.WithContext(ctx).Where("block_number = ? and source = ?", blockNumber, source).Order("tx_index desc, entry_index desc, event_index desc").Find(&cotaEvents).Error; err != nil {
+		return err
+	}
+	if len(cotaEvents) == 0 {
+		return nil
+	}
+	events := make([]biz.CotaEvent, len(cotaEvents))
+	for i, event := range cotaEvents {
+		events[i] = event.toBiz()
+	}
+	if err := revertOutboxEvents(ctx, tx, blockNumber, events); err != nil {
+		return err
+	}
+	return tx.WithContext(ctx).Where("block_number = ? and source = ?", blockNumber, source).Delete(CotaEvent{}).Error
+}
+
+func (e CotaEvent) toBiz() biz.CotaEvent {
+	return biz.CotaEvent{
+		Id:                   uint64(e.ID),
+		BlockNumber:          e.BlockNumber,
+		TxIndex:              e.TxIndex,
+		TxHash:               e.TxHash,
+		Source:               e.Source,
+		EventType:            biz.CotaEventType(e.EventType),
+		LockHash:             e.LockHash,
+		CounterpartyLockHash: e.CounterpartyLockHash,
+		CotaId:               e.CotaId,
+		TokenIndex:           e.TokenIndex,
+		EntryIndex:           e.EntryIndex,
+		EventIndex:           e.EventIndex,
+		ActionCode:           e.ActionCode,
+	}
+}
+
+// entryEvents stamps the position of the events in the chain: the block, the transaction, the
+// cota entry within the transaction and the event within the entry.
+func entryEvents(blockNumber uint64, entry biz.Entry, source biz.CheckType, actionCode uint8, events []biz.CotaEvent) []biz.CotaEvent {
+	for i := range events {
+		events[i].BlockNumber = blockNumber
+		events[i].TxIndex = entry.TxIndex
+		events[i].TxHash = entry.TxHash.String()[2:]
+		events[i].EntryIndex = entry.EntryIndex
+		events[i].EventIndex = uint32(i)
+		events[i].ActionCode = actionCode
+		events[i].Source = source
+	}
+	return events
+}
+
+func registerEvents(blockNumber uint64, txIndex uint32, txHash ckbTypes.Hash, registers []biz.RegisterCotaKvPair) []biz.CotaEvent {
+	events := make([]biz.CotaEvent, len(registers))
+	for i, register := range registers {
+		events[i] = biz.CotaEvent{EventType: biz.CotaEventRegister, LockHash: register.LockHash}
+	}
+	return entryEvents(blockNumber, biz.Entry{TxIndex: txIndex, TxHash: txHash}, biz.SyncBlock, 0, events)
+}
+
+func defineEvents(defines []biz.DefineCotaNftKvPair) []biz.CotaEvent {
+	events := make([]biz.CotaEvent, len(defines))
+	for i, define := range defines {
+		events[i] = biz.CotaEvent{
+			EventType: biz.CotaEventDefine,
+			LockHash:  define.LockHash,
+			CotaId:    define.CotaId,
+		}
+	}
+	return events
+}
+
+func withdrawEvents(eventType biz.CotaEventType, withdrawals []biz.WithdrawCotaNftKvPair) []biz.CotaEvent {
+	events := make([]biz.CotaEvent, len(withdrawals))
+	for i, withdrawal := range withdrawals {
+		tokenIndex := withdrawal.TokenIndex
+		events[i] = biz.CotaEvent{
+			EventType:            eventType,
+			LockHash:             withdrawal.LockHash,
+			CounterpartyLockHash: withdrawal.ReceiverLockHash,
+			CotaId:               withdrawal.CotaId,
+			TokenIndex:           &tokenIndex,
+		}
+	}
+	return events
+}
+
+func claimEvents(claims []biz.ClaimedCotaNftKvPair) []biz.CotaEvent {
+	events := make([]biz.CotaEvent, len(claims))
+	for i, claim := range claims {
+		tokenIndex := claim.TokenIndex
+		events[i] = biz.CotaEvent{
+			EventType:  biz.CotaEventClaim,
+			LockHash:   claim.LockHash,
+			CotaId:     claim.CotaId,
+			TokenIndex: &tokenIndex,
+		}
+	}
+	return events
+}
+
+// fillClaimCounterparties sets the counterparty of each claim event to the sender of the withdrawal it
+// claims, the lock hash of the withdraw row with the cota id, token index and out point of the claim.
+// It runs after the rows of the block are written, so a withdrawal earlier in the block is found. A
+// withdrawal synced before the start height has no row and leaves the counterparty empty.
+func fillClaimCounterparties(ctx context.Context, tx *gorm.DB, events []biz.CotaEvent, claims []biz.ClaimedCotaNftKvPair) error {
+	if len(claims) == 0 {
+		return nil
+	}
+	claimKey := func(txIndex uint32, cotaId string, tokenIndex uint32) string {
+		return fmt.Sprintf("%d/%s/%d", txIndex, cotaId, tokenIndex)
+	}
+	withdrawalKey := func(cotaId string, tokenIndex uint32, outPoint string) string {
+		return fmt.Sprintf("%s/%d/%s", cotaId, tokenIndex, outPoint)
+	}
+	outPoints := make(map[string]string, len(claims))
+	outPointCrcs := make([]uint32, 0, len(claims))
+	for _, claim := range claims {
+		outPoints[claimKey(claim.TxIndex, claim.CotaId, claim.TokenIndex)] = withdrawalKey(claim.CotaId, claim.TokenIndex, claim.OutPoint)
+		outPointCrcs = append(outPointCrcs, claim.OutPointCrc)
+	}
+	var withdrawals []WithdrawCotaNftKvPair
+	if err := tx.WithContext(ctx).Select("cota_id, token_index, out_point, lock_hash").Where("out_point_crc in ?", outPointCrcs).
+		Find(&withdrawals).Error; err != nil {
+		return err
+	}
+	senders := make(map[string]string, len(withdrawals))
+	for _, withdrawal := range withdrawals {
+		senders[withdrawalKey(withdrawal.CotaId, withdrawal.TokenIndex, withdrawal.OutPoint)] = withdrawal.LockHash
+	}
+	for i, event := range events {
+		if event.EventType != biz.CotaEventClaim || event.TokenIndex == nil {
+			continue
+		}
+		events[i].CounterpartyLockHash = senders[outPoints[claimKey(event.TxIndex, event.CotaId, *event.TokenIndex)]]
+	}
+	return nil
+}
+
+func updateEvents(holds []biz.HoldCotaNftKvPair) []biz.CotaEvent {
+	events := make([]biz.CotaEvent, len(holds))
+	for i, hold := range holds {
+		tokenIndex := hold.TokenIndex
+		events[i] = biz.CotaEvent{
+			EventType:  biz.CotaEventUpdate,
+			LockHash:   hold.LockHash,
+			CotaId:     hold.CotaId,
+			TokenIndex: &tokenIndex,
+		}
+	}
+	return events
+}
+
+func extensionEvents(entry biz.Entry) ([]biz.CotaEvent, error) {
+	lockHash, _, err := GenerateLockHash(entry)
+	if err != nil {
+		return nil, err
+	}
+	return []biz.CotaEvent{{EventType: biz.CotaEventExtension, LockHash: lockHash}}, nil
+}
@@ -0,0 +1,71 @@
+package data
+
+import (
+	"context"
+	"hash/crc32"
+	"testing"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+)
+
+func TestKvPairRepo_claimCounterparties(t *testing.T) {
+	ctx := context.Background()
+	data := newTestData(t, DriverSqlite, "file:claim_counterparties?mode=memory&cache=shared")
+	kvPairs := newTestKvPairRepo(data)
+	claimOf := func(withdrawal biz.WithdrawCotaNftKvPair, block uint64, txIndex uint32, lockHash string) biz.ClaimedCotaNftKvPair {
+		claim := testClaimed(block, txIndex, withdrawal.TokenIndex, lockHash)
+		claim.OutPoint, claim.OutPointCrc = withdrawal.OutPoint, withdrawal.OutPointCrc
+		return claim
+	}
+	claimEvent := func(claim biz.ClaimedCotaNftKvPair) biz.CotaEvent {
+		event := testEvent(claim.BlockNumber, claim.TxIndex, biz.CotaEventClaim, claim.LockHash)
+		event.TokenIndex = &claim.TokenIndex
+		return event
+	}
+	earlier := testWithdraw(101, 1, 0, lockA, lockB)
+	sameBlock := testWithdraw(103, 1, 1, lockA, lockC)
+	claimed, claimedInBlock := claimOf(earlier, 102, 2, lockB), claimOf(sameBlock, 103, 2, lockC)
+	// the withdrawal was synced before the start height
+	unknown := testClaimed(103, 3, 2, lockB)
+	unknown.OutPoint = "ffffffffffffffff"
+	unknown.OutPointCrc = crc32.ChecksumIEEE([]byte(unknown.OutPoint))
+	for _, block := range []struct {
+		number uint64
+		kvPair biz.KvPair
+	}{
+		{100, biz.KvPair{
+			Registers:   []biz.RegisterCotaKvPair{{BlockNumber: 100, LockHash: lockA, CotaCellID: 1}},
+			DefineCotas: []biz.DefineCotaNftKvPair{testDefine(100, 0, 0)},
+		}},
+		{101, biz.KvPair{WithdrawCotas: []biz.WithdrawCotaNftKvPair{earlier}}},
+		{102, biz.KvPair{
+			HoldCotas:    []biz.HoldCotaNftKvPair{testHold(102, 2, 0, lockB, "00")},
+			ClaimedCotas: []biz.ClaimedCotaNftKvPair{claimed},
+			Events:       []biz.CotaEvent{claimEvent(claimed)},
+		}},
+		{103, biz.KvPair{
+			WithdrawCotas: []biz.WithdrawCotaNftKvPair{sameBlock},
+			HoldCotas:     []biz.HoldCotaNftKvPair{testHold(103, 2, 1, lockC, "00"), testHold(103, 3, 2, lockB, "00")},
+			ClaimedCotas:  []biz.ClaimedCotaNftKvPair{claimedInBlock, unknown},
+			Events:        []biz.CotaEvent{claimEvent(claimedInBlock), claimEvent(unknown)},
+		}},
+	} {
+		if err := kvPairs.CreateCotaEntryKvPairs(ctx, biz.CheckInfo{BlockNumber: block.number, BlockHash: "h", CheckType: biz.SyncBlock}, &block.kvPair); err != nil {
+			t.Fatalf("create block %d: %v", block.number, err)
+		}
+	}
+
+	var events []CotaEvent
+	if err := data.db.Where("event_type = ?", biz.CotaEventClaim).Order("block_number, tx_index").Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := []string{lockA, lockA, ""}
+	if len(events) != len(want) {
+		t.Fatalf("claim events = %+v, want %d", events, len(want))
+	}
+	for i, event := range events {
+		if event.CounterpartyLockHash != want[i] {
+			t.Errorf("counterparty of the claim in tx %d of block %d = %q, want %q", event.TxIndex, event.BlockNumber, event.CounterpartyLockHash, want[i])
+		}
+	}
+}
@@ -2,6 +2,7 @@ package data
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/nervina-labs/cota-syncer/internal/biz"
 	"github.com/nervina-labs/cota-syncer/internal/data/blockchain"
@@ -52,7 +53,13 @@ func (c CotaWitnessArgsParser) cotaEntries(tx *ckbTypes.Transaction, txIndex uin
 	var cotaCellsIndex int
 	for typeHash, inputCotas := range inputCotaCellGroups {
 		outputGroupCotaCells := outputCotaCellGroups[typeHash]
+		if len(outputGroupCotaCells) == 0 {
+			return nil, malformedEntry("cota cell %s has no output", typeHash)
+		}
 		firstCotaAtOutputGroup := outputGroupCotaCells[0]
+		if len(firstCotaAtOutputGroup.outputData) == 0 {
+			return nil, malformedEntry("cota cell %s has no output data", typeHash)
+		}
 		firstCotaAtInputGroup := inputCotas[0]
 
 		cotaCells[cotaCellsIndex] = cotaCell{
@@ -67,11 +74,17 @@ func (c CotaWitnessArgsParser) cotaEntries(tx *ckbTypes.Transaction, txIndex uin
 	var entries []biz.Entry
 	extraWitnessesLen := len(tx.Witnesses) - len(tx.Inputs)
 	for groupIndex, cotaCell := range cotaCells {
+		if cotaCell.index >= len(tx.Witnesses) {
+			return nil, malformedEntry("cota cell input %d has no witness", cotaCell.index)
+		}
 		witness := tx.Witnesses[cotaCell.index]
 		if len(witness) == 0 {
 			continue
 		}
-		witnessArgs := blockchain.WitnessArgsFromSliceUnchecked(witness)
+		witnessArgs, err := decodeMolecule("witness args", witness, blockchain.WitnessArgsFromSlice)
+		if err != nil {
+			return nil, err
+		}
 		if witnessArgs.OutputType().IsSome() {
 			outputType, err := witnessArgs.OutputType().IntoBytes()
 			if err != nil {
@@ -81,6 +94,7 @@ func (c CotaWitnessArgsParser) cotaEntries(tx *ckbTypes.Transaction, txIndex uin
 				OutputType: outputType.RawData(),
 				LockScript: cotaCell.output.Lock,
 				TxIndex:    txIndex,
+				EntryIndex: uint32(len(entries)),
 				Version:    cotaCell.outputData[0],
 				TxHash:     tx.Hash,
 			})
@@ -95,6 +109,7 @@ func (c CotaWitnessArgsParser) cotaEntries(tx *ckbTypes.Transaction, txIndex uin
 				InputType:  inputType.RawData(),
 				LockScript: cotaCell.output.Lock,
 				TxIndex:    txIndex,
+				EntryIndex: uint32(len(entries)),
 				Version:    cotaCell.outputData[0],
 				TxHash:     tx.Hash,
 			})
@@ -104,6 +119,7 @@ func (c CotaWitnessArgsParser) cotaEntries(tx *ckbTypes.Transaction, txIndex uin
 			entries = append(entries, biz.Entry{
 				LockScript:   cotaCell.output.Lock,
 				TxIndex:      txIndex,
+				EntryIndex:   uint32(len(entries)),
 				Version:      cotaCell.outputData[0],
 				TxHash:       tx.Hash,
 				ExtraWitness: tx.Witnesses[len(tx.Inputs)+groupIndex],
@@ -149,6 +165,13 @@ func (c CotaWitnessArgsParser) inputCotaCells(inputs []*ckbTypes.CellInput, cota
 		if err != nil {
 			return nil, err
 		}
+		// the client decodes the null of an unknown transaction into zero values
+		if prevTx == nil || prevTx.Transaction == nil {
+			return nil, fmt.Errorf("previous transaction %s not found", prevOutpoint.TxHash)
+		}
+		if prevOutpoint.Index >= uint(len(prevTx.Transaction.Outputs)) {
+			return nil, malformedEntry("input %d spends output %d of %s which has %d outputs", i, prevOutpoint.Index, prevOutpoint.TxHash, len(prevTx.Transaction.Outputs))
+		}
 		prevCellOutput := prevTx.Transaction.Outputs[prevOutpoint.Index]
 		if c.isCotaCell(prevCellOutput, cotaType) {
 			cotaCells = append(cotaCells, cotaCell{
@@ -164,6 +187,9 @@ func (c CotaWitnessArgsParser) outputCotaCells(outputs []*ckbTypes.CellOutput, o
 	var cotaCells []cotaCell
 	for i := 0; i < len(outputs); i++ {
 		if c.isCotaCell(outputs[i], cotaType) {
+			if i >= len(outputsData) {
+				return nil, malformedEntry("cota cell output %d has no output data", i)
+			}
 			cotaCells = append(cotaCells, cotaCell{
 				output:     outputs[i],
 				index:      i,
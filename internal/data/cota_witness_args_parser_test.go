@@ -0,0 +1,69 @@
+package data
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+)
+
+// FuzzCotaWitnessArgsParser replaces the witness and the cota cell data of a fixture and parses the
+// transaction like the block syncer. Malformed input ends in ErrMalformedEntry or in quarantined entries.
+func FuzzCotaWitnessArgsParser(f *testing.F) {
+	fixture, tx, previous := loadGoldenFixture(f, filepath.Join("testdata", "golden", "mint_v2.json"))
+	for _, witness := range goldenWitnesses(f) {
+		for _, version := range []byte{0, 1, 2} {
+			f.Add(witness, []byte{version})
+		}
+	}
+	f.Add([]byte{}, []byte{})
+	s := newFixtureSyncer(f, "fuzz_witness_args", fixture.Chain, previous)
+
+	f.Fuzz(func(t *testing.T, witness, outputData []byte) {
+		fuzzed := *tx
+		fuzzed.Witnesses = [][]byte{witness}
+		fuzzed.OutputsData = [][]byte{outputData}
+		entries, err := s.parser.Parse(&fuzzed, fixture.TxIndex, s.systemScripts.CotaType)
+		if err != nil {
+			if !errors.Is(err, biz.ErrMalformedEntry) {
+				t.Fatalf("parse the witness args: %v, want a malformed entry", err)
+			}
+			return
+		}
+		kvPair, err := s.syncer.parseCotaEntries(fixture.BlockNumber, entries)
+		if err != nil {
+			t.Fatalf("parse the entries: %v, want the malformed ones quarantined", err)
+		}
+		for _, quarantined := range kvPair.Quarantines {
+			if quarantined.Source != biz.SyncBlock || quarantined.Reason == "" {
+				t.Errorf("quarantined entry = %+v", quarantined)
+			}
+		}
+	})
+}
+
+func TestCotaWitnessArgsParser_malformed(t *testing.T) {
+	fixture, tx, previous := loadGoldenFixture(t, filepath.Join("testdata", "golden", "mint_v2.json"))
+	s := newFixtureSyncer(t, "malformed_witness_args", fixture.Chain, previous)
+	tests := []struct {
+		name        string
+		witnesses   [][]byte
+		outputsData [][]byte
+	}{
+		{name: "no witness for the cota input", witnesses: [][]byte{}, outputsData: tx.OutputsData},
+		{name: "witness is not witness args", witnesses: [][]byte{{0x10, 0, 0, 0, 0x10}}, outputsData: tx.OutputsData},
+		{name: "no cota cell data", witnesses: tx.Witnesses, outputsData: [][]byte{}},
+		{name: "empty cota cell data", witnesses: tx.Witnesses, outputsData: [][]byte{{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			malformed := *tx
+			malformed.Witnesses = tt.witnesses
+			malformed.OutputsData = tt.outputsData
+			if _, err := s.parser.Parse(&malformed, fixture.TxIndex, s.systemScripts.CotaType); !errors.Is(err, biz.ErrMalformedEntry) {
+				t.Errorf("Parse() error = %v, want a malformed entry", err)
+			}
+		})
+	}
+}
@@ -4,17 +4,16 @@ import (
 	"context"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"os"
 
 	"github.com/golang-migrate/migrate/v4"
-	mMsql "github.com/golang-migrate/migrate/v4/database/mysql"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/google/wire"
 	"github.com/nervina-labs/cota-syncer/internal/config"
 	"github.com/nervina-labs/cota-syncer/internal/logger"
 	"github.com/nervosnetwork/ckb-sdk-go/rpc"
 	ckbTypes "github.com/nervosnetwork/ckb-sdk-go/types"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
@@ -23,10 +22,15 @@ var ProviderSet = wire.NewSet(NewData, NewDBMigration, NewCheckInfoRepo, NewRegi
 	NewDefineCotaNftKvPairRepo, NewHoldCotaNftKvPairRepo, NewWithdrawCotaNftKvPairRepo, NewClaimedCotaNftKvPairRepo,
 	NewKvPairRepo, NewSystemScripts, NewCkbNodeClient, NewBlockSyncer, NewMetadataSyncer, NewCotaWitnessArgsParser,
 	NewMintCotaKvPairRepo, NewTransferCotaKvPairRepo, NewIssuerInfoRepo, NewClassInfoRepo, NewJoyIDInfoRepo, NewInvalidDateRepo,
-	NewWithdrawExtraInfoRepo, NewExtensionKvPairRepo, NewRegisterLockScriptRepo, NewSubKeyKvPairRepo, NewSocialKvPairRepo)
+	NewWithdrawExtraInfoRepo, NewExtensionKvPairRepo, NewRegisterLockScriptRepo, NewSubKeyKvPairRepo, NewSocialKvPairRepo,
+	NewTokenTimelineRepo, NewCotaEventRepo, NewEventOutboxRepo, NewEventSink, NewQuarantinedEntryRepo, NewSnapshotRepo, NewVersionRetentionRepo, NewMetadataHandlers, NewMetadataRegistry,
+	NewLocalizationRepo, NewLocalizationFetcher, NewMediaNormalizer, NewMediaRepo, NewMetadataHistoryRepo, NewTraitRepo, NewMetadataSearchRepo, NewJoyIDDeviceRepo, NewSocialRecoveryRepo)
 
 type Data struct {
-	db *gorm.DB
+	db     *gorm.DB
+	driver string
+	// scripts caches the ids of the lock scripts
+	scripts scriptCache
 }
 
 type Option func(*Data)
@@ -37,9 +41,13 @@ func NewData(conf *config.Database, logger *logger.Logger) (*Data, func(), error
 	if dsn == "" {
 		dsn = conf.Dsn
 	}
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	dialector, err := openDialector(conf.Driver, dsn)
 	if err != nil {
-		logger.Errorf(context.TODO(), "failed opening connection to mysql: %v", err)
+		return nil, nil, err
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		logger.Errorf(context.TODO(), "failed opening connection to %s: %v", conf.Driver, err)
 		return nil, nil, err
 	}
 	sqlDB, err := db.DB()
@@ -47,12 +55,20 @@ func NewData(conf *config.Database, logger *logger.Logger) (*Data, func(), error
 		logger.Errorf(context.TODO(), "failed get sql db: %v", err)
 		return nil, nil, err
 	}
-	sqlDB.SetMaxIdleConns(conf.MaxIdleConns)
-	sqlDB.SetMaxOpenConns(conf.MaxOpenConns)
-	sqlDB.SetConnMaxLifetime(conf.ConnMaxLifeTime)
+	if conf.Driver == DriverSqlite {
+		// sqlite has a single writer, and an in-memory database lives as long as its connection
+		sqlDB.SetMaxIdleConns(1)
+		sqlDB.SetMaxOpenConns(1)
+		sqlDB.SetConnMaxLifetime(0)
+	} else {
+		sqlDB.SetMaxIdleConns(conf.MaxIdleConns)
+		sqlDB.SetMaxOpenConns(conf.MaxOpenConns)
+		sqlDB.SetConnMaxLifetime(conf.ConnMaxLifeTime)
+	}
 
 	return &Data{
-			db: db,
+			db:     db,
+			driver: conf.Driver,
 		}, func() {
 			if err := sqlDB.Close(); err != nil {
 				logger.Error(context.TODO(), err)
@@ -84,21 +100,13 @@ func NewCkbNodeClient(conf *config.CkbNode, logger *logger.Logger) (*CkbNodeClie
 }
 
 type DBMigration struct {
-	data   *Data
-	logger *logger.Logger
+	data      *Data
+	logger    *logger.Logger
+	sourceDir string
 }
 
 func (m *DBMigration) Up() error {
-	sqlDB, err := m.data.db.DB()
-	if err != nil {
-		m.logger.Errorf(context.TODO(), "failed get sql db: %v", err)
-		return err
-	}
-	driver, err := mMsql.WithInstance(sqlDB, &mMsql.Config{})
-	if err != nil {
-		return err
-	}
-	migration, err := migrate.NewWithDatabaseInstance("file://./internal/db/migrations", m.data.db.Migrator().CurrentDatabase(), driver)
+	migration, err := m.migrate()
 	if err != nil {
 		return err
 	}
@@ -110,6 +118,38 @@ func (m *DBMigration) Up() error {
 	return nil
 }
 
+// Version returns the version of the last migration applied, 0 before the first one
+func (m *DBMigration) Version() (uint, error) {
+	migration, err := m.migrate()
+	if err != nil {
+		return 0, err
+	}
+	version, dirty, err := migration.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, fmt.Errorf("migration %d is dirty", version)
+	}
+	return version, nil
+}
+
+func (m *DBMigration) migrate() (*migrate.Migrate, error) {
+	sqlDB, err := m.data.db.DB()
+	if err != nil {
+		m.logger.Errorf(context.TODO(), "failed get sql db: %v", err)
+		return nil, err
+	}
+	driver, dir, err := migrationDriver(m.data.driver, sqlDB)
+	if err != nil {
+		return nil, err
+	}
+	return migrate.NewWithDatabaseInstance("file://"+m.sourceDir+dir, m.data.db.Migrator().CurrentDatabase(), driver)
+}
+
 type SystemScriptOption func(o *SystemScripts)
 
 type SystemScript struct {
@@ -192,11 +232,11 @@ func (m *DBMigration) Down() error {
 		m.logger.Errorf(context.TODO(), "failed get sql db: %v", err)
 		return err
 	}
-	driver, err := mMsql.WithInstance(sqlDB, &mMsql.Config{})
+	driver, dir, err := migrationDriver(m.data.driver, sqlDB)
 	if err != nil {
 		return err
 	}
-	migration, err := migrate.NewWithDatabaseInstance("file://../db/migrations", m.data.db.Migrator().CurrentDatabase(), driver)
+	migration, err := migrate.NewWithDatabaseInstance("file://../db/"+dir, m.data.db.Migrator().CurrentDatabase(), driver)
 	if err != nil {
 		return err
 	}
@@ -205,7 +245,8 @@ func (m *DBMigration) Down() error {
 
 func NewDBMigration(data *Data, logger *logger.Logger) *DBMigration {
 	return &DBMigration{
-		data:   data,
-		logger: logger,
+		data:      data,
+		logger:    logger,
+		sourceDir: "./internal/db/",
 	}
 }
@@ -70,9 +70,15 @@ func (rp defineCotaNftKvPairRepo) DeleteDefineCotaNftKvPairs(ctx context.Context
 }
 
 func (rp defineCotaNftKvPairRepo) ParseDefineCotaEntries(blockNumber uint64, entry biz.Entry) (defineCotas []biz.DefineCotaNftKvPair, err error) {
-	entries := smt.DefineCotaNFTEntriesFromSliceUnchecked(entry.InputType[1:])
+	entries, err := decodeMolecule("define entries", entry.InputType[1:], smt.DefineCotaNFTEntriesFromSlice)
+	if err != nil {
+		return
+	}
 	defineCotaKeyVec := entries.DefineKeys()
 	defineCotaValueVec := entries.DefineValues()
+	if err = checkPairs("define entries", defineCotaKeyVec.Len(), defineCotaValueVec.Len()); err != nil {
+		return
+	}
 	lockHash, err := entry.LockScript.Hash()
 	if err != nil {
 		return
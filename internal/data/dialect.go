@@ -0,0 +1,127 @@
+package data
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	mMsql "github.com/golang-migrate/migrate/v4/database/mysql"
+	mPostgres "github.com/golang-migrate/migrate/v4/database/postgres"
+	mSqlite "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const (
+	DriverMysql    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSqlite   = "sqlite"
+)
+
+// openDialector returns the gorm dialector of the driver, an empty driver is mysql
+func openDialector(driver, dsn string) (gorm.Dialector, error) {
+	switch driver {
+	case "", DriverMysql:
+		return mysql.Open(dsn), nil
+	case DriverPostgres:
+		return postgres.Open(dsn), nil
+	case DriverSqlite:
+		// the pure go sqlite driver registered by the sqlite migrate driver, the binary is built without cgo
+		return sqlite.Dialector{DriverName: "sqlite", DSN: dsn}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", driver)
+	}
+}
+
+// migrationDriver returns the migrate driver and the migrations directory of the driver
+func migrationDriver(driver string, sqlDB *sql.DB) (database.Driver, string, error) {
+	switch driver {
+	case "", DriverMysql:
+		instance, err := mMsql.WithInstance(sqlDB, &mMsql.Config{})
+		return instance, "migrations", err
+	case DriverPostgres:
+		instance, err := mPostgres.WithInstance(sqlDB, &mPostgres.Config{})
+		return instance, "postgres_migrations", err
+	case DriverSqlite:
+		instance, err := mSqlite.WithInstance(sqlDB, &mSqlite.Config{})
+		return instance, "sqlite_migrations", err
+	default:
+		return nil, "", fmt.Errorf("unsupported database driver: %s", driver)
+	}
+}
+
+// Uint64 stores a full range uint64, database/sql rejects uint64 values with the high bit set.
+// Those values are written as decimal strings, which the unsigned mysql column, the numeric
+// postgres column and the text sqlite column all keep exactly.
+type Uint64 uint64
+
+func (u Uint64) Value() (driver.Value, error) {
+	if u > math.MaxInt64 {
+		return strconv.FormatUint(uint64(u), 10), nil
+	}
+	return int64(u), nil
+}
+
+func (u *Uint64) Scan(value any) error {
+	switch v := value.(type) {
+	case int64:
+		*u = Uint64(v)
+		return nil
+	case uint64:
+		*u = Uint64(v)
+		return nil
+	case []byte:
+		return u.parse(string(v))
+	case string:
+		return u.parse(v)
+	default:
+		return fmt.Errorf("unsupported uint64 value: %T", value)
+	}
+}
+
+func (u *Uint64) parse(s string) error {
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*u = Uint64(n)
+	return nil
+}
+
+// firstByKey keeps the first row of every key. The restore uses it to pick the earliest version
+// of an entry in a block, whose old values are the state before the block.
+func firstByKey[T any](rows []T, key func(T) string) []T {
+	seen := make(map[string]bool, len(rows))
+	var result []T
+	for _, row := range rows {
+		k := key(row)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		result = append(result, row)
+	}
+	return result
+}
+
+// lastByKey keeps the last row of every key in the position of its first row. PostgreSQL rejects
+// an upsert touching the same row twice, while MySQL applies the rows in order and keeps the last.
+func lastByKey[T any](rows []T, key func(T) string) []T {
+	index := make(map[string]int, len(rows))
+	var result []T
+	for _, row := range rows {
+		k := key(row)
+		if i, ok := index[k]; ok {
+			result[i] = row
+			continue
+		}
+		index[k] = len(result)
+		result = append(result, row)
+	}
+	return result
+}
@@ -0,0 +1,212 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/config"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+func Test_lastByKey(t *testing.T) {
+	rows := []HoldCotaNftKvPair{
+		{CotaId: "a", TokenIndex: 1, State: 1},
+		{CotaId: "b", TokenIndex: 1, State: 1},
+		{CotaId: "a", TokenIndex: 1, State: 2},
+		{CotaId: "a", TokenIndex: 2, State: 1},
+	}
+	want := []HoldCotaNftKvPair{
+		{CotaId: "a", TokenIndex: 1, State: 2},
+		{CotaId: "b", TokenIndex: 1, State: 1},
+		{CotaId: "a", TokenIndex: 2, State: 1},
+	}
+	if got := lastByKey(rows, holdCotaKey); !reflect.DeepEqual(got, want) {
+		t.Errorf("lastByKey() = %v, want %v", got, want)
+	}
+	if got := firstByKey(rows, holdCotaKey); !reflect.DeepEqual(got, []HoldCotaNftKvPair{rows[0], rows[1], rows[3]}) {
+		t.Errorf("firstByKey() = %v", got)
+	}
+}
+
+func TestUint64(t *testing.T) {
+	for _, n := range []Uint64{0, math.MaxInt64, math.MaxInt64 + 1, math.MaxUint64} {
+		value, err := n.Value()
+		if err != nil {
+			t.Fatalf("Value(%d): %v", uint64(n), err)
+		}
+		if _, isString := value.(string); isString != (n > math.MaxInt64) {
+			t.Errorf("Value(%d) = %T, want a string only past MaxInt64", uint64(n), value)
+		}
+		for _, scanned := range []any{value, fmt.Sprint(value), []byte(fmt.Sprint(value))} {
+			var got Uint64
+			if err := got.Scan(scanned); err != nil || got != n {
+				t.Errorf("Scan(%#v) = %d, %v, want %d", scanned, uint64(got), err, uint64(n))
+			}
+		}
+	}
+}
+
+// TestCheckInfoRepo_CreateCheckInfo creates the check info from a pointer, gorm writes the generated
+// id back into the value it is given and panics on a struct passed by value.
+func TestCheckInfoRepo_CreateCheckInfo(t *testing.T) {
+	ctx := context.Background()
+	for driver, dsn := range testBackends() {
+		t.Run(driver, func(t *testing.T) {
+			repo := NewCheckInfoRepo(newTestData(t, driver, dsn), logger.NewLogger(io.Discard, "", 0))
+			for _, block := range []uint64{100, 101} {
+				if err := repo.CreateCheckInfo(ctx, &biz.CheckInfo{BlockNumber: block, BlockHash: "h", CheckType: biz.SyncBlock}); err != nil {
+					t.Fatalf("create check info %d: %v", block, err)
+				}
+			}
+			last := biz.CheckInfo{CheckType: biz.SyncBlock}
+			if err := repo.FindLastCheckInfo(ctx, &last); err != nil || last.BlockNumber != 101 {
+				t.Errorf("last check info = %+v, %v, want block 101", last, err)
+			}
+		})
+	}
+}
+
+// testBackends returns the databases the repository suite runs against. An in-memory sqlite
+// database always runs, and the suite wipes the tables it touches, so point the DSNs at throwaway
+// databases.
+func testBackends() map[string]string {
+	backends := map[string]string{DriverSqlite: "file:cota_test?mode=memory&cache=shared"}
+	if dsn := os.Getenv("COTA_TEST_MYSQL_DSN"); dsn != "" {
+		backends[DriverMysql] = dsn
+	}
+	if dsn := os.Getenv("COTA_TEST_POSTGRES_DSN"); dsn != "" {
+		backends[DriverPostgres] = dsn
+	}
+	return backends
+}
+
+func newTestData(t testing.TB, driver, dsn string) *Data {
+	t.Helper()
+	data, cleanup, err := NewData(&config.Database{Driver: driver, Dsn: dsn, MaxIdleConns: 1, MaxOpenConns: 2}, logger.NewLogger(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("open %s: %v", driver, err)
+	}
+	t.Cleanup(cleanup)
+	sqlDB, err := data.db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	instance, dir, err := migrationDriver(driver, sqlDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migration, err := migrate.NewWithDatabaseInstance("file://../db/"+dir, data.db.Migrator().CurrentDatabase(), instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = migration.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		t.Fatalf("migrate %s: %v", driver, err)
+	}
+	for _, model := range append(kvPairTables, EventOutbox{}, VersionPruneHeight{}, LocalizedMetadata{}) {
+		if err = data.db.Where("1 = 1").Delete(model).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return data
+}
+
+// newTestMetadataRegistry returns the metadata registry of the built-in types
+func newTestMetadataRegistry(data *Data, conf *config.Metadata) *MetadataRegistry {
+	registry, err := NewMetadataRegistry(newTestMetadataHandlers(data), conf)
+	if err != nil {
+		panic(err)
+	}
+	return registry
+}
+
+// newTestMetadataHandlers returns the built-in metadata handlers
+func newTestMetadataHandlers(data *Data) MetadataHandlers {
+	log := logger.NewLogger(io.Discard, "", 0)
+	return NewMetadataHandlers(
+		biz.NewIssuerInfoUsecase(NewIssuerInfoRepo(data, log), log),
+		biz.NewClassInfoUsecase(NewClassInfoRepo(data, log), log),
+		biz.NewJoyIDInfoUsecase(NewJoyIDInfoRepo(data, log), log),
+		NewMediaNormalizer(&config.Media{}),
+	)
+}
+
+func newTestKvPairRepo(data *Data) biz.KvPairRepo {
+	return NewKvPairRepo(data, newTestMetadataRegistry(data, &config.Metadata{}), logger.NewLogger(io.Discard, "", 0))
+}
+
+func TestKvPairRepo_backends(t *testing.T) {
+	for driver, dsn := range testBackends() {
+		t.Run(driver, func(t *testing.T) {
+			testKvPairRepoCreateAndRestore(t, newTestData(t, driver, dsn))
+		})
+	}
+}
+
+func testKvPairRepoCreateAndRestore(t *testing.T, data *Data) {
+	ctx := context.Background()
+	repo := newTestKvPairRepo(data)
+	const cotaId, owner, receiver = "c0ac7ff7ec8be0a3b1a64e2e1a9a4e0f54c49b4c", "aa", "bb"
+
+	if err := repo.CreateCotaEntryKvPairs(ctx, biz.CheckInfo{BlockNumber: 100, BlockHash: "h100"}, &biz.KvPair{
+		Registers:   []biz.RegisterCotaKvPair{{BlockNumber: 100, LockHash: owner, CotaCellID: math.MaxUint64, LockScriptId: 1}},
+		DefineCotas: []biz.DefineCotaNftKvPair{{BlockNumber: 100, CotaId: cotaId, Total: 10, LockHash: owner}},
+		HoldCotas:   []biz.HoldCotaNftKvPair{{BlockNumber: 100, CotaId: cotaId, TokenIndex: 0, Characteristic: "00", LockHash: owner}},
+		ExtensionPairs: []biz.ExtensionPair{
+			{BlockNumber: 100, Key: "k", Value: "v0", LockHash: owner},
+			{BlockNumber: 100, Key: "k", Value: "v0", LockHash: receiver},
+		},
+	}); err != nil {
+		t.Fatalf("create block 100: %v", err)
+	}
+	// two updates of one row in a block must both apply in order
+	if err := repo.CreateCotaEntryKvPairs(ctx, biz.CheckInfo{BlockNumber: 101, BlockHash: "h101"}, &biz.KvPair{
+		UpdatedDefineCotas: []biz.DefineCotaNftKvPair{
+			{BlockNumber: 101, CotaId: cotaId, Total: 10, Issued: 1, LockHash: owner, TxIndex: 0},
+			{BlockNumber: 101, CotaId: cotaId, Total: 10, Issued: 2, LockHash: owner, TxIndex: 1},
+		},
+		UpdatedHoldCotas: []biz.HoldCotaNftKvPair{
+			{BlockNumber: 101, CotaId: cotaId, TokenIndex: 0, Characteristic: "01", LockHash: owner, TxIndex: 0},
+			{BlockNumber: 101, CotaId: cotaId, TokenIndex: 0, Characteristic: "02", LockHash: owner, TxIndex: 1},
+		},
+		UpdatedExtensionPairs: []biz.ExtensionPair{{BlockNumber: 101, Key: "k", Value: "v1", LockHash: receiver}},
+	}); err != nil {
+		t.Fatalf("create block 101: %v", err)
+	}
+
+	var define DefineCotaNftKvPair
+	if err := data.db.Where("cota_id = ?", cotaId).First(&define).Error; err != nil || define.Issued != 2 {
+		t.Fatalf("define after block 101 = %+v, %v, want issued 2", define, err)
+	}
+	var register RegisterCotaKvPair
+	if err := data.db.Where("lock_hash = ?", owner).First(&register).Error; err != nil || register.CotaCellID != math.MaxUint64 {
+		t.Fatalf("register = %+v, %v, want the max cota cell id", register, err)
+	}
+	var extension ExtensionKvPairVersion
+	if err := data.db.Where("block_number = ? and action_type = ?", 101, 1).First(&extension).Error; err != nil || extension.OldValue != "v0" {
+		t.Fatalf("extension version = %+v, %v", extension, err)
+	}
+
+	if err := repo.RestoreCotaEntryKvPairs(ctx, 101); err != nil {
+		t.Fatalf("restore block 101: %v", err)
+	}
+	var restoredDefine DefineCotaNftKvPair
+	if err := data.db.Where("cota_id = ?", cotaId).First(&restoredDefine).Error; err != nil || restoredDefine.Issued != 0 || restoredDefine.BlockNumber != 100 {
+		t.Errorf("define after restore = %+v, %v, want issued 0 at block 100", restoredDefine, err)
+	}
+	var hold HoldCotaNftKvPair
+	if err := data.db.Where("cota_id = ? and token_index = ?", cotaId, 0).First(&hold).Error; err != nil || hold.Characteristic != "00" {
+		t.Errorf("hold after restore = %+v, %v, want characteristic 00", hold, err)
+	}
+	var extensions []ExtensionKvPair
+	if err := data.db.Order("lock_hash").Find(&extensions).Error; err != nil || len(extensions) != 2 || extensions[1].Value != "v0" {
+		t.Errorf("extensions after restore = %+v, %v", extensions, err)
+	}
+}
@@ -0,0 +1,283 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var _ biz.EventOutboxRepo = (*eventOutboxRepo)(nil)
+
+type EventOutbox struct {
+	ID             uint `gorm:"primaryKey"`
+	SequenceNumber *uint64
+	Status         string
+	BlockNumber    uint64
+	Payload        string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (EventOutbox) TableName() string {
+	return "event_outbox"
+}
+
+// OutboxSequencer holds the last sequence number allocated to the outbox, its single row is the lock
+// that orders the allocations
+type OutboxSequencer struct {
+	ID           uint `gorm:"primaryKey"`
+	LastSequence uint64
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+const (
+	outboxSequencerId   = 1
+	outboxSequenceBatch = 500
+)
+
+// WebhookCursor and SinkCursor keep in OutboxId the sequence number of the last outbox row handled.
+// The migration that added the sequence numbers set them to the ids, so older cursors stay valid.
+type WebhookCursor struct {
+	ID        uint `gorm:"primaryKey"`
+	Endpoint  string
+	OutboxId  uint64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type SinkCursor struct {
+	ID        uint `gorm:"primaryKey"`
+	Sink      string
+	OutboxId  uint64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type WebhookDeadLetter struct {
+	ID        uint `gorm:"primaryKey"`
+	Endpoint  string
+	OutboxId  uint64
+	Payload   string
+	LastError string
+	Attempts  int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type eventOutboxRepo struct {
+	data   *Data
+	logger *logger.Logger
+}
+
+func NewEventOutboxRepo(data *Data, logger *logger.Logger) biz.EventOutboxRepo {
+	return &eventOutboxRepo{
+		data:   data,
+		logger: logger,
+	}
+}
+
+// FindOutboxEvents numbers the rows committed since the last call, then returns the rows after the
+// sequence number in sequence order
+func (rp eventOutboxRepo) FindOutboxEvents(ctx context.Context, afterSequence uint64, limit int) ([]biz.OutboxEvent, error) {
+	if err := sequenceOutbox(ctx, rp.data.db); err != nil {
+		return nil, err
+	}
+	var rows []EventOutbox
+	if err := rp.data.db.WithContext(ctx).Where("sequence_number > ?", afterSequence).Order("sequence_number").Limit(limit).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	events := make([]biz.OutboxEvent, len(rows))
+	for i, row := range rows {
+		events[i] = biz.OutboxEvent{
+			Id:       uint64(row.ID),
+			Sequence: *row.SequenceNumber,
+			Status:   biz.OutboxStatus(row.Status),
+		}
+		if err := json.Unmarshal([]byte(row.Payload), &events[i].Event); err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+func (rp eventOutboxRepo) FindDeliveryCursor(ctx context.Context, endpoint string) (uint64, error) {
+	var cursor WebhookCursor
+	err := rp.data.db.WithContext(ctx).Where("endpoint = ?", endpoint).First(&cursor).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return cursor.OutboxId, nil
+}
+
+func (rp eventOutboxRepo) SaveDeliveryCursor(ctx context.Context, endpoint string, sequence uint64) error {
+	return rp.data.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "endpoint"}},
+		DoUpdates: clause.AssignmentColumns([]string{"outbox_id", "updated_at"}),
+	}).Create(&WebhookCursor{Endpoint: endpoint, OutboxId: sequence}).Error
+}
+
+func (rp eventOutboxRepo) CreateDeadLetter(ctx context.Context, letter *biz.DeadLetter) error {
+	return rp.data.db.WithContext(ctx).Create(&WebhookDeadLetter{
+		Endpoint:  letter.Endpoint,
+		OutboxId:  letter.OutboxId,
+		Payload:   letter.Payload,
+		LastError: letter.LastError,
+		Attempts:  letter.Attempts,
+	}).Error
+}
+
+func (rp eventOutboxRepo) FindSinkCursor(ctx context.Context, sink string) (uint64, error) {
+	var cursor SinkCursor
+	err := rp.data.db.WithContext(ctx).Where("sink = ?", sink).First(&cursor).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return cursor.OutboxId, nil
+}
+
+func (rp eventOutboxRepo) SaveSinkCursor(ctx context.Context, sink string, sequence uint64) error {
+	return rp.data.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "sink"}},
+		DoUpdates: clause.AssignmentColumns([]string{"outbox_id", "updated_at"}),
+	}).Create(&SinkCursor{Sink: sink, OutboxId: sequence}).Error
+}
+
+// DeleteOutboxEvents deletes the rows numbered up to throughSequence, batchSize rows per statement.
+// Rows without a sequence number are kept.
+func (rp eventOutboxRepo) DeleteOutboxEvents(ctx context.Context, throughSequence uint64, batchSize int) (int64, error) {
+	var deleted int64
+	for {
+		var ids []uint
+		if err := rp.data.db.WithContext(ctx).Model(EventOutbox{}).Where("sequence_number <= ?", throughSequence).Order("sequence_number").
+			Limit(batchSize).Pluck("id", &ids).Error; err != nil {
+			return deleted, err
+		}
+		if len(ids) == 0 {
+			return deleted, nil
+		}
+		result := rp.data.db.WithContext(ctx).Where("id in ?", ids).Delete(EventOutbox{})
+		if result.Error != nil {
+			return deleted, result.Error
+		}
+		deleted += result.RowsAffected
+	}
+}
+
+// sequenceOutbox numbers the committed rows without a sequence number in the order of their ids. The
+// block syncer and the metadata syncer commit outbox rows concurrently, so a row with a lower id can
+// commit after a higher one was read, and a cursor over ids would skip it. The allocating transaction
+// locks the sequencer row first, so a number only becomes visible after every lower number did and a
+// late row is numbered above the cursors instead.
+func sequenceOutbox(ctx context.Context, db *gorm.DB) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockOutboxSequencer(tx); err != nil {
+			return err
+		}
+		var sequencer OutboxSequencer
+		if err := tx.Where("id = ?", outboxSequencerId).First(&sequencer).Error; err != nil {
+			return err
+		}
+		var ids []uint
+		if err := tx.Model(EventOutbox{}).Where("sequence_number IS NULL").Order("id").Limit(outboxSequenceBatch).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		for _, id := range ids {
+			sequencer.LastSequence++
+			if err := tx.Model(EventOutbox{}).Where("id = ?", id).Update("sequence_number", sequencer.LastSequence).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(OutboxSequencer{}).Where("id = ?", outboxSequencerId).Update("last_sequence", sequencer.LastSequence).Error
+	})
+}
+
+// lockOutboxSequencer locks the sequencer row, creating it on the first call
+func lockOutboxSequencer(tx *gorm.DB) error {
+	locked := tx.Model(OutboxSequencer{}).Where("id = ?", outboxSequencerId).Update("updated_at", time.Now())
+	if locked.Error != nil {
+		return locked.Error
+	}
+	if locked.RowsAffected == 0 {
+		return tx.Create(&OutboxSequencer{ID: outboxSequencerId}).Error
+	}
+	return nil
+}
+
+func createOutboxEvents(ctx context.Context, tx *gorm.DB, status biz.OutboxStatus, events []biz.CotaEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	rows := make([]EventOutbox, len(events))
+	for i, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		rows[i] = EventOutbox{
+			Status:      string(status),
+			BlockNumber: event.BlockNumber,
+			Payload:     string(payload),
+		}
+	}
+	return tx.Model(EventOutbox{}).WithContext(ctx).Create(&rows).Error
+}
+
+// revertOutboxEvents records a reverted row for each rolled back event whose applied row has a
+// sequence number, a consumer may have received it. An applied row without a sequence number was
+// never read, it is deleted instead. The sequencer lock keeps the rows from being numbered meanwhile.
+func revertOutboxEvents(ctx context.Context, tx *gorm.DB, blockNumber uint64, events []biz.CotaEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	if err := lockOutboxSequencer(tx.WithContext(ctx)); err != nil {
+		return err
+	}
+	var unsequenced []EventOutbox
+	if err := tx.WithContext(ctx).Where("block_number = ? and status = ? and sequence_number IS NULL", blockNumber, biz.OutboxApplied).
+		Find(&unsequenced).Error; err != nil {
+		return err
+	}
+	// the payload of an event is the same when it is applied and when it is rolled back
+	unread := make(map[string][]uint, len(unsequenced))
+	for _, row := range unsequenced {
+		unread[row.Payload] = append(unread[row.Payload], row.ID)
+	}
+	var (
+		unreadIds []uint
+		reverted  []biz.CotaEvent
+	)
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if ids := unread[string(payload)]; len(ids) > 0 {
+			unreadIds = append(unreadIds, ids[0])
+			unread[string(payload)] = ids[1:]
+			continue
+		}
+		reverted = append(reverted, event)
+	}
+	if len(unreadIds) > 0 {
+		if err := tx.WithContext(ctx).Where("id in ?", unreadIds).Delete(EventOutbox{}).Error; err != nil {
+			return err
+		}
+	}
+	return createOutboxEvents(ctx, tx, biz.OutboxReverted, reverted)
+}
@@ -0,0 +1,124 @@
+package data
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+func TestEventOutboxRepo_lateCommit(t *testing.T) {
+	ctx := context.Background()
+	data := newTestData(t, DriverSqlite, "file:event_outbox?mode=memory&cache=shared")
+	repo := NewEventOutboxRepo(data, logger.NewLogger(io.Discard, "", 0))
+	insert := func(id uint) {
+		t.Helper()
+		if err := data.db.Create(&EventOutbox{ID: id, Status: "applied", BlockNumber: uint64(id), Payload: "{}"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	insert(1)
+	insert(3)
+	events, err := repo.FindOutboxEvents(ctx, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Id != 1 || events[1].Id != 3 || events[0].Sequence >= events[1].Sequence {
+		t.Fatalf("FindOutboxEvents() = %+v, want ids 1 and 3 in sequence order", events)
+	}
+	cursor := events[1].Sequence
+
+	// the metadata syncer commits id 2 after the block syncer committed id 3 and the cursor passed it
+	insert(2)
+	events, err = repo.FindOutboxEvents(ctx, cursor, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Id != 2 || events[0].Sequence != cursor+1 {
+		t.Fatalf("FindOutboxEvents() after the cursor = %+v, want the late id 2", events)
+	}
+	if events, err = repo.FindOutboxEvents(ctx, cursor+1, 10); err != nil || len(events) != 0 {
+		t.Errorf("FindOutboxEvents() after the late row = %+v, %v, want none", events, err)
+	}
+}
+
+func TestEventOutboxRepo_revert(t *testing.T) {
+	ctx := context.Background()
+	data := newTestData(t, DriverSqlite, "file:event_outbox_revert?mode=memory&cache=shared")
+	repo := NewEventOutboxRepo(data, logger.NewLogger(io.Discard, "", 0))
+	kvPairs := newTestKvPairRepo(data)
+	checkInfo := biz.CheckInfo{BlockNumber: 100, BlockHash: "h", CheckType: biz.SyncBlock}
+	create := func() {
+		t.Helper()
+		kvPair := biz.KvPair{
+			DefineCotas: []biz.DefineCotaNftKvPair{testDefine(100, 0, 0)},
+			Events:      []biz.CotaEvent{testEvent(100, 0, biz.CotaEventDefine, lockA)},
+		}
+		if err := kvPairs.CreateCotaEntryKvPairs(ctx, checkInfo, &kvPair); err != nil {
+			t.Fatal(err)
+		}
+	}
+	statuses := func() []string {
+		t.Helper()
+		var rows []EventOutbox
+		if err := data.db.Order("id").Find(&rows).Error; err != nil {
+			t.Fatal(err)
+		}
+		statuses := make([]string, len(rows))
+		for i, row := range rows {
+			statuses[i] = row.Status
+		}
+		return statuses
+	}
+
+	// no consumer read the applied row, the rollback deletes it
+	create()
+	if err := kvPairs.RestoreCotaEntryKvPairs(ctx, 100); err != nil {
+		t.Fatal(err)
+	}
+	if got := statuses(); len(got) != 0 {
+		t.Errorf("outbox after rolling back an unread block = %v, want none", got)
+	}
+
+	// a numbered row may have been delivered, the rollback reverts it
+	create()
+	if _, err := repo.FindOutboxEvents(ctx, 0, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := kvPairs.RestoreCotaEntryKvPairs(ctx, 100); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := statuses(), []string{string(biz.OutboxApplied), string(biz.OutboxReverted)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("outbox after rolling back a read block = %v, want %v", got, want)
+	}
+}
+
+func TestEventOutboxRepo_DeleteOutboxEvents(t *testing.T) {
+	ctx := context.Background()
+	data := newTestData(t, DriverSqlite, "file:event_outbox_delete?mode=memory&cache=shared")
+	repo := NewEventOutboxRepo(data, logger.NewLogger(io.Discard, "", 0))
+	for id := uint(1); id <= 3; id++ {
+		if err := data.db.Create(&EventOutbox{ID: id, Status: "applied", BlockNumber: uint64(id), Payload: "{}"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := repo.FindOutboxEvents(ctx, 0, 10); err != nil {
+		t.Fatal(err)
+	}
+	// committed after the outbox was numbered, the row has no sequence number yet
+	if err := data.db.Create(&EventOutbox{ID: 4, Status: "applied", BlockNumber: 4, Payload: "{}"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := repo.DeleteOutboxEvents(ctx, 10, 1)
+	if err != nil || deleted != 3 {
+		t.Fatalf("DeleteOutboxEvents() = %d, %v, want the 3 numbered rows", deleted, err)
+	}
+	var ids []uint
+	if err = data.db.Model(EventOutbox{}).Pluck("id", &ids).Error; err != nil || !reflect.DeepEqual(ids, []uint{4}) {
+		t.Errorf("outbox ids after the delete = %v, %v, want the unnumbered row 4", ids, err)
+	}
+}
@@ -0,0 +1,112 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/config"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+var (
+	_ biz.EventSink = (*natsSink)(nil)
+	_ biz.EventSink = (*MemoryBroker)(nil)
+)
+
+// NewEventSink returns the sink configured by the driver, or nil when the sink is disabled
+func NewEventSink(conf *config.Sink, logger *logger.Logger) (biz.EventSink, func(), error) {
+	switch conf.Driver {
+	case "":
+		return nil, func() {}, nil
+	case "nats":
+		conn, err := nats.Connect(conf.Url, nats.Name("cota-syncer"), nats.MaxReconnects(-1))
+		if err != nil {
+			return nil, nil, err
+		}
+		js, err := conn.JetStream()
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		return &natsSink{js: js, subject: conf.Subject}, func() {
+			if err := conn.Drain(); err != nil {
+				logger.Error(context.TODO(), err)
+			}
+		}, nil
+	case "memory":
+		return NewMemoryBroker(), func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported sink driver: %s", conf.Driver)
+	}
+}
+
+// natsSink publishes every message on one subject of a JetStream stream to keep the block order.
+// The Nats-Msg-Id header lets the stream drop the duplicates of an at-least-once re-delivery.
+type natsSink struct {
+	js      nats.JetStreamContext
+	subject string
+}
+
+// Publish sends the messages one by one and waits for the stream to acknowledge each of them, so a
+// batch is only accepted once every message is stored. A ctx without a deadline waits 10s a batch.
+func (s *natsSink) Publish(ctx context.Context, messages []biz.SinkMessage) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+	}
+	for _, message := range messages {
+		msg := nats.NewMsg(s.subject)
+		msg.Data = message.Value
+		msg.Header.Set("Cota-Key", message.Key)
+		for k, v := range message.Headers {
+			msg.Header.Set(k, v)
+		}
+		if _, err := s.js.PublishMsg(msg, nats.MsgId(message.Key+"/"+message.Headers["Cota-Outbox-Id"]), nats.Context(ctx)); err != nil {
+			return fmt.Errorf("publish %s to %s: %w", message.Key, s.subject, err)
+		}
+	}
+	return nil
+}
+
+// MemoryBroker is an in-process EventSink keeping every published message in order
+type MemoryBroker struct {
+	mu       sync.Mutex
+	messages []biz.SinkMessage
+	failures int
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+var ErrMemoryBrokerUnavailable = errors.New("memory broker unavailable")
+
+// FailNext makes the next n Publish calls fail without storing anything
+func (b *MemoryBroker) FailNext(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = n
+}
+
+func (b *MemoryBroker) Publish(_ context.Context, messages []biz.SinkMessage) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures > 0 {
+		b.failures--
+		return ErrMemoryBrokerUnavailable
+	}
+	b.messages = append(b.messages, messages...)
+	return nil
+}
+
+func (b *MemoryBroker) Messages() []biz.SinkMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]biz.SinkMessage(nil), b.messages...)
+}
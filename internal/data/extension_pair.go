@@ -3,7 +3,6 @@ package data
 import (
 	"context"
 	"encoding/hex"
-	"fmt"
 	"hash/crc32"
 	"strconv"
 	"strings"
@@ -68,9 +67,15 @@ func (rp extensionPairRepo) DeleteExtensionPairs(ctx context.Context, blockNumbe
 }
 
 func (rp extensionPairRepo) ParseExtensionPairs(blockNumber uint64, entry biz.Entry) (pairs biz.ExtensionPairs, err error) {
-	entries := smt.ExtensionEntriesFromSliceUnchecked(entry.InputType[1:])
+	entries, err := decodeMolecule("extension entries", entry.InputType[1:], smt.ExtensionEntriesFromSlice)
+	if err != nil {
+		return
+	}
 	extensionLeafKeys := entries.Leaves().Keys()
 	extensionLeafValues := entries.Leaves().Values()
+	if err = checkPairs("extension entries", extensionLeafKeys.Len(), extensionLeafValues.Len()); err != nil {
+		return
+	}
 	lockHash, err := entry.LockScript.Hash()
 	if err != nil {
 		return
@@ -93,13 +98,13 @@ func (rp extensionPairRepo) ParseExtensionPairs(blockNumber uint64, entry biz.En
 	switch string(entries.SubType().RawData()) {
 	case "subkey":
 		var subKeys []biz.SubKeyPair
-		if subKeys, err = rp.parseSubKeyPairs(entries, blockNumber, lockHashStr); err != nil {
+		if subKeys, err = rp.parseSubKeyPairs(entries, blockNumber, entry.TxIndex, lockHashStr); err != nil {
 			return biz.ExtensionPairs{}, err
 		}
 		pairs.SubKeys = append(pairs.SubKeys, subKeys...)
 	case "social":
 		var social *biz.SocialKvPair
-		if social, err = rp.parseSocialPairs(entries, blockNumber, lockHashStr); err != nil {
+		if social, err = rp.parseSocialPairs(entries, blockNumber, entry.TxIndex, lockHashStr); err != nil {
 			return biz.ExtensionPairs{}, err
 		}
 
@@ -111,25 +116,31 @@ func (rp extensionPairRepo) ParseExtensionPairs(blockNumber uint64, entry biz.En
 	return
 }
 
-func (rp extensionPairRepo) parseSubKeyPairs(entries *smt.ExtensionEntries, blockNumber uint64, lockHash string) ([]biz.SubKeyPair, error) {
+func (rp extensionPairRepo) parseSubKeyPairs(entries *smt.ExtensionEntries, blockNumber uint64, txIndex uint32, lockHash string) ([]biz.SubKeyPair, error) {
 	var (
 		extData, algIndex int64
 		subKeys           []biz.SubKeyPair
 		err               error
 	)
 
-	subKeyEntries := smt.SubKeyEntriesFromSliceUnchecked(entries.RawData().RawData())
+	subKeyEntries, err := decodeMolecule("sub key entries", entries.RawData().RawData(), smt.SubKeyEntriesFromSlice)
+	if err != nil {
+		return nil, err
+	}
 	subKeyLeafKeys := subKeyEntries.Keys()
 	subKeyLeafValues := subKeyEntries.Values()
+	if err = checkPairs("sub key entries", subKeyLeafKeys.Len(), subKeyLeafValues.Len()); err != nil {
+		return nil, err
+	}
 	for i := uint(0); i < subKeyLeafKeys.Len(); i++ {
 		key := subKeyLeafKeys.Get(i)
 		value := subKeyLeafValues.Get(i)
 
 		if extData, err = strconv.ParseInt(hex.EncodeToString(key.ExtData().RawData()), 16, 32); err != nil {
-			return nil, fmt.Errorf("parse extData err: %w", err)
+			return nil, malformedEntry("parse extData: %v", err)
 		}
 		if algIndex, err = strconv.ParseInt(hex.EncodeToString(value.AlgIndex().RawData()), 16, 16); err != nil {
-			return nil, fmt.Errorf("parse alg idx err: %w", err)
+			return nil, malformedEntry("parse alg idx: %v", err)
 		}
 		subKeys = append(subKeys, biz.SubKeyPair{
 			BlockNumber: blockNumber,
@@ -138,6 +149,7 @@ func (rp extensionPairRepo) parseSubKeyPairs(entries *smt.ExtensionEntries, bloc
 			ExtData:     uint32(extData),
 			AlgIndex:    uint16(algIndex),
 			PubkeyHash:  remove0x(hex.EncodeToString(value.PubkeyHash().RawData())),
+			TxIndex:     txIndex,
 			UpdatedAt:   time.Now().UTC(),
 		})
 	}
@@ -145,27 +157,30 @@ func (rp extensionPairRepo) parseSubKeyPairs(entries *smt.ExtensionEntries, bloc
 	return subKeys, nil
 }
 
-func (rp extensionPairRepo) parseSocialPairs(entries *smt.ExtensionEntries, blockNumber uint64, lockHash string) (*biz.SocialKvPair, error) {
+func (rp extensionPairRepo) parseSocialPairs(entries *smt.ExtensionEntries, blockNumber uint64, txIndex uint32, lockHash string) (*biz.SocialKvPair, error) {
 	var (
 		recoveryMode, must, total int64
 		signers                   []string
 		err                       error
 	)
 
-	socialEntry := smt.SocialEntryFromSliceUnchecked(entries.RawData().RawData())
+	socialEntry, err := decodeMolecule("social entry", entries.RawData().RawData(), smt.SocialEntryFromSlice)
+	if err != nil {
+		return nil, err
+	}
 	socialLeafValue := socialEntry.Value()
 	if socialLeafValue == nil {
 		return nil, nil
 	}
 
 	if recoveryMode, err = strconv.ParseInt(hex.EncodeToString(socialLeafValue.RecoveryMode().AsSlice()), 16, 8); err != nil {
-		return nil, fmt.Errorf("parse recover mode err: %w", err)
+		return nil, malformedEntry("parse recover mode: %v", err)
 	}
 	if must, err = strconv.ParseInt(hex.EncodeToString(socialLeafValue.Must().AsSlice()), 16, 8); err != nil {
-		return nil, fmt.Errorf("parse must err: %w", err)
+		return nil, malformedEntry("parse must: %v", err)
 	}
 	if total, err = strconv.ParseInt(hex.EncodeToString(socialLeafValue.Total().AsSlice()), 16, 8); err != nil {
-		return nil, fmt.Errorf("parse total err: %w", err)
+		return nil, malformedEntry("parse total: %v", err)
 	}
 
 	lockScriptVec := socialLeafValue.Signers()
@@ -182,6 +197,7 @@ func (rp extensionPairRepo) parseSocialPairs(entries *smt.ExtensionEntries, bloc
 		Must:         uint8(must),
 		Total:        uint8(total),
 		Signers:      strings.Join(signers, ","),
+		TxIndex:      txIndex,
 		UpdatedAt:    time.Now().UTC(),
 	}, nil
 }
@@ -0,0 +1,37 @@
+package data
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+)
+
+// FuzzParseExtensionPairs runs the extension, sub key and social parsers on fuzzed entries
+func FuzzParseExtensionPairs(f *testing.F) {
+	_, tx, _ := loadGoldenFixture(f, filepath.Join("testdata", "golden", "extension_subkey_v2.json"))
+	for _, inputType := range goldenInputTypes(f) {
+		if inputType[0] == 0xF0 || inputType[0] == 0xF1 {
+			f.Add(inputType[1:])
+		}
+	}
+	f.Add([]byte{})
+	repo := extensionPairRepo{}
+
+	f.Fuzz(func(t *testing.T, entries []byte) {
+		entry := biz.Entry{InputType: append([]byte{0xF0}, entries...), LockScript: tx.Outputs[0].Lock, TxHash: tx.Hash}
+		pairs, err := repo.ParseExtensionPairs(1, entry)
+		if err != nil {
+			if !errors.Is(err, biz.ErrMalformedEntry) {
+				t.Fatalf("ParseExtensionPairs() error = %v, want a malformed entry", err)
+			}
+			return
+		}
+		for _, subKey := range pairs.SubKeys {
+			if subKey.LockHash == "" {
+				t.Errorf("sub key without a lock hash: %+v", subKey)
+			}
+		}
+	})
+}
@@ -0,0 +1,384 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/ckbtest"
+	"github.com/nervina-labs/cota-syncer/internal/config"
+	"github.com/nervina-labs/cota-syncer/internal/data/blockchain"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+	ckbTypes "github.com/nervosnetwork/ckb-sdk-go/types"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the parser tests")
+
+// goldenFixture is a transaction with the transactions of its inputs, written by
+// testdata/gen_golden.go. The transactions are in the json encoding of the node. A synthetic fixture
+// was built by the tool instead of captured from a node.
+type goldenFixture struct {
+	Description          string            `json:"description"`
+	Synthetic            bool              `json:"synthetic"`
+	Chain                string            `json:"chain"`
+	BlockNumber          uint64            `json:"block_number"`
+	TxIndex              uint32            `json:"tx_index"`
+	Transaction          json.RawMessage   `json:"transaction"`
+	PreviousTransactions []json.RawMessage `json:"previous_transactions"`
+}
+
+// TestBlockSyncer_golden parses every fixture of testdata/golden with the witness args parser and the
+// action parsers, and compares the kv pairs with the golden file of the fixture
+func TestBlockSyncer_golden(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "golden", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		if strings.HasSuffix(path, ".golden.json") {
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		t.Run(name, func(t *testing.T) {
+			got := parseGoldenFixture(t, name, path)
+			goldenPath := strings.TrimSuffix(path, ".json") + ".golden.json"
+			if *update {
+				if err := os.WriteFile(goldenPath, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("read the golden file, run the test with -update to write it: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("kv pairs differ from %s, run the test with -update if the change is expected\ngot:\n%s", goldenPath, got)
+			}
+		})
+	}
+}
+
+func parseGoldenFixture(t *testing.T, name, path string) []byte {
+	t.Helper()
+	kvPair := parseGoldenKvPair(t, name, path)
+	got, err := json.MarshalIndent(kvPair, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(got, '\n')
+}
+
+func parseGoldenKvPair(t *testing.T, name, path string) biz.KvPair {
+	t.Helper()
+	fixture, tx, previous := loadGoldenFixture(t, path)
+	f := newFixtureSyncer(t, "golden_"+name, fixture.Chain, previous)
+	entries, err := f.parser.Parse(tx, fixture.TxIndex, f.systemScripts.CotaType)
+	if err != nil {
+		t.Fatalf("parse the witness args: %v", err)
+	}
+	if len(entries) == 0 {
+		t.Fatal("the fixture has no cota entries")
+	}
+	kvPair, err := f.syncer.parseCotaEntries(fixture.BlockNumber, entries)
+	if err != nil {
+		t.Fatalf("parse the entries: %v", err)
+	}
+	clearParseTimes(&kvPair)
+	return kvPair
+}
+
+// TestBlockSyncer_goldenKeyFields checks the key fields of the synthetic fixtures against the inputs
+// of testdata/gen_golden.go. The golden files are written by the parsers themselves, these values are
+// written by hand from the corpus so that a wrong parser can not agree with itself.
+func TestBlockSyncer_goldenKeyFields(t *testing.T) {
+	const (
+		cotaId         = "f14aca18aae9df753af304469d8f4ebbc174a938"
+		otherCotaId    = "b22585a8053af3fed0fd39127f5b1487ce08b756"
+		characteristic = "0505050505050505050505050505050505050505"
+		updatedChar    = "0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a"
+		// the last 20 bytes of the withdrawal tx hash of the corpus, the out point index follows
+		withdrawOutPoint = "c2d2a3b5b4b0d3f1b6f1aab1c1d2e3f4a5b6c7d8"
+	)
+	secp256k1 := ckbTypes.HexToHash("0x9bd7e06f3ecf4be0f2fcd2188b23f1b9fcc88e5d4b65a8637b17723bbda3cce8")
+	scriptHash := func(script *ckbTypes.Script) string {
+		hash, err := script.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash.String()[2:]
+	}
+	alice := scriptHash(&ckbTypes.Script{CodeHash: secp256k1, HashType: ckbTypes.HashTypeType, Args: bytes.Repeat([]byte{0xa1}, 20)})
+	bob := scriptHash(&ckbTypes.Script{CodeHash: secp256k1, HashType: ckbTypes.HashTypeType, Args: bytes.Repeat([]byte{0xb0}, 20)})
+	carol := scriptHash(&ckbTypes.Script{CodeHash: ckbTypes.HexToHash("0xd23761b364210735c19c60561d213fb3beae2fd6172743719eff6920e020baac"), HashType: ckbTypes.HashTypeType,
+		Args: append([]byte{0x00, 0x01}, bytes.Repeat([]byte{0xc0}, 20)...)})
+	outPoint := func(index uint32) string {
+		return fmt.Sprintf("%s%08x", withdrawOutPoint, index)
+	}
+
+	tests := []struct {
+		name  string
+		check func(kvPair biz.KvPair) bool
+	}{
+		{"define_v0", func(p biz.KvPair) bool {
+			d := p.DefineCotas
+			return len(d) == 1 && d[0].CotaId == otherCotaId && d[0].Total == 0 && d[0].Issued == 0 && d[0].Configure == 0xc0 && d[0].LockHash == alice
+		}},
+		{"mint_v2", func(p biz.KvPair) bool {
+			d, w := p.UpdatedDefineCotas, p.WithdrawCotas
+			return len(d) == 1 && d[0].CotaId == cotaId && d[0].Total == 100 && d[0].Issued == 4 &&
+				len(w) == 2 && w[0].TokenIndex == 2 && w[0].ReceiverLockHash == bob && w[1].TokenIndex == 3 && w[1].ReceiverLockHash == carol &&
+				w[0].OutPoint == outPoint(0) && w[0].Characteristic == characteristic && w[0].LockHash == alice && w[0].Version == 2
+		}},
+		{"withdraw_v0", func(p biz.KvPair) bool {
+			w := p.WithdrawCotas
+			return len(w) == 1 && w[0].CotaId == cotaId && w[0].TokenIndex == 5 && w[0].OutPoint == outPoint(1) && w[0].ReceiverLockHash == bob && w[0].Version == 0
+		}},
+		{"claim_v2", func(p biz.KvPair) bool {
+			h, c := p.HoldCotas, p.ClaimedCotas
+			return len(h) == 1 && h[0].TokenIndex == 7 && h[0].LockHash == bob && h[0].Characteristic == characteristic &&
+				len(c) == 1 && c[0].TokenIndex == 7 && c[0].OutPoint == outPoint(2) && c[0].LockHash == bob
+		}},
+		{"update_v2", func(p biz.KvPair) bool {
+			u := p.UpdatedHoldCotas
+			return len(u) == 2 && u[0].CotaId == cotaId && u[0].TokenIndex == 9 && u[0].State == 1 && u[0].Characteristic == updatedChar &&
+				u[1].CotaId == otherCotaId && u[1].TokenIndex == 0 && u[1].State == 0 && u[1].LockHash == alice
+		}},
+		{"transfer_v1", func(p biz.KvPair) bool {
+			c, w := p.ClaimedCotas, p.WithdrawCotas
+			return len(c) == 1 && c[0].TokenIndex == 10 && c[0].OutPoint == outPoint(4) && c[0].LockHash == bob &&
+				len(w) == 1 && w[0].TokenIndex == 10 && w[0].OutPoint == outPoint(5) && w[0].LockHash == bob && w[0].ReceiverLockHash == carol && w[0].Version == 1
+		}},
+		{"claim_update_v2", func(p biz.KvPair) bool {
+			h, c := p.HoldCotas, p.ClaimedCotas
+			return len(h) == 1 && h[0].TokenIndex == 8 && h[0].Characteristic == updatedChar && len(c) == 1 && c[0].OutPoint == outPoint(3)
+		}},
+		{"transfer_update_v2", func(p biz.KvPair) bool {
+			c, w := p.ClaimedCotas, p.WithdrawCotas
+			return len(c) == 1 && c[0].TokenIndex == 11 && c[0].OutPoint == outPoint(6) &&
+				len(w) == 1 && w[0].TokenIndex == 11 && w[0].Characteristic == updatedChar && w[0].ReceiverLockHash == alice && w[0].Version == 2
+		}},
+		{"extension_subkey_v2", func(p biz.KvPair) bool {
+			k := p.SubKeyPairs
+			return len(k) == 2 && k[0].LockHash == carol && k[0].ExtData == 1 && k[0].AlgIndex == 1 && k[0].PubkeyHash == strings.Repeat("21", 20) &&
+				k[1].ExtData == 2 && k[1].AlgIndex == 2 && k[1].PubkeyHash == strings.Repeat("22", 20)
+		}},
+		{"extension_social_v2", func(p biz.KvPair) bool {
+			s := p.UpdatedSocialPairs
+			return len(s) == 1 && s[0].LockHash == carol && s[0].RecoveryMode == 0 && s[0].Must == 1 && s[0].Total == 2 && strings.Count(s[0].Signers, ",") == 1 &&
+				strings.Contains(s[0].Signers, strings.Repeat("b0", 20)) && strings.Contains(s[0].Signers, "0001"+strings.Repeat("c0", 20))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join("testdata", "golden", tt.name+".json")
+			if fixture, _, _ := loadGoldenFixture(t, path); !fixture.Synthetic {
+				t.Fatalf("%s is not a synthetic fixture", tt.name)
+			}
+			if kvPair := parseGoldenKvPair(t, "keys_"+tt.name, path); !tt.check(kvPair) {
+				got, _ := json.MarshalIndent(kvPair, "", "  ")
+				t.Errorf("key fields of %s differ from the corpus:\n%s", tt.name, got)
+			}
+		})
+	}
+}
+
+// TestBlockSyncer_goldenCaptured checks that testdata/golden/capture.txt names a transaction to
+// capture for every action and version of the synthetic corpus, and lists the actions and versions
+// that have no captured fixture yet. It is skipped until all of them are captured, unless
+// COTA_GOLDEN_REQUIRE_CAPTURED is set.
+func TestBlockSyncer_goldenCaptured(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "golden", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := os.ReadFile(filepath.Join("testdata", "golden", "capture.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed := make(map[string]bool)
+	for _, line := range strings.Split(string(manifest), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && !strings.HasPrefix(fields[0], "#") {
+			listed[fields[0]] = true
+		}
+	}
+	var synthetic, captured []string
+	for _, path := range paths {
+		if strings.HasSuffix(path, ".golden.json") {
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		if fixture, _, _ := loadGoldenFixture(t, path); fixture.Synthetic {
+			synthetic = append(synthetic, name)
+		} else {
+			captured = append(captured, name)
+		}
+	}
+	var missing []string
+	for _, name := range synthetic {
+		hasListed, hasCaptured := false, false
+		for entry := range listed {
+			hasListed = hasListed || strings.HasPrefix(entry, name+"_")
+		}
+		for _, c := range captured {
+			hasCaptured = hasCaptured || strings.HasPrefix(c, name+"_")
+		}
+		if !hasListed {
+			t.Errorf("capture.txt has no transaction to capture for %s", name)
+		}
+		if !hasCaptured {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		if os.Getenv("COTA_GOLDEN_REQUIRE_CAPTURED") != "" {
+			t.Fatalf("no captured fixture for %s", strings.Join(missing, ", "))
+		}
+		t.Skipf("no captured fixture for %s", strings.Join(missing, ", "))
+	}
+}
+
+// loadGoldenFixture returns the fixture with its transaction and the transactions of its inputs
+func loadGoldenFixture(t testing.TB, path string) (goldenFixture, *ckbTypes.Transaction, []*ckbTypes.Transaction) {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fixture goldenFixture
+	if err = json.Unmarshal(content, &fixture); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := ckbtest.UnmarshalTransaction(fixture.Transaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var previous []*ckbTypes.Transaction
+	for _, raw := range fixture.PreviousTransactions {
+		previousTx, err := ckbtest.UnmarshalTransaction(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		previous = append(previous, previousTx)
+	}
+	return fixture, tx, previous
+}
+
+// fixtureSyncer is a block syncer reading the transactions of the inputs from a fake node
+type fixtureSyncer struct {
+	data          *Data
+	parser        CotaWitnessArgsParser
+	systemScripts SystemScripts
+	syncer        BlockSyncer
+}
+
+// newFixtureSyncer starts a node serving the previous transactions. A database per name keeps the
+// script ids of the golden files stable.
+func newFixtureSyncer(t testing.TB, name, chainName string, previous []*ckbTypes.Transaction) fixtureSyncer {
+	t.Helper()
+	// the node serves the transactions of the inputs to the witness args parser
+	chain := ckbtest.NewChain(chainName)
+	chain.AddBlock(previous...)
+	server := ckbtest.NewServer(chain)
+	t.Cleanup(server.Close)
+
+	log := logger.NewLogger(io.Discard, "", 0)
+	data := newTestData(t, DriverSqlite, "file:"+name+"?mode=memory&cache=shared")
+	client, err := NewCkbNodeClient(&config.CkbNode{RpcUrl: server.URL}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Rpc.Close)
+	systemScripts := NewSystemScripts(client, log)
+	parser := NewCotaWitnessArgsParser(client)
+	syncer := NewBlockSyncer(
+		biz.NewClaimedCotaNftKvPairUsecase(NewClaimedCotaNftKvPairRepo(data, log), log),
+		biz.NewDefineCotaNftKvPairUsecase(NewDefineCotaNftKvPairRepo(data, log), log),
+		biz.NewHoldCotaNftKvPairUsecase(NewHoldCotaNftKvPairRepo(data, log), log),
+		biz.NewRegisterCotaKvPairUsecase(NewRegisterCotaKvPairRepo(data, log), log),
+		biz.NewWithdrawCotaNftKvPairUsecase(NewWithdrawCotaNftKvPairRepo(data, log), log),
+		parser,
+		biz.NewSyncKvPairUsecase(newTestKvPairRepo(data), log),
+		biz.NewMintCotaKvPairUsecase(NewMintCotaKvPairRepo(data, log), log),
+		biz.NewTransferCotaKvPairUsecase(NewTransferCotaKvPairRepo(data, log), log),
+		biz.NewIssuerInfoUsecase(NewIssuerInfoRepo(data, log), log),
+		biz.NewClassInfoUsecase(NewClassInfoRepo(data, log), log),
+		biz.NewJoyIDInfoUsecase(NewJoyIDInfoRepo(data, log), log),
+		biz.NewExtensionPairUsecase(NewExtensionKvPairRepo(data, log), log),
+		biz.NewSubKeyPairRepoUsecase(NewSubKeyKvPairRepo(data, log), log),
+	)
+	return fixtureSyncer{data: data, parser: parser, systemScripts: systemScripts, syncer: syncer}
+}
+
+// goldenWitnesses returns the non empty witnesses of every fixture, they seed the fuzz tests
+func goldenWitnesses(t testing.TB) [][]byte {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join("testdata", "golden", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var witnesses [][]byte
+	for _, path := range paths {
+		if strings.HasSuffix(path, ".golden.json") {
+			continue
+		}
+		_, tx, _ := loadGoldenFixture(t, path)
+		for _, witness := range tx.Witnesses {
+			if len(witness) > 0 {
+				witnesses = append(witnesses, witness)
+			}
+		}
+	}
+	return witnesses
+}
+
+// clearParseTimes zeroes the times some parsers set to the parse time
+func clearParseTimes(kvPair *biz.KvPair) {
+	for _, pairs := range [][]biz.DefineCotaNftKvPair{kvPair.DefineCotas, kvPair.UpdatedDefineCotas} {
+		for i := range pairs {
+			pairs[i].UpdatedAt = time.Time{}
+		}
+	}
+	for _, pairs := range [][]biz.HoldCotaNftKvPair{kvPair.HoldCotas, kvPair.UpdatedHoldCotas} {
+		for i := range pairs {
+			pairs[i].UpdatedAt = time.Time{}
+		}
+	}
+	for _, pairs := range [][]biz.SubKeyPair{kvPair.SubKeyPairs, kvPair.UpdatedSubKeyPairs} {
+		for i := range pairs {
+			pairs[i].UpdatedAt = time.Time{}
+		}
+	}
+	for _, pairs := range [][]biz.SocialKvPair{kvPair.SocialPairs, kvPair.UpdatedSocialPairs} {
+		for i := range pairs {
+			pairs[i].UpdatedAt = time.Time{}
+		}
+	}
+}
+
+// goldenInputTypes returns the input types of the witness args of every fixture, the first byte is
+// the action of the entry
+func goldenInputTypes(t testing.TB) [][]byte {
+	t.Helper()
+	var inputTypes [][]byte
+	for _, witness := range goldenWitnesses(t) {
+		witnessArgs, err := blockchain.WitnessArgsFromSlice(witness, true)
+		if err != nil || witnessArgs.InputType().IsNone() {
+			continue
+		}
+		inputType, err := witnessArgs.InputType().IntoBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputTypes = append(inputTypes, inputType.RawData())
+	}
+	return inputTypes
+}
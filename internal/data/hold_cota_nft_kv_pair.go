@@ -74,7 +74,10 @@ func (rp holdCotaNftKvPairRepo) DeleteHoldCotaNftKvPairs(ctx context.Context, bl
 }
 
 func (rp holdCotaNftKvPairRepo) ParseHoldCotaEntries(blockNumber uint64, entry biz.Entry) (holdCotas []biz.HoldCotaNftKvPair, err error) {
-	entries := smt.UpdateCotaNFTEntriesFromSliceUnchecked(entry.InputType[1:])
+	entries, err := decodeMolecule("update entries", entry.InputType[1:], smt.UpdateCotaNFTEntriesFromSlice)
+	if err != nil {
+		return
+	}
 	holdCotaKeyVec := entries.HoldKeys()
 	holdCotaValueVec := entries.HoldNewValues()
 	lockHash, err := entry.LockScript.Hash()
@@ -83,6 +86,9 @@ func (rp holdCotaNftKvPairRepo) ParseHoldCotaEntries(blockNumber uint64, entry b
 	}
 	lockHashStr := lockHash.String()[2:]
 	lockHashCRC32 := crc32.ChecksumIEEE([]byte(lockHashStr))
+	if err = checkPairs("hold entries", holdCotaKeyVec.Len(), holdCotaValueVec.Len()); err != nil {
+		return
+	}
 	for i := uint(0); i < holdCotaKeyVec.Len(); i++ {
 		key := holdCotaKeyVec.Get(i)
 		value := holdCotaValueVec.Get(i)
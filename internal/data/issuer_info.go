@@ -85,6 +85,7 @@ func (repo issuerInfoRepo) ParseIssuerInfo(blockNumber uint64, txIndex uint32, l
 	var issuerInfo biz.IssuerInfoJson
 	err = mapstructure.Decode(issuerMeta, &issuerInfo)
 	if err != nil {
+		err = malformedEntry("issuer info: %v", err)
 		return
 	}
 	localization, err := json.Marshal(issuerInfo.Localization)
@@ -0,0 +1,183 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+	"gorm.io/gorm"
+)
+
+var _ biz.JoyIDDeviceRepo = (*joyIDDeviceRepo)(nil)
+
+type joyIDDeviceRepo struct {
+	data   *Data
+	logger *logger.Logger
+}
+
+func NewJoyIDDeviceRepo(data *Data, logger *logger.Logger) biz.JoyIDDeviceRepo {
+	return &joyIDDeviceRepo{
+		data:   data,
+		logger: logger,
+	}
+}
+
+// FindJoyIDInfo returns the JoyID metadata of the lock with its sub keys, nil without metadata
+func (rp joyIDDeviceRepo) FindJoyIDInfo(ctx context.Context, lockHash string) (*biz.JoyIDInfo, error) {
+	var joyID JoyIDInfo
+	err := rp.data.db.WithContext(ctx).Where("lock_hash = ?", lockHash).First(&joyID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var subKeys []SubKeyInfo
+	if err = rp.data.db.WithContext(ctx).Where("lock_hash = ?", lockHash).Order("id").Find(&subKeys).Error; err != nil {
+		return nil, err
+	}
+	info := &biz.JoyIDInfo{
+		BlockNumber:          joyID.BlockNumber,
+		LockHash:             joyID.LockHash,
+		Version:              joyID.Version,
+		PubKey:               joyID.PubKey,
+		CredentialId:         joyID.CredentialId,
+		Alg:                  joyID.Alg,
+		FrontEnd:             joyID.FrontEnd,
+		DeviceName:           joyID.DeviceName,
+		DeviceType:           joyID.DeviceType,
+		CotaCellId:           joyID.CotaCellId,
+		Name:                 joyID.Name,
+		Avatar:               joyID.Avatar,
+		Description:          joyID.Description,
+		Extension:            joyID.Extension,
+		DerivationCId:        joyID.DerivationCId,
+		DerivationCommitment: joyID.DerivationCommitment,
+		SubKeys:              make([]biz.SubKeyInfo, len(subKeys)),
+	}
+	for i, subKey := range subKeys {
+		info.SubKeys[i] = biz.SubKeyInfo{
+			BlockNumber:          subKey.BlockNumber,
+			LockHash:             subKey.LockHash,
+			PubKey:               subKey.PubKey,
+			CredentialId:         subKey.CredentialId,
+			Alg:                  subKey.Alg,
+			FrontEnd:             subKey.FrontEnd,
+			DeviceName:           subKey.DeviceName,
+			DeviceType:           subKey.DeviceType,
+			DerivationCId:        subKey.DerivationCId,
+			DerivationCommitment: subKey.DerivationCommitment,
+		}
+	}
+	return info, nil
+}
+
+func (rp joyIDDeviceRepo) FindSubKeyPairs(ctx context.Context, lockHash string) ([]biz.SubKeyPair, error) {
+	var rows []SubKeyKvPair
+	if err := rp.data.db.WithContext(ctx).Where("lock_hash = ?", lockHash).Order("ext_data").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	pairs := make([]biz.SubKeyPair, len(rows))
+	for i, row := range rows {
+		pairs[i] = subKeyPair(row)
+	}
+	return pairs, nil
+}
+
+// FindSubKeyPairAt returns the entry of the sub key SMT of the lock holding the pubkey hash at the
+// block, nil when no entry holds it. The entry of an ext data at the block is the old value of its
+// first version after the block, or its current row when it has no later version.
+func (rp joyIDDeviceRepo) FindSubKeyPairAt(ctx context.Context, lockHash string, pubkeyHash string, blockNumber *uint64) (*biz.SubKeyPair, error) {
+	db := rp.data.db.WithContext(ctx)
+	if blockNumber == nil {
+		var row SubKeyKvPair
+		err := db.Where("lock_hash = ? and pubkey_hash = ?", lockHash, pubkeyHash).Order("ext_data").First(&row).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		pair := subKeyPair(row)
+		return &pair, nil
+	}
+	height, err := findPruneHeight(ctx, rp.data.db, biz.SyncBlock)
+	if err != nil {
+		return nil, err
+	}
+	if *blockNumber < height {
+		return nil, fmt.Errorf("%w: block %d, the versions are kept from block %d", biz.ErrQueryBeyondRetention, *blockNumber, height)
+	}
+	// the ext data that hold the pubkey hash now or held it at any retained version
+	var extData []uint32
+	if err = db.Model(SubKeyKvPair{}).Where("lock_hash = ? and pubkey_hash = ?", lockHash, pubkeyHash).Pluck("ext_data", &extData).Error; err != nil {
+		return nil, err
+	}
+	var versioned []uint32
+	if err = db.Model(SubKeyKvPairVersion{}).Distinct("ext_data").Where("lock_hash = ? and (pubkey_hash = ? or old_pubkey_hash = ?)", lockHash, pubkeyHash, pubkeyHash).
+		Pluck("ext_data", &versioned).Error; err != nil {
+		return nil, err
+	}
+	seen := make(map[uint32]bool, len(extData)+len(versioned))
+	var found *biz.SubKeyPair
+	for _, ext := range append(extData, versioned...) {
+		if seen[ext] {
+			continue
+		}
+		seen[ext] = true
+		pair, err := rp.subKeyPairAt(ctx, lockHash, ext, *blockNumber)
+		if err != nil {
+			return nil, err
+		}
+		if pair != nil && pair.PubkeyHash == pubkeyHash && (found == nil || pair.ExtData < found.ExtData) {
+			found = pair
+		}
+	}
+	return found, nil
+}
+
+// subKeyPairAt returns the entry of an ext data at the block, nil when it was not created yet
+func (rp joyIDDeviceRepo) subKeyPairAt(ctx context.Context, lockHash string, extData uint32, blockNumber uint64) (*biz.SubKeyPair, error) {
+	db := rp.data.db.WithContext(ctx)
+	var versions []SubKeyKvPairVersion
+	if err := db.Where("lock_hash = ? and ext_data = ? and block_number > ?", lockHash, extData, blockNumber).Order("block_number, id").Limit(1).Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	if len(versions) > 0 {
+		version := versions[0]
+		if version.ActionType == 0 {
+			return nil, nil
+		}
+		return &biz.SubKeyPair{
+			BlockNumber: version.OldBlockNumber,
+			LockHash:    version.LockHash,
+			SubType:     version.SubType,
+			ExtData:     version.ExtData,
+			AlgIndex:    version.OldAlgIndex,
+			PubkeyHash:  version.OldPubkeyHash,
+		}, nil
+	}
+	var rows []SubKeyKvPair
+	if err := db.Where("lock_hash = ? and ext_data = ? and block_number <= ?", lockHash, extData, blockNumber).Limit(1).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	pair := subKeyPair(rows[0])
+	return &pair, nil
+}
+
+func subKeyPair(row SubKeyKvPair) biz.SubKeyPair {
+	return biz.SubKeyPair{
+		BlockNumber: row.BlockNumber,
+		LockHash:    row.LockHash,
+		SubType:     row.SubType,
+		ExtData:     row.ExtData,
+		AlgIndex:    row.AlgIndex,
+		PubkeyHash:  row.PubkeyHash,
+		UpdatedAt:   row.UpdatedAt,
+	}
+}
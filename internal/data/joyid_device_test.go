@@ -0,0 +1,118 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+func TestJoyIDDeviceRepo_devices(t *testing.T) {
+	ctx := context.Background()
+	log := logger.NewLogger(io.Discard, "", 0)
+	data := newTestData(t, DriverSqlite, "file:joyid_devices?mode=memory&cache=shared")
+	kvPairs := newTestKvPairRepo(data)
+	uc := biz.NewJoyIDDeviceUsecase(NewJoyIDDeviceRepo(data, log), log)
+	hash := func(pubKey string) string {
+		t.Helper()
+		pubkeyHash, err := biz.SubKeyPubkeyHash(pubKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pubkeyHash
+	}
+	unknown := "ffffffffffffffffffffffffffffffffffffffff"
+
+	if _, err := uc.Registry(ctx, lockA); !errors.Is(err, biz.ErrJoyIDNotFound) {
+		t.Errorf("Registry() without keys error = %v", err)
+	}
+	if err := kvPairs.CreateMetadataKvPairs(ctx, biz.CheckInfo{BlockNumber: 100, BlockHash: "h", CheckType: biz.SyncMetadata}, &biz.KvPair{
+		JoyIDInfos: []biz.JoyIDInfo{testJoyID(100, 0, "phone", "02", "03")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := kvPairs.CreateCotaEntryKvPairs(ctx, biz.CheckInfo{BlockNumber: 100, BlockHash: "h", CheckType: biz.SyncBlock}, &biz.KvPair{
+		SubKeyPairs: []biz.SubKeyPair{testSubKey(100, 0, 2, unknown), testSubKey(100, 0, 1, hash("02"))},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	registry, err := uc.Registry(ctx, lockA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		status     biz.DeviceStatus
+		pubkeyHash string
+		extData    int64
+	}{
+		{biz.DeviceMain, hash("01"), -1},
+		{biz.DeviceRegistered, hash("02"), 1},
+		{biz.DeviceNotOnChain, hash("03"), -1},
+		{biz.DeviceNoMetadata, unknown, 2},
+	}
+	if len(registry.Devices) != len(want) || registry.NotOnChain != 1 {
+		t.Fatalf("Registry() = %+v, want %d devices and 1 not on chain", registry, len(want))
+	}
+	for i, w := range want {
+		device := registry.Devices[i]
+		extData := int64(-1)
+		if device.ExtData != nil {
+			extData = int64(*device.ExtData)
+		}
+		if device.Status != w.status || device.PubkeyHash != w.pubkeyHash || extData != w.extData {
+			t.Errorf("device %d = %+v, want %+v", i, device, w)
+		}
+	}
+	if registry.Devices[1].DeviceName != "phone" || registry.Devices[1].SmtBlockNumber != 100 {
+		t.Errorf("registered device = %+v, want the metadata and the SMT entry", registry.Devices[1])
+	}
+
+	// the sub key of ext data 1 moves to the pub key 03 at block 101
+	if err = kvPairs.CreateCotaEntryKvPairs(ctx, biz.CheckInfo{BlockNumber: 101, BlockHash: "h", CheckType: biz.SyncBlock}, &biz.KvPair{
+		UpdatedSubKeyPairs: []biz.SubKeyPair{testSubKey(101, 0, 1, hash("03"))},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	at := func(block uint64) *uint64 { return &block }
+	tests := []struct {
+		name        string
+		pubkeyHash  string
+		blockNumber *uint64
+		authorized  bool
+		since       uint64
+	}{
+		{"latest replaced key", hash("02"), nil, false, 0},
+		{"latest new key", hash("03"), nil, true, 101},
+		{"before the SMT", hash("02"), at(99), false, 0},
+		{"replaced key before the update", hash("02"), at(100), true, 100},
+		{"new key before the update", hash("03"), at(100), false, 0},
+		{"replaced key after the update", hash("02"), at(101), false, 0},
+		{"new key after the update", hash("03"), at(150), true, 101},
+		{"unknown key", unknown, at(100), true, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authorization, err := uc.Authorization(ctx, lockA, tt.pubkeyHash, tt.blockNumber)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if authorization.Authorized != tt.authorized || authorization.Since != tt.since {
+				t.Errorf("Authorization() = %+v, want authorized %v since %d", authorization, tt.authorized, tt.since)
+			}
+		})
+	}
+	if registry, err = uc.Registry(ctx, lockA); err != nil || registry.NotOnChain != 1 || registry.Devices[1].Status != biz.DeviceNotOnChain ||
+		registry.Devices[2].Status != biz.DeviceRegistered {
+		t.Errorf("Registry() after the update = %+v, %v", registry, err)
+	}
+
+	if err = data.db.Create(&VersionPruneHeight{CheckType: biz.SyncBlock, BlockNumber: 101}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err = uc.Authorization(ctx, lockA, hash("02"), at(100)); !errors.Is(err, biz.ErrQueryBeyondRetention) {
+		t.Errorf("Authorization() below the prune height error = %v", err)
+	}
+}
@@ -141,6 +141,7 @@ func (repo joyIDInfoRepo) ParseJoyIDInfo(ctx context.Context, blockNumber uint64
 	var joyIDInfo biz.JoyIDInfoJson
 	err = mapstructure.Decode(joyIDMeta, &joyIDInfo)
 	if err != nil {
+		err = malformedEntry("joyid info: %v", err)
 		return
 	}
 	if lenWithout0x(joyIDInfo.PubKey) > 128 || lenWithout0x(joyIDInfo.CotaCellId) > 16 || lenWithout0x(joyIDInfo.Alg) > 2 {
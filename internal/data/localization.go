@@ -0,0 +1,264 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/config"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var _ biz.LocalizationRepo = (*localizationRepo)(nil)
+
+// maxLocalizedDocumentSize bounds the body read from a localization uri
+const maxLocalizedDocumentSize = 1 << 20
+
+// LocalizedMetadata caches the name and description of an issuer or a class in one locale. A row is
+// used only while Localization equals the localization of the info, so an update or a rollback of the
+// info makes the fetcher fetch it again.
+type LocalizedMetadata struct {
+	ID           uint `gorm:"primaryKey"`
+	MetaType     string
+	MetaKey      string
+	Locale       string
+	Uri          string
+	Localization string
+	Name         string
+	Description  string
+	FetchError   string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (LocalizedMetadata) TableName() string {
+	return "localized_metadata"
+}
+
+type localizationRepo struct {
+	data   *Data
+	logger *logger.Logger
+}
+
+func NewLocalizationRepo(data *Data, logger *logger.Logger) biz.LocalizationRepo {
+	return &localizationRepo{
+		data:   data,
+		logger: logger,
+	}
+}
+
+func (rp localizationRepo) FindLocalizationSources(ctx context.Context, metaType string, afterId uint64, limit int) ([]biz.LocalizationSource, error) {
+	var (
+		model any
+		key   string
+	)
+	switch metaType {
+	case biz.LocalizedIssuer:
+		model, key = IssuerInfo{}, "lock_hash"
+	case biz.LocalizedClass:
+		model, key = ClassInfo{}, "cota_id"
+	default:
+		return nil, fmt.Errorf("unknown localized meta type %q", metaType)
+	}
+	var rows []struct {
+		ID           uint64
+		MetaKey      string
+		Localization string
+	}
+	if err := rp.data.db.WithContext(ctx).Model(model).Select("id, "+key+" as meta_key, localization").
+		Where("id > ? and localization <> ''", afterId).Order("id").Limit(limit).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	sources := make([]biz.LocalizationSource, len(rows))
+	for i, row := range rows {
+		sources[i] = biz.LocalizationSource{Id: row.ID, MetaType: metaType, Key: row.MetaKey, Localization: row.Localization}
+	}
+	return sources, nil
+}
+
+func (rp localizationRepo) FindLocalizedMetadata(ctx context.Context, metaType string, key string) ([]biz.LocalizedMetadata, error) {
+	var rows []LocalizedMetadata
+	if err := rp.data.db.WithContext(ctx).Where("meta_type = ? and meta_key = ?", metaType, key).Order("locale").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	metadata := make([]biz.LocalizedMetadata, len(rows))
+	for i, row := range rows {
+		metadata[i] = biz.LocalizedMetadata{
+			MetaType:     row.MetaType,
+			Key:          row.MetaKey,
+			Locale:       row.Locale,
+			Uri:          row.Uri,
+			Localization: row.Localization,
+			Name:         row.Name,
+			Description:  row.Description,
+			Error:        row.FetchError,
+			UpdatedAt:    row.UpdatedAt,
+		}
+	}
+	return metadata, nil
+}
+
+func (rp localizationRepo) SaveLocalizedMetadata(ctx context.Context, metadata biz.LocalizedMetadata) error {
+	return rp.data.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "meta_type"}, {Name: "meta_key"}, {Name: "locale"}},
+		DoUpdates: clause.AssignmentColumns([]string{"uri", "localization", "name", "description", "fetch_error", "updated_at"}),
+	}).Create(&LocalizedMetadata{
+		MetaType:     metadata.MetaType,
+		MetaKey:      metadata.Key,
+		Locale:       metadata.Locale,
+		Uri:          metadata.Uri,
+		Localization: metadata.Localization,
+		Name:         metadata.Name,
+		Description:  metadata.Description,
+		FetchError:   metadata.Error,
+	}).Error
+}
+
+func (rp localizationRepo) FindIssuerInfo(ctx context.Context, lockHash string) (biz.LocalizedIssuerInfo, error) {
+	var issuer IssuerInfo
+	err := rp.data.db.WithContext(ctx).Where("lock_hash = ?", lockHash).First(&issuer).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return biz.LocalizedIssuerInfo{}, biz.ErrInfoNotFound
+	}
+	if err != nil {
+		return biz.LocalizedIssuerInfo{}, err
+	}
+	return biz.LocalizedIssuerInfo{
+		LockHash:     issuer.LockHash,
+		Version:      issuer.Version,
+		Name:         issuer.Name,
+		Avatar:       issuer.Avatar,
+		Description:  issuer.Description,
+		Localization: issuer.Localization,
+	}, nil
+}
+
+func (rp localizationRepo) FindClassInfo(ctx context.Context, cotaId string) (biz.LocalizedClassInfo, error) {
+	var class ClassInfo
+	err := rp.data.db.WithContext(ctx).Where("cota_id = ?", cotaId).First(&class).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return biz.LocalizedClassInfo{}, biz.ErrInfoNotFound
+	}
+	if err != nil {
+		return biz.LocalizedClassInfo{}, err
+	}
+	return biz.LocalizedClassInfo{
+		CotaId:         class.CotaId,
+		Version:        class.Version,
+		Name:           class.Name,
+		Symbol:         class.Symbol,
+		Description:    class.Description,
+		Image:          class.Image,
+		Audio:          class.Audio,
+		Video:          class.Video,
+		Model:          class.Model,
+		Characteristic: class.Characteristic,
+		Properties:     class.Properties,
+		Localization:   class.Localization,
+	}, nil
+}
+
+// httpLocalizationFetcher fetches localization documents over http and https. ipfs:// and ar:// uris
+// go through the media gateways, and the dialer refuses the loopback, private and link-local addresses
+// unless AllowPrivateNetworks is set, so a localization uri can not reach the internal network.
+type httpLocalizationFetcher struct {
+	client *http.Client
+	media  *MediaNormalizer
+}
+
+func NewLocalizationFetcher(conf *config.Localization, media *MediaNormalizer) biz.LocalizationFetcher {
+	timeout := conf.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	if !conf.AllowPrivateNetworks {
+		dialer.Control = publicAddressControl
+	}
+	client := &http.Client{
+		Timeout: timeout,
+		// no proxy, the dialer must see the address of the document host
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: timeout},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxLocalizationRedirects {
+				return fmt.Errorf("fetch %s: over %d redirects", via[0].URL, maxLocalizationRedirects)
+			}
+			return checkLocalizationScheme(req.URL)
+		},
+	}
+	return httpLocalizationFetcher{client: client, media: media}
+}
+
+// maxLocalizationRedirects bounds the redirects followed by a fetch
+const maxLocalizationRedirects = 3
+
+func checkLocalizationScheme(uri *url.URL) error {
+	if uri.Scheme != "http" && uri.Scheme != "https" {
+		return fmt.Errorf("fetch %s: unsupported scheme %q", uri.Redacted(), uri.Scheme)
+	}
+	return nil
+}
+
+// publicAddressControl refuses the connections to non-public addresses. It runs after the name is
+// resolved, so a public name resolving to an internal address is refused too.
+func publicAddressControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("dial %s: not a public address", address)
+	}
+	return nil
+}
+
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip))
+}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598, which net.IP.IsPrivate leaves out
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func (f httpLocalizationFetcher) Fetch(ctx context.Context, uri string) ([]byte, error) {
+	if ref := f.media.Normalize(uri); ref.Kind == biz.MediaIpfs || ref.Kind == biz.MediaArweave {
+		uri = ref.Url
+	}
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkLocalizationScheme(parsed); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: status %d", uri, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxLocalizedDocumentSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxLocalizedDocumentSize {
+		return nil, fmt.Errorf("fetch %s: document over %d bytes", uri, maxLocalizedDocumentSize)
+	}
+	return body, nil
+}
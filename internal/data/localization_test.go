@@ -0,0 +1,146 @@
+package data
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/config"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+func TestLocalizationUsecase_fetchAndQuery(t *testing.T) {
+	ctx := context.Background()
+	data := newTestData(t, DriverSqlite, "file:localization?mode=memory&cache=shared")
+	log := logger.NewLogger(io.Discard, "", 0)
+	dir := t.TempDir()
+	for name, document := range map[string]string{
+		"class/en.json":  `{"name":"Kernel","description":"the core"}`,
+		"class/zh.json":  `{"name":"内核","description":"核心"}`,
+		"issuer/de.json": `{"name":"Kevin","description":"nur ein Mann"}`,
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(document), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	t.Cleanup(server.Close)
+
+	classLocalization := `{"uri":"` + server.URL + `/class/{locale}.json","default":"en","locales":["en","zh","fr"]}`
+	issuer := testIssuer(100, 0, lockA, "kevin")
+	issuer.Localization = `{"uri":"` + server.URL + `/issuer/{locale}.json","default":"de"}`
+	class := testClass(100, 1, "chain")
+	class.Localization = classLocalization
+	kvPairs := newTestKvPairRepo(data)
+	if err := kvPairs.CreateMetadataKvPairs(ctx, biz.CheckInfo{BlockNumber: 100, BlockHash: "h", CheckType: biz.SyncMetadata}, &biz.KvPair{
+		IssuerInfos: []biz.IssuerInfo{issuer}, ClassInfos: []biz.ClassInfo{class},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewLocalizationRepo(data, log)
+	uc := biz.NewLocalizationUsecase(repo, NewLocalizationFetcher(&config.Localization{Timeout: time.Second, AllowPrivateNetworks: true}, NewMediaNormalizer(&config.Media{})), log)
+	if next, fetched, err := uc.Refresh(ctx, biz.LocalizedClass, 0, 10, time.Hour); err != nil || next != 0 || fetched != 3 {
+		t.Fatalf("Refresh() = %d, %d, %v, want the 3 locales of the class", next, fetched, err)
+	}
+	metadata, err := repo.FindLocalizedMetadata(ctx, biz.LocalizedClass, testCotaId)
+	if err != nil || len(metadata) != 3 || metadata[0].Locale != "en" || metadata[0].Name != "Kernel" || metadata[0].Uri != server.URL+"/class/en.json" ||
+		metadata[1].Locale != "fr" || !strings.Contains(metadata[1].Error, "status 404") || metadata[2].Name != "内核" {
+		t.Fatalf("localized metadata = %+v, %v", metadata, err)
+	}
+	if _, fetched, err := uc.Refresh(ctx, biz.LocalizedClass, 0, 10, time.Hour); err != nil || fetched != 0 {
+		t.Errorf("Refresh() again = %d, %v, want nothing fetched before the retry interval", fetched, err)
+	}
+	if _, fetched, err := uc.Refresh(ctx, biz.LocalizedClass, 0, 10, 0); err != nil || fetched != 1 {
+		t.Errorf("Refresh() after the retry interval = %d, %v, want the failed locale fetched again", fetched, err)
+	}
+	if _, fetched, err := uc.Refresh(ctx, biz.LocalizedIssuer, 0, 10, time.Hour); err != nil || fetched != 1 {
+		t.Errorf("Refresh() of the issuers = %d, %v, want the default locale", fetched, err)
+	}
+
+	tests := []struct {
+		locale, wantLocale, wantName string
+	}{
+		{locale: "zh", wantLocale: "zh", wantName: "内核"},
+		{locale: "fr", wantLocale: "en", wantName: "Kernel"},
+		{locale: "", wantLocale: "en", wantName: "Kernel"},
+	}
+	for _, tt := range tests {
+		info, err := uc.ClassInfo(ctx, testCotaId, tt.locale)
+		if err != nil || info.Locale != tt.wantLocale || info.Name != tt.wantName || info.Symbol != "T" {
+			t.Errorf("ClassInfo(%q) = %+v, %v, want %s in %q", tt.locale, info, err, tt.wantName, tt.wantLocale)
+		}
+	}
+	if info, err := uc.IssuerInfo(ctx, lockA, "en"); err != nil || info.Locale != "de" || info.Description != "nur ein Mann" {
+		t.Errorf("IssuerInfo() = %+v, %v, want the default locale de", info, err)
+	}
+	if _, err = uc.IssuerInfo(ctx, lockB, "en"); err != biz.ErrInfoNotFound {
+		t.Errorf("IssuerInfo() of an unknown issuer = %v, want ErrInfoNotFound", err)
+	}
+
+	// a new localization leaves the cached documents unused until they are fetched for it
+	class = testClass(101, 0, "renamed")
+	class.Localization = strings.Replace(classLocalization, `"default":"en"`, `"default":"zh"`, 1)
+	if err = kvPairs.CreateMetadataKvPairs(ctx, biz.CheckInfo{BlockNumber: 101, BlockHash: "h", CheckType: biz.SyncMetadata}, &biz.KvPair{ClassInfos: []biz.ClassInfo{class}}); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := uc.ClassInfo(ctx, testCotaId, "zh"); err != nil || info.Locale != "" || info.Name != "renamed" {
+		t.Errorf("ClassInfo() after an update = %+v, %v, want the name on chain", info, err)
+	}
+	if _, fetched, err := uc.Refresh(ctx, biz.LocalizedClass, 0, 10, time.Hour); err != nil || fetched != 3 {
+		t.Errorf("Refresh() after an update = %d, %v, want every locale fetched again", fetched, err)
+	}
+	if info, err := uc.ClassInfo(ctx, testCotaId, "fr"); err != nil || info.Locale != "zh" || info.Name != "内核" {
+		t.Errorf("ClassInfo() after the refresh = %+v, %v, want the new default locale zh", info, err)
+	}
+}
+
+func TestLocalizationFetcher_Fetch(t *testing.T) {
+	ctx := context.Background()
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/loop"):
+			http.Redirect(w, r, r.URL.Path+"x", http.StatusFound)
+		case r.URL.Path == "/file":
+			http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	media := NewMediaNormalizer(&config.Media{IpfsGateway: server.URL + "/ipfs/"})
+
+	public := NewLocalizationFetcher(&config.Localization{Timeout: time.Second}, media)
+	for _, uri := range []string{server.URL + "/en.json", "http://169.254.169.254/latest/meta-data", "http://10.0.0.1/en.json", "http://[::1]/en.json", "file:///etc/passwd", "gopher://example.com/"} {
+		if _, err := public.Fetch(ctx, uri); err == nil {
+			t.Errorf("Fetch(%s) expected an error", uri)
+		}
+	}
+	if len(paths) != 0 {
+		t.Fatalf("the server got %v, want every fetch refused before the request", paths)
+	}
+
+	private := NewLocalizationFetcher(&config.Localization{Timeout: time.Second, AllowPrivateNetworks: true}, media)
+	cid := "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+	if body, err := private.Fetch(ctx, "ipfs://"+cid+"/en.json"); err != nil || string(body) != "{}" || paths[0] != "/ipfs/"+cid+"/en.json" {
+		t.Errorf("Fetch(ipfs) = %s, %v after %v, want the document from the gateway", body, err, paths)
+	}
+	if _, err := private.Fetch(ctx, server.URL+"/loop"); err == nil || !strings.Contains(err.Error(), "redirects") {
+		t.Errorf("Fetch() of a redirect loop = %v, want the redirect limit", err)
+	}
+	if _, err := private.Fetch(ctx, server.URL+"/file"); err == nil || !strings.Contains(err.Error(), "unsupported scheme") {
+		t.Errorf("Fetch() redirected to a file = %v, want an unsupported scheme", err)
+	}
+}
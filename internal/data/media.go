@@ -0,0 +1,226 @@
+package data
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/config"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+	"gorm.io/gorm"
+)
+
+var _ biz.MediaRepo = (*mediaRepo)(nil)
+
+const (
+	defaultIpfsGateway    = "https://ipfs.io/ipfs/"
+	defaultArweaveGateway = "https://arweave.net/"
+)
+
+var (
+	// ipfsCid matches a CIDv0 in base58 or a CIDv1 in base32
+	ipfsCid   = regexp.MustCompile(`^(Qm[1-9A-HJ-NP-Za-km-z]{44}|b[a-z2-7]{58,})$`)
+	arweaveTx = regexp.MustCompile(`^[A-Za-z0-9_-]{43}$`)
+	ipfsPath  = regexp.MustCompile(`^/ipfs/([^/?#]+)(.*)$`)
+)
+
+// MediaNormalizer classifies the media urls of class metadata and rewrites the content-addressed ones
+// to the configured gateways
+type MediaNormalizer struct {
+	ipfsGateway    string
+	arweaveGateway string
+}
+
+func NewMediaNormalizer(conf *config.Media) *MediaNormalizer {
+	return &MediaNormalizer{
+		ipfsGateway:    gatewayPrefix(conf.IpfsGateway, defaultIpfsGateway),
+		arweaveGateway: gatewayPrefix(conf.ArweaveGateway, defaultArweaveGateway),
+	}
+}
+
+func gatewayPrefix(gateway, fallback string) string {
+	if gateway == "" {
+		return fallback
+	}
+	if !strings.HasSuffix(gateway, "/") {
+		gateway += "/"
+	}
+	return gateway
+}
+
+// Normalize classifies a media url by its scheme. ipfs:// and ar:// urls and the /ipfs/ paths of
+// public gateways are rewritten to the gateways, other urls are kept as they are.
+func (m *MediaNormalizer) Normalize(raw string) biz.MediaRef {
+	media := strings.TrimSpace(raw)
+	ref := biz.MediaRef{Raw: raw, Kind: biz.MediaUnknown, Url: raw}
+	if media == "" {
+		return biz.MediaRef{Raw: raw, Kind: biz.MediaNone}
+	}
+	scheme, rest, ok := strings.Cut(media, ":")
+	if !ok {
+		return ref
+	}
+	switch strings.ToLower(scheme) {
+	case "ipfs":
+		// ipfs://<cid>/<path>, or the legacy ipfs://ipfs/<cid>/<path>
+		rest = strings.TrimPrefix(strings.TrimPrefix(rest, "//"), "ipfs/")
+		return m.contentRef(ref, biz.MediaIpfs, rest)
+	case "ar":
+		return m.contentRef(ref, biz.MediaArweave, strings.TrimPrefix(rest, "//"))
+	case "data":
+		ref.Kind = biz.MediaData
+	case "http", "https":
+		ref.Kind = biz.MediaHttp
+		parsed, err := url.Parse(media)
+		if err != nil {
+			return ref
+		}
+		if match := ipfsPath.FindStringSubmatch(parsed.EscapedPath()); match != nil && ipfsCid.MatchString(match[1]) {
+			path := match[1] + match[2]
+			if parsed.RawQuery != "" {
+				path += "?" + parsed.RawQuery
+			}
+			return m.contentRef(ref, biz.MediaIpfs, path)
+		}
+		if host := strings.ToLower(parsed.Hostname()); host == "arweave.net" || strings.HasSuffix(host, ".arweave.net") {
+			if contentRef := m.contentRef(ref, biz.MediaArweave, strings.TrimPrefix(parsed.EscapedPath(), "/")); contentRef.ContentId != "" {
+				return contentRef
+			}
+		}
+	}
+	return ref
+}
+
+// contentRef splits <content id>/<path> and builds the ref and the gateway url, a malformed content id
+// keeps the url as it is
+func (m *MediaNormalizer) contentRef(ref biz.MediaRef, kind biz.MediaKind, path string) biz.MediaRef {
+	end := strings.IndexAny(path, "/?#")
+	if end < 0 {
+		end = len(path)
+	}
+	contentId, suffix := path[:end], path[end:]
+	gateway, scheme, valid := m.ipfsGateway, "ipfs://", ipfsCid
+	if kind == biz.MediaArweave {
+		gateway, scheme, valid = m.arweaveGateway, "ar://", arweaveTx
+	}
+	if !valid.MatchString(contentId) {
+		if ref.Kind == biz.MediaUnknown {
+			ref.Kind = kind
+		}
+		return ref
+	}
+	ref.Kind = kind
+	ref.ContentId = contentId
+	ref.Ref = scheme + contentId + suffix
+	ref.Url = gateway + contentId + suffix
+	return ref
+}
+
+// normalizeClassInfo fills the normalized urls and refs of the media of a class info
+func (m *MediaNormalizer) normalizeClassInfo(class *ClassInfo) {
+	for _, field := range []struct {
+		raw             string
+		normalized, ref *string
+	}{
+		{class.Image, &class.ImageNormalized, &class.ImageRef},
+		{class.Audio, &class.AudioNormalized, &class.AudioRef},
+		{class.Video, &class.VideoNormalized, &class.VideoRef},
+		{class.Model, &class.ModelNormalized, &class.ModelRef},
+	} {
+		media := m.Normalize(field.raw)
+		*field.normalized, *field.ref = media.Url, media.Ref
+	}
+}
+
+func (m *MediaNormalizer) normalizeAudio(audio *TokenClassAudio) {
+	media := m.Normalize(audio.Url)
+	audio.UrlNormalized, audio.UrlRef = media.Url, media.Ref
+}
+
+type mediaRepo struct {
+	data   *Data
+	media  *MediaNormalizer
+	logger *logger.Logger
+}
+
+func NewMediaRepo(data *Data, media *MediaNormalizer, logger *logger.Logger) biz.MediaRepo {
+	return &mediaRepo{
+		data:   data,
+		media:  media,
+		logger: logger,
+	}
+}
+
+func (rp mediaRepo) BackfillMedia(ctx context.Context, batchSize int) (int64, int64, error) {
+	classes, err := backfillRows(ctx, rp.data.db, batchSize, func(class ClassInfo) uint { return class.ID }, func(tx *gorm.DB, class *ClassInfo) (bool, error) {
+		normalized := *class
+		rp.media.normalizeClassInfo(&normalized)
+		if normalized == *class {
+			return false, nil
+		}
+		columns := make(map[string]any, 8)
+		for _, field := range []struct {
+			name            string
+			normalized, ref string
+		}{
+			{"image", normalized.ImageNormalized, normalized.ImageRef},
+			{"audio", normalized.AudioNormalized, normalized.AudioRef},
+			{"video", normalized.VideoNormalized, normalized.VideoRef},
+			{"model", normalized.ModelNormalized, normalized.ModelRef},
+		} {
+			columns[field.name+"_normalized"], columns[field.name+"_ref"] = field.normalized, field.ref
+		}
+		return true, tx.Model(ClassInfo{}).Where("id = ?", class.ID).UpdateColumns(columns).Error
+	})
+	if err != nil {
+		return classes, 0, err
+	}
+	audios, err := backfillRows(ctx, rp.data.db, batchSize, func(audio TokenClassAudio) uint { return audio.ID }, func(tx *gorm.DB, audio *TokenClassAudio) (bool, error) {
+		normalized := *audio
+		rp.media.normalizeAudio(&normalized)
+		if normalized == *audio {
+			return false, nil
+		}
+		return true, tx.Model(TokenClassAudio{}).Where("id = ?", audio.ID).
+			UpdateColumns(map[string]any{"url_normalized": normalized.UrlNormalized, "url_ref": normalized.UrlRef}).Error
+	})
+	return classes, audios, err
+}
+
+// backfillRows calls update on the rows of T in the order of their ids, batchSize rows per
+// transaction, and returns the number of rows update changed
+func backfillRows[T any](ctx context.Context, db *gorm.DB, batchSize int, id func(T) uint, update func(*gorm.DB, *T) (bool, error)) (int64, error) {
+	var (
+		changed int64
+		afterId uint
+	)
+	for {
+		var rows []T
+		if err := db.WithContext(ctx).Where("id > ?", afterId).Order("id").Limit(batchSize).Find(&rows).Error; err != nil {
+			return changed, err
+		}
+		if len(rows) == 0 {
+			return changed, nil
+		}
+		var batch int64
+		err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			for i := range rows {
+				ok, err := update(tx, &rows[i])
+				if err != nil {
+					return err
+				}
+				if ok {
+					batch++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return changed, err
+		}
+		changed += batch
+		afterId = id(rows[len(rows)-1])
+	}
+}
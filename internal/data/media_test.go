@@ -0,0 +1,78 @@
+package data
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/config"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+const (
+	testCidV0 = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+	testCidV1 = "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi"
+	testArTx  = "bNbA3TEQVL60xlgCcqdz4ZPHFZ711cZ3hmkpGttDt_U"
+)
+
+func TestMediaNormalizer_Normalize(t *testing.T) {
+	media := NewMediaNormalizer(&config.Media{IpfsGateway: "https://gw.example/ipfs"})
+	tests := []struct {
+		raw  string
+		want biz.MediaRef
+	}{
+		{"", biz.MediaRef{Kind: biz.MediaNone}},
+		{"ipfs://" + testCidV0, biz.MediaRef{Kind: biz.MediaIpfs, ContentId: testCidV0, Ref: "ipfs://" + testCidV0, Url: "https://gw.example/ipfs/" + testCidV0}},
+		{"ipfs://ipfs/" + testCidV1 + "/song.mp3", biz.MediaRef{Kind: biz.MediaIpfs, ContentId: testCidV1, Ref: "ipfs://" + testCidV1 + "/song.mp3", Url: "https://gw.example/ipfs/" + testCidV1 + "/song.mp3"}},
+		{"https://cloudflare-ipfs.com/ipfs/" + testCidV0 + "/a.png?w=1", biz.MediaRef{Kind: biz.MediaIpfs, ContentId: testCidV0, Ref: "ipfs://" + testCidV0 + "/a.png?w=1", Url: "https://gw.example/ipfs/" + testCidV0 + "/a.png?w=1"}},
+		{"ar://" + testArTx, biz.MediaRef{Kind: biz.MediaArweave, ContentId: testArTx, Ref: "ar://" + testArTx, Url: "https://arweave.net/" + testArTx}},
+		{"https://arweave.net/" + testArTx + "/model.glb", biz.MediaRef{Kind: biz.MediaArweave, ContentId: testArTx, Ref: "ar://" + testArTx + "/model.glb", Url: "https://arweave.net/" + testArTx + "/model.glb"}},
+		{"https://example.com/a.png", biz.MediaRef{Kind: biz.MediaHttp, Url: "https://example.com/a.png"}},
+		{"https://example.com/ipfs/not-a-cid", biz.MediaRef{Kind: biz.MediaHttp, Url: "https://example.com/ipfs/not-a-cid"}},
+		{"data:image/png;base64,AAAA", biz.MediaRef{Kind: biz.MediaData, Url: "data:image/png;base64,AAAA"}},
+		{"ipfs://kernel", biz.MediaRef{Kind: biz.MediaIpfs, Url: "ipfs://kernel"}},
+		{"kernel.png", biz.MediaRef{Kind: biz.MediaUnknown, Url: "kernel.png"}},
+	}
+	for _, tt := range tests {
+		tt.want.Raw = tt.raw
+		if got := media.Normalize(tt.raw); got != tt.want {
+			t.Errorf("Normalize(%q) = %+v, want %+v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestMediaRepo_BackfillMedia(t *testing.T) {
+	ctx := context.Background()
+	data := newTestData(t, DriverSqlite, "file:media?mode=memory&cache=shared")
+	class := testClass(100, 0, "chain")
+	class.Image = "ipfs://" + testCidV0
+	class.Audios = []biz.Audio{{Url: "ar://" + testArTx, Name: "theme"}}
+	if err := newTestKvPairRepo(data).CreateMetadataKvPairs(ctx, biz.CheckInfo{BlockNumber: 100, BlockHash: "h", CheckType: biz.SyncMetadata}, &biz.KvPair{
+		ClassInfos: []biz.ClassInfo{class},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var classInfo ClassInfo
+	if err := data.db.Where("cota_id = ?", testCotaId).First(&classInfo).Error; err != nil ||
+		classInfo.ImageNormalized != "https://ipfs.io/ipfs/"+testCidV0 || classInfo.ImageRef != "ipfs://"+testCidV0 {
+		t.Fatalf("synced class info = %+v, %v, want the image on the default gateway", classInfo, err)
+	}
+
+	repo := NewMediaRepo(data, NewMediaNormalizer(&config.Media{IpfsGateway: "https://gw.example/ipfs/", ArweaveGateway: "https://ar.example/"}), logger.NewLogger(io.Discard, "", 0))
+	if classes, audios, err := repo.BackfillMedia(ctx, 1); err != nil || classes != 1 || audios != 1 {
+		t.Fatalf("BackfillMedia() = %d, %d, %v, want 1 class and 1 audio", classes, audios, err)
+	}
+	if err := data.db.Where("cota_id = ?", testCotaId).First(&classInfo).Error; err != nil ||
+		classInfo.Image != "ipfs://"+testCidV0 || classInfo.ImageNormalized != "https://gw.example/ipfs/"+testCidV0 {
+		t.Errorf("backfilled class info = %+v, %v, want the raw image kept and the new gateway", classInfo, err)
+	}
+	var audio TokenClassAudio
+	if err := data.db.Where("cota_id = ?", testCotaId).First(&audio).Error; err != nil ||
+		audio.UrlNormalized != "https://ar.example/"+testArTx || audio.UrlRef != "ar://"+testArTx {
+		t.Errorf("backfilled audio = %+v, %v", audio, err)
+	}
+	if classes, audios, err := repo.BackfillMedia(ctx, 1); err != nil || classes != 0 || audios != 0 {
+		t.Errorf("second BackfillMedia() = %d, %d, %v, want nothing changed", classes, audios, err)
+	}
+}
@@ -0,0 +1,53 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"gorm.io/gorm"
+)
+
+// MetadataConflict records a metadata document superseded by a later document of the same type and
+// target in its block, Data is the document as it was on chain
+type MetadataConflict struct {
+	ID               uint `gorm:"primaryKey"`
+	BlockNumber      uint64
+	TxIndex          uint32
+	EntryIndex       uint32
+	LockHash         string
+	MetaType         string
+	MetaKey          string
+	WinnerTxIndex    uint32
+	WinnerEntryIndex uint32
+	Reason           string
+	Data             string
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+func createMetadataConflicts(ctx context.Context, tx *gorm.DB, conflicts []biz.MetadataConflict) error {
+	if len(conflicts) == 0 {
+		return nil
+	}
+	rows := make([]MetadataConflict, len(conflicts))
+	for i, conflict := range conflicts {
+		rows[i] = MetadataConflict{
+			BlockNumber:      conflict.BlockNumber,
+			TxIndex:          conflict.TxIndex,
+			EntryIndex:       conflict.EntryIndex,
+			LockHash:         conflict.LockHash,
+			MetaType:         conflict.Type,
+			MetaKey:          conflict.Key,
+			WinnerTxIndex:    conflict.WinnerTxIndex,
+			WinnerEntryIndex: conflict.WinnerEntryIndex,
+			Reason:           conflict.Reason,
+			Data:             conflict.Data,
+		}
+	}
+	return tx.Model(MetadataConflict{}).WithContext(ctx).Create(&rows).Error
+}
+
+func deleteMetadataConflicts(ctx context.Context, tx *gorm.DB, blockNumber uint64) error {
+	return tx.WithContext(ctx).Where("block_number = ?", blockNumber).Delete(MetadataConflict{}).Error
+}
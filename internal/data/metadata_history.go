@@ -0,0 +1,159 @@
+package data
+
+import (
+	"context"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+var _ biz.MetadataHistoryRepo = (*metadataHistoryRepo)(nil)
+
+type metadataHistoryRepo struct {
+	data   *Data
+	logger *logger.Logger
+}
+
+func NewMetadataHistoryRepo(data *Data, logger *logger.Logger) biz.MetadataHistoryRepo {
+	return &metadataHistoryRepo{
+		data:   data,
+		logger: logger,
+	}
+}
+
+func (rp metadataHistoryRepo) FindMetadataVersions(ctx context.Context, metaType string, key string) ([]biz.MetadataVersion, error) {
+	switch metaType {
+	case biz.MetadataHistoryIssuer:
+		return rp.findIssuerVersions(ctx, key)
+	case biz.MetadataHistoryClass:
+		return rp.findClassVersions(ctx, key)
+	case biz.MetadataHistoryJoyID:
+		return rp.findJoyIDVersions(ctx, key)
+	default:
+		return nil, biz.ErrUnknownMetadataType
+	}
+}
+
+// FindPruneHeight returns the prune height of the metadata syncer, which writes the metadata versions
+func (rp metadataHistoryRepo) FindPruneHeight(ctx context.Context) (uint64, error) {
+	return findPruneHeight(ctx, rp.data.db, biz.SyncMetadata)
+}
+
+func (rp metadataHistoryRepo) findIssuerVersions(ctx context.Context, lockHash string) ([]biz.MetadataVersion, error) {
+	var rows []IssuerInfoVersion
+	if err := rp.data.db.WithContext(ctx).Where("lock_hash = ?", lockHash).Order("block_number, tx_index, id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	versions := make([]biz.MetadataVersion, len(rows))
+	for i, row := range rows {
+		versions[i] = biz.MetadataVersion{
+			BlockNumber: row.BlockNumber,
+			TxIndex:     row.TxIndex,
+			ActionType:  row.ActionType,
+			Fields: []biz.MetadataFieldChange{
+				{Field: "version", Old: row.OldVersion, New: row.Version},
+				{Field: "name", Old: row.OldName, New: row.Name},
+				{Field: "avatar", Old: row.OldAvatar, New: row.Avatar},
+				{Field: "description", Old: row.OldDescription, New: row.Description},
+				{Field: "localization", Old: row.OldLocalization, New: row.Localization},
+			},
+		}
+	}
+	return versions, nil
+}
+
+func (rp metadataHistoryRepo) findClassVersions(ctx context.Context, cotaId string) ([]biz.MetadataVersion, error) {
+	var rows []ClassInfoVersion
+	if err := rp.data.db.WithContext(ctx).Where("cota_id = ?", cotaId).Order("block_number, tx_index, id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	versions := make([]biz.MetadataVersion, len(rows))
+	for i, row := range rows {
+		versions[i] = biz.MetadataVersion{
+			BlockNumber: row.BlockNumber,
+			TxIndex:     row.TxIndex,
+			ActionType:  row.ActionType,
+			Fields: []biz.MetadataFieldChange{
+				{Field: "version", Old: row.OldVersion, New: row.Version},
+				{Field: "name", Old: row.OldName, New: row.Name},
+				{Field: "symbol", Old: row.OldSymbol, New: row.Symbol},
+				{Field: "description", Old: row.OldDescription, New: row.Description},
+				{Field: "image", Old: row.OldImage, New: row.Image},
+				{Field: "audio", Old: row.OldAudio, New: row.Audio},
+				{Field: "video", Old: row.OldVideo, New: row.Video},
+				{Field: "model", Old: row.OldModel, New: row.Model},
+				{Field: "characteristic", Old: row.OldCharacteristic, New: row.Characteristic},
+				{Field: "properties", Old: row.OldProperties, New: row.Properties},
+				{Field: "localization", Old: row.OldLocalization, New: row.Localization},
+			},
+		}
+	}
+	return versions, nil
+}
+
+// findJoyIDVersions returns the versions of the main key and the sub keys of a JoyID account. The
+// versions keep no old pub key, credential id, alg or cota cell id, so those are only listed on create.
+func (rp metadataHistoryRepo) findJoyIDVersions(ctx context.Context, lockHash string) ([]biz.MetadataVersion, error) {
+	var rows []JoyIDInfoVersion
+	if err := rp.data.db.WithContext(ctx).Where("lock_hash = ?", lockHash).Order("block_number, tx_index, id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	var subKeyRows []SubKeyInfoVersion
+	if err := rp.data.db.WithContext(ctx).Where("lock_hash = ?", lockHash).Order("block_number, tx_index, id").Find(&subKeyRows).Error; err != nil {
+		return nil, err
+	}
+	versions := make([]biz.MetadataVersion, 0, len(rows)+len(subKeyRows))
+	for _, row := range rows {
+		var fields []biz.MetadataFieldChange
+		if row.ActionType == 0 {
+			fields = append(fields,
+				biz.MetadataFieldChange{Field: "pub_key", New: row.PubKey},
+				biz.MetadataFieldChange{Field: "credential_id", New: row.CredentialId},
+				biz.MetadataFieldChange{Field: "alg", New: row.Alg},
+				biz.MetadataFieldChange{Field: "cota_cell_id", New: row.CotaCellId},
+			)
+		}
+		fields = append(fields,
+			biz.MetadataFieldChange{Field: "version", Old: row.OldVersion, New: row.Version},
+			biz.MetadataFieldChange{Field: "name", Old: row.OldName, New: row.Name},
+			biz.MetadataFieldChange{Field: "avatar", Old: row.OldAvatar, New: row.Avatar},
+			biz.MetadataFieldChange{Field: "description", Old: row.OldDescription, New: row.Description},
+			biz.MetadataFieldChange{Field: "extension", Old: row.OldExtension, New: row.Extension},
+			biz.MetadataFieldChange{Field: "front_end", Old: row.OldFrontEnd, New: row.FrontEnd},
+			biz.MetadataFieldChange{Field: "device_name", Old: row.OldDeviceName, New: row.DeviceName},
+			biz.MetadataFieldChange{Field: "device_type", Old: row.OldDeviceType, New: row.DeviceType},
+			biz.MetadataFieldChange{Field: "derivation_cid", Old: row.OldDerivationCId, New: row.DerivationCId},
+			biz.MetadataFieldChange{Field: "derivation_commitment", Old: row.OldDerivationCommitment, New: row.DerivationCommitment},
+		)
+		versions = append(versions, biz.MetadataVersion{
+			BlockNumber: row.BlockNumber,
+			TxIndex:     row.TxIndex,
+			ActionType:  row.ActionType,
+			Fields:      fields,
+		})
+	}
+	for _, row := range subKeyRows {
+		var fields []biz.MetadataFieldChange
+		if row.ActionType == 0 {
+			fields = append(fields,
+				biz.MetadataFieldChange{Field: "credential_id", New: row.CredentialId},
+				biz.MetadataFieldChange{Field: "alg", New: row.Alg},
+			)
+		}
+		fields = append(fields,
+			biz.MetadataFieldChange{Field: "front_end", Old: row.OldFrontEnd, New: row.FrontEnd},
+			biz.MetadataFieldChange{Field: "device_name", Old: row.OldDeviceName, New: row.DeviceName},
+			biz.MetadataFieldChange{Field: "device_type", Old: row.OldDeviceType, New: row.DeviceType},
+			biz.MetadataFieldChange{Field: "derivation_cid", Old: row.OldDerivationCId, New: row.DerivationCId},
+			biz.MetadataFieldChange{Field: "derivation_commitment", Old: row.OldDerivationCommitment, New: row.DerivationCommitment},
+		)
+		versions = append(versions, biz.MetadataVersion{
+			BlockNumber: row.BlockNumber,
+			TxIndex:     row.TxIndex,
+			ActionType:  row.ActionType,
+			SubKey:      row.PubKey,
+			Fields:      fields,
+		})
+	}
+	return versions, nil
+}
@@ -0,0 +1,75 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+func TestMetadataHistoryUsecase_History(t *testing.T) {
+	ctx := context.Background()
+	data := newTestData(t, DriverSqlite, "file:metadata_history?mode=memory&cache=shared")
+	kvPairs := newTestKvPairRepo(data)
+	for i, kvPair := range []*biz.KvPair{
+		{ClassInfos: []biz.ClassInfo{testClass(100, 0, "chain")}, JoyIDInfos: []biz.JoyIDInfo{testJoyID(100, 1, "phone", "02")}},
+		{ClassInfos: []biz.ClassInfo{testClass(101, 0, "renamed")}, JoyIDInfos: []biz.JoyIDInfo{testJoyID(101, 1, "laptop", "02")}},
+		// the same class again changes no field
+		{ClassInfos: []biz.ClassInfo{testClass(102, 2, "renamed")}},
+	} {
+		block := uint64(100 + i)
+		if err := kvPairs.CreateMetadataKvPairs(ctx, biz.CheckInfo{BlockNumber: block, BlockHash: "h", CheckType: biz.SyncMetadata}, kvPair); err != nil {
+			t.Fatalf("create block %d: %v", block, err)
+		}
+	}
+	uc := biz.NewMetadataHistoryUsecase(NewMetadataHistoryRepo(data, logger.NewLogger(io.Discard, "", 0)), logger.NewLogger(io.Discard, "", 0))
+
+	history, err := uc.History(ctx, biz.MetadataHistoryClass, testCotaId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []biz.MetadataChange{
+		{BlockNumber: 100, TxIndex: 0, Action: biz.MetadataCreate, Fields: []biz.MetadataFieldChange{
+			{Field: "version", New: "0"}, {Field: "name", New: "chain"}, {Field: "symbol", New: "T"}, {Field: "image", New: "ipfs://chain"},
+		}},
+		{BlockNumber: 101, TxIndex: 0, Action: biz.MetadataUpdate, Fields: []biz.MetadataFieldChange{
+			{Field: "name", Old: "chain", New: "renamed"}, {Field: "image", Old: "ipfs://chain", New: "ipfs://renamed"},
+		}},
+	}
+	if !reflect.DeepEqual(history.Changes, want) {
+		t.Errorf("class history = %+v, want %+v", history.Changes, want)
+	}
+
+	history, err = uc.History(ctx, biz.MetadataHistoryJoyID, lockA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Changes) != 4 || history.Changes[0].SubKey != "" || history.Changes[1].SubKey != "02" ||
+		history.Changes[2].Action != biz.MetadataUpdate || history.Changes[3].SubKey != "02" ||
+		!reflect.DeepEqual(history.Changes[3].Fields, []biz.MetadataFieldChange{{Field: "device_name", Old: "phone", New: "laptop"}}) {
+		t.Errorf("joy id history = %+v, want the main key and the sub key created and renamed", history.Changes)
+	}
+
+	if history, err = uc.History(ctx, biz.MetadataHistoryIssuer, lockB); err != nil || len(history.Changes) != 0 {
+		t.Errorf("issuer history = %+v, %v, want no changes", history, err)
+	}
+	if _, err = uc.History(ctx, "badge", testCotaId); !errors.Is(err, biz.ErrUnknownMetadataType) {
+		t.Errorf("badge history error = %v, want ErrUnknownMetadataType", err)
+	}
+	if history, err = uc.History(ctx, biz.MetadataHistoryClass, testCotaId); err != nil || history.KeptFrom != 0 {
+		t.Errorf("class history = %+v, %v, want it kept from block 0", history, err)
+	}
+
+	// keeping one block below the synced block 102 prunes the versions of block 100
+	if _, err = NewVersionRetentionRepo(data, nil).PruneVersions(ctx, biz.SyncMetadata, 1, 10); err != nil {
+		t.Fatal(err)
+	}
+	history, err = uc.History(ctx, biz.MetadataHistoryClass, testCotaId)
+	if err != nil || history.KeptFrom != 101 || !reflect.DeepEqual(history.Changes, want[1:]) {
+		t.Errorf("pruned class history = %+v, %v, want the change of block 101 kept from block 101", history, err)
+	}
+}
@@ -0,0 +1,431 @@
+package data
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/config"
+	"gorm.io/gorm"
+)
+
+//go:embed metadata_schemas
+var metadataSchemas embed.FS
+
+const (
+	MetadataValidationStrict  = "strict"
+	MetadataValidationLenient = "lenient"
+)
+
+// MetadataHandler parses, writes and rolls back the CTMeta metadata of one type. Schema is the json
+// schema of the data, checked before Parse, or nil. Parse appends what it parsed and its events to
+// kvPair, an error matching biz.ErrMalformedEntry quarantines the entry.
+// Create and Restore run in the transaction of the block and are called for every block, so they only
+// touch the pairs of their own type.
+type MetadataHandler interface {
+	Type() string
+	Schema() []byte
+	Parse(ctx context.Context, blockNumber uint64, entry biz.Entry, meta biz.MetaData, kvPair *biz.KvPair) error
+	Create(ctx context.Context, tx *gorm.DB, kvPair *biz.KvPair) error
+	Restore(ctx context.Context, tx *gorm.DB, blockNumber uint64) error
+}
+
+// MetadataTargeter is implemented by the handlers whose documents replace the metadata of one target.
+// Target returns the lock hash or cota id of the document parsed into kvPair. Of the documents of a
+// block with the same type and target only the last one is applied.
+type MetadataTargeter interface {
+	Target(kvPair biz.KvPair) string
+}
+
+// MetadataRegistry maps the CTMeta types to their handlers. A type without a handler is rejected,
+// or kept in raw_metadata when store_unknown is on.
+type MetadataRegistry struct {
+	handlers     []MetadataHandler
+	types        map[string]MetadataHandler
+	schemas      map[string]*jsonSchema
+	raw          MetadataHandler
+	storeUnknown bool
+	validation   string
+}
+
+// MetadataHandlers are the handlers a registry is built with, registered in order
+type MetadataHandlers []MetadataHandler
+
+// NewMetadataHandlers returns the built-in handlers of issuer, cota and joy_id. A build with more types
+// provides its own MetadataHandlers to wire in place of this provider, for example the built-in
+// handlers with its handlers appended.
+func NewMetadataHandlers(issuerInfoUsecase *biz.IssuerInfoUsecase, classInfoUsecase *biz.ClassInfoUsecase, joyIDInfoUsecase *biz.JoyIDInfoUsecase, media *MediaNormalizer) MetadataHandlers {
+	return MetadataHandlers{
+		issuerMetadataHandler{issuerInfoUsecase: issuerInfoUsecase},
+		classMetadataHandler{classInfoUsecase: classInfoUsecase, media: media},
+		joyIDMetadataHandler{joyIDInfoUsecase: joyIDInfoUsecase},
+	}
+}
+
+// NewMetadataRegistry registers the handlers, two handlers of the same type are an error
+func NewMetadataRegistry(handlers MetadataHandlers, conf *config.Metadata) (*MetadataRegistry, error) {
+	if conf.Validation == "" {
+		conf.Validation = MetadataValidationLenient
+	}
+	if conf.Validation != MetadataValidationStrict && conf.Validation != MetadataValidationLenient {
+		return nil, fmt.Errorf("unknown metadata validation %q", conf.Validation)
+	}
+	registry := &MetadataRegistry{
+		types:        make(map[string]MetadataHandler),
+		schemas:      make(map[string]*jsonSchema),
+		raw:          rawMetadataHandler{},
+		storeUnknown: conf.StoreUnknown,
+		validation:   conf.Validation,
+	}
+	for _, handler := range handlers {
+		if err := registry.Register(handler); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+// Register adds the handler of a new metadata type
+func (r *MetadataRegistry) Register(handler MetadataHandler) error {
+	if _, ok := r.types[handler.Type()]; ok {
+		return fmt.Errorf("metadata type %q is already registered", handler.Type())
+	}
+	if raw := handler.Schema(); raw != nil {
+		schema, err := compileSchema(raw)
+		if err != nil {
+			return err
+		}
+		r.schemas[handler.Type()] = schema
+	}
+	r.types[handler.Type()] = handler
+	r.handlers = append(r.handlers, handler)
+	return nil
+}
+
+// Handlers returns the registered handlers in the order of registration and the raw handler last.
+// The raw handler is always included, so a block is rolled back after store_unknown is turned off.
+func (r *MetadataRegistry) Handlers() []MetadataHandler {
+	return append(r.handlers[:len(r.handlers):len(r.handlers)], r.raw)
+}
+
+// Handler returns the handler of a metadata type
+func (r *MetadataRegistry) Handler(metaType string) (MetadataHandler, error) {
+	if handler, ok := r.types[metaType]; ok {
+		return handler, nil
+	}
+	if r.storeUnknown {
+		return r.raw, nil
+	}
+	return nil, biz.NewMalformedEntryError("invalid meta type %q", metaType)
+}
+
+// Decode decodes the metadata of a witness and finds the handler of its type
+func (r *MetadataRegistry) Decode(meta []byte) (biz.CTMeta, MetadataHandler, error) {
+	ctMeta, err := biz.ParseMetadata(meta)
+	if err != nil {
+		return ctMeta, nil, err
+	}
+	handler, err := r.Handler(ctMeta.Metadata.Type)
+	if err != nil {
+		return biz.CTMeta{}, nil, err
+	}
+	return ctMeta, handler, nil
+}
+
+// Validate checks the data of an entry against the schema of its type. Strict validation rejects an
+// entry with schema errors as malformed, lenient validation returns a warning to store with it.
+func (r *MetadataRegistry) Validate(blockNumber uint64, entry biz.Entry, meta biz.MetaData) (*biz.MetadataWarning, error) {
+	schema, ok := r.schemas[meta.Type]
+	if !ok {
+		return nil, nil
+	}
+	errs := schema.validate(meta.Data)
+	if len(errs) == 0 {
+		return nil, nil
+	}
+	if r.validation == MetadataValidationStrict {
+		reasons := make([]string, len(errs))
+		for i, err := range errs {
+			reasons[i] = err.Error()
+		}
+		return nil, biz.NewMalformedEntryError("metadata schema %s: %s", schema.Id, strings.Join(reasons, "; "))
+	}
+	lockHash, _, err := GenerateLockHash(entry)
+	if err != nil {
+		return nil, err
+	}
+	return &biz.MetadataWarning{
+		BlockNumber: blockNumber,
+		TxIndex:     entry.TxIndex,
+		EntryIndex:  entry.EntryIndex,
+		LockHash:    lockHash,
+		Type:        meta.Type,
+		Schema:      schema.Id,
+		Errors:      errs,
+	}, nil
+}
+
+// metadataSchema returns a built-in schema, the version is the directory of the file and part of its $id
+func metadataSchema(name string) []byte {
+	schema, err := metadataSchemas.ReadFile("metadata_schemas/v1/" + name)
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+type issuerMetadataHandler struct {
+	issuerInfoUsecase *biz.IssuerInfoUsecase
+}
+
+func (h issuerMetadataHandler) Type() string {
+	return "issuer"
+}
+
+func (h issuerMetadataHandler) Schema() []byte {
+	return metadataSchema("issuer.json")
+}
+
+func (h issuerMetadataHandler) Parse(_ context.Context, blockNumber uint64, entry biz.Entry, meta biz.MetaData, kvPair *biz.KvPair) error {
+	issuerInfo, err := h.issuerInfoUsecase.ParseMetadata(blockNumber, entry.TxIndex, entry.LockScript, meta.Data)
+	if err != nil {
+		return err
+	}
+	kvPair.IssuerInfos = append(kvPair.IssuerInfos, issuerInfo)
+	kvPair.Events = append(kvPair.Events, entryEvents(blockNumber, entry, biz.SyncMetadata, 0, []biz.CotaEvent{{EventType: biz.CotaEventIssuer, LockHash: issuerInfo.LockHash}})...)
+	return nil
+}
+
+func (h issuerMetadataHandler) Target(kvPair biz.KvPair) string {
+	if len(kvPair.IssuerInfos) == 0 {
+		return ""
+	}
+	return kvPair.IssuerInfos[0].LockHash
+}
+
+// Create writes the issuer infos and indexes the issuers with a new name or description for search
+func (h issuerMetadataHandler) Create(ctx context.Context, tx *gorm.DB, kvPair *biz.KvPair) error {
+	if !kvPair.HasIssuerInfos() {
+		return nil
+	}
+	if err := createIssuerInfos(ctx, tx, kvPair); err != nil {
+		return err
+	}
+	lockHashes, err := issuerSearchChanges(ctx, tx, kvPair.IssuerInfos[0].BlockNumber)
+	if err != nil {
+		return err
+	}
+	return refreshIssuerSearch(ctx, tx, lockHashes)
+}
+
+func (h issuerMetadataHandler) Restore(ctx context.Context, tx *gorm.DB, blockNumber uint64) error {
+	lockHashes, err := issuerSearchChanges(ctx, tx, blockNumber)
+	if err != nil {
+		return err
+	}
+	if err = restoreIssuerInfos(ctx, tx, blockNumber); err != nil {
+		return err
+	}
+	return refreshIssuerSearch(ctx, tx, lockHashes)
+}
+
+type classMetadataHandler struct {
+	classInfoUsecase *biz.ClassInfoUsecase
+	media            *MediaNormalizer
+}
+
+func (h classMetadataHandler) Type() string {
+	return "cota"
+}
+
+func (h classMetadataHandler) Schema() []byte {
+	return metadataSchema("cota.json")
+}
+
+func (h classMetadataHandler) Parse(_ context.Context, blockNumber uint64, entry biz.Entry, meta biz.MetaData, kvPair *biz.KvPair) error {
+	classInfo, err := h.classInfoUsecase.ParseMetadata(blockNumber, entry.TxIndex, meta.Data)
+	if errors.Is(err, ErrInvalidClassInfo) {
+		return biz.NewMalformedEntryError("%v", err)
+	}
+	if err != nil {
+		return err
+	}
+	lockHash, _, err := GenerateLockHash(entry)
+	if err != nil {
+		return err
+	}
+	kvPair.ClassInfos = append(kvPair.ClassInfos, classInfo)
+	kvPair.Events = append(kvPair.Events, entryEvents(blockNumber, entry, biz.SyncMetadata, 0, []biz.CotaEvent{{EventType: biz.CotaEventClassInfo, LockHash: lockHash, CotaId: classInfo.CotaId}})...)
+	return nil
+}
+
+func (h classMetadataHandler) Target(kvPair biz.KvPair) string {
+	if len(kvPair.ClassInfos) == 0 {
+		return ""
+	}
+	return kvPair.ClassInfos[0].CotaId
+}
+
+// Create writes the class infos, decodes the traits of the tokens of the classes with a new
+// characteristic schema and indexes the classes with a new name, symbol or description for search
+func (h classMetadataHandler) Create(ctx context.Context, tx *gorm.DB, kvPair *biz.KvPair) error {
+	if !kvPair.HasClassInfos() {
+		return nil
+	}
+	blockNumber := kvPair.ClassInfos[0].BlockNumber
+	if err := createClassInfos(ctx, tx, h.media, kvPair); err != nil {
+		return err
+	}
+	cotaIds, err := classTraitChanges(ctx, tx, blockNumber)
+	if err != nil {
+		return err
+	}
+	if err = refreshClassTraits(ctx, tx, cotaIds); err != nil {
+		return err
+	}
+	if cotaIds, err = classSearchChanges(ctx, tx, blockNumber); err != nil {
+		return err
+	}
+	return refreshClassSearch(ctx, tx, cotaIds)
+}
+
+func (h classMetadataHandler) Restore(ctx context.Context, tx *gorm.DB, blockNumber uint64) error {
+	cotaIds, err := classTraitChanges(ctx, tx, blockNumber)
+	if err != nil {
+		return err
+	}
+	searchIds, err := classSearchChanges(ctx, tx, blockNumber)
+	if err != nil {
+		return err
+	}
+	if err = restoreClassInfos(ctx, tx, h.media, blockNumber); err != nil {
+		return err
+	}
+	if err = refreshClassTraits(ctx, tx, cotaIds); err != nil {
+		return err
+	}
+	return refreshClassSearch(ctx, tx, searchIds)
+}
+
+type joyIDMetadataHandler struct {
+	joyIDInfoUsecase *biz.JoyIDInfoUsecase
+}
+
+func (h joyIDMetadataHandler) Type() string {
+	return "joy_id"
+}
+
+func (h joyIDMetadataHandler) Schema() []byte {
+	return metadataSchema("joy_id.json")
+}
+
+func (h joyIDMetadataHandler) Parse(ctx context.Context, blockNumber uint64, entry biz.Entry, meta biz.MetaData, kvPair *biz.KvPair) error {
+	joyIDInfo, err := h.joyIDInfoUsecase.ParseMetadata(ctx, blockNumber, entry.TxIndex, entry.LockScript, meta.Data)
+	if errors.Is(err, ErrInvalidJoyIDInfo) {
+		return biz.NewMalformedEntryError("%v", err)
+	}
+	if err != nil {
+		return err
+	}
+	kvPair.JoyIDInfos = append(kvPair.JoyIDInfos, joyIDInfo)
+	kvPair.Events = append(kvPair.Events, entryEvents(blockNumber, entry, biz.SyncMetadata, 0, []biz.CotaEvent{{EventType: biz.CotaEventJoyID, LockHash: joyIDInfo.LockHash}})...)
+	return nil
+}
+
+func (h joyIDMetadataHandler) Target(kvPair biz.KvPair) string {
+	if len(kvPair.JoyIDInfos) == 0 {
+		return ""
+	}
+	return kvPair.JoyIDInfos[0].LockHash
+}
+
+func (h joyIDMetadataHandler) Create(ctx context.Context, tx *gorm.DB, kvPair *biz.KvPair) error {
+	return createJoyIDInfos(ctx, tx, kvPair)
+}
+
+func (h joyIDMetadataHandler) Restore(ctx context.Context, tx *gorm.DB, blockNumber uint64) error {
+	return restoreJoyIDInfos(ctx, tx, blockNumber)
+}
+
+type RawMetadata struct {
+	ID          uint `gorm:"primaryKey"`
+	BlockNumber uint64
+	TxIndex     uint32
+	LockHash    string
+	MetaType    string
+	Target      string
+	Data        string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (RawMetadata) TableName() string {
+	return "raw_metadata"
+}
+
+// rawMetadataHandler keeps the metadata of the types without a handler as json, one row per entry
+type rawMetadataHandler struct{}
+
+func (h rawMetadataHandler) Type() string {
+	return ""
+}
+
+func (h rawMetadataHandler) Schema() []byte {
+	return nil
+}
+
+func (h rawMetadataHandler) Parse(_ context.Context, blockNumber uint64, entry biz.Entry, meta biz.MetaData, kvPair *biz.KvPair) error {
+	data, err := json.Marshal(meta.Data)
+	if err != nil {
+		return err
+	}
+	lockHash, _, err := GenerateLockHash(entry)
+	if err != nil {
+		return err
+	}
+	kvPair.Metadata = append(kvPair.Metadata, biz.MetadataPair{
+		BlockNumber: blockNumber,
+		TxIndex:     entry.TxIndex,
+		Type:        meta.Type,
+		Value: biz.RawMetadata{
+			BlockNumber: blockNumber,
+			TxIndex:     entry.TxIndex,
+			LockHash:    lockHash,
+			Type:        meta.Type,
+			Target:      meta.Target,
+			Data:        string(data),
+		},
+	})
+	return nil
+}
+
+func (h rawMetadataHandler) Create(ctx context.Context, tx *gorm.DB, kvPair *biz.KvPair) error {
+	var rows []RawMetadata
+	for _, pair := range kvPair.Metadata {
+		raw, ok := pair.Value.(biz.RawMetadata)
+		if !ok {
+			continue
+		}
+		rows = append(rows, RawMetadata{
+			BlockNumber: raw.BlockNumber,
+			TxIndex:     raw.TxIndex,
+			LockHash:    raw.LockHash,
+			MetaType:    raw.Type,
+			Target:      raw.Target,
+			Data:        raw.Data,
+		})
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return tx.Model(RawMetadata{}).WithContext(ctx).Create(&rows).Error
+}
+
+func (h rawMetadataHandler) Restore(ctx context.Context, tx *gorm.DB, blockNumber uint64) error {
+	return tx.WithContext(ctx).Where("block_number = ?", blockNumber).Delete(RawMetadata{}).Error
+}
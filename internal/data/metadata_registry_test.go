@@ -0,0 +1,236 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/config"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+	ckbTypes "github.com/nervosnetwork/ckb-sdk-go/types"
+	"gorm.io/gorm"
+)
+
+// badgeHandler is a metadata type registered by a test, it keeps its pairs in kvPair.Metadata
+type badgeHandler struct {
+	created, restored *[]uint64
+}
+
+func (h badgeHandler) Type() string {
+	return "badge"
+}
+
+func (h badgeHandler) Schema() []byte {
+	return nil
+}
+
+func (h badgeHandler) Parse(_ context.Context, blockNumber uint64, entry biz.Entry, meta biz.MetaData, kvPair *biz.KvPair) error {
+	if _, ok := meta.Data["name"].(string); !ok {
+		return biz.NewMalformedEntryError("badge without a name")
+	}
+	kvPair.Metadata = append(kvPair.Metadata, biz.MetadataPair{BlockNumber: blockNumber, TxIndex: entry.TxIndex, Type: h.Type(), Value: meta.Data["name"]})
+	return nil
+}
+
+func (h badgeHandler) Create(_ context.Context, _ *gorm.DB, kvPair *biz.KvPair) error {
+	for _, pair := range kvPair.Metadata {
+		if pair.Type == h.Type() {
+			*h.created = append(*h.created, pair.BlockNumber)
+		}
+	}
+	return nil
+}
+
+func (h badgeHandler) Restore(_ context.Context, _ *gorm.DB, blockNumber uint64) error {
+	*h.restored = append(*h.restored, blockNumber)
+	return nil
+}
+
+func TestMetadataRegistry_customAndUnknownTypes(t *testing.T) {
+	ctx := context.Background()
+	data := newTestData(t, DriverSqlite, "file:metadata_registry?mode=memory&cache=shared")
+	log := logger.NewLogger(io.Discard, "", 0)
+	var created, restored []uint64
+	registry, err := NewMetadataRegistry(append(newTestMetadataHandlers(data), badgeHandler{created: &created, restored: &restored}), &config.Metadata{StoreUnknown: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = registry.Register(badgeHandler{}); err == nil {
+		t.Fatal("registered the badge type twice")
+	}
+	if _, err = NewMetadataRegistry(MetadataHandlers{badgeHandler{}, badgeHandler{}}, &config.Metadata{}); err == nil {
+		t.Fatal("NewMetadataRegistry() accepted the badge type twice")
+	}
+	repo := NewKvPairRepo(data, registry, log)
+	syncer := NewMetadataSyncer(biz.NewSyncKvPairUsecase(repo, log), CotaWitnessArgsParser{}, registry)
+
+	lock := &ckbTypes.Script{CodeHash: ckbTypes.HexToHash("0x01"), HashType: ckbTypes.HashTypeType, Args: []byte{1}}
+	entries := []biz.Entry{
+		{OutputType: []byte(`{"id":"CTMeta","ver":"1.0","metadata":{"target":"output#0","type":"badge","data":{"name":"gold"}}}`), LockScript: lock, TxIndex: 1},
+		{OutputType: []byte(`{"id":"CTMeta","ver":"1.0","metadata":{"target":"output#0","type":"badge","data":{}}}`), LockScript: lock, TxIndex: 2},
+		{OutputType: []byte(`{"id":"CTMeta","ver":"1.0","metadata":{"target":"output#1","type":"poap","data":{"event":"ckcon"}}}`), LockScript: lock, TxIndex: 3},
+	}
+	kvPair, err := syncer.parseMetadata(ctx, 100, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvPair.Metadata) != 2 || len(kvPair.Quarantines) != 1 || kvPair.Quarantines[0].TxIndex != 2 {
+		t.Fatalf("parseMetadata() = %+v, want a badge, a raw poap and the badge without a name quarantined", kvPair)
+	}
+	if err = repo.CreateMetadataKvPairs(ctx, biz.CheckInfo{BlockNumber: 100, BlockHash: "h", CheckType: biz.SyncMetadata}, &kvPair); err != nil {
+		t.Fatal(err)
+	}
+	var raw []RawMetadata
+	if err = data.db.Find(&raw).Error; err != nil || len(raw) != 1 || raw[0].MetaType != "poap" || raw[0].Target != "output#1" ||
+		raw[0].Data != `{"event":"ckcon"}` || raw[0].TxIndex != 3 {
+		t.Fatalf("raw metadata = %+v, %v, want the poap entry", raw, err)
+	}
+	if len(created) != 1 || created[0] != 100 {
+		t.Errorf("badge handler created blocks %v, want [100]", created)
+	}
+
+	if err = repo.RestoreMetadataKvPairs(ctx, 100); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	if err = data.db.Model(RawMetadata{}).Count(&count).Error; err != nil || count != 0 {
+		t.Errorf("raw metadata after the rollback = %d, %v, want none", count, err)
+	}
+	if len(restored) != 1 || restored[0] != 100 {
+		t.Errorf("badge handler restored blocks %v, want [100]", restored)
+	}
+
+	// without store_unknown an unknown type is quarantined
+	strict := NewMetadataSyncer(biz.NewSyncKvPairUsecase(repo, log), CotaWitnessArgsParser{}, newTestMetadataRegistry(data, &config.Metadata{}))
+	kvPair, err = strict.parseMetadata(ctx, 101, entries[2:])
+	if err != nil || len(kvPair.Metadata) != 0 || len(kvPair.Quarantines) != 1 || !strings.Contains(kvPair.Quarantines[0].Reason, `invalid meta type "poap"`) {
+		t.Errorf("parseMetadata() = %+v, %v, want the poap entry quarantined", kvPair, err)
+	}
+	if _, err = registry.Handler("poap"); err != nil {
+		t.Errorf("handler of an unknown type with store_unknown = %v, want the raw handler", err)
+	}
+	if _, err = newTestMetadataRegistry(data, &config.Metadata{}).Handler("poap"); !errors.Is(err, biz.ErrMalformedEntry) {
+		t.Errorf("handler of an unknown type = %v, want a malformed entry", err)
+	}
+}
+
+func TestMetadataRegistry_Validate(t *testing.T) {
+	ctx := context.Background()
+	data := newTestData(t, DriverSqlite, "file:metadata_validation?mode=memory&cache=shared")
+	log := logger.NewLogger(io.Discard, "", 0)
+	lock := &ckbTypes.Script{CodeHash: ckbTypes.HexToHash("0x01"), HashType: ckbTypes.HashTypeType, Args: []byte{1}}
+	// the parser takes keys of any characters, the schema wants hex
+	entry := biz.Entry{
+		OutputType: []byte(`{"id":"CTMeta","ver":"1.0","metadata":{"target":"output#0","type":"joy_id","data":{"version":"0","pub_key":"0xzz","alg":"0x01","sub_keys":[{"pub_key":"0x03","alg":"0xzz"}]}}}`),
+		LockScript: lock, TxIndex: 2, EntryIndex: 1, TxHash: ckbTypes.HexToHash("0x02"),
+	}
+	wantErrors := []biz.SchemaError{
+		{Path: "data.pub_key", Message: "does not match pattern '^(0x)?[0-9a-fA-F]{0,128}$'"},
+		{Path: "data.sub_keys[0].alg", Message: "does not match pattern '^(0x)?[0-9a-fA-F]{0,2}$'"},
+	}
+
+	strict := newTestMetadataRegistry(data, &config.Metadata{Validation: MetadataValidationStrict})
+	kvPair, err := NewMetadataSyncer(biz.NewSyncKvPairUsecase(newTestKvPairRepo(data), log), CotaWitnessArgsParser{}, strict).parseMetadata(ctx, 100, []biz.Entry{entry})
+	if err != nil || len(kvPair.JoyIDInfos) != 0 || len(kvPair.Quarantines) != 1 {
+		t.Fatalf("strict parseMetadata() = %+v, %v, want the entry quarantined", kvPair, err)
+	}
+	for _, want := range wantErrors {
+		if !strings.Contains(kvPair.Quarantines[0].Reason, want.Error()) {
+			t.Errorf("quarantine reason %q does not contain %q", kvPair.Quarantines[0].Reason, want.Error())
+		}
+	}
+
+	repo := newTestKvPairRepo(data)
+	kvPair, err = NewMetadataSyncer(biz.NewSyncKvPairUsecase(repo, log), CotaWitnessArgsParser{}, newTestMetadataRegistry(data, &config.Metadata{})).parseMetadata(ctx, 100, []biz.Entry{entry})
+	if err != nil || len(kvPair.JoyIDInfos) != 1 || len(kvPair.Quarantines) != 0 || len(kvPair.MetadataWarnings) != 1 {
+		t.Fatalf("lenient parseMetadata() = %+v, %v, want the entry stored with a warning", kvPair, err)
+	}
+	warning := kvPair.MetadataWarnings[0]
+	if warning.TxIndex != 2 || warning.EntryIndex != 1 || warning.Type != "joy_id" || !strings.HasSuffix(warning.Schema, "/v1/joy_id.json") ||
+		!reflect.DeepEqual(warning.Errors, wantErrors) {
+		t.Errorf("warning = %+v, want the errors %+v", warning, wantErrors)
+	}
+	if err = repo.CreateMetadataKvPairs(ctx, biz.CheckInfo{BlockNumber: 100, BlockHash: "h", CheckType: biz.SyncMetadata}, &kvPair); err != nil {
+		t.Fatal(err)
+	}
+	var rows []MetadataWarning
+	if err = data.db.Find(&rows).Error; err != nil || len(rows) != 1 || rows[0].LockHash != kvPair.JoyIDInfos[0].LockHash ||
+		rows[0].Errors != `[{"path":"data.pub_key","message":"does not match pattern '^(0x)?[0-9a-fA-F]{0,128}$'"},{"path":"data.sub_keys[0].alg","message":"does not match pattern '^(0x)?[0-9a-fA-F]{0,2}$'"}]` {
+		t.Fatalf("metadata warnings = %+v, %v", rows, err)
+	}
+	if err = repo.RestoreMetadataKvPairs(ctx, 100); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	if err = data.db.Model(MetadataWarning{}).Count(&count).Error; err != nil || count != 0 {
+		t.Errorf("metadata warnings after the rollback = %d, %v, want none", count, err)
+	}
+
+	if _, err = NewMetadataRegistry(nil, &config.Metadata{Validation: "loose"}); err == nil {
+		t.Error("NewMetadataRegistry() accepted the validation loose")
+	}
+}
+
+func TestMetadataRegistry_schemas(t *testing.T) {
+	registry := newTestMetadataRegistry(nil, &config.Metadata{})
+	tests := []struct {
+		meta string
+		want []biz.SchemaError
+	}{
+		{meta: `{"type":"issuer","data":{"name":"kevin","localization":{"locales":["en",1]}}}`, want: []biz.SchemaError{{Path: "data.localization.locales[1]", Message: "expected string, but got number"}}},
+		{meta: `{"type":"cota","data":{"name":"Kernel","characteristic":[["level",5],"rare"]}}`, want: []biz.SchemaError{
+			{Path: "data", Message: "missing properties: 'cota_id'"}, {Path: "data.characteristic[1]", Message: "expected array, but got string"},
+		}},
+		{meta: `{"type":"joy_id","data":{"name":"` + strings.Repeat("名", 240) + `","cota_cell_id":"0x0000000000000001"}}`},
+		{meta: `{"type":"joy_id","data":{"description":null}}`, want: []biz.SchemaError{{Path: "data.description", Message: "expected string, but got null"}}},
+	}
+	for _, tt := range tests {
+		var meta biz.MetaData
+		if err := json.Unmarshal([]byte(tt.meta), &meta); err != nil {
+			t.Fatal(err)
+		}
+		if got := registry.schemas[meta.Type].validate(meta.Data); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("validate(%s) = %+v, want %+v", tt.meta, got, tt.want)
+		}
+	}
+}
+
+// Test_compileSchema checks that keywords beyond the ones the bundled schemas use are enforced too,
+// and that a schema with a keyword of a wrong form fails to load
+func Test_compileSchema(t *testing.T) {
+	for _, tt := range []struct {
+		schema string
+		data   string
+		path   string
+	}{
+		{schema: `{"$id":"s","type":"object","additionalProperties":false}`, data: `{"alg":"01"}`, path: "data"},
+		{schema: `{"$id":"s","type":"object","properties":{"alg":{"type":"string","enum":["01"]}}}`, data: `{"alg":"02"}`, path: "data.alg"},
+		{schema: `{"$id":"s","type":"array","items":{"type":"integer","minimum":1}}`, data: `[1,0]`, path: "data[1]"},
+	} {
+		schema, err := compileSchema([]byte(tt.schema))
+		if err != nil {
+			t.Fatalf("compileSchema(%s) = %v", tt.schema, err)
+		}
+		var value any
+		if err = json.Unmarshal([]byte(tt.data), &value); err != nil {
+			t.Fatal(err)
+		}
+		if errs := schema.validate(value); len(errs) != 1 || errs[0].Path != tt.path {
+			t.Errorf("validate(%s) against %s = %+v, want one error at %s", tt.data, tt.schema, errs, tt.path)
+		}
+	}
+	for _, raw := range []string{
+		`{"type":"object"}`,
+		`{"$id":"s","type":"object","properties":{"alg":{"$ref":"#/$defs/alg"}}}`,
+		`{"$id":"s","type":"object","required":"alg"}`,
+	} {
+		if _, err := compileSchema([]byte(raw)); err == nil {
+			t.Errorf("compileSchema(%s) accepted an invalid schema", raw)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// jsonSchema is a compiled metadata schema, validated by a full JSON Schema 2020-12 implementation
+type jsonSchema struct {
+	Id     string
+	schema *jsonschema.Schema
+}
+
+// compileSchema compiles a schema under its $id, a schema with a keyword of a wrong form or an
+// unresolved $ref fails to compile
+func compileSchema(raw []byte) (*jsonSchema, error) {
+	var root struct {
+		Id string `json:"$id"`
+	}
+	if err := json.Unmarshal(raw, &root); err != nil {
+		return nil, fmt.Errorf("metadata schema: %w", err)
+	}
+	if root.Id == "" {
+		return nil, fmt.Errorf("metadata schema without $id")
+	}
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	if err := compiler.AddResource(root.Id, bytes.NewReader(raw)); err != nil {
+		return nil, fmt.Errorf("metadata schema %s: %w", root.Id, err)
+	}
+	schema, err := compiler.Compile(root.Id)
+	if err != nil {
+		return nil, fmt.Errorf("metadata schema %s: %w", root.Id, err)
+	}
+	return &jsonSchema{Id: root.Id, schema: schema}, nil
+}
+
+// validate returns the errors of the decoded data of a metadata entry, each with the path of its
+// field starting at data, sorted by path
+func (s *jsonSchema) validate(value any) []biz.SchemaError {
+	err := s.schema.Validate(value)
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		if err != nil {
+			return []biz.SchemaError{{Path: "data", Message: err.Error()}}
+		}
+		return nil
+	}
+	var errs []biz.SchemaError
+	var leaves func(e *jsonschema.ValidationError)
+	leaves = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			errs = append(errs, biz.SchemaError{Path: schemaPath(value, e.InstanceLocation), Message: e.Message})
+		}
+		for _, cause := range e.Causes {
+			leaves(cause)
+		}
+	}
+	leaves(validationErr)
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].Path != errs[j].Path {
+			return errs[i].Path < errs[j].Path
+		}
+		return errs[i].Message < errs[j].Message
+	})
+	return errs
+}
+
+// schemaPath turns the JSON pointer of a value into the path of its field, data.sub_keys[0].alg
+func schemaPath(value any, pointer string) string {
+	path := "data"
+	if pointer == "" {
+		return path
+	}
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch v := value.(type) {
+		case []any:
+			path += "[" + token + "]"
+			if i, err := strconv.Atoi(token); err == nil && i < len(v) {
+				value = v[i]
+			}
+		case map[string]any:
+			path += "." + token
+			value = v[token]
+		default:
+			path += "." + token
+		}
+	}
+	return path
+}
@@ -0,0 +1,319 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+	"gorm.io/gorm"
+)
+
+var _ biz.MetadataSearchRepo = (*metadataSearchRepo)(nil)
+
+// MetadataSearchTerm is a term of the name, symbol or description of a class or an issuer, written on
+// sqlite only. The terms are derived from class_infos and issuer_infos in the transaction that writes
+// or restores them, so the index follows the infos through reorgs.
+type MetadataSearchTerm struct {
+	ID        uint `gorm:"primaryKey"`
+	MetaType  string
+	MetaKey   string
+	Term      string
+	Weight    int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// classSearchChanges returns the cota ids of the classes created or with a changed name, symbol or
+// description at the block number, read from the versions before they are restored
+func classSearchChanges(ctx context.Context, tx *gorm.DB, blockNumber uint64) ([]string, error) {
+	var cotaIds []string
+	err := tx.WithContext(ctx).Model(ClassInfoVersion{}).Distinct("cota_id").
+		Where("block_number = ? and (action_type = ? or old_name <> name or old_symbol <> symbol or old_description <> description)", blockNumber, 0).
+		Pluck("cota_id", &cotaIds).Error
+	return cotaIds, err
+}
+
+// issuerSearchChanges returns the lock hashes of the issuers created or with a changed name or
+// description at the block number
+func issuerSearchChanges(ctx context.Context, tx *gorm.DB, blockNumber uint64) ([]string, error) {
+	var lockHashes []string
+	err := tx.WithContext(ctx).Model(IssuerInfoVersion{}).Distinct("lock_hash").
+		Where("block_number = ? and (action_type = ? or old_name <> name or old_description <> description)", blockNumber, 0).
+		Pluck("lock_hash", &lockHashes).Error
+	return lockHashes, err
+}
+
+// termSearch tells whether the search terms are written. MySQL and PostgreSQL search the infos with
+// the FULLTEXT and tsvector indexes they maintain themselves.
+func termSearch(tx *gorm.DB) bool {
+	return tx.Dialector.Name() == DriverSqlite
+}
+
+// refreshClassSearch indexes the classes again, a class without an info is removed from the index
+func refreshClassSearch(ctx context.Context, tx *gorm.DB, cotaIds []string) error {
+	if len(cotaIds) == 0 || !termSearch(tx) {
+		return nil
+	}
+	var classes []ClassInfo
+	if err := tx.WithContext(ctx).Select("cota_id, name, symbol, description").Where("cota_id in ?", cotaIds).Find(&classes).Error; err != nil {
+		return err
+	}
+	terms := make(map[string][]biz.SearchTerm, len(classes))
+	for _, class := range classes {
+		terms[class.CotaId] = biz.ClassSearchTerms(class.Name, class.Symbol, class.Description)
+	}
+	return replaceSearchTerms(ctx, tx, biz.SearchClass, cotaIds, terms)
+}
+
+// refreshIssuerSearch indexes the issuers again, an issuer without an info is removed from the index
+func refreshIssuerSearch(ctx context.Context, tx *gorm.DB, lockHashes []string) error {
+	if len(lockHashes) == 0 || !termSearch(tx) {
+		return nil
+	}
+	var issuers []IssuerInfo
+	if err := tx.WithContext(ctx).Select("lock_hash, name, description").Where("lock_hash in ?", lockHashes).Find(&issuers).Error; err != nil {
+		return err
+	}
+	terms := make(map[string][]biz.SearchTerm, len(issuers))
+	for _, issuer := range issuers {
+		terms[issuer.LockHash] = biz.IssuerSearchTerms(issuer.Name, issuer.Description)
+	}
+	return replaceSearchTerms(ctx, tx, biz.SearchIssuer, lockHashes, terms)
+}
+
+func replaceSearchTerms(ctx context.Context, tx *gorm.DB, metaType string, keys []string, terms map[string][]biz.SearchTerm) error {
+	if err := tx.WithContext(ctx).Where("meta_type = ? and meta_key in ?", metaType, keys).Delete(MetadataSearchTerm{}).Error; err != nil {
+		return err
+	}
+	var rows []MetadataSearchTerm
+	for _, key := range keys {
+		for _, term := range terms[key] {
+			rows = append(rows, MetadataSearchTerm{MetaType: metaType, MetaKey: key, Term: term.Term, Weight: term.Weight})
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return tx.WithContext(ctx).CreateInBatches(&rows, 500).Error
+}
+
+// searchMatch returns the query selecting the meta_type, meta_key and integer score of the classes
+// and issuers matching every term, of the type unless it is empty
+type searchMatch func(terms []string, metaType string) (string, []any)
+
+type metadataSearchRepo struct {
+	data   *Data
+	match  searchMatch
+	logger *logger.Logger
+}
+
+// NewMetadataSearchRepo searches with the native index of the driver, a FULLTEXT index on MySQL and a
+// tsvector index on PostgreSQL, and with the term table on sqlite
+func NewMetadataSearchRepo(data *Data, logger *logger.Logger) biz.MetadataSearchRepo {
+	match := termMatch
+	switch data.driver {
+	case "", DriverMysql:
+		match = mysqlMatch
+	case DriverPostgres:
+		match = postgresMatch
+	}
+	return &metadataSearchRepo{
+		data:   data,
+		match:  match,
+		logger: logger,
+	}
+}
+
+// termMatch matches every query term as a prefix of an indexed term. Each query term scores the weight
+// of its best match, doubled for an exact match, and a result scores the sum over the terms.
+func termMatch(terms []string, metaType string) (string, []any) {
+	var (
+		matches []string
+		args    []any
+	)
+	for i, term := range terms {
+		match := fmt.Sprintf("SELECT meta_type, meta_key, %d AS q, CASE WHEN term = ? THEN weight * 2 ELSE weight END AS score FROM metadata_search_terms WHERE term LIKE ?", i)
+		args = append(args, term, term+"%")
+		if metaType != "" {
+			match += " AND meta_type = ?"
+			args = append(args, metaType)
+		}
+		matches = append(matches, match)
+	}
+	query := "SELECT meta_type, meta_key, SUM(score) AS score FROM " +
+		"(SELECT meta_type, meta_key, q, MAX(score) AS score FROM (" + strings.Join(matches, " UNION ALL ") + ") m GROUP BY meta_type, meta_key, q) s " +
+		"GROUP BY meta_type, meta_key HAVING COUNT(*) = ?"
+	return query, append(args, len(terms))
+}
+
+// mysqlMatch requires every query term as a prefix in boolean mode. The ngram parser matches a term
+// longer than its token size as a phrase of ngrams anywhere in a word, and the score is the InnoDB
+// relevance times 1000.
+func mysqlMatch(terms []string, metaType string) (string, []any) {
+	required := make([]string, len(terms))
+	for i, term := range terms {
+		required[i] = "+" + term + "*"
+	}
+	against := strings.Join(required, " ")
+	var (
+		matches []string
+		args    []any
+	)
+	if metaType != biz.SearchIssuer {
+		matches = append(matches, "SELECT '"+biz.SearchClass+"' AS meta_type, cota_id AS meta_key, "+
+			"CAST(ROUND(MATCH(`name`, symbol, description) AGAINST (? IN BOOLEAN MODE) * 1000) AS SIGNED) AS score "+
+			"FROM class_infos WHERE MATCH(`name`, symbol, description) AGAINST (? IN BOOLEAN MODE)")
+		args = append(args, against, against)
+	}
+	if metaType != biz.SearchClass {
+		matches = append(matches, "SELECT '"+biz.SearchIssuer+"' AS meta_type, lock_hash AS meta_key, "+
+			"CAST(ROUND(MATCH(`name`, description) AGAINST (? IN BOOLEAN MODE) * 1000) AS SIGNED) AS score "+
+			"FROM issuer_infos WHERE MATCH(`name`, description) AGAINST (? IN BOOLEAN MODE)")
+		args = append(args, against, against)
+	}
+	return strings.Join(matches, " UNION ALL "), args
+}
+
+// postgresMatch requires every query term as a prefix of a word of the search vector, and the score is
+// the ts_rank of the weighted vector times 1000
+func postgresMatch(terms []string, metaType string) (string, []any) {
+	prefixes := make([]string, len(terms))
+	for i, term := range terms {
+		prefixes[i] = term + ":*"
+	}
+	query := strings.Join(prefixes, " & ")
+	var (
+		matches []string
+		args    []any
+	)
+	if metaType != biz.SearchIssuer {
+		matches = append(matches, "SELECT '"+biz.SearchClass+"' AS meta_type, cota_id AS meta_key, "+
+			"CAST(ROUND(ts_rank(search_vector, to_tsquery('simple', ?)) * 1000) AS integer) AS score "+
+			"FROM class_infos WHERE search_vector @@ to_tsquery('simple', ?)")
+		args = append(args, query, query)
+	}
+	if metaType != biz.SearchClass {
+		matches = append(matches, "SELECT '"+biz.SearchIssuer+"' AS meta_type, lock_hash AS meta_key, "+
+			"CAST(ROUND(ts_rank(search_vector, to_tsquery('simple', ?)) * 1000) AS integer) AS score "+
+			"FROM issuer_infos WHERE search_vector @@ to_tsquery('simple', ?)")
+		args = append(args, query, query)
+	}
+	return strings.Join(matches, " UNION ALL "), args
+}
+
+// SearchMetadata pages the matches of the index of the driver by score descending, then type and key.
+// The scores of the drivers differ, MySQL and PostgreSQL rank with their own relevance.
+func (rp metadataSearchRepo) SearchMetadata(ctx context.Context, terms []string, metaType string, cursor *biz.SearchCursor, limit int) ([]biz.SearchResult, error) {
+	match, args := rp.match(terms, metaType)
+	query := "SELECT meta_type, meta_key, score FROM (" + match + ") r"
+	if cursor != nil {
+		query += " WHERE score < ? OR (score = ? AND (meta_type > ? OR (meta_type = ? AND meta_key > ?)))"
+		args = append(args, cursor.Score, cursor.Score, cursor.Type, cursor.Type, cursor.Key)
+	}
+	query += " ORDER BY score DESC, meta_type, meta_key LIMIT ?"
+	args = append(args, limit)
+	var hits []struct {
+		MetaType string
+		MetaKey  string
+		Score    int
+	}
+	if err := rp.data.db.WithContext(ctx).Raw(query, args...).Scan(&hits).Error; err != nil {
+		return nil, err
+	}
+	var cotaIds, lockHashes []string
+	for _, hit := range hits {
+		if hit.MetaType == biz.SearchClass {
+			cotaIds = append(cotaIds, hit.MetaKey)
+		} else {
+			lockHashes = append(lockHashes, hit.MetaKey)
+		}
+	}
+	infos := make(map[string]biz.SearchResult, len(hits))
+	if len(cotaIds) > 0 {
+		var classes []ClassInfo
+		if err := rp.data.db.WithContext(ctx).Where("cota_id in ?", cotaIds).Find(&classes).Error; err != nil {
+			return nil, err
+		}
+		for _, class := range classes {
+			infos[biz.SearchClass+class.CotaId] = biz.SearchResult{Name: class.Name, Symbol: class.Symbol, Description: class.Description, Image: class.ImageNormalized}
+		}
+	}
+	if len(lockHashes) > 0 {
+		var issuers []IssuerInfo
+		if err := rp.data.db.WithContext(ctx).Where("lock_hash in ?", lockHashes).Find(&issuers).Error; err != nil {
+			return nil, err
+		}
+		for _, issuer := range issuers {
+			infos[biz.SearchIssuer+issuer.LockHash] = biz.SearchResult{Name: issuer.Name, Description: issuer.Description, Image: issuer.Avatar}
+		}
+	}
+	results := make([]biz.SearchResult, len(hits))
+	for i, hit := range hits {
+		results[i] = infos[hit.MetaType+hit.MetaKey]
+		results[i].Type, results[i].Key, results[i].Score = hit.MetaType, hit.MetaKey, hit.Score
+	}
+	return results, nil
+}
+
+// RebuildSearch writes the search terms of every info again. MySQL and PostgreSQL maintain their
+// index, it only counts the infos the index covers there.
+func (rp metadataSearchRepo) RebuildSearch(ctx context.Context, batchSize int) (int64, int64, error) {
+	if batchSize <= 0 {
+		return 0, 0, fmt.Errorf("batch size must be positive: %d", batchSize)
+	}
+	if !termSearch(rp.data.db) {
+		var classes, issuers int64
+		if err := rp.data.db.WithContext(ctx).Model(ClassInfo{}).Count(&classes).Error; err != nil {
+			return 0, 0, err
+		}
+		err := rp.data.db.WithContext(ctx).Model(IssuerInfo{}).Count(&issuers).Error
+		return classes, issuers, err
+	}
+	classes, err := refreshKeyBatches(ctx, rp.data.db, batchSize, func(class ClassInfo) (uint, string) { return class.ID, class.CotaId }, refreshClassSearch)
+	if err != nil {
+		return classes, 0, err
+	}
+	issuers, err := refreshKeyBatches(ctx, rp.data.db, batchSize, func(issuer IssuerInfo) (uint, string) { return issuer.ID, issuer.LockHash }, refreshIssuerSearch)
+	if err != nil {
+		return classes, issuers, err
+	}
+	// drop the terms of infos removed while the index was not maintained
+	if err = rp.data.db.WithContext(ctx).Where("meta_type = ? and meta_key not in (?)", biz.SearchClass, rp.data.db.Model(ClassInfo{}).Select("cota_id")).
+		Delete(MetadataSearchTerm{}).Error; err != nil {
+		return classes, issuers, err
+	}
+	err = rp.data.db.WithContext(ctx).Where("meta_type = ? and meta_key not in (?)", biz.SearchIssuer, rp.data.db.Model(IssuerInfo{}).Select("lock_hash")).
+		Delete(MetadataSearchTerm{}).Error
+	return classes, issuers, err
+}
+
+// refreshKeyBatches calls refresh with the keys of the rows of T in the order of their ids, batchSize
+// rows per transaction, and returns the number of rows refreshed
+func refreshKeyBatches[T any](ctx context.Context, db *gorm.DB, batchSize int, key func(T) (uint, string), refresh func(context.Context, *gorm.DB, []string) error) (int64, error) {
+	var (
+		rebuilt int64
+		afterId uint
+	)
+	for {
+		var rows []T
+		if err := db.WithContext(ctx).Where("id > ?", afterId).Order("id").Limit(batchSize).Find(&rows).Error; err != nil {
+			return rebuilt, err
+		}
+		if len(rows) == 0 {
+			return rebuilt, nil
+		}
+		keys := make([]string, len(rows))
+		for i, row := range rows {
+			afterId, keys[i] = key(row)
+		}
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return refresh(ctx, tx, keys)
+		}); err != nil {
+			return rebuilt, err
+		}
+		rebuilt += int64(len(rows))
+	}
+}
@@ -0,0 +1,172 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", nil},
+		{"Dragon Ball Z", []string{"dragon", "ball", "z"}},
+		{"dragon-ball, DRAGON_ball!", []string{"dragon", "ball"}},
+		{"Café N°1", []string{"café", "n", "1"}},
+		{"龙珠 Dragon", []string{"龙", "珠", "dragon"}},
+		{strings.Repeat("é", 40), []string{strings.Repeat("é", 32)}},
+	}
+	for _, tt := range tests {
+		if got := biz.SearchTerms(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SearchTerms(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestMetadataSearchRepo_search(t *testing.T) {
+	for driver, dsn := range testBackends() {
+		t.Run(driver, func(t *testing.T) {
+			testMetadataSearch(t, newTestData(t, driver, dsn), driver)
+		})
+	}
+}
+
+// testMetadataSearch checks the matches and the paging of every backend, and the scores of the term
+// table on sqlite. MySQL and PostgreSQL rank with their own relevance.
+func testMetadataSearch(t *testing.T, data *Data, driver string) {
+	ctx := context.Background()
+	log := logger.NewLogger(io.Discard, "", 0)
+	kvPairs := newTestKvPairRepo(data)
+	uc := biz.NewMetadataSearchUsecase(NewMetadataSearchRepo(data, log), log)
+	const otherCotaId = "0000000000000000000000000000000000000002"
+	search := func(query, metaType string, limit int) []string {
+		t.Helper()
+		var (
+			keys   []string
+			cursor *biz.SearchCursor
+		)
+		for {
+			results, next, err := uc.Search(ctx, query, metaType, cursor, limit)
+			if err != nil {
+				t.Fatalf("Search(%q) error: %v", query, err)
+			}
+			for _, result := range results {
+				keys = append(keys, result.Key)
+			}
+			if next == nil {
+				return keys
+			}
+			if cursor, err = biz.ParseSearchCursor(next.String()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	block := func(number uint64, kvPair biz.KvPair) {
+		t.Helper()
+		if err := kvPairs.CreateMetadataKvPairs(ctx, biz.CheckInfo{BlockNumber: number, BlockHash: "h", CheckType: biz.SyncMetadata}, &kvPair); err != nil {
+			t.Fatalf("create block %d: %v", number, err)
+		}
+	}
+
+	class := testClass(100, 0, "Dragon Ball")
+	class.Description = "Legendary dragon cards"
+	other := testClass(100, 1, "Dragonfly")
+	other.CotaId, other.Description = otherCotaId, "insects"
+	issuer := testIssuer(100, 2, lockA, "Dragon Studio")
+	issuer.Description = "Makers of 龙 cards"
+	block(100, biz.KvPair{ClassInfos: []biz.ClassInfo{class, other}, IssuerInfos: []biz.IssuerInfo{issuer}})
+
+	sorted := func(keys []string) []string {
+		sort.Strings(keys)
+		return keys
+	}
+	results, next, err := uc.Search(ctx, "dragon", "", nil, 10)
+	if err != nil || next != nil || len(results) != 3 {
+		t.Fatalf("Search(dragon) = %+v, %v, %v", results, next, err)
+	}
+	byScore := []string{results[0].Key, results[1].Key, results[2].Key}
+	if keys := search("dragon", "", 1); !reflect.DeepEqual(keys, byScore) {
+		t.Errorf("paged Search(dragon) = %v, want %v", keys, byScore)
+	}
+	if keys := sorted(search("DRAG card", "", 10)); !reflect.DeepEqual(keys, sorted([]string{testCotaId, lockA})) {
+		t.Errorf("Search(DRAG card) = %v, want the results with both terms", keys)
+	}
+	if keys := search("dragon", biz.SearchIssuer, 10); !reflect.DeepEqual(keys, []string{lockA}) {
+		t.Errorf("Search(dragon) of issuers = %v", keys)
+	}
+	if driver == DriverSqlite {
+		want := []biz.SearchResult{
+			{Type: biz.SearchClass, Key: testCotaId, Name: "Dragon Ball", Symbol: "T", Description: "Legendary dragon cards", Image: "ipfs://Dragon Ball", Score: 2 * biz.SearchWeightName},
+			{Type: biz.SearchIssuer, Key: lockA, Name: "Dragon Studio", Description: "Makers of 龙 cards", Score: 2 * biz.SearchWeightName},
+			{Type: biz.SearchClass, Key: otherCotaId, Name: "Dragonfly", Symbol: "T", Description: "insects", Image: "ipfs://Dragonfly", Score: biz.SearchWeightName},
+		}
+		if !reflect.DeepEqual(results, want) {
+			t.Errorf("Search(dragon) = %+v, want %+v", results, want)
+		}
+		if keys := search("t", biz.SearchClass, 10); !reflect.DeepEqual(keys, []string{otherCotaId, testCotaId}) {
+			t.Errorf("Search(t) of classes = %v, want both classes by their symbol", keys)
+		}
+		if keys := search("龙", "", 10); !reflect.DeepEqual(keys, []string{lockA}) {
+			t.Errorf("Search(龙) = %v", keys)
+		}
+	}
+	if _, _, err = uc.Search(ctx, " !? ", "", nil, 10); !errors.Is(err, biz.ErrEmptySearchQuery) {
+		t.Errorf("Search without terms error = %v", err)
+	}
+	if _, _, err = uc.Search(ctx, "dragon", "joy_id", nil, 10); !errors.Is(err, biz.ErrUnknownSearchType) {
+		t.Errorf("Search of joy_id error = %v", err)
+	}
+
+	// a renamed class keeps only the terms of its description, the rollback indexes the old name again
+	renamed := testClass(101, 0, "Phoenix")
+	renamed.Description = class.Description
+	block(101, biz.KvPair{ClassInfos: []biz.ClassInfo{renamed}})
+	if keys := search("phoenix", "", 10); !reflect.DeepEqual(keys, []string{testCotaId}) {
+		t.Errorf("Search(phoenix) = %v", keys)
+	}
+	if keys := sorted(search("dragon", "", 10)); !reflect.DeepEqual(keys, sorted([]string{lockA, otherCotaId, testCotaId})) {
+		t.Errorf("Search(dragon) after the rename = %v", keys)
+	}
+	if err = kvPairs.RestoreMetadataKvPairs(ctx, 101); err != nil {
+		t.Fatal(err)
+	}
+	if keys := search("phoenix", "", 10); len(keys) != 0 {
+		t.Errorf("Search(phoenix) after the rollback = %v", keys)
+	}
+	if keys := search("dragon", "", 10); !reflect.DeepEqual(keys, byScore) {
+		t.Errorf("Search(dragon) after the rollback = %v, want %v", keys, byScore)
+	}
+
+	if err = data.db.Where("1 = 1").Delete(MetadataSearchTerm{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if classes, issuers, err := uc.Rebuild(ctx, 1); err != nil || classes != 2 || issuers != 1 || len(search("dragon", "", 10)) != 3 {
+		t.Errorf("Rebuild() = %d, %d, %v, want every info indexed", classes, issuers, err)
+	}
+	if err = kvPairs.RestoreMetadataKvPairs(ctx, 100); err != nil {
+		t.Fatal(err)
+	}
+	if keys := search("dragon", "", 10); len(keys) != 0 {
+		t.Errorf("Search(dragon) after the rollback of the infos = %v", keys)
+	}
+	var count int64
+	if err = data.db.Model(MetadataSearchTerm{}).Count(&count).Error; err != nil || count != 0 {
+		t.Errorf("%d search terms after the rollback of the infos, %v, want none", count, err)
+	}
+	// only sqlite writes the term table
+	if driver != DriverSqlite {
+		block(102, biz.KvPair{ClassInfos: []biz.ClassInfo{testClass(102, 0, "Dragon Ball")}})
+		if err = data.db.Model(MetadataSearchTerm{}).Count(&count).Error; err != nil || count != 0 {
+			t.Errorf("%d search terms on %s, %v, want none", count, driver, err)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package data
 import (
 	"context"
 	"errors"
+	"sort"
 
 	"github.com/nervina-labs/cota-syncer/internal/biz"
 	ckbTypes "github.com/nervosnetwork/ckb-sdk-go/types"
@@ -11,21 +12,14 @@ import (
 type MetadataSyncer struct {
 	kvPairUsecase         *biz.SyncKvPairUsecase
 	cotaWitnessArgsParser CotaWitnessArgsParser
-	issuerInfoUsecase     *biz.IssuerInfoUsecase
-	classInfoUsecase      *biz.ClassInfoUsecase
-	joyIDInfoUsecase      *biz.JoyIDInfoUsecase
+	metadata              *MetadataRegistry
 }
 
-func NewMetadataSyncer(
-	kvPairUsecase *biz.SyncKvPairUsecase, cotaWitnessArgsParser CotaWitnessArgsParser, issuerInfoUsecase *biz.IssuerInfoUsecase,
-	classInfoUsecase *biz.ClassInfoUsecase, joyIDInfoUsecase *biz.JoyIDInfoUsecase) MetadataSyncer {
-
+func NewMetadataSyncer(kvPairUsecase *biz.SyncKvPairUsecase, cotaWitnessArgsParser CotaWitnessArgsParser, metadata *MetadataRegistry) MetadataSyncer {
 	return MetadataSyncer{
 		kvPairUsecase:         kvPairUsecase,
 		cotaWitnessArgsParser: cotaWitnessArgsParser,
-		issuerInfoUsecase:     issuerInfoUsecase,
-		classInfoUsecase:      classInfoUsecase,
-		joyIDInfoUsecase:      joyIDInfoUsecase,
+		metadata:              metadata,
 	}
 }
 
@@ -35,6 +29,9 @@ func (bp MetadataSyncer) Sync(ctx context.Context, block *ckbTypes.Block, checkI
 		entries, err := bp.cotaWitnessArgsParser.Parse(tx, uint32(index), systemScripts.CotaType)
 		if err != nil && err.Error() == "No data" {
 			continue
+		} else if errors.Is(err, biz.ErrMalformedEntry) {
+			// the block syncer quarantines the transaction
+			continue
 		} else if err != nil {
 			return err
 		}
@@ -55,57 +52,127 @@ func (bp MetadataSyncer) Rollback(ctx context.Context, blockNumber uint64) error
 	return bp.kvPairUsecase.RestoreMetadataKvPairs(ctx, blockNumber)
 }
 
+// metadataDocument is a metadata document of an entry parsed on its own
+type metadataDocument struct {
+	entry   biz.Entry
+	data    []byte
+	meta    biz.MetaData
+	handler MetadataHandler
+	target  string
+	kvPair  biz.KvPair
+}
+
+// parseMetadata parses the metadata documents of a block in the order of their tx index and entry
+// index, at most one document per entry. The document of an entry is its output type. Its extra
+// witness is the fallback, parsed only when the entry has no output type or its output type fails
+// to decode, so it never overrides a valid output type of the same entry. An entry whose document
+// fails is quarantined.
+// Of the documents with the same type and target, the last one in that order is applied and each
+// earlier one is recorded as a metadata conflict against it. So a later transaction overrides an
+// earlier one, and the extra witness entry the witness args parser emits after the output type
+// entry of a cota cell overrides it. Documents without a target are all applied.
 func (bp MetadataSyncer) parseMetadata(ctx context.Context, blockNumber uint64, entries []biz.Entry) (biz.KvPair, error) {
-	var (
-		kvPair biz.KvPair
-		ctMeta biz.CTMeta
-		err    error
-	)
+	var kvPair biz.KvPair
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].TxIndex != entries[j].TxIndex {
+			return entries[i].TxIndex < entries[j].TxIndex
+		}
+		return entries[i].EntryIndex < entries[j].EntryIndex
+	})
+	var documents []metadataDocument
 	for _, entry := range entries {
-		// Parse Issuer/Class/JoyID Metadata
-		if len(entry.OutputType) > 0 {
-			ctMeta, err = biz.ParseMetadata(entry.OutputType)
-			if err != nil && len(entry.ExtraWitness) > 0 {
-				ctMeta, err = biz.ParseMetadata(entry.ExtraWitness)
-				if err != nil {
-					continue
-				}
-			}
-		} else if len(entry.ExtraWitness) > 0 {
-			ctMeta, err = biz.ParseMetadata(entry.ExtraWitness)
-			if err != nil {
-				continue
-			}
-		} else {
+		document, err := bp.parseDocument(ctx, blockNumber, entry)
+		if errors.Is(err, biz.ErrMalformedEntry) {
+			kvPair.Quarantines = append(kvPair.Quarantines, quarantineEntry(blockNumber, entry, biz.SyncMetadata, err))
 			continue
 		}
-		switch ctMeta.Metadata.Type {
-		case "issuer":
-			issuerInfo, err := bp.issuerInfoUsecase.ParseMetadata(blockNumber, entry.TxIndex, entry.LockScript, ctMeta.Metadata.Data)
-			if err != nil {
-				return kvPair, err
-			}
-			kvPair.IssuerInfos = append(kvPair.IssuerInfos, issuerInfo)
-		case "cota":
-			classInfo, err := bp.classInfoUsecase.ParseMetadata(blockNumber, entry.TxIndex, ctMeta.Metadata.Data)
-			if errors.Is(err, ErrInvalidClassInfo) {
-				continue
-			}
-
-			if err != nil {
-				return kvPair, err
-			}
-			kvPair.ClassInfos = append(kvPair.ClassInfos, classInfo)
-		case "joy_id":
-			joyIDInfo, err := bp.joyIDInfoUsecase.ParseMetadata(ctx, blockNumber, entry.TxIndex, entry.LockScript, ctMeta.Metadata.Data)
-			if errors.Is(err, ErrInvalidJoyIDInfo) {
-				continue
-			}
-			if err != nil {
-				return kvPair, err
-			}
-			kvPair.JoyIDInfos = append(kvPair.JoyIDInfos, joyIDInfo)
+		if err != nil {
+			return kvPair, err
+		}
+		if document != nil {
+			documents = append(documents, *document)
 		}
 	}
+	winners := make(map[string]int, len(documents))
+	for i, document := range documents {
+		if document.target != "" {
+			winners[document.meta.Type+"/"+document.target] = i
+		}
+	}
+	for i, document := range documents {
+		if document.target == "" || winners[document.meta.Type+"/"+document.target] == i {
+			kvPair.Append(document.kvPair)
+			continue
+		}
+		winner := documents[winners[document.meta.Type+"/"+document.target]]
+		conflict, err := metadataConflict(blockNumber, document, winner)
+		if err != nil {
+			return kvPair, err
+		}
+		kvPair.MetadataConflicts = append(kvPair.MetadataConflicts, conflict)
+	}
 	return kvPair, nil
 }
+
+// parseDocument decodes, validates and parses the metadata of an entry, nil for an entry without one
+func (bp MetadataSyncer) parseDocument(ctx context.Context, blockNumber uint64, entry biz.Entry) (*metadataDocument, error) {
+	var (
+		document = metadataDocument{entry: entry}
+		ctMeta   biz.CTMeta
+		err      error
+	)
+	if len(entry.OutputType) > 0 {
+		document.data = entry.OutputType
+		ctMeta, document.handler, err = bp.metadata.Decode(entry.OutputType)
+		if err != nil && len(entry.ExtraWitness) > 0 {
+			document.data = entry.ExtraWitness
+			ctMeta, document.handler, err = bp.metadata.Decode(entry.ExtraWitness)
+		}
+	} else if len(entry.ExtraWitness) > 0 {
+		document.data = entry.ExtraWitness
+		ctMeta, document.handler, err = bp.metadata.Decode(entry.ExtraWitness)
+	} else {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	document.meta = ctMeta.Metadata
+	warning, err := bp.metadata.Validate(blockNumber, entry, document.meta)
+	if err != nil {
+		return nil, err
+	}
+	if err = document.handler.Parse(ctx, blockNumber, entry, document.meta, &document.kvPair); err != nil {
+		return nil, err
+	}
+	if warning != nil {
+		document.kvPair.MetadataWarnings = append(document.kvPair.MetadataWarnings, *warning)
+	}
+	if targeter, ok := document.handler.(MetadataTargeter); ok {
+		document.target = targeter.Target(document.kvPair)
+	}
+	return &document, nil
+}
+
+func metadataConflict(blockNumber uint64, loser, winner metadataDocument) (biz.MetadataConflict, error) {
+	lockHash, _, err := GenerateLockHash(loser.entry)
+	if err != nil {
+		return biz.MetadataConflict{}, err
+	}
+	reason := biz.MetadataConflictSameBlock
+	if loser.entry.TxIndex == winner.entry.TxIndex {
+		reason = biz.MetadataConflictSameTx
+	}
+	return biz.MetadataConflict{
+		BlockNumber:      blockNumber,
+		TxIndex:          loser.entry.TxIndex,
+		EntryIndex:       loser.entry.EntryIndex,
+		LockHash:         lockHash,
+		Type:             loser.meta.Type,
+		Key:              loser.target,
+		WinnerTxIndex:    winner.entry.TxIndex,
+		WinnerEntryIndex: winner.entry.EntryIndex,
+		Reason:           reason,
+		Data:             string(loser.data),
+	}, nil
+}
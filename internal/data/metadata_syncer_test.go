@@ -0,0 +1,157 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/config"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+	ckbTypes "github.com/nervosnetwork/ckb-sdk-go/types"
+)
+
+// FuzzParseMetadata parses fuzzed metadata like the metadata syncer, rejected metadata is quarantined
+// or skipped and never aborts the block
+func FuzzParseMetadata(f *testing.F) {
+	for _, seed := range []string{
+		`{"id":"CTMeta","ver":"1.0","metadata":{"target":"output#0","type":"issuer","data":{"version":"0","name":"kevin","avatar":"https://i.loli.net/2021/04/28/ZCQPoxztsVHdNA9.jpg","description":"just a man"}}}`,
+		`{"id":"CTMeta","ver":"1.0","metadata":{"target":"output#0","type":"cota","data":{"cota_id":"0x718a6223d13598926c1e093e82e18b98d148f373","version":"1","name":"Kernel","symbol":"udt","characteristic":[["level",5]],"properties":{"a":1},"audios":[{"url":"u","name":"n"}]}}}`,
+		`{"id":"CTMeta","ver":"1.0","metadata":{"target":"output#0","type":"joy_id","data":{"version":"0","pub_key":"0x02","credential_id":"0xc1","alg":"0x01","cota_cell_id":"0x01","sub_keys":[{"pub_key":"0x03","alg":"0x01"}]}}}`,
+		`{"metadata":{"type":"issuer","data":{"name":1}}}`,
+		`{"id":1,"metadata":{"type":"cota"}}`,
+		`null`,
+	} {
+		f.Add([]byte(seed))
+	}
+	log := logger.NewLogger(io.Discard, "", 0)
+	data := newTestData(f, DriverSqlite, "file:fuzz_metadata?mode=memory&cache=shared")
+	syncer := NewMetadataSyncer(
+		biz.NewSyncKvPairUsecase(newTestKvPairRepo(data), log),
+		CotaWitnessArgsParser{},
+		newTestMetadataRegistry(data, &config.Metadata{}),
+	)
+	lock := &ckbTypes.Script{CodeHash: ckbTypes.HexToHash("0x01"), HashType: ckbTypes.HashTypeType, Args: []byte{1}}
+
+	f.Fuzz(func(t *testing.T, meta []byte) {
+		ctMeta, err := biz.ParseMetadata(meta)
+		if err != nil && (!errors.Is(err, biz.ErrMalformedEntry) || !reflect.DeepEqual(ctMeta, biz.CTMeta{})) {
+			t.Fatalf("ParseMetadata() = %+v, %v, want no metadata and a malformed entry", ctMeta, err)
+		}
+		entry := biz.Entry{OutputType: meta, LockScript: lock, TxHash: ckbTypes.HexToHash("0x02")}
+		kvPair, err := syncer.parseMetadata(context.Background(), 1, []biz.Entry{entry})
+		if err != nil {
+			t.Fatalf("parse the metadata: %v, want it quarantined", err)
+		}
+		if len(meta) > 0 && len(kvPair.Quarantines)+len(kvPair.IssuerInfos)+len(kvPair.ClassInfos)+len(kvPair.JoyIDInfos)+len(kvPair.Metadata) > 1 {
+			t.Errorf("one metadata entry parsed into %+v", kvPair)
+		}
+	})
+}
+
+func TestMetadataSyncer_parseMetadata_invalid(t *testing.T) {
+	log := logger.NewLogger(io.Discard, "", 0)
+	data := newTestData(t, DriverSqlite, "file:invalid_metadata?mode=memory&cache=shared")
+	syncer := NewMetadataSyncer(
+		biz.NewSyncKvPairUsecase(newTestKvPairRepo(data), log),
+		CotaWitnessArgsParser{},
+		newTestMetadataRegistry(data, &config.Metadata{}),
+	)
+	lock := &ckbTypes.Script{CodeHash: ckbTypes.HexToHash("0x01"), HashType: ckbTypes.HashTypeType, Args: []byte{1}}
+	tests := []struct {
+		name   string
+		meta   string
+		reason error
+	}{
+		{name: "short cota id", meta: `{"id":"CTMeta","ver":"1.0","metadata":{"target":"output#0","type":"cota","data":{"cota_id":"0x718a","version":"1","name":"Kernel"}}}`, reason: ErrInvalidClassInfo},
+		{name: "long joyid pub key", meta: `{"id":"CTMeta","ver":"1.0","metadata":{"target":"output#0","type":"joy_id","data":{"version":"0","pub_key":"0x` + strings.Repeat("ab", 65) + `"}}}`, reason: ErrInvalidJoyIDInfo},
+		{name: "bad json", meta: `{"id":`, reason: biz.ErrMalformedEntry},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := biz.Entry{OutputType: []byte(tt.meta), LockScript: lock, TxIndex: 3, EntryIndex: 1, TxHash: ckbTypes.HexToHash("0x02")}
+			kvPair, err := syncer.parseMetadata(context.Background(), 1, []biz.Entry{entry})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kvPair.ClassInfos)+len(kvPair.JoyIDInfos) != 0 || len(kvPair.Quarantines) != 1 {
+				t.Fatalf("parseMetadata() = %+v, want the entry quarantined", kvPair)
+			}
+			quarantined := kvPair.Quarantines[0]
+			if quarantined.Source != biz.SyncMetadata || quarantined.TxIndex != 3 || quarantined.EntryIndex != 1 ||
+				quarantined.ParserVersion != biz.ParserVersion || !strings.Contains(quarantined.Reason, tt.reason.Error()) {
+				t.Errorf("quarantined entry = %+v, want the reason %q", quarantined, tt.reason)
+			}
+		})
+	}
+}
+
+func TestMetadataSyncer_parseMetadata_precedence(t *testing.T) {
+	ctx := context.Background()
+	log := logger.NewLogger(io.Discard, "", 0)
+	data := newTestData(t, DriverSqlite, "file:metadata_precedence?mode=memory&cache=shared")
+	repo := newTestKvPairRepo(data)
+	syncer := NewMetadataSyncer(
+		biz.NewSyncKvPairUsecase(repo, log),
+		CotaWitnessArgsParser{},
+		newTestMetadataRegistry(data, &config.Metadata{}),
+	)
+	lock := &ckbTypes.Script{CodeHash: ckbTypes.HexToHash("0x01"), HashType: ckbTypes.HashTypeType, Args: []byte{1}}
+	class := func(name string) []byte {
+		return []byte(`{"id":"CTMeta","ver":"1.0","metadata":{"target":"output#0","type":"cota","data":{"cota_id":"0x718a6223d13598926c1e093e82e18b98d148f373","version":"1","name":"` + name + `"}}}`)
+	}
+	issuer := []byte(`{"id":"CTMeta","ver":"1.0","metadata":{"target":"output#0","type":"issuer","data":{"version":"0","name":"kevin"}}}`)
+	// the extra witness of the last entry overrides the output type of its transaction and the earlier one
+	entries := []biz.Entry{
+		{ExtraWitness: class("witness"), LockScript: lock, TxIndex: 2, EntryIndex: 1},
+		{OutputType: class("output"), LockScript: lock, TxIndex: 2, EntryIndex: 0},
+		{OutputType: issuer, LockScript: lock, TxIndex: 1, EntryIndex: 0},
+		{OutputType: class("earlier"), LockScript: lock, TxIndex: 1, EntryIndex: 1},
+	}
+	kvPair, err := syncer.parseMetadata(ctx, 100, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvPair.IssuerInfos) != 1 || len(kvPair.ClassInfos) != 1 || kvPair.ClassInfos[0].Name != "witness" {
+		t.Fatalf("parseMetadata() = %+v, want the issuer and the class of the extra witness", kvPair)
+	}
+	wantConflicts := []struct {
+		txIndex, entryIndex uint32
+		reason, name        string
+	}{
+		{1, 1, biz.MetadataConflictSameBlock, "earlier"},
+		{2, 0, biz.MetadataConflictSameTx, "output"},
+	}
+	if len(kvPair.MetadataConflicts) != len(wantConflicts) {
+		t.Fatalf("conflicts = %+v, want %d", kvPair.MetadataConflicts, len(wantConflicts))
+	}
+	for i, want := range wantConflicts {
+		conflict := kvPair.MetadataConflicts[i]
+		if conflict.TxIndex != want.txIndex || conflict.EntryIndex != want.entryIndex || conflict.Reason != want.reason ||
+			conflict.WinnerTxIndex != 2 || conflict.WinnerEntryIndex != 1 || conflict.Type != "cota" ||
+			conflict.Key != "718a6223d13598926c1e093e82e18b98d148f373" || !strings.Contains(conflict.Data, want.name) {
+			t.Errorf("conflict %d = %+v, want %+v", i, conflict, want)
+		}
+	}
+
+	if err = repo.CreateMetadataKvPairs(ctx, biz.CheckInfo{BlockNumber: 100, BlockHash: "h", CheckType: biz.SyncMetadata}, &kvPair); err != nil {
+		t.Fatal(err)
+	}
+	var stored ClassInfo
+	if err = data.db.First(&stored).Error; err != nil || stored.Name != "witness" {
+		t.Fatalf("class info = %+v, %v, want the class of the extra witness", stored, err)
+	}
+	var count int64
+	if err = data.db.Model(MetadataConflict{}).Where("block_number = ?", 100).Count(&count).Error; err != nil || count != 2 {
+		t.Fatalf("%d metadata conflicts stored, %v, want 2", count, err)
+	}
+	if err = repo.RestoreMetadataKvPairs(ctx, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err = data.db.Model(MetadataConflict{}).Count(&count).Error; err != nil || count != 0 {
+		t.Errorf("%d metadata conflicts after the restore, %v, want none", count, err)
+	}
+}
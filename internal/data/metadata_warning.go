@@ -0,0 +1,52 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"gorm.io/gorm"
+)
+
+// MetadataWarning flags an entry stored by lenient validation although its data does not match the
+// schema of its type, Errors is the json array of the field paths and messages
+type MetadataWarning struct {
+	ID          uint `gorm:"primaryKey"`
+	BlockNumber uint64
+	TxIndex     uint32
+	EntryIndex  uint32
+	LockHash    string
+	MetaType    string
+	SchemaId    string
+	Errors      string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func createMetadataWarnings(ctx context.Context, tx *gorm.DB, warnings []biz.MetadataWarning) error {
+	if len(warnings) == 0 {
+		return nil
+	}
+	rows := make([]MetadataWarning, len(warnings))
+	for i, warning := range warnings {
+		errs, err := json.Marshal(warning.Errors)
+		if err != nil {
+			return err
+		}
+		rows[i] = MetadataWarning{
+			BlockNumber: warning.BlockNumber,
+			TxIndex:     warning.TxIndex,
+			EntryIndex:  warning.EntryIndex,
+			LockHash:    warning.LockHash,
+			MetaType:    warning.Type,
+			SchemaId:    warning.Schema,
+			Errors:      string(errs),
+		}
+	}
+	return tx.Model(MetadataWarning{}).WithContext(ctx).Create(&rows).Error
+}
+
+func deleteMetadataWarnings(ctx context.Context, tx *gorm.DB, blockNumber uint64) error {
+	return tx.WithContext(ctx).Where("block_number = ?", blockNumber).Delete(MetadataWarning{}).Error
+}
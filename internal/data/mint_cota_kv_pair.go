@@ -27,7 +27,10 @@ func (rp mintCotaKvPairRepo) ParseMintCotaEntries(blockNumber uint64, entry biz.
 }
 
 func generateMintV1KvPairs(blockNumber uint64, entry biz.Entry, rp mintCotaKvPairRepo) (defineCotas []biz.DefineCotaNftKvPair, withdrawCotas []biz.WithdrawCotaNftKvPair, err error) {
-	entries := smt.MintCotaNFTV1EntriesFromSliceUnchecked(entry.InputType[1:])
+	entries, err := decodeMolecule("mint entries", entry.InputType[1:], smt.MintCotaNFTV1EntriesFromSlice)
+	if err != nil {
+		return
+	}
 	defineCotaKeyVec := entries.DefineKeys()
 	defineCotaValueVec := entries.DefineNewValues()
 	senderLock, err := GenerateSenderLock(entry)
@@ -41,6 +44,9 @@ func generateMintV1KvPairs(blockNumber uint64, entry biz.Entry, rp mintCotaKvPai
 	if err != nil {
 		return
 	}
+	if err = checkPairs("define entries", defineCotaKeyVec.Len(), defineCotaValueVec.Len()); err != nil {
+		return
+	}
 	for i := uint(0); i < defineCotaKeyVec.Len(); i++ {
 		key := defineCotaKeyVec.Get(i)
 		value := defineCotaValueVec.Get(i)
@@ -52,17 +58,24 @@ func generateMintV1KvPairs(blockNumber uint64, entry biz.Entry, rp mintCotaKvPai
 			Configure:   value.Configure().AsSlice()[0],
 			LockHash:    lockHashStr,
 			LockHashCRC: lockHashCRC32,
+			TxIndex:     entry.TxIndex,
 			UpdatedAt:   time.Now(),
 		})
 	}
 	withdrawKeyVec := entries.WithdrawalKeys()
 	withdrawValueVec := entries.WithdrawalValues()
+	if err = checkPairs("withdrawal entries", withdrawKeyVec.Len(), withdrawValueVec.Len()); err != nil {
+		return
+	}
 	for i := uint(0); i < withdrawKeyVec.Len(); i++ {
 		key := withdrawKeyVec.Get(i)
 		value := withdrawValueVec.Get(i)
 		cotaId := hex.EncodeToString(key.NftId().CotaId().RawData())
 		outpointStr := hex.EncodeToString(key.OutPoint().RawData())
-		receiverLock := GenerateReceiverLock(value.ToLock().RawData())
+		var receiverLock biz.Script
+		if receiverLock, err = GenerateReceiverLock(value.ToLock().RawData()); err != nil {
+			return
+		}
 		if err = rp.FindOrCreateScript(context.TODO(), &receiverLock); err != nil {
 			return
 		}
@@ -74,10 +87,12 @@ func generateMintV1KvPairs(blockNumber uint64, entry biz.Entry, rp mintCotaKvPai
 			OutPoint:             outpointStr,
 			OutPointCrc:          crc32.ChecksumIEEE([]byte(outpointStr)),
 			TxHash:               entry.TxHash.String()[2:],
+			TxIndex:              entry.TxIndex,
 			State:                value.NftInfo().State().AsSlice()[0],
 			Configure:            value.NftInfo().Configure().AsSlice()[0],
 			Characteristic:       hex.EncodeToString(value.NftInfo().Characteristic().RawData()),
 			ReceiverLockScriptId: receiverLock.ID,
+			ReceiverLockHash:     GenerateReceiverLockHash(value.ToLock().RawData()),
 			LockHash:             lockHashStr,
 			LockHashCrc:          lockHashCRC32,
 			LockScriptId:         senderLock.ID,
@@ -88,7 +103,10 @@ func generateMintV1KvPairs(blockNumber uint64, entry biz.Entry, rp mintCotaKvPai
 }
 
 func generateMintV0KvPairs(blockNumber uint64, entry biz.Entry, rp mintCotaKvPairRepo) (defineCotas []biz.DefineCotaNftKvPair, withdrawCotas []biz.WithdrawCotaNftKvPair, err error) {
-	entries := smt.MintCotaNFTEntriesFromSliceUnchecked(entry.InputType[1:])
+	entries, err := decodeMolecule("mint entries", entry.InputType[1:], smt.MintCotaNFTEntriesFromSlice)
+	if err != nil {
+		return
+	}
 	defineCotaKeyVec := entries.DefineKeys()
 	defineCotaValueVec := entries.DefineNewValues()
 	senderLock, err := GenerateSenderLock(entry)
@@ -102,6 +120,9 @@ func generateMintV0KvPairs(blockNumber uint64, entry biz.Entry, rp mintCotaKvPai
 	if err != nil {
 		return
 	}
+	if err = checkPairs("define entries", defineCotaKeyVec.Len(), defineCotaValueVec.Len()); err != nil {
+		return
+	}
 	for i := uint(0); i < defineCotaKeyVec.Len(); i++ {
 		key := defineCotaKeyVec.Get(i)
 		value := defineCotaValueVec.Get(i)
@@ -113,17 +134,24 @@ func generateMintV0KvPairs(blockNumber uint64, entry biz.Entry, rp mintCotaKvPai
 			Configure:   value.Configure().AsSlice()[0],
 			LockHash:    lockHashStr,
 			LockHashCRC: lockHashCRC32,
+			TxIndex:     entry.TxIndex,
 			UpdatedAt:   time.Now().UTC(),
 		})
 	}
 	withdrawKeyVec := entries.WithdrawalKeys()
 	withdrawValueVec := entries.WithdrawalValues()
+	if err = checkPairs("withdrawal entries", withdrawKeyVec.Len(), withdrawValueVec.Len()); err != nil {
+		return
+	}
 	for i := uint(0); i < withdrawKeyVec.Len(); i++ {
 		key := withdrawKeyVec.Get(i)
 		value := withdrawValueVec.Get(i)
 		cotaId := hex.EncodeToString(key.CotaId().RawData())
 		outpointStr := hex.EncodeToString(value.OutPoint().RawData())
-		receiverLock := GenerateReceiverLock(value.ToLock().RawData())
+		var receiverLock biz.Script
+		if receiverLock, err = GenerateReceiverLock(value.ToLock().RawData()); err != nil {
+			return
+		}
 		if err = rp.FindOrCreateScript(context.TODO(), &receiverLock); err != nil {
 			return
 		}
@@ -135,10 +163,12 @@ func generateMintV0KvPairs(blockNumber uint64, entry biz.Entry, rp mintCotaKvPai
 			OutPoint:             outpointStr,
 			OutPointCrc:          crc32.ChecksumIEEE([]byte(outpointStr)),
 			TxHash:               entry.TxHash.String()[2:],
+			TxIndex:              entry.TxIndex,
 			State:                value.NftInfo().State().AsSlice()[0],
 			Configure:            value.NftInfo().Configure().AsSlice()[0],
 			Characteristic:       hex.EncodeToString(value.NftInfo().Characteristic().RawData()),
 			ReceiverLockScriptId: receiverLock.ID,
+			ReceiverLockHash:     GenerateReceiverLockHash(value.ToLock().RawData()),
 			LockHash:             lockHashStr,
 			LockHashCrc:          lockHashCRC32,
 			LockScriptId:         senderLock.ID,
@@ -149,22 +179,7 @@ func generateMintV0KvPairs(blockNumber uint64, entry biz.Entry, rp mintCotaKvPai
 }
 
 func (rp mintCotaKvPairRepo) FindOrCreateScript(ctx context.Context, script *biz.Script) error {
-	ht, err := hashType(script.HashType)
-	if err != nil {
-		return err
-	}
-	s := Script{}
-	if err = rp.data.db.WithContext(ctx).FirstOrCreate(&s, Script{
-		CodeHash:    script.CodeHash,
-		CodeHashCrc: crc32.ChecksumIEEE([]byte(script.CodeHash)),
-		HashType:    ht,
-		Args:        script.Args,
-		ArgsCrc:     crc32.ChecksumIEEE([]byte(script.Args)),
-	}).Error; err != nil {
-		return err
-	}
-	script.ID = s.ID
-	return nil
+	return findOrCreateScript(ctx, rp.data, script)
 }
 
 func NewMintCotaKvPairRepo(data *Data, logger *logger.Logger) biz.MintCotaKvPairRepo {
@@ -0,0 +1,162 @@
+package data
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+	ckbTypes "github.com/nervosnetwork/ckb-sdk-go/types"
+	"gorm.io/gorm"
+)
+
+var _ biz.QuarantinedEntryRepo = (*quarantinedEntryRepo)(nil)
+
+type QuarantinedEntry struct {
+	ID            uint `gorm:"primaryKey"`
+	BlockNumber   uint64
+	TxIndex       uint32
+	TxHash        string
+	EntryIndex    uint32
+	Source        biz.CheckType
+	Action        uint8
+	Raw           string
+	Reason        string
+	ParserVersion uint32
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+type quarantinedEntryRepo struct {
+	data   *Data
+	logger *logger.Logger
+}
+
+func NewQuarantinedEntryRepo(data *Data, logger *logger.Logger) biz.QuarantinedEntryRepo {
+	return &quarantinedEntryRepo{
+		data:   data,
+		logger: logger,
+	}
+}
+
+func (rp quarantinedEntryRepo) FindQuarantinedEntries(ctx context.Context, beforeVersion uint32) ([]biz.QuarantinedEntry, error) {
+	var quarantined []QuarantinedEntry
+	if err := rp.data.db.WithContext(ctx).Where("parser_version < ?", beforeVersion).Order("block_number, source, tx_index, entry_index").Find(&quarantined).Error; err != nil {
+		return nil, err
+	}
+	entries := make([]biz.QuarantinedEntry, len(quarantined))
+	for i, entry := range quarantined {
+		entries[i] = biz.QuarantinedEntry{
+			Id:            uint64(entry.ID),
+			BlockNumber:   entry.BlockNumber,
+			TxIndex:       entry.TxIndex,
+			TxHash:        entry.TxHash,
+			EntryIndex:    entry.EntryIndex,
+			Source:        entry.Source,
+			Action:        entry.Action,
+			Raw:           entry.Raw,
+			Reason:        entry.Reason,
+			ParserVersion: entry.ParserVersion,
+		}
+	}
+	return entries, nil
+}
+
+func createQuarantinedEntries(ctx context.Context, tx *gorm.DB, entries []biz.QuarantinedEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	quarantined := make([]QuarantinedEntry, len(entries))
+	for i, entry := range entries {
+		quarantined[i] = QuarantinedEntry{
+			BlockNumber:   entry.BlockNumber,
+			TxIndex:       entry.TxIndex,
+			TxHash:        entry.TxHash,
+			EntryIndex:    entry.EntryIndex,
+			Source:        entry.Source,
+			Action:        entry.Action,
+			Raw:           entry.Raw,
+			Reason:        entry.Reason,
+			ParserVersion: entry.ParserVersion,
+		}
+	}
+	return tx.Model(QuarantinedEntry{}).WithContext(ctx).Create(&quarantined).Error
+}
+
+func deleteQuarantinedEntries(ctx context.Context, tx *gorm.DB, blockNumber uint64, source biz.CheckType) error {
+	return tx.WithContext(ctx).Where("block_number = ? and source = ?", blockNumber, source).Delete(QuarantinedEntry{}).Error
+}
+
+// quarantineEntry keeps an entry the action or metadata parsers rejected, the raw bytes are the first
+// of the input type, the output type and the extra witness the entry has
+func quarantineEntry(blockNumber uint64, entry biz.Entry, source biz.CheckType, err error) biz.QuarantinedEntry {
+	raw := entry.InputType
+	if len(raw) == 0 {
+		raw = entry.OutputType
+	}
+	if len(raw) == 0 {
+		raw = entry.ExtraWitness
+	}
+	var action uint8
+	if len(entry.InputType) > 0 {
+		action = entry.InputType[0]
+	}
+	return biz.QuarantinedEntry{
+		BlockNumber:   blockNumber,
+		TxIndex:       entry.TxIndex,
+		TxHash:        entry.TxHash.String()[2:],
+		EntryIndex:    entry.EntryIndex,
+		Source:        source,
+		Action:        action,
+		Raw:           hex.EncodeToString(raw),
+		Reason:        err.Error(),
+		ParserVersion: biz.ParserVersion,
+	}
+}
+
+// quarantineTx keeps a transaction whose witnesses could not be split into cota entries, the raw
+// bytes are the witnesses in hex separated by commas
+func quarantineTx(blockNumber uint64, txIndex uint32, tx *ckbTypes.Transaction, err error) biz.QuarantinedEntry {
+	witnesses := make([]string, len(tx.Witnesses))
+	for i, witness := range tx.Witnesses {
+		witnesses[i] = hex.EncodeToString(witness)
+	}
+	return biz.QuarantinedEntry{
+		BlockNumber:   blockNumber,
+		TxIndex:       txIndex,
+		TxHash:        tx.Hash.String()[2:],
+		Source:        biz.SyncBlock,
+		Raw:           strings.Join(witnesses, ","),
+		Reason:        err.Error(),
+		ParserVersion: biz.ParserVersion,
+	}
+}
+
+func malformedEntry(format string, args ...any) error {
+	return biz.NewMalformedEntryError(format, args...)
+}
+
+// decodeMolecule decodes a slice with a checked molecule decoder. The generated decoders verify only
+// part of the offsets and can still slice out of range, so a panic is a malformed entry as well.
+func decodeMolecule[T any](name string, slice []byte, decode func([]byte, bool) (*T, error)) (result *T, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, malformedEntry("%s: %v", name, r)
+		}
+	}()
+	if result, err = decode(slice, true); err != nil {
+		return nil, malformedEntry("%s: %v", name, err)
+	}
+	return
+}
+
+// checkPairs rejects the entries whose key and value vectors differ in length, the values are read by
+// the index of the keys
+func checkPairs(name string, keys, values uint) error {
+	if keys != values {
+		return malformedEntry("%s has %d keys and %d values", name, keys, values)
+	}
+	return nil
+}
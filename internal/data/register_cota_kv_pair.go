@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/binary"
 	"encoding/hex"
-	"hash/crc32"
 	"time"
 
 	"github.com/nervina-labs/cota-smt-go/smt"
@@ -20,7 +19,7 @@ type RegisterCotaKvPair struct {
 	ID           uint `gorm:"primaryKey"`
 	BlockNumber  uint64
 	LockHash     string
-	CotaCellID   uint64
+	CotaCellID   Uint64
 	LockScriptId uint
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
@@ -53,12 +52,22 @@ func (rp registerCotaKvPairRepo) DeleteRegisterCotaKvPairs(ctx context.Context,
 }
 
 func (rp registerCotaKvPairRepo) ParseRegistryEntries(ctx context.Context, blockNumber uint64, tx *ckbTypes.Transaction) (registerCotas []biz.RegisterCotaKvPair, err error) {
-	bytes, err := blockchain.WitnessArgsFromSliceUnchecked(tx.Witnesses[0]).InputType().IntoBytes()
+	if len(tx.Witnesses) == 0 {
+		return nil, malformedEntry("registry transaction has no witnesses")
+	}
+	witnessArgs, err := decodeMolecule("registry witness", tx.Witnesses[0], blockchain.WitnessArgsFromSlice)
+	if err != nil {
+		return
+	}
+	bytes, err := witnessArgs.InputType().IntoBytes()
 	if err != nil {
 		return
 	}
 	registerWitnessType := bytes.RawData()
-	registryEntries := smt.CotaNFTRegistryEntriesFromSliceUnchecked(registerWitnessType)
+	registryEntries, err := decodeMolecule("registry entries", registerWitnessType, smt.CotaNFTRegistryEntriesFromSlice)
+	if err != nil {
+		return
+	}
 	registryVec := registryEntries.Registries()
 	lockMap, err := rp.generateLockMap(tx)
 	if err != nil {
@@ -90,22 +99,7 @@ func (rp registerCotaKvPairRepo) ParseRegistryEntries(ctx context.Context, block
 }
 
 func (rp registerCotaKvPairRepo) FindOrCreateScript(ctx context.Context, script *biz.Script) error {
-	ht, err := hashType(script.HashType)
-	if err != nil {
-		return err
-	}
-	s := Script{}
-	if err = rp.data.db.WithContext(ctx).FirstOrCreate(&s, Script{
-		CodeHash:    script.CodeHash,
-		CodeHashCrc: crc32.ChecksumIEEE([]byte(script.CodeHash)),
-		HashType:    ht,
-		Args:        script.Args,
-		ArgsCrc:     crc32.ChecksumIEEE([]byte(script.Args)),
-	}).Error; err != nil {
-		return err
-	}
-	script.ID = s.ID
-	return nil
+	return findOrCreateScript(ctx, rp.data, script)
 }
 
 func (rp registerCotaKvPairRepo) generateLockMap(tx *ckbTypes.Transaction) (map[string]*biz.Script, error) {
@@ -2,7 +2,6 @@ package data
 
 import (
 	"context"
-	"hash/crc32"
 
 	"github.com/nervina-labs/cota-syncer/internal/biz"
 	"github.com/nervina-labs/cota-syncer/internal/logger"
@@ -56,20 +55,5 @@ func (rp registerLockScriptRepo) FindRegisterQueryInfos(ctx context.Context, pag
 }
 
 func (rp registerLockScriptRepo) FindOrCreateScript(ctx context.Context, script *biz.Script) error {
-	ht, err := hashType(script.HashType)
-	if err != nil {
-		return err
-	}
-	s := Script{}
-	if err = rp.data.db.WithContext(ctx).FirstOrCreate(&s, Script{
-		CodeHash:    script.CodeHash,
-		CodeHashCrc: crc32.ChecksumIEEE([]byte(script.CodeHash)),
-		HashType:    ht,
-		Args:        script.Args,
-		ArgsCrc:     crc32.ChecksumIEEE([]byte(script.Args)),
-	}).Error; err != nil {
-		return err
-	}
-	script.ID = s.ID
-	return nil
+	return findOrCreateScript(ctx, rp.data, script)
 }
@@ -0,0 +1,59 @@
+package data
+
+import (
+	"container/list"
+	"sync"
+)
+
+// scriptCacheSize bounds the ids of the lock scripts kept in memory. A catch-up sync sees the same
+// few receiver locks in every block, a script seen once is dropped when the cache is full.
+const scriptCacheSize = 10000
+
+// scriptCache keeps the ids of the most recently used lock scripts, a script row is never changed or
+// deleted. The zero value is an empty cache of scriptCacheSize entries.
+type scriptCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type scriptCacheEntry struct {
+	key string
+	id  uint
+}
+
+func (c *scriptCache) get(key string) (uint, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return 0, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(scriptCacheEntry).id, true
+}
+
+// add caches the id of the script and evicts the least recently used one past the size
+func (c *scriptCache) add(key string, id uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		if c.size <= 0 {
+			c.size = scriptCacheSize
+		}
+		c.order = list.New()
+		c.entries = make(map[string]*list.Element)
+	}
+	if element, ok := c.entries[key]; ok {
+		element.Value = scriptCacheEntry{key: key, id: id}
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(scriptCacheEntry{key: key, id: id})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(scriptCacheEntry).key)
+	}
+}
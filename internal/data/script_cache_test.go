@@ -0,0 +1,34 @@
+package data
+
+import "testing"
+
+func Test_scriptCache(t *testing.T) {
+	cache := scriptCache{size: 2}
+	if _, ok := cache.get("a"); ok {
+		t.Fatal("get() on an empty cache found a script")
+	}
+	cache.add("a", 1)
+	cache.add("b", 2)
+	// a is used after b, so b is the least recently used script when c comes
+	if id, ok := cache.get("a"); !ok || id != 1 {
+		t.Errorf("get(a) = %d, %v, want 1", id, ok)
+	}
+	cache.add("c", 3)
+	if _, ok := cache.get("b"); ok {
+		t.Error("get(b) found the least recently used script past the size")
+	}
+	for key, want := range map[string]uint{"a": 1, "c": 3} {
+		if id, ok := cache.get(key); !ok || id != want {
+			t.Errorf("get(%s) = %d, %v, want %d", key, id, ok, want)
+		}
+	}
+	if len(cache.entries) != 2 || cache.order.Len() != 2 {
+		t.Errorf("cache holds %d entries and %d elements, want 2", len(cache.entries), cache.order.Len())
+	}
+
+	var unsized scriptCache
+	unsized.add("a", 1)
+	if unsized.size != scriptCacheSize {
+		t.Errorf("size of the zero cache = %d, want %d", unsized.size, scriptCacheSize)
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/nervina-labs/cota-syncer/internal/biz"
 	"github.com/nervina-labs/cota-syncer/internal/data/blockchain"
+	"github.com/nervosnetwork/ckb-sdk-go/crypto/blake2b"
 )
 
 func GenerateSenderLock(entry biz.Entry) (lockScript biz.Script, err error) {
@@ -31,12 +32,22 @@ func GenerateLockHash(entry biz.Entry) (lockHashStr string, lockHashCRC32 uint32
 	return
 }
 
-func GenerateReceiverLock(slice []byte) biz.Script {
-	receiverLock := blockchain.ScriptFromSliceUnchecked(slice)
+func GenerateReceiverLock(slice []byte) (biz.Script, error) {
+	receiverLock, err := decodeMolecule("receiver lock", slice, blockchain.ScriptFromSlice)
+	if err != nil {
+		return biz.Script{}, err
+	}
 	script := biz.Script{
 		CodeHash: hex.EncodeToString(receiverLock.CodeHash().RawData()),
 		HashType: hex.EncodeToString(receiverLock.HashType().AsSlice()),
 		Args:     hex.EncodeToString(receiverLock.Args().RawData()),
 	}
-	return script
+	return script, nil
+}
+
+// GenerateReceiverLockHash returns the ckb script hash of a molecule serialized receiver lock
+func GenerateReceiverLockHash(slice []byte) string {
+	// Blake256 fails only with an invalid hash config, which is fixed here
+	hash, _ := blake2b.Blake256(slice)
+	return hex.EncodeToString(hash)
 }
@@ -0,0 +1,417 @@
+package data
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+	"gorm.io/gorm"
+)
+
+var _ biz.SnapshotRepo = (*snapshotRepo)(nil)
+
+const (
+	snapshotBatchSize    = 1000
+	snapshotManifestName = "manifest.json"
+	snapshotTablesDir    = "tables"
+)
+
+// snapshotTables are the tables of a snapshot in the order they are loaded. The event outbox and the
+// webhook and sink cursors belong to a deployment and are left out, an imported replica delivers the
+// events it syncs after the snapshot.
+var snapshotTables = []snapshotTable{
+	newSnapshotTable[RegisterCotaKvPair](), newSnapshotTable[DefineCotaNftKvPair](), newSnapshotTable[DefineCotaNftKvPairVersion](),
+	newSnapshotTable[HoldCotaNftKvPair](), newSnapshotTable[HoldCotaNftKvPairVersion](), newSnapshotTable[WithdrawCotaNftKvPair](),
+	newSnapshotTable[ClaimedCotaNftKvPair](), newSnapshotTable[ExtensionKvPair](), newSnapshotTable[ExtensionKvPairVersion](),
+	newSnapshotTable[SubKeyKvPair](), newSnapshotTable[SubKeyKvPairVersion](), newSnapshotTable[SocialKvPair](),
+	newSnapshotTable[SocialKvPairVersion](), newSnapshotTable[IssuerInfo](), newSnapshotTable[IssuerInfoVersion](),
+	newSnapshotTable[ClassInfo](), newSnapshotTable[ClassInfoVersion](), newSnapshotTable[TokenClassAudio](),
+	newSnapshotTable[JoyIDInfo](), newSnapshotTable[JoyIDInfoVersion](), newSnapshotTable[SubKeyInfo](),
+	newSnapshotTable[SubKeyInfoVersion](), newSnapshotTable[Script](), newSnapshotTable[CotaEvent](),
+	newSnapshotTable[QuarantinedEntry](), newSnapshotTable[VersionPruneHeight](), newSnapshotTable[RawMetadata](),
+	newSnapshotTable[MetadataWarning](), newSnapshotTable[MetadataConflict](), newSnapshotTable[TokenTrait](),
+	newSnapshotTable[MetadataSearchTerm](), newSnapshotTable[SocialGuardian](), newSnapshotTable[CheckInfo](),
+}
+
+// snapshotTable writes the rows of a model as json lines in the order of their ids and loads them back
+type snapshotTable struct {
+	model  any
+	export func(ctx context.Context, tx *gorm.DB, w io.Writer) (int64, error)
+	load   func(ctx context.Context, tx *gorm.DB, r io.Reader) (int64, error)
+}
+
+func newSnapshotTable[T any]() snapshotTable {
+	return snapshotTable{
+		model: new(T),
+		export: func(ctx context.Context, tx *gorm.DB, w io.Writer) (int64, error) {
+			var (
+				rows  int64
+				batch []T
+			)
+			encoder := json.NewEncoder(w)
+			err := tx.WithContext(ctx).Model(new(T)).FindInBatches(&batch, snapshotBatchSize, func(*gorm.DB, int) error {
+				for _, row := range batch {
+					if err := encoder.Encode(row); err != nil {
+						return err
+					}
+				}
+				rows += int64(len(batch))
+				return nil
+			}).Error
+			return rows, err
+		},
+		load: func(ctx context.Context, tx *gorm.DB, r io.Reader) (int64, error) {
+			var rows int64
+			batch := make([]T, 0, snapshotBatchSize)
+			flush := func() error {
+				if len(batch) == 0 {
+					return nil
+				}
+				if err := tx.WithContext(ctx).Create(&batch).Error; err != nil {
+					return err
+				}
+				rows += int64(len(batch))
+				batch = batch[:0]
+				return nil
+			}
+			decoder := json.NewDecoder(r)
+			for {
+				var row T
+				if err := decoder.Decode(&row); errors.Is(err, io.EOF) {
+					break
+				} else if err != nil {
+					return rows, err
+				}
+				// the rows keep their ids, scripts.id is referenced by the lock script ids of the registers
+				// and withdrawals and the ids of the source may have gaps
+				batch = append(batch, row)
+				if len(batch) == snapshotBatchSize {
+					if err := flush(); err != nil {
+						return rows, err
+					}
+				}
+			}
+			return rows, flush()
+		},
+	}
+}
+
+func (t snapshotTable) name(db *gorm.DB) (string, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(t.model); err != nil {
+		return "", err
+	}
+	return stmt.Schema.Table, nil
+}
+
+type snapshotRepo struct {
+	data      *Data
+	migration *DBMigration
+	metadata  *MetadataRegistry
+	logger    *logger.Logger
+}
+
+func NewSnapshotRepo(data *Data, migration *DBMigration, metadata *MetadataRegistry, logger *logger.Logger) biz.SnapshotRepo {
+	return &snapshotRepo{
+		data:      data,
+		migration: migration,
+		metadata:  metadata,
+		logger:    logger,
+	}
+}
+
+// ExportSnapshot writes a gzipped tar with the manifest first and a json lines file per table. The
+// tables are read in one read-only transaction, so an export at the tip runs beside the syncers
+// without locking the rows they write. A height below the tip of a syncer needs rewind, the blocks
+// after the height are then rolled back in the transaction and never committed. The rollback writes
+// the hot state rows, so it is only allowed with the syncers stopped.
+func (rp snapshotRepo) ExportSnapshot(ctx context.Context, height uint64, rewind bool, w io.Writer) (biz.SnapshotManifest, error) {
+	migrationVersion, err := rp.migration.Version()
+	if err != nil {
+		return biz.SnapshotManifest{}, err
+	}
+	tx := rp.data.db.WithContext(ctx).Begin(rp.txOptions(rewind))
+	if tx.Error != nil {
+		return biz.SnapshotManifest{}, tx.Error
+	}
+	defer tx.Rollback()
+	synced, err := syncedHeights(ctx, tx)
+	if err != nil {
+		return biz.SnapshotManifest{}, err
+	}
+	switch {
+	case height == 0:
+		// the tip, each syncer resumes after its own check info
+		height = synced[0]
+		if synced[1] < height {
+			height = synced[1]
+		}
+	case synced[0] == height && synced[1] == height:
+	case !rewind:
+		return biz.SnapshotManifest{}, fmt.Errorf("%w: the syncers are at blocks %d and %d, the height is %d", biz.ErrSnapshotRewind, synced[0], synced[1], height)
+	default:
+		if err = rp.rewind(ctx, tx, height, synced); err != nil {
+			return biz.SnapshotManifest{}, err
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "cota-snapshot")
+	if err != nil {
+		return biz.SnapshotManifest{}, err
+	}
+	defer os.RemoveAll(dir)
+	manifest := biz.SnapshotManifest{
+		FormatVersion:    biz.SnapshotFormatVersion,
+		Height:           height,
+		MigrationVersion: migrationVersion,
+		CreatedAt:        time.Now().UTC(),
+	}
+	for _, table := range snapshotTables {
+		var snapshotTable biz.SnapshotTable
+		if snapshotTable, err = exportSnapshotTable(ctx, tx, table, dir); err != nil {
+			return biz.SnapshotManifest{}, err
+		}
+		manifest.Tables = append(manifest.Tables, snapshotTable)
+	}
+	return manifest, writeSnapshotArchive(w, dir, manifest)
+}
+
+func exportSnapshotTable(ctx context.Context, tx *gorm.DB, table snapshotTable, dir string) (biz.SnapshotTable, error) {
+	name, err := table.name(tx)
+	if err != nil {
+		return biz.SnapshotTable{}, err
+	}
+	file, err := os.Create(filepath.Join(dir, name+".jsonl"))
+	if err != nil {
+		return biz.SnapshotTable{}, err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	rows, err := table.export(ctx, tx, io.MultiWriter(file, hash))
+	if err != nil {
+		return biz.SnapshotTable{}, fmt.Errorf("export %s: %w", name, err)
+	}
+	return biz.SnapshotTable{Name: name, Rows: rows, Sha256: hex.EncodeToString(hash.Sum(nil))}, file.Close()
+}
+
+func writeSnapshotArchive(w io.Writer, dir string, manifest biz.SnapshotManifest) error {
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+	manifestJson, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = archive.WriteHeader(&tar.Header{Name: snapshotManifestName, Mode: 0644, Size: int64(len(manifestJson)), ModTime: manifest.CreatedAt}); err != nil {
+		return err
+	}
+	if _, err = archive.Write(manifestJson); err != nil {
+		return err
+	}
+	for _, table := range manifest.Tables {
+		if err = writeSnapshotFile(archive, filepath.Join(dir, table.Name+".jsonl"), path.Join(snapshotTablesDir, table.Name+".jsonl"), manifest.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if err = archive.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func writeSnapshotFile(archive *tar.Writer, file, name string, modTime time.Time) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err = archive.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: modTime}); err != nil {
+		return err
+	}
+	_, err = io.Copy(archive, f)
+	return err
+}
+
+var snapshotCheckTypes = []biz.CheckType{biz.SyncBlock, biz.SyncMetadata}
+
+// syncedHeights returns the last block of the block syncer and of the metadata syncer
+func syncedHeights(ctx context.Context, tx *gorm.DB) ([]uint64, error) {
+	synced := make([]uint64, len(snapshotCheckTypes))
+	for i, checkType := range snapshotCheckTypes {
+		var last CheckInfo
+		if err := tx.WithContext(ctx).Where("check_type = ?", checkType).Order("block_number desc").Limit(1).Find(&last).Error; err != nil {
+			return nil, err
+		}
+		synced[i] = last.BlockNumber
+	}
+	return synced, nil
+}
+
+// rewind rolls both syncers back to the height. The height needs a check info of each syncer, so it
+// is at most the retention of the check info cleaner behind.
+func (rp snapshotRepo) rewind(ctx context.Context, tx *gorm.DB, height uint64, synced []uint64) error {
+	kvPairs := kvPairRepo{data: &Data{db: tx, driver: rp.data.driver}, metadata: rp.metadata, logger: rp.logger}
+	for i, checkType := range snapshotCheckTypes {
+		if synced[i] < height {
+			return fmt.Errorf("%s is synced to block %d below the height %d", checkType.String(), synced[i], height)
+		}
+		var checkpoints int64
+		if err := tx.WithContext(ctx).Model(CheckInfo{}).Where("check_type = ? and block_number = ?", checkType, height).Count(&checkpoints).Error; err != nil {
+			return err
+		}
+		if checkpoints == 0 {
+			return fmt.Errorf("no %s check info at the height %d", checkType.String(), height)
+		}
+		var blockNumbers []uint64
+		if err := tx.WithContext(ctx).Model(CheckInfo{}).Distinct("block_number").Where("check_type = ? and block_number > ?", checkType, height).Order("block_number desc").Pluck("block_number", &blockNumbers).Error; err != nil {
+			return err
+		}
+		for _, blockNumber := range blockNumbers {
+			restore := kvPairs.RestoreCotaEntryKvPairs
+			if checkType == biz.SyncMetadata {
+				restore = kvPairs.RestoreMetadataKvPairs
+			}
+			if err := restore(ctx, blockNumber); err != nil {
+				return fmt.Errorf("roll back %s block %d: %w", checkType.String(), blockNumber, err)
+			}
+		}
+	}
+	return nil
+}
+
+// txOptions reads the tables from one snapshot of the database, read-only unless the export rewinds.
+// Sqlite transactions are serializable.
+func (rp snapshotRepo) txOptions(rewind bool) *sql.TxOptions {
+	if rp.data.driver == DriverSqlite {
+		return nil
+	}
+	return &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: !rewind}
+}
+
+// ImportSnapshot migrates the database, checks that it is empty and at the migration version of the
+// snapshot, then loads every table in one transaction. A table whose checksum or row count differs
+// from the manifest rolls the whole import back.
+func (rp snapshotRepo) ImportSnapshot(ctx context.Context, r io.Reader) (biz.SnapshotManifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return biz.SnapshotManifest{}, err
+	}
+	defer gz.Close()
+	archive := tar.NewReader(gz)
+	var manifest biz.SnapshotManifest
+	header, err := archive.Next()
+	if err != nil {
+		return manifest, err
+	}
+	if header.Name != snapshotManifestName {
+		return manifest, fmt.Errorf("snapshot archive starts with %s instead of the manifest", header.Name)
+	}
+	if err = json.NewDecoder(archive).Decode(&manifest); err != nil {
+		return manifest, err
+	}
+	if manifest.FormatVersion != biz.SnapshotFormatVersion {
+		return manifest, fmt.Errorf("snapshot format version %d, want %d", manifest.FormatVersion, biz.SnapshotFormatVersion)
+	}
+	if err = rp.migration.Up(); err != nil {
+		return manifest, err
+	}
+	migrationVersion, err := rp.migration.Version()
+	if err != nil {
+		return manifest, err
+	}
+	if migrationVersion != manifest.MigrationVersion {
+		return manifest, fmt.Errorf("snapshot of migration version %d, the database is at %d", manifest.MigrationVersion, migrationVersion)
+	}
+	err = rp.data.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		tables := make(map[string]snapshotTable, len(snapshotTables))
+		for _, table := range snapshotTables {
+			name, err := table.name(tx)
+			if err != nil {
+				return err
+			}
+			var count int64
+			if err = tx.Model(table.model).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return fmt.Errorf("%w: %s has %d rows", biz.ErrSnapshotNotEmpty, name, count)
+			}
+			tables[name] = table
+		}
+		if err := loadSnapshotTables(ctx, tx, archive, manifest, tables); err != nil {
+			return err
+		}
+		return rp.advanceIdSequences(ctx, tx, manifest)
+	})
+	return manifest, err
+}
+
+// advanceIdSequences moves the id sequences past the imported ids. Mysql and sqlite move the auto
+// increment counter on an insert with an explicit id, a postgres sequence has to be set.
+func (rp snapshotRepo) advanceIdSequences(ctx context.Context, tx *gorm.DB, manifest biz.SnapshotManifest) error {
+	if rp.data.driver != DriverPostgres {
+		return nil
+	}
+	for _, table := range manifest.Tables {
+		query := fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%s', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM %s", table.Name, table.Name)
+		if err := tx.WithContext(ctx).Exec(query).Error; err != nil {
+			return fmt.Errorf("advance the id sequence of %s: %w", table.Name, err)
+		}
+	}
+	return nil
+}
+
+func loadSnapshotTables(ctx context.Context, tx *gorm.DB, archive *tar.Reader, manifest biz.SnapshotManifest, tables map[string]snapshotTable) error {
+	expected := make(map[string]biz.SnapshotTable, len(manifest.Tables))
+	for _, table := range manifest.Tables {
+		expected[table.Name] = table
+	}
+	loaded := make(map[string]bool, len(manifest.Tables))
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(header.Name, snapshotTablesDir+"/"), ".jsonl")
+		table, ok := tables[name]
+		want, listed := expected[name]
+		if !ok || !listed || loaded[name] {
+			return fmt.Errorf("unexpected file %s in the snapshot archive", header.Name)
+		}
+		hash := sha256.New()
+		rows, err := table.load(ctx, tx, io.TeeReader(archive, hash))
+		if err != nil {
+			return fmt.Errorf("import %s: %w", name, err)
+		}
+		if sum := hex.EncodeToString(hash.Sum(nil)); sum != want.Sha256 || rows != want.Rows {
+			return fmt.Errorf("%w: %s has %d rows with sha256 %s, the manifest lists %d rows with sha256 %s", biz.ErrSnapshotChecksum, name, rows, sum, want.Rows, want.Sha256)
+		}
+		loaded[name] = true
+	}
+	for _, table := range manifest.Tables {
+		if !loaded[table.Name] {
+			return fmt.Errorf("%w: %s is missing from the archive", biz.ErrSnapshotChecksum, table.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package data
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/config"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+func newTestSnapshotRepo(t *testing.T, name string) (*Data, biz.SnapshotRepo) {
+	log := logger.NewLogger(io.Discard, "", 0)
+	data := newTestData(t, DriverSqlite, "file:"+name+"?mode=memory&cache=shared")
+	return data, NewSnapshotRepo(data, &DBMigration{data: data, logger: log, sourceDir: "../db/"}, newTestMetadataRegistry(data, &config.Metadata{}), log)
+}
+
+func TestSnapshotRepo_exportAndImport(t *testing.T) {
+	ctx := context.Background()
+	src, srcRepo := newTestSnapshotRepo(t, "snapshot_src")
+	var want map[string][]string
+	kvPairs := newTestKvPairRepo(src)
+	for _, block := range []testBlock{
+		{number: 100, kvPair: biz.KvPair{
+			Registers:   []biz.RegisterCotaKvPair{{BlockNumber: 100, LockHash: lockA, CotaCellID: 1}},
+			DefineCotas: []biz.DefineCotaNftKvPair{testDefine(100, 0, 0)},
+			HoldCotas:   []biz.HoldCotaNftKvPair{testHold(100, 1, 0, lockA, "00")},
+			Events:      []biz.CotaEvent{testEvent(100, 0, biz.CotaEventDefine, lockA)},
+		}},
+		{number: 100, metadata: true, kvPair: biz.KvPair{IssuerInfos: []biz.IssuerInfo{testIssuer(100, 0, lockA, "before")}}},
+		{number: 101, kvPair: biz.KvPair{
+			UpdatedDefineCotas: []biz.DefineCotaNftKvPair{testDefine(101, 0, 1)},
+			UpdatedHoldCotas:   []biz.HoldCotaNftKvPair{testHold(101, 0, 0, lockA, "01")},
+		}},
+		{number: 101, metadata: true, kvPair: biz.KvPair{IssuerInfos: []biz.IssuerInfo{testIssuer(101, 0, lockA, "after")}}},
+	} {
+		block := block
+		create := kvPairs.CreateCotaEntryKvPairs
+		checkInfo := biz.CheckInfo{BlockNumber: block.number, BlockHash: "h", CheckType: biz.SyncBlock}
+		if block.metadata {
+			create = kvPairs.CreateMetadataKvPairs
+			checkInfo.CheckType = biz.SyncMetadata
+		}
+		if err := create(ctx, checkInfo, &block.kvPair); err != nil {
+			t.Fatalf("create block %d: %v", block.number, err)
+		}
+		if block.number == 100 && block.metadata {
+			want = snapshot(t, src.db)
+		}
+	}
+	latest := snapshot(t, src.db)
+
+	var archive bytes.Buffer
+	if _, err := srcRepo.ExportSnapshot(ctx, 100, false, io.Discard); !errors.Is(err, biz.ErrSnapshotRewind) {
+		t.Errorf("export below the tip without rewind: %v, want ErrSnapshotRewind", err)
+	}
+	manifest, err := srcRepo.ExportSnapshot(ctx, 100, true, &archive)
+	if err != nil {
+		t.Fatalf("export the snapshot: %v", err)
+	}
+	if manifest.Height != 100 || manifest.MigrationVersion == 0 || len(manifest.Tables) != len(snapshotTables) {
+		t.Errorf("manifest = %+v", manifest)
+	}
+	if got := snapshot(t, src.db); !reflect.DeepEqual(got, latest) {
+		t.Errorf("the export changed the database:\n got %v\nwant %v", got, latest)
+	}
+	if _, err = srcRepo.ExportSnapshot(ctx, 102, true, io.Discard); err == nil {
+		t.Error("exported a height the syncers have not reached")
+	}
+
+	dst, dstRepo := newTestSnapshotRepo(t, "snapshot_dst")
+	testImportSnapshot(t, dst, dstRepo, archive.Bytes(), want)
+}
+
+func TestSnapshotRepo_scriptIds(t *testing.T) {
+	ctx := context.Background()
+	src, srcRepo := newTestSnapshotRepo(t, "snapshot_ids_src")
+	// ids 1 and 3 to 6 were burned by failed inserts
+	scripts := []Script{{ID: 2, CodeHash: "aa", Args: "01"}, {ID: 7, CodeHash: "aa", Args: "02"}}
+	for _, row := range []any{
+		&scripts,
+		&RegisterCotaKvPair{BlockNumber: 100, LockHash: lockA, CotaCellID: 1, LockScriptId: 7},
+		&WithdrawCotaNftKvPair{BlockNumber: 100, CotaId: testCotaId, LockHash: lockA, LockScriptId: 7, ReceiverLockScriptId: 2},
+		&[]CheckInfo{{BlockNumber: 100, BlockHash: "h", CheckType: biz.SyncBlock}, {BlockNumber: 100, BlockHash: "h", CheckType: biz.SyncMetadata}},
+	} {
+		if err := src.db.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	var archive bytes.Buffer
+	manifest, err := srcRepo.ExportSnapshot(ctx, 0, false, &archive)
+	if err != nil {
+		t.Fatalf("export the tip: %v", err)
+	}
+	if manifest.Height != 100 {
+		t.Errorf("exported height %d, want 100", manifest.Height)
+	}
+
+	dst, dstRepo := newTestSnapshotRepo(t, "snapshot_ids_dst")
+	if _, err = dstRepo.ImportSnapshot(ctx, &archive); err != nil {
+		t.Fatalf("import the snapshot: %v", err)
+	}
+	var (
+		register RegisterCotaKvPair
+		withdraw WithdrawCotaNftKvPair
+		lock     Script
+		receiver Script
+	)
+	if err = dst.db.First(&register).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = dst.db.First(&withdraw).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = dst.db.First(&lock, register.LockScriptId).Error; err != nil || lock.Args != "02" {
+		t.Errorf("register lock script = %+v, %v, want the script with args 02", lock, err)
+	}
+	if err = dst.db.First(&receiver, withdraw.ReceiverLockScriptId).Error; err != nil || receiver.Args != "01" {
+		t.Errorf("withdraw receiver lock script = %+v, %v, want the script with args 01", receiver, err)
+	}
+	next := Script{CodeHash: "aa", Args: "03"}
+	if err = dst.db.Create(&next).Error; err != nil || next.ID != 8 {
+		t.Errorf("new script id = %d, %v, want 8 after the imported ids", next.ID, err)
+	}
+}
+
+// testImportSnapshot imports the archive of the state after block 100
+func testImportSnapshot(t *testing.T, data *Data, repo biz.SnapshotRepo, exported []byte, want map[string][]string) {
+	ctx := context.Background()
+	manifest, err := repo.ImportSnapshot(ctx, bytes.NewReader(exported))
+	if err != nil {
+		t.Fatalf("import the snapshot: %v", err)
+	}
+	if manifest.Height != 100 {
+		t.Errorf("imported height %d, want 100", manifest.Height)
+	}
+	if _, err = repo.ImportSnapshot(ctx, bytes.NewReader(exported)); !errors.Is(err, biz.ErrSnapshotNotEmpty) {
+		t.Errorf("import into a synced database: %v, want ErrSnapshotNotEmpty", err)
+	}
+	if got := snapshot(t, data.db); !reflect.DeepEqual(got, want) {
+		t.Errorf("imported rows:\n got %v\nwant %v", got, want)
+	}
+
+	tampered, err := tamperSnapshot(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emptyData, emptyRepo := newTestSnapshotRepo(t, "snapshot_tampered")
+	if _, err = emptyRepo.ImportSnapshot(ctx, bytes.NewReader(tampered)); !errors.Is(err, biz.ErrSnapshotChecksum) {
+		t.Errorf("import a tampered snapshot: %v, want ErrSnapshotChecksum", err)
+	}
+	var count int64
+	if err = emptyData.db.Model(CheckInfo{}).Count(&count).Error; err != nil || count != 0 {
+		t.Errorf("%d check infos after a failed import, %v, want none", count, err)
+	}
+}
+
+// tamperSnapshot changes one row of the check info table and keeps the manifest
+func tamperSnapshot(archive []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	reader := tar.NewReader(gz)
+	var out bytes.Buffer
+	gzOut := gzip.NewWriter(&out)
+	writer := tar.NewWriter(gzOut)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+		if header.Name == snapshotTablesDir+"/check_infos.jsonl" {
+			var row CheckInfo
+			if err = json.NewDecoder(bytes.NewReader(content)).Decode(&row); err != nil {
+				return nil, err
+			}
+			row.BlockHash = "tampered"
+			line, _ := json.Marshal(row)
+			content = append(append(line, '\n'), content[bytes.IndexByte(content, '\n')+1:]...)
+			header.Size = int64(len(content))
+		}
+		if err = writer.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err = writer.Write(content); err != nil {
+			return nil, err
+		}
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+	if err = gzOut.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
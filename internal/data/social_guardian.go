@@ -0,0 +1,187 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+	"gorm.io/gorm"
+)
+
+var _ biz.SocialRecoveryRepo = (*socialRecoveryRepo)(nil)
+
+// SocialGuardian is a signer of the social recovery of an account, split from the signers of its
+// social_kv_pairs row in the transaction that writes or restores it
+type SocialGuardian struct {
+	ID             uint `gorm:"primaryKey"`
+	BlockNumber    uint64
+	LockHash       string
+	Position       int
+	Signer         string
+	SignerLockHash string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// kvPairSocialAccounts returns the lock hashes of the accounts whose social recovery the block wrote
+func kvPairSocialAccounts(kvPair *biz.KvPair) []string {
+	var lockHashes []string
+	seen := make(map[string]bool)
+	for _, pairs := range [][]biz.SocialKvPair{kvPair.SocialPairs, kvPair.UpdatedSocialPairs} {
+		for _, pair := range pairs {
+			if !seen[pair.LockHash] {
+				seen[pair.LockHash] = true
+				lockHashes = append(lockHashes, pair.LockHash)
+			}
+		}
+	}
+	return lockHashes
+}
+
+// blockSocialAccounts returns the lock hashes of the accounts whose social recovery changed at the
+// block number, read from the versions before they are restored
+func blockSocialAccounts(ctx context.Context, tx *gorm.DB, blockNumber uint64) ([]string, error) {
+	var lockHashes []string
+	err := tx.WithContext(ctx).Model(SocialKvPairVersion{}).Distinct("lock_hash").Where("block_number = ?", blockNumber).Pluck("lock_hash", &lockHashes).Error
+	return lockHashes, err
+}
+
+// refreshSocialGuardians splits the signers of the accounts into guardians again, an account without a
+// social recovery has none
+func refreshSocialGuardians(ctx context.Context, tx *gorm.DB, lockHashes []string) error {
+	if len(lockHashes) == 0 {
+		return nil
+	}
+	if err := tx.WithContext(ctx).Where("lock_hash in ?", lockHashes).Delete(SocialGuardian{}).Error; err != nil {
+		return err
+	}
+	var pairs []SocialKvPair
+	if err := tx.WithContext(ctx).Where("lock_hash in ?", lockHashes).Find(&pairs).Error; err != nil {
+		return err
+	}
+	var guardians []SocialGuardian
+	for _, pair := range pairs {
+		for _, guardian := range socialGuardians(pair) {
+			guardians = append(guardians, SocialGuardian{
+				BlockNumber:    guardian.BlockNumber,
+				LockHash:       guardian.LockHash,
+				Position:       guardian.Position,
+				Signer:         guardian.Signer,
+				SignerLockHash: guardian.SignerLockHash,
+			})
+		}
+	}
+	if len(guardians) == 0 {
+		return nil
+	}
+	return tx.WithContext(ctx).CreateInBatches(&guardians, 500).Error
+}
+
+// socialGuardians splits the signers of a social recovery, a signer that is not hex has no lock hash
+func socialGuardians(pair SocialKvPair) []biz.Guardian {
+	signers := biz.SplitSigners(pair.Signers)
+	guardians := make([]biz.Guardian, len(signers))
+	for i, signer := range signers {
+		lockHash, _ := biz.GuardianLockHash(signer)
+		guardians[i] = biz.Guardian{LockHash: pair.LockHash, Position: i, Signer: signer, SignerLockHash: lockHash, BlockNumber: pair.BlockNumber}
+	}
+	return guardians
+}
+
+type socialRecoveryRepo struct {
+	data   *Data
+	logger *logger.Logger
+}
+
+func NewSocialRecoveryRepo(data *Data, logger *logger.Logger) biz.SocialRecoveryRepo {
+	return &socialRecoveryRepo{
+		data:   data,
+		logger: logger,
+	}
+}
+
+// FindSocialConfigs returns the social recoveries of the lock hashes, or of every account when
+// lockHashes is nil, after afterId in the order of their ids
+func (rp socialRecoveryRepo) FindSocialConfigs(ctx context.Context, lockHashes []string, afterId uint64, limit int) ([]biz.SocialConfig, error) {
+	db := rp.data.db.WithContext(ctx).Where("id > ?", afterId)
+	if lockHashes != nil {
+		db = db.Where("lock_hash in ?", lockHashes)
+	}
+	var pairs []SocialKvPair
+	if err := db.Order("id").Limit(limit).Find(&pairs).Error; err != nil {
+		return nil, err
+	}
+	configs := make([]biz.SocialConfig, len(pairs))
+	for i, pair := range pairs {
+		configs[i] = biz.SocialConfig{
+			Id:           uint64(pair.ID),
+			LockHash:     pair.LockHash,
+			BlockNumber:  pair.BlockNumber,
+			RecoveryMode: pair.RecoveryMode,
+			Must:         pair.Must,
+			Total:        pair.Total,
+			Guardians:    socialGuardians(pair),
+		}
+	}
+	return configs, nil
+}
+
+func (rp socialRecoveryRepo) FindSocialChanges(ctx context.Context, lockHash string) ([]biz.SocialChange, error) {
+	var versions []SocialKvPairVersion
+	if err := rp.data.db.WithContext(ctx).Where("lock_hash = ?", lockHash).Order("block_number, id").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	changes := make([]biz.SocialChange, len(versions))
+	for i, version := range versions {
+		changes[i] = biz.SocialChange{
+			BlockNumber:  version.BlockNumber,
+			Action:       biz.MetadataCreate,
+			RecoveryMode: version.RecoveryMode,
+			Must:         version.Must,
+			Total:        version.Total,
+			OldSigners:   []string{},
+			Signers:      biz.SplitSigners(version.Signers),
+		}
+		if version.ActionType == 1 {
+			changes[i].Action = biz.MetadataUpdate
+			changes[i].OldRecoveryMode, changes[i].OldMust, changes[i].OldTotal = version.OldRecoveryMode, version.OldMust, version.OldTotal
+			changes[i].OldSigners = biz.SplitSigners(version.OldSigners)
+		}
+	}
+	return changes, nil
+}
+
+// FindPruneHeight returns the prune height of the block syncer, which writes the social versions
+func (rp socialRecoveryRepo) FindPruneHeight(ctx context.Context) (uint64, error) {
+	return findPruneHeight(ctx, rp.data.db, biz.SyncBlock)
+}
+
+// FindGuardedAccounts returns one guardian per account, the first position of the signer when an account
+// lists it more than once, so a page never splits an account
+func (rp socialRecoveryRepo) FindGuardedAccounts(ctx context.Context, signerLockHash string, afterLockHash string, limit int) ([]biz.Guardian, error) {
+	var rows []SocialGuardian
+	if err := rp.data.db.WithContext(ctx).Model(SocialGuardian{}).Select("lock_hash, MIN(position) AS position, signer, signer_lock_hash, block_number").
+		Where("signer_lock_hash = ? and lock_hash > ?", signerLockHash, afterLockHash).Group("lock_hash, signer, signer_lock_hash, block_number").
+		Order("lock_hash").Limit(limit).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	guardians := make([]biz.Guardian, len(rows))
+	for i, row := range rows {
+		guardians[i] = biz.Guardian{LockHash: row.LockHash, Position: row.Position, Signer: row.Signer, SignerLockHash: row.SignerLockHash, BlockNumber: row.BlockNumber}
+	}
+	return guardians, nil
+}
+
+func (rp socialRecoveryRepo) RebuildGuardians(ctx context.Context, batchSize int) (int64, error) {
+	if batchSize <= 0 {
+		return 0, fmt.Errorf("batch size must be positive: %d", batchSize)
+	}
+	rebuilt, err := refreshKeyBatches(ctx, rp.data.db, batchSize, func(pair SocialKvPair) (uint, string) { return pair.ID, pair.LockHash }, refreshSocialGuardians)
+	if err != nil {
+		return rebuilt, err
+	}
+	err = rp.data.db.WithContext(ctx).Where("lock_hash not in (?)", rp.data.db.Model(SocialKvPair{}).Select("lock_hash")).Delete(SocialGuardian{}).Error
+	return rebuilt, err
+}
@@ -0,0 +1,116 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+func TestSocialRecoveryRepo_guardians(t *testing.T) {
+	ctx := context.Background()
+	log := logger.NewLogger(io.Discard, "", 0)
+	data := newTestData(t, DriverSqlite, "file:social_guardians?mode=memory&cache=shared")
+	kvPairs := newTestKvPairRepo(data)
+	uc := biz.NewSocialRecoveryUsecase(NewSocialRecoveryRepo(data, log), log)
+	guardianB, err := biz.GuardianLockHash(lockB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = uc.Config(ctx, lockA); !errors.Is(err, biz.ErrSocialNotFound) {
+		t.Errorf("Config() without a social recovery error = %v", err)
+	}
+	// two signers for a total of three
+	if err = kvPairs.CreateCotaEntryKvPairs(ctx, biz.CheckInfo{BlockNumber: 100, BlockHash: "h", CheckType: biz.SyncBlock}, &biz.KvPair{
+		SocialPairs: []biz.SocialKvPair{testSocial(100, 0, 2)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	config, err := uc.Config(ctx, lockA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Guardians) != 2 || config.Guardians[0].Signer != lockB || config.Guardians[0].SignerLockHash != guardianB || config.Guardians[1].Position != 1 {
+		t.Errorf("Config() guardians = %+v", config.Guardians)
+	}
+	if want := []biz.SocialIssue{biz.SocialSignerCountMismatch}; !reflect.DeepEqual(config.Issues, want) {
+		t.Errorf("Config() issues = %v, want %v", config.Issues, want)
+	}
+	guarded, err := uc.GuardedAccounts(ctx, guardianB, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(guarded) != 1 || guarded[0].LockHash != lockA || guarded[0].Position != 0 || guarded[0].BlockNumber != 100 {
+		t.Errorf("GuardedAccounts() = %+v, want account %s", guarded, lockA)
+	}
+
+	// the threshold is raised above the total at block 101
+	update := testSocial(101, 0, 4)
+	update.Signers = lockC
+	if err = kvPairs.CreateCotaEntryKvPairs(ctx, biz.CheckInfo{BlockNumber: 101, BlockHash: "h", CheckType: biz.SyncBlock}, &biz.KvPair{
+		UpdatedSocialPairs: []biz.SocialKvPair{update},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if guarded, err = uc.GuardedAccounts(ctx, guardianB, "", 10); err != nil || len(guarded) != 0 {
+		t.Errorf("GuardedAccounts() after the update = %+v, %v, want none", guarded, err)
+	}
+	social, err := uc.History(ctx, lockA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history := social.Changes
+	if social.KeptFrom != 0 || len(history) != 2 || history[0].Action != biz.MetadataCreate || history[1].Action != biz.MetadataUpdate ||
+		history[1].OldMust != 2 || history[1].Must != 4 || !reflect.DeepEqual(history[1].OldSigners, []string{lockB, lockC}) {
+		t.Fatalf("History() = %+v", history)
+	}
+	if want := []biz.SocialIssue{biz.SocialMustAboveTotal, biz.SocialSignerCountMismatch}; !reflect.DeepEqual(history[1].Issues, want) {
+		t.Errorf("History() issues = %v, want %v", history[1].Issues, want)
+	}
+	inconsistent, err := uc.Check(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inconsistent) != 1 || inconsistent[0].Must != 4 {
+		t.Errorf("Check() = %+v, want the updated configuration", inconsistent)
+	}
+
+	// a rollback of block 101 brings the guardian back
+	if err = kvPairs.RestoreCotaEntryKvPairs(ctx, 101); err != nil {
+		t.Fatal(err)
+	}
+	if guarded, err = uc.GuardedAccounts(ctx, guardianB, "", 10); err != nil || len(guarded) != 1 {
+		t.Errorf("GuardedAccounts() after the restore = %+v, %v, want account %s", guarded, err, lockA)
+	}
+
+	// a rebuild fills the guardians dropped outside of the sync
+	if err = data.db.Where("1 = 1").Delete(SocialGuardian{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, err := uc.Rebuild(ctx, 1)
+	if err != nil || rebuilt != 1 {
+		t.Fatalf("Rebuild() = %d, %v, want 1", rebuilt, err)
+	}
+	var count int64
+	if err = data.db.Model(SocialGuardian{}).Count(&count).Error; err != nil || count != 2 {
+		t.Errorf("guardians after the rebuild = %d, %v, want 2", count, err)
+	}
+
+	// keeping one block below block 102 prunes the create of block 100
+	if err = kvPairs.CreateCotaEntryKvPairs(ctx, biz.CheckInfo{BlockNumber: 102, BlockHash: "h", CheckType: biz.SyncBlock}, &biz.KvPair{
+		UpdatedSocialPairs: []biz.SocialKvPair{testSocial(102, 0, 3)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewVersionRetentionRepo(data, nil).PruneVersions(ctx, biz.SyncBlock, 1, 10); err != nil {
+		t.Fatal(err)
+	}
+	if social, err = uc.History(ctx, lockA); err != nil || social.KeptFrom != 101 || len(social.Changes) != 1 || social.Changes[0].BlockNumber != 102 {
+		t.Errorf("pruned History() = %+v, %v, want the update of block 102 kept from block 101", social, err)
+	}
+}
@@ -45,15 +45,23 @@ type socialPairRepo struct {
 	logger *logger.Logger
 }
 
-func NewSocialKvPairRepo(data *Data, logger *logger.Logger) biz.SubKeyPairRepo {
-	return &subKeyPairRepo{
+func NewSocialKvPairRepo(data *Data, logger *logger.Logger) biz.SocialPairRepo {
+	return &socialPairRepo{
 		data:   data,
 		logger: logger,
 	}
 }
 
 func (rp socialPairRepo) CreateSocialPair(ctx context.Context, social *biz.SocialKvPair) error {
-	if err := rp.data.db.WithContext(ctx).Create(social).Error; err != nil {
+	if err := rp.data.db.WithContext(ctx).Create(&SocialKvPair{
+		BlockNumber:  social.BlockNumber,
+		LockHash:     social.LockHash,
+		LockHashCRC:  social.LockHashCRC,
+		RecoveryMode: social.RecoveryMode,
+		Must:         social.Must,
+		Total:        social.Total,
+		Signers:      social.Signers,
+	}).Error; err != nil {
 		return err
 	}
 	return nil
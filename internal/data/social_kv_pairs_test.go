@@ -0,0 +1,30 @@
+package data
+
+import (
+	"context"
+	"testing"
+)
+
+// TestSocialPairRepo covers NewSocialKvPairRepo, which returned the sub key repo as a
+// biz.SubKeyPairRepo and left wire without a biz.SocialPairRepo provider, and CreateSocialPair, which
+// wrote the biz pair with its tx index, a column the table does not have
+func TestSocialPairRepo(t *testing.T) {
+	ctx := context.Background()
+	data := newTestData(t, DriverSqlite, "file:social_pair_repo?mode=memory&cache=shared")
+	repo := NewSocialKvPairRepo(data, nil)
+	social := testSocial(100, 0, 1)
+	if err := repo.CreateSocialPair(ctx, &social); err != nil {
+		t.Fatal(err)
+	}
+	var socials []SocialKvPair
+	if err := data.db.Find(&socials).Error; err != nil || len(socials) != 1 || socials[0].LockHash != lockA || socials[0].Must != 1 {
+		t.Fatalf("social pairs = %+v, %v, want the created pair", socials, err)
+	}
+	if err := repo.DeleteSocialPairs(ctx, 100); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	if err := data.db.Model(SocialKvPair{}).Count(&count).Error; err != nil || count != 0 {
+		t.Errorf("%d social pairs after the delete, %v, want 0", count, err)
+	}
+}
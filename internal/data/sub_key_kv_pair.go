@@ -50,7 +50,14 @@ func NewSubKeyKvPairRepo(data *Data, logger *logger.Logger) biz.SubKeyPairRepo {
 }
 
 func (rp subKeyPairRepo) CreateSubKeyPair(ctx context.Context, subKey *biz.SubKeyPair) error {
-	if err := rp.data.db.WithContext(ctx).Create(subKey).Error; err != nil {
+	if err := rp.data.db.WithContext(ctx).Create(&SubKeyKvPair{
+		BlockNumber: subKey.BlockNumber,
+		LockHash:    subKey.LockHash,
+		SubType:     subKey.SubType,
+		ExtData:     subKey.ExtData,
+		AlgIndex:    subKey.AlgIndex,
+		PubkeyHash:  subKey.PubkeyHash,
+	}).Error; err != nil {
 		return err
 	}
 	return nil
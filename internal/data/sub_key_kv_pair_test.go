@@ -0,0 +1,29 @@
+package data
+
+import (
+	"context"
+	"testing"
+)
+
+// TestSubKeyPairRepo covers CreateSubKeyPair, which wrote the biz pair, so gorm named its table
+// sub_key_pairs instead of sub_key_kv_pairs
+func TestSubKeyPairRepo(t *testing.T) {
+	ctx := context.Background()
+	data := newTestData(t, DriverSqlite, "file:sub_key_pair_repo?mode=memory&cache=shared")
+	repo := NewSubKeyKvPairRepo(data, nil)
+	subKey := testSubKey(100, 1, 0, "01")
+	if err := repo.CreateSubKeyPair(ctx, &subKey); err != nil {
+		t.Fatal(err)
+	}
+	var subKeys []SubKeyKvPair
+	if err := data.db.Find(&subKeys).Error; err != nil || len(subKeys) != 1 || subKeys[0].LockHash != lockA || subKeys[0].PubkeyHash != "01" {
+		t.Fatalf("sub key pairs = %+v, %v, want the created pair", subKeys, err)
+	}
+	if err := repo.DeleteSubKeyPairs(ctx, 100); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	if err := data.db.Model(SubKeyKvPair{}).Count(&count).Error; err != nil || count != 0 {
+		t.Errorf("%d sub key pairs after the delete, %v, want 0", count, err)
+	}
+}
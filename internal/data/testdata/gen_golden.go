@@ -0,0 +1,484 @@
+//go:build ignore
+
+// gen_golden writes the transaction fixtures of the golden parser tests to testdata/golden.
+//
+// Without flags it writes the built corpus, a transaction per CoTA action and version in the witness
+// layout of the CoTA type script. The corpus is synthetic: the transactions, their hashes and blocks
+// are made up and are not on any chain, the chain only selects the system scripts of the CoTA cells.
+// Its fixtures are marked "synthetic", and TestBlockSyncer_goldenKeyFields checks the key fields of
+// their kv pairs against the inputs below by hand, since the golden files are written by the parsers:
+//
+//	go run ./internal/data/testdata/gen_golden.go
+//
+// With -rpc and -tx it captures a transaction and the transactions of its inputs from a node:
+//
+//	go run ./internal/data/testdata/gen_golden.go -rpc https://testnet.ckb.dev/rpc -tx 0x... -name claim_v2_testnet
+//
+// With -rpc and -list it captures every "<name> <tx hash>" line of a file, lines without a hash are
+// skipped. testdata/golden/capture.txt names a real transaction to capture per action and version:
+//
+//	go run ./internal/data/testdata/gen_golden.go -rpc https://mainnet.ckb.dev/rpc -list internal/data/testdata/golden/capture.txt
+//
+// A captured fixture is named after the synthetic one of its action and version with the chain as a
+// suffix, TestBlockSyncer_goldenCaptured lists the actions and versions that have none yet.
+// Run the parser tests with -update afterwards to write the golden output of new fixtures.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nervina-labs/cota-syncer/internal/ckbtest"
+	"github.com/nervosnetwork/ckb-sdk-go/rpc"
+	ckbTypes "github.com/nervosnetwork/ckb-sdk-go/types"
+)
+
+type fixture struct {
+	Description          string            `json:"description"`
+	Synthetic            bool              `json:"synthetic"`
+	Chain                string            `json:"chain"`
+	BlockNumber          uint64            `json:"block_number"`
+	TxIndex              uint32            `json:"tx_index"`
+	Transaction          json.RawMessage   `json:"transaction"`
+	PreviousTransactions []json.RawMessage `json:"previous_transactions"`
+}
+
+var (
+	rpcURL = flag.String("rpc", "", "the rpc url of the node to capture the transaction from")
+	txHash = flag.String("tx", "", "the hash of the transaction to capture")
+	name   = flag.String("name", "", "the fixture name of the captured transaction")
+	list   = flag.String("list", "", "a file of \"<name> <tx hash>\" lines to capture")
+	dir    = flag.String("dir", "internal/data/testdata/golden", "the fixture directory")
+)
+
+func main() {
+	flag.Parse()
+	if *rpcURL != "" {
+		if err := capture(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	for _, c := range corpus() {
+		if err := write(c.name, c.fixture()); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func capture() error {
+	ctx := context.Background()
+	client, err := rpc.Dial(*rpcURL)
+	if err != nil {
+		return err
+	}
+	info, err := client.GetBlockchainInfo(ctx)
+	if err != nil {
+		return err
+	}
+	if *list == "" {
+		return captureTx(ctx, client, info.Chain, *txHash, *name)
+	}
+	file, err := os.Open(*list)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if err = captureTx(ctx, client, info.Chain, fields[1], fields[0]); err != nil {
+			return fmt.Errorf("capture %s: %w", fields[0], err)
+		}
+		log.Printf("captured %s", fields[0])
+	}
+	return scanner.Err()
+}
+
+func captureTx(ctx context.Context, client rpc.Client, chain, hash, name string) error {
+	tx, err := client.GetTransaction(ctx, ckbTypes.HexToHash(hash))
+	if err != nil {
+		return err
+	}
+	header, err := client.GetHeader(ctx, *tx.TxStatus.BlockHash)
+	if err != nil {
+		return err
+	}
+	block, err := client.GetBlockByNumber(ctx, header.Number)
+	if err != nil {
+		return err
+	}
+	f := fixture{Description: "captured from " + chain, Chain: chain, BlockNumber: header.Number}
+	for i, blockTx := range block.Transactions {
+		if blockTx.Hash == tx.Transaction.Hash {
+			f.TxIndex = uint32(i)
+		}
+	}
+	if f.Transaction, err = ckbtest.MarshalTransaction(tx.Transaction); err != nil {
+		return err
+	}
+	seen := make(map[ckbTypes.Hash]bool)
+	for _, input := range tx.Transaction.Inputs {
+		if seen[input.PreviousOutput.TxHash] {
+			continue
+		}
+		seen[input.PreviousOutput.TxHash] = true
+		previous, err := client.GetTransaction(ctx, input.PreviousOutput.TxHash)
+		if err != nil {
+			return err
+		}
+		data, err := ckbtest.MarshalTransaction(previous.Transaction)
+		if err != nil {
+			return err
+		}
+		f.PreviousTransactions = append(f.PreviousTransactions, data)
+	}
+	return write(name, f)
+}
+
+func write(name string, f fixture) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(*dir, name+".json"), append(data, '\n'), 0o644)
+}
+
+// molecule encoding, a struct or an array is the concatenation of its fields
+
+func u32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return b
+}
+
+func be16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+func be32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+func concat(parts ...[]byte) []byte {
+	var result []byte
+	for _, part := range parts {
+		result = append(result, part...)
+	}
+	return result
+}
+
+func fixvec(items ...[]byte) []byte {
+	return concat(u32(uint32(len(items))), concat(items...))
+}
+
+// table encodes a table, a dynamic vector has the same layout
+func table(fields ...[]byte) []byte {
+	size := 4 + 4*len(fields)
+	header := []byte{}
+	for _, field := range fields {
+		header = append(header, u32(uint32(size))...)
+		size += len(field)
+	}
+	return concat(u32(uint32(size)), header, concat(fields...))
+}
+
+func molBytes(data []byte) []byte {
+	return concat(u32(uint32(len(data))), data)
+}
+
+func bytesOf(hexStr string, size int) []byte {
+	b, err := hex.DecodeString(hexStr)
+	if err != nil {
+		panic(err)
+	}
+	if size > 0 && len(b) != size {
+		panic("bad size: " + hexStr)
+	}
+	return b
+}
+
+func fill(b byte, size int) []byte {
+	result := make([]byte, size)
+	for i := range result {
+		result[i] = b
+	}
+	return result
+}
+
+func molScript(script *ckbTypes.Script) []byte {
+	hashType, err := script.HashType.Serialize()
+	if err != nil {
+		panic(err)
+	}
+	return table(script.CodeHash.Bytes(), hashType, molBytes(script.Args))
+}
+
+// the smt types of the leaves
+
+const (
+	defineSmtType   = 0x8100
+	holdSmtType     = 0x8101
+	withdrawSmtType = 0x8102
+	claimSmtType    = 0x8103
+	extSmtType      = 0xff00
+)
+
+func nftId(smtType uint16, cotaId string, index uint32) []byte {
+	return concat(be16(smtType), bytesOf(cotaId, 20), be32(index))
+}
+
+func nftInfo(configure, state byte, characteristic string) []byte {
+	return concat([]byte{configure, state}, bytesOf(characteristic, 20))
+}
+
+func defineId(cotaId string) []byte {
+	return concat(be16(defineSmtType), bytesOf(cotaId, 20))
+}
+
+func defineValue(total, issued uint32, configure byte) []byte {
+	return concat(be32(total), be32(issued), []byte{configure})
+}
+
+// outPointSlice is the last 20 bytes of the tx hash and the index
+func outPointSlice(txHash string, index uint32) []byte {
+	return concat(ckbTypes.HexToHash(txHash).Bytes()[12:], be32(index))
+}
+
+func withdrawalValueV0(info []byte, to *ckbTypes.Script, outPoint []byte) []byte {
+	return table(info, molBytes(molScript(to)), outPoint)
+}
+
+func withdrawalValueV1(info []byte, to *ckbTypes.Script) []byte {
+	return table(info, molBytes(molScript(to)))
+}
+
+func claimKey(id []byte, outPoint []byte) []byte {
+	return concat(id, outPoint)
+}
+
+func claimInfo(version byte, info []byte) []byte {
+	return concat([]byte{version}, info)
+}
+
+var (
+	proof  = molBytes(fill(0x4c, 8))
+	action = molBytes([]byte("CoTA action"))
+)
+
+// v2Tail is the withdrawal proof of the v2 claims and transfers
+func v2Tail() [][]byte {
+	txProof := table(fill(0x77, 32), table(fixvec(u32(1)), fixvec(fill(0x78, 32))))
+	return [][]byte{molBytes(fill(0x4d, 8)), fixvec(fill(0x01, 32)), fixvec(fill(0x02, 32)), molBytes(fill(0x03, 16)), u32(0), txProof}
+}
+
+// the accounts and tokens of the corpus
+
+var (
+	secp256k1 = ckbTypes.HexToHash("0x9bd7e06f3ecf4be0f2fcd2188b23f1b9fcc88e5d4b65a8637b17723bbda3cce8")
+	alice     = &ckbTypes.Script{CodeHash: secp256k1, HashType: ckbTypes.HashTypeType, Args: bytesOf("a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1", 20)}
+	bob       = &ckbTypes.Script{CodeHash: secp256k1, HashType: ckbTypes.HashTypeType, Args: bytesOf("b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0", 20)}
+	carol     = &ckbTypes.Script{CodeHash: ckbTypes.HexToHash("0xd23761b364210735c19c60561d213fb3beae2fd6172743719eff6920e020baac"), HashType: ckbTypes.HashTypeType, Args: bytesOf("0001c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0", 22)}
+)
+
+const (
+	cotaId         = "f14aca18aae9df753af304469d8f4ebbc174a938"
+	otherCotaId    = "b22585a8053af3fed0fd39127f5b1487ce08b756"
+	characteristic = "0505050505050505050505050505050505050505"
+	updatedChar    = "0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a"
+	withdrawTxHash = "0x6d6e5c9e6d8cf6a8d2ae4a2bc2d2a3b5b4b0d3f1b6f1aab1c1d2e3f4a5b6c7d8"
+)
+
+type fixtureCase struct {
+	name        string
+	description string
+	chain       string
+	version     byte
+	sender      *ckbTypes.Script
+	action      byte
+	entries     []byte
+}
+
+func corpus() []fixtureCase {
+	mintDefine := [][]byte{fixvec(defineId(cotaId)), fixvec(defineValue(100, 2, 0)), fixvec(defineValue(100, 4, 0))}
+	mintV0 := table(append(mintDefine,
+		fixvec(nftId(withdrawSmtType, cotaId, 2), nftId(withdrawSmtType, cotaId, 3)),
+		table(withdrawalValueV0(nftInfo(0, 0, characteristic), bob, outPointSlice(withdrawTxHash, 0)),
+			withdrawalValueV0(nftInfo(0, 0, characteristic), carol, outPointSlice(withdrawTxHash, 0))),
+		proof, action)...)
+	mintV1 := table(append(mintDefine,
+		fixvec(claimKey(nftId(withdrawSmtType, cotaId, 2), outPointSlice(withdrawTxHash, 0)), claimKey(nftId(withdrawSmtType, cotaId, 3), outPointSlice(withdrawTxHash, 0))),
+		table(withdrawalValueV1(nftInfo(0, 0, characteristic), bob), withdrawalValueV1(nftInfo(0, 0, characteristic), carol)),
+		proof, action)...)
+
+	hold := [][]byte{fixvec(nftId(holdSmtType, cotaId, 5)), fixvec(nftInfo(0, 0, characteristic))}
+	withdrawV0 := table(append(hold,
+		fixvec(nftId(withdrawSmtType, cotaId, 5)),
+		table(withdrawalValueV0(nftInfo(0, 0, characteristic), bob, outPointSlice(withdrawTxHash, 1))),
+		proof, action)...)
+	withdrawV1 := table(append(hold,
+		fixvec(claimKey(nftId(withdrawSmtType, cotaId, 5), outPointSlice(withdrawTxHash, 1))),
+		table(withdrawalValueV1(nftInfo(0, 0, characteristic), bob)),
+		proof, action)...)
+
+	claimed := [][]byte{
+		fixvec(nftId(holdSmtType, cotaId, 7)), fixvec(nftInfo(0, 0, characteristic)),
+		fixvec(claimKey(nftId(claimSmtType, cotaId, 7), outPointSlice(withdrawTxHash, 2))),
+	}
+	claimV0 := table(append(claimed, fixvec(fill(0x11, 32)), proof, molBytes(fill(0x4d, 8)), action)...)
+	claimV2 := table(append(append(claimed, fixvec(fill(0x11, 32)), proof, action), v2Tail()...)...)
+
+	claimedUpdate := [][]byte{
+		fixvec(nftId(holdSmtType, cotaId, 8)), fixvec(nftInfo(0, 0, updatedChar)),
+		fixvec(claimKey(nftId(claimSmtType, cotaId, 8), outPointSlice(withdrawTxHash, 3))),
+		fixvec(claimInfo(1, nftInfo(0, 0, characteristic))),
+	}
+	claimUpdateV0 := table(append(claimedUpdate, proof, molBytes(fill(0x4d, 8)), action)...)
+	claimUpdateV2 := table(append(append(claimedUpdate, proof, action), v2Tail()...)...)
+
+	update := table(fixvec(nftId(holdSmtType, cotaId, 9), nftId(holdSmtType, otherCotaId, 0)),
+		fixvec(nftInfo(0, 0, characteristic), nftInfo(0, 0, characteristic)),
+		fixvec(nftInfo(0, 1, updatedChar), nftInfo(0, 0, updatedChar)),
+		proof, action)
+	define := table(fixvec(defineId(otherCotaId)), fixvec(defineValue(0, 0, 0xc0)), proof, action)
+
+	transferClaim := [][]byte{fixvec(claimKey(nftId(claimSmtType, cotaId, 10), outPointSlice(withdrawTxHash, 4))), fixvec(fill(0x11, 32))}
+	transferV0 := table(append(transferClaim,
+		fixvec(nftId(withdrawSmtType, cotaId, 10)),
+		table(withdrawalValueV0(nftInfo(0, 0, characteristic), carol, outPointSlice(withdrawTxHash, 5))),
+		proof, molBytes(fill(0x4d, 8)), action)...)
+	transferWithdrawV1 := [][]byte{
+		fixvec(claimKey(nftId(withdrawSmtType, cotaId, 10), outPointSlice(withdrawTxHash, 5))),
+		table(withdrawalValueV1(nftInfo(0, 0, characteristic), carol)),
+	}
+	transferV1 := table(append(append(transferClaim, transferWithdrawV1...), proof, molBytes(fill(0x4d, 8)), action)...)
+	transferV2 := table(append(append(append(transferClaim, transferWithdrawV1...), proof, action), v2Tail()...)...)
+
+	transferUpdateClaim := [][]byte{
+		fixvec(claimKey(nftId(claimSmtType, cotaId, 11), outPointSlice(withdrawTxHash, 6))),
+		fixvec(claimInfo(1, nftInfo(0, 0, characteristic))),
+	}
+	transferUpdateV0 := table(append(transferUpdateClaim,
+		fixvec(nftId(withdrawSmtType, cotaId, 11)),
+		table(withdrawalValueV0(nftInfo(0, 0, updatedChar), alice, outPointSlice(withdrawTxHash, 7))),
+		proof, molBytes(fill(0x4d, 8)), action)...)
+	transferUpdateWithdrawV1 := [][]byte{
+		fixvec(claimKey(nftId(withdrawSmtType, cotaId, 11), outPointSlice(withdrawTxHash, 7))),
+		table(withdrawalValueV1(nftInfo(0, 0, updatedChar), alice)),
+	}
+	transferUpdateV1 := table(append(append(transferUpdateClaim, transferUpdateWithdrawV1...), proof, molBytes(fill(0x4d, 8)), action)...)
+	transferUpdateV2 := table(append(append(append(transferUpdateClaim, transferUpdateWithdrawV1...), proof, action), v2Tail()...)...)
+
+	subKeyLeaf := concat(be16(extSmtType), []byte("subkey"), fill(0, 24))
+	subKeys := table(
+		fixvec(concat(be16(extSmtType), []byte("subkey"), be32(1), fill(0, 20)), concat(be16(extSmtType), []byte("subkey"), be32(2), fill(0, 20))),
+		fixvec(concat(be16(1), fill(0x21, 20), fill(0, 9), []byte{0}), concat(be16(2), fill(0x22, 20), fill(0, 9), []byte{0})),
+	)
+	extensionSubKey := table(table(fixvec(subKeyLeaf), fixvec(fill(0x31, 32)), fixvec(fill(0, 32)), proof), []byte("subkey"), molBytes(subKeys))
+	socialLeaf := concat(be16(extSmtType), []byte("social"), fill(0, 24))
+	social := table(socialLeaf, table([]byte{0}, []byte{1}, []byte{2}, table(molBytes(molScript(bob)), molBytes(molScript(carol)))))
+	extensionSocial := table(table(fixvec(socialLeaf), fixvec(fill(0x32, 32)), fixvec(fill(0x31, 32)), proof), []byte("social"), molBytes(social))
+
+	return []fixtureCase{
+		{"define_v0", "define a class", "ckb_testnet", 0, alice, 1, define},
+		{"define_v2", "define a class with a v2 cota cell", "ckb", 2, alice, 1, define},
+		{"mint_v0", "mint two tokens to two receivers", "ckb_testnet", 0, alice, 2, mintV0},
+		{"mint_v1", "mint two tokens to two receivers", "ckb_testnet", 1, alice, 2, mintV1},
+		{"mint_v2", "mint two tokens to two receivers", "ckb", 2, alice, 2, mintV1},
+		{"withdraw_v0", "withdraw a held token to a receiver", "ckb_testnet", 0, alice, 3, withdrawV0},
+		{"withdraw_v1", "withdraw a held token to a receiver", "ckb_testnet", 1, alice, 3, withdrawV1},
+		{"withdraw_v2", "withdraw a held token to a receiver", "ckb", 2, alice, 3, withdrawV1},
+		{"claim_v0", "claim a withdrawn token", "ckb_testnet", 0, bob, 4, claimV0},
+		{"claim_v1", "claim a withdrawn token, v1 cells claim with the v2 entries", "ckb_testnet", 1, bob, 4, claimV2},
+		{"claim_v2", "claim a withdrawn token", "ckb", 2, bob, 4, claimV2},
+		{"update_v0", "update the state and characteristic of two held tokens", "ckb_testnet", 0, alice, 5, update},
+		{"update_v2", "update the state and characteristic of two held tokens", "ckb", 2, alice, 5, update},
+		{"transfer_v0", "claim a token and withdraw it to another receiver", "ckb_testnet", 0, bob, 6, transferV0},
+		{"transfer_v1", "claim a token and withdraw it to another receiver", "ckb_testnet", 1, bob, 6, transferV1},
+		{"transfer_v2", "claim a token and withdraw it to another receiver", "ckb", 2, bob, 6, transferV2},
+		{"claim_update_v0", "claim a token and update its characteristic", "ckb_testnet", 0, bob, 7, claimUpdateV0},
+		{"claim_update_v2", "claim a token and update its characteristic", "ckb", 2, bob, 7, claimUpdateV2},
+		{"transfer_update_v0", "claim a token, update it and withdraw it back", "ckb_testnet", 0, bob, 8, transferUpdateV0},
+		{"transfer_update_v1", "claim a token, update it and withdraw it back", "ckb_testnet", 1, bob, 8, transferUpdateV1},
+		{"transfer_update_v2", "claim a token, update it and withdraw it back", "ckb", 2, bob, 8, transferUpdateV2},
+		{"extension_subkey_v2", "add two sub keys", "ckb", 2, carol, 0xF0, extensionSubKey},
+		{"extension_social_v2", "update the social recovery of a JoyID account", "ckb", 2, carol, 0xF1, extensionSocial},
+	}
+}
+
+// cotaType is the cota type script of the chain, see cotaTypeScript in data.go
+func cotaType(chain string, sender *ckbTypes.Script) *ckbTypes.Script {
+	codeHash := "0x89cd8003a0eaf8e65e0c31525b7d1d5c1becefd2ea75bb4cff87810ae37764d8"
+	if chain == "ckb" {
+		codeHash = "0x1122a4fb54697cf2e6e3a96c9d80fd398a936559b90954c6e88eb7ba0cf652df"
+	}
+	lockHash, err := sender.Hash()
+	if err != nil {
+		panic(err)
+	}
+	return &ckbTypes.Script{CodeHash: ckbTypes.HexToHash(codeHash), HashType: ckbTypes.HashTypeType, Args: lockHash.Bytes()[:20]}
+}
+
+func marshal(tx *ckbTypes.Transaction) json.RawMessage {
+	hash, err := tx.ComputeHash()
+	if err != nil {
+		panic(err)
+	}
+	tx.Hash = hash
+	data, err := ckbtest.MarshalTransaction(tx)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// fixture spends the cota cell of the sender created by a previous transaction and writes the entries
+// to the input type of its witness
+func (c fixtureCase) fixture() fixture {
+	cell := &ckbTypes.CellOutput{Capacity: 15_000_000_000, Lock: c.sender, Type: cotaType(c.chain, c.sender)}
+	previous := &ckbTypes.Transaction{
+		CellDeps:    []*ckbTypes.CellDep{},
+		HeaderDeps:  []ckbTypes.Hash{},
+		Inputs:      []*ckbTypes.CellInput{{PreviousOutput: &ckbTypes.OutPoint{TxHash: ckbTypes.HexToHash(withdrawTxHash), Index: 9}}},
+		Outputs:     []*ckbTypes.CellOutput{cell},
+		OutputsData: [][]byte{concat([]byte{c.version}, fill(0, 32))},
+		Witnesses:   [][]byte{},
+	}
+	previousJSON := marshal(previous)
+	witness := table([]byte{}, molBytes(concat([]byte{c.action}, c.entries)), []byte{})
+	tx := &ckbTypes.Transaction{
+		CellDeps:   []*ckbTypes.CellDep{},
+		HeaderDeps: []ckbTypes.Hash{},
+		Inputs: []*ckbTypes.CellInput{
+			{PreviousOutput: &ckbTypes.OutPoint{TxHash: previous.Hash, Index: 0}},
+		},
+		Outputs:     []*ckbTypes.CellOutput{cell},
+		OutputsData: [][]byte{concat([]byte{c.version}, fill(0xee, 32))},
+		Witnesses:   [][]byte{witness},
+	}
+	return fixture{
+		Description:          c.description,
+		Synthetic:            true,
+		Chain:                c.chain,
+		BlockNumber:          7_000_000 + uint64(c.action),
+		TxIndex:              1,
+		Transaction:          marshal(tx),
+		PreviousTransactions: []json.RawMessage{previousJSON},
+	}
+}
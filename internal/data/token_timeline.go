@@ -0,0 +1,236 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+	"gorm.io/gorm"
+)
+
+var _ biz.TokenTimelineRepo = (*tokenTimelineRepo)(nil)
+
+type tokenTimelineRepo struct {
+	data   *Data
+	logger *logger.Logger
+}
+
+func NewTokenTimelineRepo(data *Data, logger *logger.Logger) biz.TokenTimelineRepo {
+	return &tokenTimelineRepo{
+		data:   data,
+		logger: logger,
+	}
+}
+
+func (rp tokenTimelineRepo) FindDefineEvents(ctx context.Context, cotaId string) ([]biz.TokenEvent, error) {
+	var versions []DefineCotaNftKvPairVersion
+	if err := rp.data.db.WithContext(ctx).Where("cota_id = ? and action_type = ?", cotaId, 0).Order("block_number, tx_index").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	events := make([]biz.TokenEvent, len(versions))
+	for i, version := range versions {
+		events[i] = biz.TokenEvent{
+			Type:        biz.TokenEventDefine,
+			BlockNumber: version.BlockNumber,
+			TxIndex:     version.TxIndex,
+			LockHash:    version.LockHash,
+		}
+	}
+	return events, rp.fillTxHashes(ctx, events)
+}
+
+func (rp tokenTimelineRepo) FindWithdrawEvents(ctx context.Context, cotaId string, tokenIndex uint32) ([]biz.TokenEvent, error) {
+	var withdrawals []WithdrawCotaNftKvPair
+	if err := rp.data.db.WithContext(ctx).Where("cota_id = ? and token_index = ?", cotaId, tokenIndex).Order("block_number, tx_index, id").Find(&withdrawals).Error; err != nil {
+		return nil, err
+	}
+	var scriptIds []uint
+	for _, withdrawal := range withdrawals {
+		scriptIds = append(scriptIds, withdrawal.ReceiverLockScriptId, withdrawal.LockScriptId)
+	}
+	scripts, err := rp.findScripts(ctx, scriptIds)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]biz.TokenEvent, len(withdrawals))
+	for i, withdrawal := range withdrawals {
+		events[i] = biz.TokenEvent{
+			Type:               biz.TokenEventWithdraw,
+			BlockNumber:        withdrawal.BlockNumber,
+			TxIndex:            withdrawal.TxIndex,
+			TxHash:             withdrawal.TxHash,
+			LockHash:           withdrawal.LockHash,
+			SenderLockScript:   scripts[withdrawal.LockScriptId],
+			ReceiverLockScript: scripts[withdrawal.ReceiverLockScriptId],
+			OutPoint:           withdrawal.OutPoint,
+			State:              withdrawal.State,
+			Characteristic:     withdrawal.Characteristic,
+		}
+	}
+	return events, nil
+}
+
+func (rp tokenTimelineRepo) FindClaimEvents(ctx context.Context, cotaId string, tokenIndex uint32) ([]biz.TokenEvent, error) {
+	var claims []ClaimedCotaNftKvPair
+	if err := rp.data.db.WithContext(ctx).Where("cota_id = ? and token_index = ?", cotaId, tokenIndex).Order("block_number, tx_index, id").Find(&claims).Error; err != nil {
+		return nil, err
+	}
+	events := make([]biz.TokenEvent, len(claims))
+	for i, claim := range claims {
+		events[i] = biz.TokenEvent{
+			Type:        biz.TokenEventClaim,
+			BlockNumber: claim.BlockNumber,
+			TxIndex:     claim.TxIndex,
+			TxHash:      claim.TxHash,
+			LockHash:    claim.LockHash,
+			OutPoint:    claim.OutPoint,
+		}
+	}
+	return events, nil
+}
+
+func (rp tokenTimelineRepo) FindUpdateEvents(ctx context.Context, cotaId string, tokenIndex uint32) ([]biz.TokenEvent, error) {
+	var versions []HoldCotaNftKvPairVersion
+	if err := rp.data.db.WithContext(ctx).Where("cota_id = ? and token_index = ? and action_type = ?", cotaId, tokenIndex, 1).Order("block_number, tx_index, id").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	events := make([]biz.TokenEvent, len(versions))
+	for i, version := range versions {
+		events[i] = biz.TokenEvent{
+			Type:              biz.TokenEventUpdate,
+			BlockNumber:       version.BlockNumber,
+			TxIndex:           version.TxIndex,
+			LockHash:          version.LockHash,
+			OldState:          version.OldState,
+			State:             version.State,
+			OldCharacteristic: version.OldCharacteristic,
+			Characteristic:    version.Characteristic,
+		}
+	}
+	return events, rp.fillTxHashes(ctx, events)
+}
+
+// FindPruneHeight returns the prune height of the block syncer, which writes the define and hold versions
+func (rp tokenTimelineRepo) FindPruneHeight(ctx context.Context) (uint64, error) {
+	return findPruneHeight(ctx, rp.data.db, biz.SyncBlock)
+}
+
+// HasUnfilledTxs tells whether a withdrawal or a claim of the token was synced before migration 25 added
+// their tx index, those rows still have the tx index 0 of the cellbase
+func (rp tokenTimelineRepo) HasUnfilledTxs(ctx context.Context, cotaId string, tokenIndex uint32) (bool, error) {
+	for _, model := range []any{WithdrawCotaNftKvPair{}, ClaimedCotaNftKvPair{}} {
+		var count int64
+		if err := rp.data.db.WithContext(ctx).Model(model).Where("cota_id = ? and token_index = ? and tx_index = 0", cotaId, tokenIndex).Limit(1).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (rp tokenTimelineRepo) FindUnfilledBlocks(ctx context.Context, afterBlock uint64, limit int) ([]uint64, error) {
+	blocks := make(map[uint64]bool)
+	for _, model := range []any{WithdrawCotaNftKvPair{}, ClaimedCotaNftKvPair{}} {
+		var numbers []uint64
+		if err := rp.data.db.WithContext(ctx).Model(model).Distinct("block_number").Where("block_number > ? and tx_index = 0", afterBlock).
+			Order("block_number").Limit(limit).Pluck("block_number", &numbers).Error; err != nil {
+			return nil, err
+		}
+		for _, number := range numbers {
+			blocks[number] = true
+		}
+	}
+	numbers := mapKeys(blocks)
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	if len(numbers) > limit {
+		numbers = numbers[:limit]
+	}
+	return numbers, nil
+}
+
+// FillTxs matches a withdrawal by its tx hash, which was kept before migration 25, and a claim by the
+// out point of the withdrawal it claims. Only rows still unfilled are written.
+func (rp tokenTimelineRepo) FillTxs(ctx context.Context, withdrawals []biz.WithdrawCotaNftKvPair, claims []biz.ClaimedCotaNftKvPair) (int64, error) {
+	var filled int64
+	err := rp.data.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, withdrawal := range withdrawals {
+			result := tx.Model(WithdrawCotaNftKvPair{}).Where("block_number = ? and cota_id = ? and token_index = ? and tx_hash = ? and tx_index = 0",
+				withdrawal.BlockNumber, withdrawal.CotaId, withdrawal.TokenIndex, withdrawal.TxHash).Update("tx_index", withdrawal.TxIndex)
+			if result.Error != nil {
+				return result.Error
+			}
+			filled += result.RowsAffected
+		}
+		for _, claim := range claims {
+			result := tx.Model(ClaimedCotaNftKvPair{}).Where("block_number = ? and cota_id = ? and token_index = ? and out_point = ? and tx_index = 0",
+				claim.BlockNumber, claim.CotaId, claim.TokenIndex, claim.OutPoint).Updates(map[string]any{"tx_hash": claim.TxHash, "tx_index": claim.TxIndex})
+			if result.Error != nil {
+				return result.Error
+			}
+			filled += result.RowsAffected
+		}
+		return nil
+	})
+	return filled, err
+}
+
+// fillTxHashes sets the tx hash of the events built from version rows, which keep only the block and
+// the tx index. The hash is read from the cota events the block syncer wrote for the same transaction.
+func (rp tokenTimelineRepo) fillTxHashes(ctx context.Context, events []biz.TokenEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	blockNumbers := make(map[uint64]bool)
+	for _, event := range events {
+		blockNumbers[event.BlockNumber] = true
+	}
+	var txs []CotaEvent
+	if err := rp.data.db.WithContext(ctx).Model(CotaEvent{}).Distinct("block_number", "tx_index", "tx_hash").
+		Where("block_number in ? and source = ?", mapKeys(blockNumbers), biz.SyncBlock).Find(&txs).Error; err != nil {
+		return err
+	}
+	txHashes := make(map[string]string, len(txs))
+	for _, tx := range txs {
+		txHashes[fmt.Sprintf("%d-%d", tx.BlockNumber, tx.TxIndex)] = tx.TxHash
+	}
+	for i, event := range events {
+		events[i].TxHash = txHashes[fmt.Sprintf("%d-%d", event.BlockNumber, event.TxIndex)]
+	}
+	return nil
+}
+
+func (rp tokenTimelineRepo) findScripts(ctx context.Context, ids []uint) (map[uint]*biz.TokenLockScript, error) {
+	result := make(map[uint]*biz.TokenLockScript)
+	if len(ids) == 0 {
+		return result, nil
+	}
+	var scripts []Script
+	if err := rp.data.db.WithContext(ctx).Where("id IN ?", ids).Find(&scripts).Error; err != nil {
+		return nil, err
+	}
+	for _, script := range scripts {
+		result[script.ID] = &biz.TokenLockScript{
+			CodeHash: script.CodeHash,
+			HashType: hashTypeName(script.HashType),
+			Args:     script.Args,
+		}
+	}
+	return result, nil
+}
+
+func hashTypeName(hashType int64) string {
+	switch hashType {
+	case 0:
+		return "data"
+	case 1:
+		return "type"
+	case 2:
+		return "data1"
+	default:
+		return ""
+	}
+}
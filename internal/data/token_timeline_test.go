@@ -0,0 +1,148 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+)
+
+func TestTokenTimelineRepo_txHashes(t *testing.T) {
+	ctx := context.Background()
+	data := newTestData(t, DriverSqlite, "file:token_timeline?mode=memory&cache=shared")
+	kvPairs := newTestKvPairRepo(data)
+	event := func(block uint64, txIndex uint32, eventType biz.CotaEventType) biz.CotaEvent {
+		e := testEvent(block, txIndex, eventType, lockA)
+		e.TxHash = fmt.Sprintf("%064x", block<<8|uint64(txIndex))
+		return e
+	}
+	for _, block := range []struct {
+		number uint64
+		kvPair biz.KvPair
+	}{
+		{100, biz.KvPair{
+			DefineCotas: []biz.DefineCotaNftKvPair{testDefine(100, 0, 0)},
+			HoldCotas:   []biz.HoldCotaNftKvPair{testHold(100, 1, 0, lockA, "00")},
+			Events:      []biz.CotaEvent{event(100, 0, biz.CotaEventDefine), event(100, 1, biz.CotaEventClaim)},
+		}},
+		{101, biz.KvPair{
+			UpdatedHoldCotas: []biz.HoldCotaNftKvPair{testHold(101, 2, 0, lockA, "11")},
+			Events:           []biz.CotaEvent{event(101, 1, biz.CotaEventClaim), event(101, 2, biz.CotaEventUpdate)},
+		}},
+	} {
+		if err := kvPairs.CreateCotaEntryKvPairs(ctx, biz.CheckInfo{BlockNumber: block.number, BlockHash: "h", CheckType: biz.SyncBlock}, &block.kvPair); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo := NewTokenTimelineRepo(data, nil)
+	defines, err := repo.FindDefineEvents(ctx, testCotaId)
+	if err != nil || len(defines) != 1 || defines[0].TxHash != fmt.Sprintf("%064x", 100<<8) {
+		t.Errorf("FindDefineEvents() = %+v, %v, want the tx hash of tx 0 of block 100", defines, err)
+	}
+	updates, err := repo.FindUpdateEvents(ctx, testCotaId, 0)
+	if err != nil || len(updates) != 1 || updates[0].TxHash != fmt.Sprintf("%064x", 101<<8|2) {
+		t.Errorf("FindUpdateEvents() = %+v, %v, want the tx hash of tx 2 of block 101", updates, err)
+	}
+}
+
+func TestTokenTimelineUsecase_keptFrom(t *testing.T) {
+	ctx := context.Background()
+	data := newTestData(t, DriverSqlite, "file:token_timeline_kept_from?mode=memory&cache=shared")
+	kvPairs := newTestKvPairRepo(data)
+	for _, block := range []struct {
+		number uint64
+		kvPair biz.KvPair
+	}{
+		{100, biz.KvPair{DefineCotas: []biz.DefineCotaNftKvPair{testDefine(100, 0, 0)}, HoldCotas: []biz.HoldCotaNftKvPair{testHold(100, 1, 0, lockA, "00")}}},
+		{101, biz.KvPair{UpdatedHoldCotas: []biz.HoldCotaNftKvPair{testHold(101, 0, 0, lockA, "11")}}},
+	} {
+		if err := kvPairs.CreateCotaEntryKvPairs(ctx, biz.CheckInfo{BlockNumber: block.number, BlockHash: "h", CheckType: biz.SyncBlock}, &block.kvPair); err != nil {
+			t.Fatal(err)
+		}
+	}
+	uc := biz.NewTokenTimelineUsecase(NewTokenTimelineRepo(data, nil), nil)
+	timeline, err := uc.Timeline(ctx, testCotaId, 0)
+	if err != nil || timeline.KeptFrom != 0 || len(timeline.Events) != 2 || timeline.Events[0].Type != biz.TokenEventDefine {
+		t.Fatalf("Timeline() = %+v, %v, want the define and the update kept from block 0", timeline, err)
+	}
+
+	// keeping no block below block 101 prunes the define of block 100
+	if _, err = NewVersionRetentionRepo(data, nil).PruneVersions(ctx, biz.SyncBlock, 0, 10); err != nil {
+		t.Fatal(err)
+	}
+	timeline, err = uc.Timeline(ctx, testCotaId, 0)
+	if err != nil || timeline.KeptFrom != 101 || len(timeline.Events) != 1 || timeline.Events[0].Type != biz.TokenEventUpdate {
+		t.Errorf("pruned Timeline() = %+v, %v, want the update kept from block 101", timeline, err)
+	}
+}
+
+func TestTokenTimelineRepo_fillTxs(t *testing.T) {
+	ctx := context.Background()
+	data := newTestData(t, DriverSqlite, "file:token_timeline_fill_txs?mode=memory&cache=shared")
+	kvPairs := newTestKvPairRepo(data)
+	withdrawal, claim := testWithdraw(101, 1, 0, lockA, lockB), testClaimed(102, 2, 0, lockB)
+	for _, block := range []struct {
+		number uint64
+		kvPair biz.KvPair
+	}{
+		{100, biz.KvPair{
+			Registers:   []biz.RegisterCotaKvPair{{BlockNumber: 100, LockHash: lockA, CotaCellID: 1}},
+			DefineCotas: []biz.DefineCotaNftKvPair{testDefine(100, 0, 0)},
+		}},
+		{101, biz.KvPair{WithdrawCotas: []biz.WithdrawCotaNftKvPair{withdrawal}}},
+		{102, biz.KvPair{HoldCotas: []biz.HoldCotaNftKvPair{testHold(102, 2, 0, lockB, "00")}, ClaimedCotas: []biz.ClaimedCotaNftKvPair{claim}}},
+	} {
+		if err := kvPairs.CreateCotaEntryKvPairs(ctx, biz.CheckInfo{BlockNumber: block.number, BlockHash: "h", CheckType: biz.SyncBlock}, &block.kvPair); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// rows synced before migration 25 keep the tx hash of a withdrawal but no tx index, and nothing of a claim
+	if err := data.db.Model(WithdrawCotaNftKvPair{}).Where("1 = 1").Update("tx_index", 0).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := data.db.Model(ClaimedCotaNftKvPair{}).Where("1 = 1").Updates(map[string]any{"tx_hash": "", "tx_index": 0}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewTokenTimelineRepo(data, nil)
+	uc := biz.NewTokenTimelineUsecase(repo, nil)
+	if _, err := uc.Timeline(ctx, testCotaId, 0); !errors.Is(err, biz.ErrTimelineNotBackfilled) {
+		t.Fatalf("Timeline() error = %v, want ErrTimelineNotBackfilled", err)
+	}
+	blocks, err := uc.UnfilledBlocks(ctx, 0, 10)
+	if err != nil || !reflect.DeepEqual(blocks, []uint64{101, 102}) {
+		t.Fatalf("UnfilledBlocks() = %v, %v, want [101 102]", blocks, err)
+	}
+	if blocks, err = uc.UnfilledBlocks(ctx, 101, 10); err != nil || !reflect.DeepEqual(blocks, []uint64{102}) {
+		t.Errorf("UnfilledBlocks(101) = %v, %v, want [102]", blocks, err)
+	}
+
+	filled, err := uc.FillTxs(ctx, []biz.WithdrawCotaNftKvPair{withdrawal}, []biz.ClaimedCotaNftKvPair{claim})
+	if err != nil || filled != 2 {
+		t.Fatalf("FillTxs() = %d, %v, want 2 rows", filled, err)
+	}
+	// a filled row is not written again
+	if filled, err = uc.FillTxs(ctx, []biz.WithdrawCotaNftKvPair{withdrawal}, []biz.ClaimedCotaNftKvPair{claim}); err != nil || filled != 0 {
+		t.Errorf("second FillTxs() = %d, %v, want 0 rows", filled, err)
+	}
+	if blocks, err = uc.UnfilledBlocks(ctx, 0, 10); err != nil || len(blocks) != 0 {
+		t.Errorf("filled UnfilledBlocks() = %v, %v, want none", blocks, err)
+	}
+	timeline, err := uc.Timeline(ctx, testCotaId, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var txHashes []string
+	for _, event := range timeline.Events {
+		if event.Type == biz.TokenEventMint || event.Type == biz.TokenEventClaim {
+			txHashes = append(txHashes, event.TxHash)
+		}
+	}
+	if want := []string{withdrawal.TxHash, claim.TxHash}; !reflect.DeepEqual(txHashes, want) {
+		t.Errorf("filled Timeline() mint and claim tx hashes = %v, want %v", txHashes, want)
+	}
+}
@@ -0,0 +1,299 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"time"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var _ biz.TraitRepo = (*traitRepo)(nil)
+
+// TokenTrait is a trait of a token decoded from its current characteristic with the characteristic
+// schema of its class. The traits are derived rows, they are decoded again in the transaction that
+// changes the characteristic of a token or the schema of its class.
+type TokenTrait struct {
+	ID         uint `gorm:"primaryKey"`
+	CotaId     string
+	TokenIndex uint32
+	TraitName  string
+	TraitValue string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// kvPairTraitTokens returns the token indexes by cota id of the tokens a block held, updated or
+// withdrew
+func kvPairTraitTokens(kvPair *biz.KvPair) map[string]map[uint32]bool {
+	tokens := make(map[string]map[uint32]bool)
+	add := func(cotaId string, tokenIndex uint32) {
+		if tokens[cotaId] == nil {
+			tokens[cotaId] = make(map[uint32]bool)
+		}
+		tokens[cotaId][tokenIndex] = true
+	}
+	for _, hold := range kvPair.HoldCotas {
+		add(hold.CotaId, hold.TokenIndex)
+	}
+	for _, hold := range kvPair.UpdatedHoldCotas {
+		add(hold.CotaId, hold.TokenIndex)
+	}
+	for _, withdrawal := range kvPair.WithdrawCotas {
+		add(withdrawal.CotaId, withdrawal.TokenIndex)
+	}
+	return tokens
+}
+
+// blockTraitTokens returns the token indexes by cota id of the tokens the rows written at the block
+// number hold, withdrew or changed, read before the block is rolled back
+func blockTraitTokens(ctx context.Context, tx *gorm.DB, blockNumber uint64) (map[string]map[uint32]bool, error) {
+	var rows []struct {
+		CotaId     string
+		TokenIndex uint32
+	}
+	tokens := make(map[string]map[uint32]bool)
+	for _, model := range []any{HoldCotaNftKvPair{}, HoldCotaNftKvPairVersion{}, WithdrawCotaNftKvPair{}} {
+		if err := tx.WithContext(ctx).Model(model).Select("cota_id, token_index").Where("block_number = ?", blockNumber).Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			if tokens[row.CotaId] == nil {
+				tokens[row.CotaId] = make(map[uint32]bool)
+			}
+			tokens[row.CotaId][row.TokenIndex] = true
+		}
+	}
+	return tokens, nil
+}
+
+// lockTraitClasses serializes the trait refreshes of the classes. The block syncer decodes the traits
+// of the tokens it changes with the schema of their class, the metadata syncer decodes the traits of a
+// class whose schema it changes with the characteristics of its tokens, and each transaction would
+// not see the uncommitted write of the other. The block syncer takes the lock before it writes the
+// tokens and the metadata syncer before it reads them, so the later transaction reads the committed
+// rows of the earlier one. Postgres takes an advisory lock, since a class row may not exist yet, and
+// mysql locks the class rows, gap locks covering the classes not created yet. Sqlite has one writer.
+func lockTraitClasses(ctx context.Context, tx *gorm.DB, cotaIds []string) error {
+	if len(cotaIds) == 0 {
+		return nil
+	}
+	sorted := append([]string(nil), cotaIds...)
+	sort.Strings(sorted)
+	switch tx.Dialector.Name() {
+	case DriverPostgres:
+		for _, cotaId := range sorted {
+			if err := tx.WithContext(ctx).Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "token_traits:"+cotaId).Error; err != nil {
+				return err
+			}
+		}
+	case DriverMysql:
+		var ids []uint
+		return tx.WithContext(ctx).Model(ClassInfo{}).Clauses(clause.Locking{Strength: "UPDATE"}).Where("cota_id in ?", sorted).
+			Order("cota_id").Pluck("id", &ids).Error
+	}
+	return nil
+}
+
+// latestRows reads the latest committed rows inside a mysql repeatable read transaction, whose plain
+// reads see the snapshot of its first read. The other databases read committed rows per statement.
+func latestRows(db *gorm.DB) *gorm.DB {
+	if db.Dialector.Name() != DriverMysql {
+		return db
+	}
+	return db.Clauses(clause.Locking{Strength: "SHARE"})
+}
+
+// refreshTokenTraits decodes the traits of the tokens again
+func refreshTokenTraits(ctx context.Context, tx *gorm.DB, tokens map[string]map[uint32]bool) error {
+	if err := lockTraitClasses(ctx, tx, mapKeys(tokens)); err != nil {
+		return err
+	}
+	for cotaId, indexes := range tokens {
+		tokenIndexes := mapKeys(indexes)
+		for start := 0; start < len(tokenIndexes); start += preloadChunkSize {
+			end := start + preloadChunkSize
+			if end > len(tokenIndexes) {
+				end = len(tokenIndexes)
+			}
+			if err := refreshTraits(ctx, tx, cotaId, tokenIndexes[start:end]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// classTraitChanges returns the cota ids of the classes created or with a changed characteristic at
+// the block number
+func classTraitChanges(ctx context.Context, tx *gorm.DB, blockNumber uint64) ([]string, error) {
+	var cotaIds []string
+	err := tx.WithContext(ctx).Model(ClassInfoVersion{}).Distinct("cota_id").
+		Where("block_number = ? and (action_type = ? or old_characteristic <> characteristic)", blockNumber, 0).Pluck("cota_id", &cotaIds).Error
+	return cotaIds, err
+}
+
+// refreshClassTraits decodes the traits of every token of the classes again
+func refreshClassTraits(ctx context.Context, tx *gorm.DB, cotaIds []string) error {
+	if err := lockTraitClasses(ctx, tx, cotaIds); err != nil {
+		return err
+	}
+	for _, cotaId := range cotaIds {
+		if err := refreshTraits(ctx, tx, cotaId, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshTraits replaces the traits of the tokens of a class, all of them when tokenIndexes is nil. The
+// characteristic of a token is the one of its hold, or of its latest withdrawal while it is not claimed.
+// A class without a characteristic schema or a token not matching it has no traits.
+func refreshTraits(ctx context.Context, tx *gorm.DB, cotaId string, tokenIndexes []uint32) error {
+	scope := func(db *gorm.DB) *gorm.DB {
+		if tokenIndexes == nil {
+			return db
+		}
+		return db.Where("token_index in ?", tokenIndexes)
+	}
+	if err := tx.WithContext(ctx).Scopes(scope).Where("cota_id = ?", cotaId).Delete(TokenTrait{}).Error; err != nil {
+		return err
+	}
+	var class ClassInfo
+	err := tx.WithContext(ctx).Scopes(latestRows).Select("characteristic").Where("cota_id = ?", cotaId).Take(&class).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	schema, err := biz.ParseCharacteristicSchema(class.Characteristic)
+	if err != nil || len(schema) == 0 {
+		// a malformed schema is kept on chain as it is and decodes no traits
+		return nil
+	}
+
+	characteristics := make(map[uint32]string)
+	var withdrawals []WithdrawCotaNftKvPair
+	if err = tx.WithContext(ctx).Scopes(scope, latestRows).Select("token_index, characteristic").
+		Where("cota_id_crc = ? and cota_id = ?", crc32.ChecksumIEEE([]byte(cotaId)), cotaId).
+		Order("block_number, tx_index, id").Find(&withdrawals).Error; err != nil {
+		return err
+	}
+	for _, withdrawal := range withdrawals {
+		characteristics[withdrawal.TokenIndex] = withdrawal.Characteristic
+	}
+	var holds []HoldCotaNftKvPair
+	if err = tx.WithContext(ctx).Scopes(scope, latestRows).Select("token_index, characteristic").Where("cota_id = ?", cotaId).Find(&holds).Error; err != nil {
+		return err
+	}
+	for _, hold := range holds {
+		characteristics[hold.TokenIndex] = hold.Characteristic
+	}
+
+	var traits []TokenTrait
+	for tokenIndex, characteristic := range characteristics {
+		decoded, err := schema.Decode(characteristic)
+		if err != nil {
+			continue
+		}
+		for _, trait := range decoded {
+			traits = append(traits, TokenTrait{CotaId: cotaId, TokenIndex: tokenIndex, TraitName: trait.Name, TraitValue: trait.Value})
+		}
+	}
+	if len(traits) == 0 {
+		return nil
+	}
+	return tx.WithContext(ctx).CreateInBatches(&traits, preloadChunkSize).Error
+}
+
+type traitRepo struct {
+	data   *Data
+	logger *logger.Logger
+}
+
+func NewTraitRepo(data *Data, logger *logger.Logger) biz.TraitRepo {
+	return &traitRepo{
+		data:   data,
+		logger: logger,
+	}
+}
+
+func (rp traitRepo) CountTraitTokens(ctx context.Context, cotaId string) (int64, error) {
+	var tokens int64
+	err := rp.data.db.WithContext(ctx).Model(TokenTrait{}).Where("cota_id = ?", cotaId).Distinct("token_index").Count(&tokens).Error
+	return tokens, err
+}
+
+func (rp traitRepo) FindTraitCounts(ctx context.Context, cotaId string) ([]biz.TraitCount, error) {
+	var rows []struct {
+		TraitName  string
+		TraitValue string
+		Tokens     int64
+	}
+	if err := rp.data.db.WithContext(ctx).Model(TokenTrait{}).Select("trait_name, trait_value, count(*) as tokens").
+		Where("cota_id = ?", cotaId).Group("trait_name, trait_value").Order("trait_name, tokens, trait_value").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := make([]biz.TraitCount, len(rows))
+	for i, row := range rows {
+		counts[i] = biz.TraitCount{Name: row.TraitName, Value: row.TraitValue, Count: row.Tokens}
+	}
+	return counts, nil
+}
+
+// FindTokensByTraits matches a token when it has a row for every trait, a trait name given twice
+// matches no token
+func (rp traitRepo) FindTokensByTraits(ctx context.Context, cotaId string, traits []biz.TokenTrait, afterIndex int64, limit int) ([]uint32, error) {
+	query := rp.data.db.WithContext(ctx).Model(TokenTrait{}).Where("cota_id = ? and token_index > ?", cotaId, afterIndex)
+	if len(traits) > 0 {
+		match := rp.data.db.Where("trait_name = ? and trait_value = ?", traits[0].Name, traits[0].Value)
+		for _, trait := range traits[1:] {
+			match = match.Or("trait_name = ? and trait_value = ?", trait.Name, trait.Value)
+		}
+		query = query.Where(match)
+	}
+	var tokenIndexes []uint32
+	err := query.Group("token_index").Having("count(*) >= ?", len(traits)).Order("token_index").Limit(limit).Pluck("token_index", &tokenIndexes).Error
+	return tokenIndexes, err
+}
+
+// RebuildTraits decodes the traits of the classes in the order of their ids, one transaction per batch,
+// and deletes the traits of the tokens without a class
+func (rp traitRepo) RebuildTraits(ctx context.Context, batchSize int) (int64, error) {
+	if batchSize <= 0 {
+		return 0, fmt.Errorf("batch size must be positive: %d", batchSize)
+	}
+	var (
+		rebuilt int64
+		afterId uint
+	)
+	for {
+		var classes []ClassInfo
+		if err := rp.data.db.WithContext(ctx).Select("id, cota_id").Where("id > ?", afterId).Order("id").Limit(batchSize).Find(&classes).Error; err != nil {
+			return rebuilt, err
+		}
+		if len(classes) == 0 {
+			break
+		}
+		cotaIds := make([]string, len(classes))
+		for i, class := range classes {
+			cotaIds[i] = class.CotaId
+		}
+		if err := rp.data.db.Transaction(func(tx *gorm.DB) error {
+			return refreshClassTraits(ctx, tx, cotaIds)
+		}); err != nil {
+			return rebuilt, err
+		}
+		rebuilt += int64(len(classes))
+		afterId = classes[len(classes)-1].ID
+	}
+	err := rp.data.db.WithContext(ctx).Where("cota_id not in (?)", rp.data.db.Model(ClassInfo{}).Select("cota_id")).Delete(TokenTrait{}).Error
+	return rebuilt, err
+}
@@ -0,0 +1,139 @@
+package data
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+func TestCharacteristicSchema_Decode(t *testing.T) {
+	tests := []struct {
+		name           string
+		schema         string
+		characteristic string
+		want           []biz.TokenTrait
+		wantErr        bool
+	}{
+		{"empty schema", "", "0a", nil, false},
+		{"string sizes", `[["hp","1"],["act","3"]]`, "0a000102" + "00000000000000000000000000000000", []biz.TokenTrait{{Name: "hp", Value: "10"}, {Name: "act", Value: "258"}}, false},
+		{"typed traits", `[["rare",1,"bool"],["kind",2,"hex"],["title",4,"string"]]`, "01beef616263000000000000000000000000000000", []biz.TokenTrait{{Name: "rare", Value: "true"}, {Name: "kind", Value: "beef"}, {Name: "title", Value: "abc"}}, false},
+		{"string not utf-8", `[["title",2,"string"]]`, "ff61", []biz.TokenTrait{{Name: "title", Value: "ff61"}}, false},
+		{"string with an inner nul", `[["title",3,"string"]]`, "610062", []biz.TokenTrait{{Name: "title", Value: "610062"}}, false},
+		{"hex above 8 bytes", `[["seed",10]]`, "0x0102030405060708090a", []biz.TokenTrait{{Name: "seed", Value: "0102030405060708090a"}}, false},
+		{"short characteristic", `[["hp",2]]`, "0a", nil, true},
+		{"schema over 20 bytes", `[["a",12],["b",9]]`, "", nil, true},
+		{"repeated trait", `[["hp",1],["hp",1]]`, "", nil, true},
+		{"wide uint", `[["hp",9,"uint"]]`, "", nil, true},
+		{"not a schema", `[["hp","one"]]`, "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := biz.ParseCharacteristicSchema(tt.schema)
+			var got []biz.TokenTrait
+			if err == nil {
+				got, err = schema.Decode(tt.characteristic)
+			}
+			if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decode = %+v, %v, want %+v, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTraitRepo_traits(t *testing.T) {
+	ctx := context.Background()
+	data := newTestData(t, DriverSqlite, "file:token_traits?mode=memory&cache=shared")
+	kvPairs := newTestKvPairRepo(data)
+	uc := biz.NewTraitUsecase(NewTraitRepo(data, logger.NewLogger(io.Discard, "", 0)), logger.NewLogger(io.Discard, "", 0))
+	traitsOf := func(tokenIndex uint32) map[string]string {
+		t.Helper()
+		var rows []TokenTrait
+		if err := data.db.Where("cota_id = ? and token_index = ?", testCotaId, tokenIndex).Find(&rows).Error; err != nil {
+			t.Fatal(err)
+		}
+		traits := make(map[string]string, len(rows))
+		for _, row := range rows {
+			traits[row.TraitName] = row.TraitValue
+		}
+		return traits
+	}
+	block := func(number uint64, metadata bool, kvPair biz.KvPair) {
+		t.Helper()
+		var err error
+		if metadata {
+			err = kvPairs.CreateMetadataKvPairs(ctx, biz.CheckInfo{BlockNumber: number, BlockHash: "h", CheckType: biz.SyncMetadata}, &kvPair)
+		} else {
+			err = kvPairs.CreateCotaEntryKvPairs(ctx, biz.CheckInfo{BlockNumber: number, BlockHash: "h", CheckType: biz.SyncBlock}, &kvPair)
+		}
+		if err != nil {
+			t.Fatalf("create block %d: %v", number, err)
+		}
+	}
+
+	// the tokens are synced before their class
+	withdrawal := testWithdraw(100, 1, 1, lockA, lockB)
+	withdrawal.Characteristic = "02" + "0005" + "0000000000000000000000000000000000"
+	block(100, false, biz.KvPair{
+		HoldCotas:     []biz.HoldCotaNftKvPair{testHold(100, 0, 0, lockA, "01"+"0003"+"0000000000000000000000000000000000")},
+		WithdrawCotas: []biz.WithdrawCotaNftKvPair{withdrawal},
+	})
+	if traits := traitsOf(0); len(traits) != 0 {
+		t.Fatalf("traits without a class = %v", traits)
+	}
+	class := testClass(100, 0, "chain")
+	class.Characteristic = `[["level",1],["power",2]]`
+	block(100, true, biz.KvPair{ClassInfos: []biz.ClassInfo{class}})
+	if traits := traitsOf(0); !reflect.DeepEqual(traits, map[string]string{"level": "1", "power": "3"}) {
+		t.Errorf("traits of the hold = %v", traits)
+	}
+	if traits := traitsOf(1); !reflect.DeepEqual(traits, map[string]string{"level": "2", "power": "5"}) {
+		t.Errorf("traits of the withdrawal = %v", traits)
+	}
+
+	block(101, false, biz.KvPair{UpdatedHoldCotas: []biz.HoldCotaNftKvPair{testHold(101, 0, 0, lockA, "02"+"0005"+"0000000000000000000000000000000000")}})
+	if traits := traitsOf(0); traits["level"] != "2" {
+		t.Errorf("traits after the update = %v", traits)
+	}
+	stats, err := uc.ClassTraits(ctx, testCotaId)
+	if err != nil || stats.Tokens != 2 || len(stats.Traits) != 2 || stats.Traits[0] != (biz.TraitCount{Name: "level", Value: "2", Count: 2, Rarity: 1}) {
+		t.Errorf("ClassTraits() = %+v, %v", stats, err)
+	}
+	if err = kvPairs.RestoreCotaEntryKvPairs(ctx, 101); err != nil {
+		t.Fatal(err)
+	}
+	if traits := traitsOf(0); traits["level"] != "1" {
+		t.Errorf("traits after the rollback = %v", traits)
+	}
+	tokens, err := uc.TokensByTraits(ctx, testCotaId, []biz.TokenTrait{{Name: "level", Value: "2"}, {Name: "power", Value: "5"}}, -1, 10)
+	if err != nil || !reflect.DeepEqual(tokens, []uint32{1}) {
+		t.Errorf("TokensByTraits() = %v, %v, want token 1", tokens, err)
+	}
+	if tokens, err = uc.TokensByTraits(ctx, testCotaId, nil, 0, 10); err != nil || !reflect.DeepEqual(tokens, []uint32{1}) {
+		t.Errorf("TokensByTraits() after token 0 = %v, %v, want token 1", tokens, err)
+	}
+
+	// a new schema decodes every token again, the rollback restores the old one
+	class = testClass(102, 0, "chain")
+	class.Characteristic = `[["level",3]]`
+	block(102, true, biz.KvPair{ClassInfos: []biz.ClassInfo{class}})
+	if traits := traitsOf(1); !reflect.DeepEqual(traits, map[string]string{"level": "131077"}) {
+		t.Errorf("traits with the new schema = %v", traits)
+	}
+	if err = kvPairs.RestoreMetadataKvPairs(ctx, 102); err != nil {
+		t.Fatal(err)
+	}
+	if traits := traitsOf(1); !reflect.DeepEqual(traits, map[string]string{"level": "2", "power": "5"}) {
+		t.Errorf("traits after the schema rollback = %v", traits)
+	}
+
+	if err = data.db.Where("1 = 1").Delete(TokenTrait{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if classes, err := uc.Rebuild(ctx, 10); err != nil || classes != 1 || len(traitsOf(0)) != 2 || len(traitsOf(1)) != 2 {
+		t.Errorf("Rebuild() = %d, %v, want the traits of both tokens", classes, err)
+	}
+}
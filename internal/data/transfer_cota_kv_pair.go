@@ -33,22 +33,7 @@ func (rp transferCotaKvPairRepo) ParseTransferUpdateCotaEntries(blockNumber uint
 }
 
 func (rp transferCotaKvPairRepo) FindOrCreateScript(ctx context.Context, script *biz.Script) error {
-	ht, err := hashType(script.HashType)
-	if err != nil {
-		return err
-	}
-	s := Script{}
-	if err = rp.data.db.WithContext(ctx).FirstOrCreate(&s, Script{
-		CodeHash:    script.CodeHash,
-		CodeHashCrc: crc32.ChecksumIEEE([]byte(script.CodeHash)),
-		HashType:    ht,
-		Args:        script.Args,
-		ArgsCrc:     crc32.ChecksumIEEE([]byte(script.Args)),
-	}).Error; err != nil {
-		return err
-	}
-	script.ID = s.ID
-	return nil
+	return findOrCreateScript(ctx, rp.data, script)
 }
 
 func NewTransferCotaKvPairRepo(data *Data, logger *logger.Logger) biz.TransferCotaKvPairRepo {
@@ -59,7 +44,10 @@ func NewTransferCotaKvPairRepo(data *Data, logger *logger.Logger) biz.TransferCo
 }
 
 func generateTransferV0KvPairs(blockNumber uint64, entry biz.Entry, rp transferCotaKvPairRepo) (claimedCotas []biz.ClaimedCotaNftKvPair, withdrawCotas []biz.WithdrawCotaNftKvPair, err error) {
-	entries := smt.TransferCotaNFTEntriesFromSliceUnchecked(entry.InputType[1:])
+	entries, err := decodeMolecule("transfer entries", entry.InputType[1:], smt.TransferCotaNFTEntriesFromSlice)
+	if err != nil {
+		return
+	}
 	claimedCotaKeyVec := entries.ClaimKeys()
 	senderLock, err := GenerateSenderLock(entry)
 	if err != nil {
@@ -85,16 +73,24 @@ func generateTransferV0KvPairs(blockNumber uint64, entry biz.Entry, rp transferC
 			OutPointCrc: crc32.ChecksumIEEE([]byte(outpointStr)),
 			LockHash:    lockHashStr,
 			LockHashCrc: lockHashCRC32,
+			TxHash:      entry.TxHash.String()[2:],
+			TxIndex:     entry.TxIndex,
 		})
 	}
 	withdrawKeyVec := entries.WithdrawalKeys()
 	withdrawValueVec := entries.WithdrawalValues()
+	if err = checkPairs("withdrawal entries", withdrawKeyVec.Len(), withdrawValueVec.Len()); err != nil {
+		return
+	}
 	for i := uint(0); i < withdrawKeyVec.Len(); i++ {
 		key := withdrawKeyVec.Get(i)
 		value := withdrawValueVec.Get(i)
 		cotaId := hex.EncodeToString(key.CotaId().RawData())
 		outpointStr := hex.EncodeToString(value.OutPoint().RawData())
-		receiverLock := GenerateReceiverLock(value.ToLock().RawData())
+		var receiverLock biz.Script
+		if receiverLock, err = GenerateReceiverLock(value.ToLock().RawData()); err != nil {
+			return
+		}
 		if err = rp.FindOrCreateScript(context.TODO(), &receiverLock); err != nil {
 			return
 		}
@@ -106,10 +102,12 @@ func generateTransferV0KvPairs(blockNumber uint64, entry biz.Entry, rp transferC
 			OutPoint:             outpointStr,
 			OutPointCrc:          crc32.ChecksumIEEE([]byte(outpointStr)),
 			TxHash:               entry.TxHash.String()[2:],
+			TxIndex:              entry.TxIndex,
 			State:                value.NftInfo().State().AsSlice()[0],
 			Configure:            value.NftInfo().Configure().AsSlice()[0],
 			Characteristic:       hex.EncodeToString(value.NftInfo().Characteristic().RawData()),
 			ReceiverLockScriptId: receiverLock.ID,
+			ReceiverLockHash:     GenerateReceiverLockHash(value.ToLock().RawData()),
 			LockHash:             lockHashStr,
 			LockHashCrc:          lockHashCRC32,
 			LockScriptId:         senderLock.ID,
@@ -126,12 +124,18 @@ func generateTransferV1ToV2KvPairs(blockNumber uint64, entry biz.Entry, rp trans
 		withdrawValueVec  *smt.WithdrawalCotaNFTValueV1Vec
 	)
 	if entry.Version == 1 {
-		entries := smt.TransferCotaNFTV1EntriesFromSliceUnchecked(entry.InputType[1:])
+		var entries *smt.TransferCotaNFTV1Entries
+		if entries, err = decodeMolecule("transfer entries", entry.InputType[1:], smt.TransferCotaNFTV1EntriesFromSlice); err != nil {
+			return
+		}
 		claimedCotaKeyVec = entries.ClaimKeys()
 		withdrawKeyVec = entries.WithdrawalKeys()
 		withdrawValueVec = entries.WithdrawalValues()
 	} else {
-		entries := smt.TransferCotaNFTV2EntriesFromSliceUnchecked(entry.InputType[1:])
+		var entries *smt.TransferCotaNFTV2Entries
+		if entries, err = decodeMolecule("transfer entries", entry.InputType[1:], smt.TransferCotaNFTV2EntriesFromSlice); err != nil {
+			return
+		}
 		claimedCotaKeyVec = entries.ClaimKeys()
 		withdrawKeyVec = entries.WithdrawalKeys()
 		withdrawValueVec = entries.WithdrawalValues()
@@ -160,14 +164,22 @@ func generateTransferV1ToV2KvPairs(blockNumber uint64, entry biz.Entry, rp trans
 			OutPointCrc: crc32.ChecksumIEEE([]byte(outpointStr)),
 			LockHash:    lockHashStr,
 			LockHashCrc: lockHashCRC32,
+			TxHash:      entry.TxHash.String()[2:],
+			TxIndex:     entry.TxIndex,
 		})
 	}
+	if err = checkPairs("withdrawal entries", withdrawKeyVec.Len(), withdrawValueVec.Len()); err != nil {
+		return
+	}
 	for i := uint(0); i < withdrawKeyVec.Len(); i++ {
 		key := withdrawKeyVec.Get(i)
 		value := withdrawValueVec.Get(i)
 		cotaId := hex.EncodeToString(key.NftId().CotaId().RawData())
 		outpointStr := hex.EncodeToString(key.OutPoint().RawData())
-		receiverLock := GenerateReceiverLock(value.ToLock().RawData())
+		var receiverLock biz.Script
+		if receiverLock, err = GenerateReceiverLock(value.ToLock().RawData()); err != nil {
+			return
+		}
 		if err = rp.FindOrCreateScript(context.TODO(), &receiverLock); err != nil {
 			return
 		}
@@ -179,10 +191,12 @@ func generateTransferV1ToV2KvPairs(blockNumber uint64, entry biz.Entry, rp trans
 			OutPoint:             outpointStr,
 			OutPointCrc:          crc32.ChecksumIEEE([]byte(outpointStr)),
 			TxHash:               entry.TxHash.String()[2:],
+			TxIndex:              entry.TxIndex,
 			State:                value.NftInfo().State().AsSlice()[0],
 			Configure:            value.NftInfo().Configure().AsSlice()[0],
 			Characteristic:       hex.EncodeToString(value.NftInfo().Characteristic().RawData()),
 			ReceiverLockScriptId: receiverLock.ID,
+			ReceiverLockHash:     GenerateReceiverLockHash(value.ToLock().RawData()),
 			LockHash:             lockHashStr,
 			LockHashCrc:          lockHashCRC32,
 			LockScriptId:         senderLock.ID,
@@ -193,7 +207,10 @@ func generateTransferV1ToV2KvPairs(blockNumber uint64, entry biz.Entry, rp trans
 }
 
 func generateTransferUpdateV0KvPairs(blockNumber uint64, entry biz.Entry, rp transferCotaKvPairRepo) (claimedCotas []biz.ClaimedCotaNftKvPair, withdrawCotas []biz.WithdrawCotaNftKvPair, err error) {
-	entries := smt.TransferUpdateCotaNFTEntriesFromSliceUnchecked(entry.InputType[1:])
+	entries, err := decodeMolecule("transfer update entries", entry.InputType[1:], smt.TransferUpdateCotaNFTEntriesFromSlice)
+	if err != nil {
+		return
+	}
 	claimedCotaKeyVec := entries.ClaimKeys()
 	senderLock, err := GenerateSenderLock(entry)
 	if err != nil {
@@ -219,16 +236,24 @@ func generateTransferUpdateV0KvPairs(blockNumber uint64, entry biz.Entry, rp tra
 			OutPointCrc: crc32.ChecksumIEEE([]byte(outpointStr)),
 			LockHash:    lockHashStr,
 			LockHashCrc: lockHashCRC32,
+			TxHash:      entry.TxHash.String()[2:],
+			TxIndex:     entry.TxIndex,
 		})
 	}
 	withdrawKeyVec := entries.WithdrawalKeys()
 	withdrawValueVec := entries.WithdrawalValues()
+	if err = checkPairs("withdrawal entries", withdrawKeyVec.Len(), withdrawValueVec.Len()); err != nil {
+		return
+	}
 	for i := uint(0); i < withdrawKeyVec.Len(); i++ {
 		key := withdrawKeyVec.Get(i)
 		value := withdrawValueVec.Get(i)
 		cotaId := hex.EncodeToString(key.CotaId().RawData())
 		outpointStr := hex.EncodeToString(value.OutPoint().RawData())
-		receiverLock := GenerateReceiverLock(value.ToLock().RawData())
+		var receiverLock biz.Script
+		if receiverLock, err = GenerateReceiverLock(value.ToLock().RawData()); err != nil {
+			return
+		}
 		if err = rp.FindOrCreateScript(context.TODO(), &receiverLock); err != nil {
 			return
 		}
@@ -240,10 +265,12 @@ func generateTransferUpdateV0KvPairs(blockNumber uint64, entry biz.Entry, rp tra
 			OutPoint:             outpointStr,
 			OutPointCrc:          crc32.ChecksumIEEE([]byte(outpointStr)),
 			TxHash:               entry.TxHash.String()[2:],
+			TxIndex:              entry.TxIndex,
 			State:                value.NftInfo().State().AsSlice()[0],
 			Configure:            value.NftInfo().Configure().AsSlice()[0],
 			Characteristic:       hex.EncodeToString(value.NftInfo().Characteristic().RawData()),
 			ReceiverLockScriptId: receiverLock.ID,
+			ReceiverLockHash:     GenerateReceiverLockHash(value.ToLock().RawData()),
 			LockHash:             lockHashStr,
 			LockHashCrc:          lockHashCRC32,
 			LockScriptId:         senderLock.ID,
@@ -261,12 +288,18 @@ func generateTransferUpdateV1ToV2KvPairs(blockNumber uint64, entry biz.Entry, rp
 	)
 
 	if entry.Version == 1 {
-		entries := smt.TransferUpdateCotaNFTV1EntriesFromSliceUnchecked(entry.InputType[1:])
+		var entries *smt.TransferUpdateCotaNFTV1Entries
+		if entries, err = decodeMolecule("transfer update entries", entry.InputType[1:], smt.TransferUpdateCotaNFTV1EntriesFromSlice); err != nil {
+			return
+		}
 		claimedCotaKeyVec = entries.ClaimKeys()
 		withdrawKeyVec = entries.WithdrawalKeys()
 		withdrawValueVec = entries.WithdrawalValues()
 	} else {
-		entries := smt.TransferUpdateCotaNFTV2EntriesFromSliceUnchecked(entry.InputType[1:])
+		var entries *smt.TransferUpdateCotaNFTV2Entries
+		if entries, err = decodeMolecule("transfer update entries", entry.InputType[1:], smt.TransferUpdateCotaNFTV2EntriesFromSlice); err != nil {
+			return
+		}
 		claimedCotaKeyVec = entries.ClaimKeys()
 		withdrawKeyVec = entries.WithdrawalKeys()
 		withdrawValueVec = entries.WithdrawalValues()
@@ -295,14 +328,22 @@ func generateTransferUpdateV1ToV2KvPairs(blockNumber uint64, entry biz.Entry, rp
 			OutPointCrc: crc32.ChecksumIEEE([]byte(outpointStr)),
 			LockHash:    lockHashStr,
 			LockHashCrc: lockHashCRC32,
+			TxHash:      entry.TxHash.String()[2:],
+			TxIndex:     entry.TxIndex,
 		})
 	}
+	if err = checkPairs("withdrawal entries", withdrawKeyVec.Len(), withdrawValueVec.Len()); err != nil {
+		return
+	}
 	for i := uint(0); i < withdrawKeyVec.Len(); i++ {
 		key := withdrawKeyVec.Get(i)
 		value := withdrawValueVec.Get(i)
 		cotaId := hex.EncodeToString(key.NftId().CotaId().RawData())
 		outpointStr := hex.EncodeToString(key.OutPoint().RawData())
-		receiverLock := GenerateReceiverLock(value.ToLock().RawData())
+		var receiverLock biz.Script
+		if receiverLock, err = GenerateReceiverLock(value.ToLock().RawData()); err != nil {
+			return
+		}
 		if err = rp.FindOrCreateScript(context.TODO(), &receiverLock); err != nil {
 			return
 		}
@@ -314,10 +355,12 @@ func generateTransferUpdateV1ToV2KvPairs(blockNumber uint64, entry biz.Entry, rp
 			OutPoint:             outpointStr,
 			OutPointCrc:          crc32.ChecksumIEEE([]byte(outpointStr)),
 			TxHash:               entry.TxHash.String()[2:],
+			TxIndex:              entry.TxIndex,
 			State:                value.NftInfo().State().AsSlice()[0],
 			Configure:            value.NftInfo().Configure().AsSlice()[0],
 			Characteristic:       hex.EncodeToString(value.NftInfo().Characteristic().RawData()),
 			ReceiverLockScriptId: receiverLock.ID,
+			ReceiverLockHash:     GenerateReceiverLockHash(value.ToLock().RawData()),
 			LockHash:             lockHashStr,
 			LockHashCrc:          lockHashCRC32,
 			LockScriptId:         senderLock.ID,
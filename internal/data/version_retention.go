@@ -0,0 +1,112 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var _ biz.VersionRetentionRepo = (*versionRetentionRepo)(nil)
+
+// versionTables are the history tables a rollback restores the rows of each syncer from
+var versionTables = map[biz.CheckType][]any{
+	biz.SyncBlock: {
+		DefineCotaNftKvPairVersion{}, HoldCotaNftKvPairVersion{}, ExtensionKvPairVersion{}, SubKeyKvPairVersion{}, SocialKvPairVersion{},
+	},
+	biz.SyncMetadata: {
+		IssuerInfoVersion{}, ClassInfoVersion{}, JoyIDInfoVersion{}, SubKeyInfoVersion{},
+	},
+}
+
+// VersionPruneHeight is the lowest block of a syncer whose version rows are kept
+type VersionPruneHeight struct {
+	ID          uint `gorm:"primaryKey"`
+	CheckType   biz.CheckType
+	BlockNumber uint64
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type versionRetentionRepo struct {
+	data   *Data
+	logger *logger.Logger
+}
+
+func NewVersionRetentionRepo(data *Data, logger *logger.Logger) biz.VersionRetentionRepo {
+	return &versionRetentionRepo{
+		data:   data,
+		logger: logger,
+	}
+}
+
+// PruneVersions raises the prune height first, so that a rollback below it is refused before its
+// versions are gone. The rows are then deleted by id in short transactions of batchSize rows.
+func (rp versionRetentionRepo) PruneVersions(ctx context.Context, checkType biz.CheckType, keepBlocks uint64, batchSize int) (int64, error) {
+	var last CheckInfo
+	if err := rp.data.db.WithContext(ctx).Where("check_type = ?", checkType).Order("block_number desc").Limit(1).Find(&last).Error; err != nil {
+		return 0, err
+	}
+	if last.BlockNumber <= keepBlocks {
+		return 0, nil
+	}
+	height := last.BlockNumber - keepBlocks
+	if err := rp.data.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "check_type"}},
+		DoUpdates: clause.AssignmentColumns([]string{"block_number", "updated_at"}),
+	}).Create(&VersionPruneHeight{CheckType: checkType, BlockNumber: height}).Error; err != nil {
+		return 0, err
+	}
+	var pruned int64
+	for _, model := range versionTables[checkType] {
+		for {
+			var ids []uint
+			if err := rp.data.db.WithContext(ctx).Model(model).Where("block_number < ?", height).Order("id").Limit(batchSize).Pluck("id", &ids).Error; err != nil {
+				return pruned, err
+			}
+			if len(ids) == 0 {
+				break
+			}
+			result := rp.data.db.WithContext(ctx).Where("id in ?", ids).Delete(model)
+			if result.Error != nil {
+				return pruned, result.Error
+			}
+			pruned += result.RowsAffected
+			if len(ids) < batchSize {
+				break
+			}
+		}
+	}
+	return pruned, nil
+}
+
+func (rp versionRetentionRepo) FindPruneHeight(ctx context.Context, checkType biz.CheckType) (uint64, error) {
+	return findPruneHeight(ctx, rp.data.db, checkType)
+}
+
+func findPruneHeight(ctx context.Context, tx *gorm.DB, checkType biz.CheckType) (uint64, error) {
+	var heights []uint64
+	if err := tx.WithContext(ctx).Model(VersionPruneHeight{}).Where("check_type = ?", checkType).Pluck("block_number", &heights).Error; err != nil {
+		return 0, err
+	}
+	if len(heights) == 0 {
+		return 0, nil
+	}
+	return heights[0], nil
+}
+
+// checkRetention refuses the rollback of a block below the prune height of the syncer
+func checkRetention(ctx context.Context, tx *gorm.DB, blockNumber uint64, checkType biz.CheckType) error {
+	height, err := findPruneHeight(ctx, tx, checkType)
+	if err != nil {
+		return err
+	}
+	if blockNumber < height {
+		return fmt.Errorf("%w: %s block %d, the versions are kept from block %d", biz.ErrRollbackBeyondRetention, checkType.String(), blockNumber, height)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+func TestVersionRetentionRepo_PruneVersions(t *testing.T) {
+	ctx := context.Background()
+	data := newTestData(t, DriverSqlite, "file:version_retention?mode=memory&cache=shared")
+	kvPairs := newTestKvPairRepo(data)
+	repo := NewVersionRetentionRepo(data, logger.NewLogger(io.Discard, "", 0))
+
+	if err := kvPairs.CreateCotaEntryKvPairs(ctx, biz.CheckInfo{BlockNumber: 100, BlockHash: "h", CheckType: biz.SyncBlock}, &biz.KvPair{
+		DefineCotas: []biz.DefineCotaNftKvPair{testDefine(100, 0, 0)},
+	}); err != nil {
+		t.Fatalf("create block 100: %v", err)
+	}
+	for block := uint64(101); block <= 104; block++ {
+		if err := kvPairs.CreateCotaEntryKvPairs(ctx, biz.CheckInfo{BlockNumber: block, BlockHash: "h", CheckType: biz.SyncBlock}, &biz.KvPair{
+			UpdatedDefineCotas: []biz.DefineCotaNftKvPair{testDefine(block, 0, uint32(block-100)*2-1), testDefine(block, 1, uint32(block-100)*2)},
+		}); err != nil {
+			t.Fatalf("create block %d: %v", block, err)
+		}
+	}
+
+	if pruned, err := repo.PruneVersions(ctx, biz.SyncBlock, 10, 1); err != nil || pruned != 0 {
+		t.Fatalf("prune within the kept blocks = %d, %v, want nothing", pruned, err)
+	}
+	// keeping two blocks before block 104 deletes the versions of blocks 100 and 101 one row at a time
+	pruned, err := repo.PruneVersions(ctx, biz.SyncBlock, 2, 1)
+	if err != nil || pruned != 3 {
+		t.Fatalf("prune = %d, %v, want 3 rows", pruned, err)
+	}
+	if height, err := repo.FindPruneHeight(ctx, biz.SyncBlock); err != nil || height != 102 {
+		t.Errorf("prune height = %d, %v, want 102", height, err)
+	}
+	if height, err := repo.FindPruneHeight(ctx, biz.SyncMetadata); err != nil || height != 0 {
+		t.Errorf("metadata prune height = %d, %v, want 0", height, err)
+	}
+	var versions []DefineCotaNftKvPairVersion
+	if err = data.db.Order("id").Find(&versions).Error; err != nil || len(versions) != 6 || versions[0].BlockNumber != 102 {
+		t.Fatalf("kept versions = %+v, %v, want the 6 rows from block 102", versions, err)
+	}
+
+	if err = kvPairs.RestoreCotaEntryKvPairs(ctx, 104); err != nil {
+		t.Fatalf("restore block 104: %v", err)
+	}
+	if err = kvPairs.RestoreCotaEntryKvPairs(ctx, 101); !errors.Is(err, biz.ErrRollbackBeyondRetention) {
+		t.Fatalf("restore block 101: %v, want ErrRollbackBeyondRetention", err)
+	}
+	var define DefineCotaNftKvPair
+	if err = data.db.Where("cota_id = ?", testCotaId).First(&define).Error; err != nil || define.Issued != 6 || define.BlockNumber != 103 {
+		t.Errorf("define after the refused restore = %+v, %v, want issued 6 at block 103", define, err)
+	}
+}
@@ -25,6 +25,7 @@ type WithdrawCotaNftKvPair struct {
 	OutPoint             string
 	OutPointCrc          uint32
 	TxHash               string
+	TxIndex              uint32
 	State                uint8
 	Configure            uint8
 	Characteristic       string
@@ -82,12 +83,32 @@ func (rp withdrawCotaNftKvPairRepo) ParseWithdrawCotaEntries(blockNumber uint64,
 }
 
 func (rp withdrawCotaNftKvPairRepo) FindOrCreateScript(ctx context.Context, script *biz.Script) error {
+	return findOrCreateScript(ctx, rp.data, script)
+}
+
+func hashType(hashTypeStr string) (int64, error) {
+	t, err := strconv.ParseInt(hashTypeStr, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("parse hash type: %s, err: %w", hashTypeStr, err)
+	}
+
+	return t, nil
+}
+
+// findOrCreateScript sets the id of the script, creating its row on first sight. The ids of the
+// recently used scripts are cached, a catch-up sync sees the same few receiver locks in every block.
+func findOrCreateScript(ctx context.Context, data *Data, script *biz.Script) error {
 	ht, err := hashType(script.HashType)
 	if err != nil {
 		return err
 	}
+	key := fmt.Sprintf("%s-%d-%s", script.CodeHash, ht, script.Args)
+	if id, ok := data.scripts.get(key); ok {
+		script.ID = id
+		return nil
+	}
 	s := Script{}
-	if err = rp.data.db.WithContext(ctx).FirstOrCreate(&s, Script{
+	if err = data.db.WithContext(ctx).FirstOrCreate(&s, Script{
 		CodeHash:    script.CodeHash,
 		CodeHashCrc: crc32.ChecksumIEEE([]byte(script.CodeHash)),
 		HashType:    ht,
@@ -96,21 +117,16 @@ func (rp withdrawCotaNftKvPairRepo) FindOrCreateScript(ctx context.Context, scri
 	}).Error; err != nil {
 		return err
 	}
+	data.scripts.add(key, s.ID)
 	script.ID = s.ID
 	return nil
 }
 
-func hashType(hashTypeStr string) (int64, error) {
-	t, err := strconv.ParseInt(hashTypeStr, 16, 32)
+func generateV0WithdrawKvPair(blockNumber uint64, entry biz.Entry, rp withdrawCotaNftKvPairRepo) (withdrawCotas []biz.WithdrawCotaNftKvPair, err error) {
+	entries, err := decodeMolecule("withdrawal entries", entry.InputType[1:], smt.WithdrawalCotaNFTEntriesFromSlice)
 	if err != nil {
-		return 0, fmt.Errorf("parse hash type: %s, err: %w", hashTypeStr, err)
+		return
 	}
-
-	return t, nil
-}
-
-func generateV0WithdrawKvPair(blockNumber uint64, entry biz.Entry, rp withdrawCotaNftKvPairRepo) (withdrawCotas []biz.WithdrawCotaNftKvPair, err error) {
-	entries := smt.WithdrawalCotaNFTEntriesFromSliceUnchecked(entry.InputType[1:])
 	withdrawKeyVec := entries.WithdrawalKeys()
 	withdrawValueVec := entries.WithdrawalValues()
 	senderLock, err := GenerateSenderLock(entry)
@@ -124,12 +140,18 @@ func generateV0WithdrawKvPair(blockNumber uint64, entry biz.Entry, rp withdrawCo
 	if err != nil {
 		return
 	}
+	if err = checkPairs("withdrawal entries", withdrawKeyVec.Len(), withdrawValueVec.Len()); err != nil {
+		return
+	}
 	for i := uint(0); i < withdrawKeyVec.Len(); i++ {
 		key := withdrawKeyVec.Get(i)
 		value := withdrawValueVec.Get(i)
 		cotaId := hex.EncodeToString(key.CotaId().RawData())
 		outpointStr := hex.EncodeToString(value.OutPoint().RawData())
-		receiverLock := GenerateReceiverLock(value.ToLock().RawData())
+		var receiverLock biz.Script
+		if receiverLock, err = GenerateReceiverLock(value.ToLock().RawData()); err != nil {
+			return
+		}
 		if err = rp.FindOrCreateScript(context.TODO(), &receiverLock); err != nil {
 			return
 		}
@@ -141,10 +163,12 @@ func generateV0WithdrawKvPair(blockNumber uint64, entry biz.Entry, rp withdrawCo
 			OutPoint:             outpointStr,
 			OutPointCrc:          crc32.ChecksumIEEE([]byte(outpointStr)),
 			TxHash:               entry.TxHash.String()[2:],
+			TxIndex:              entry.TxIndex,
 			State:                value.NftInfo().State().AsSlice()[0],
 			Configure:            value.NftInfo().Configure().AsSlice()[0],
 			Characteristic:       hex.EncodeToString(value.NftInfo().Characteristic().RawData()),
 			ReceiverLockScriptId: receiverLock.ID,
+			ReceiverLockHash:     GenerateReceiverLockHash(value.ToLock().RawData()),
 			LockHash:             lockHashStr,
 			LockHashCrc:          lockHashCRC32,
 			LockScriptId:         senderLock.ID,
@@ -155,7 +179,10 @@ func generateV0WithdrawKvPair(blockNumber uint64, entry biz.Entry, rp withdrawCo
 }
 
 func generateV1WithdrawKvPair(blockNumber uint64, entry biz.Entry, rp withdrawCotaNftKvPairRepo) (withdrawCotas []biz.WithdrawCotaNftKvPair, err error) {
-	entries := smt.WithdrawalCotaNFTV1EntriesFromSliceUnchecked(entry.InputType[1:])
+	entries, err := decodeMolecule("withdrawal entries", entry.InputType[1:], smt.WithdrawalCotaNFTV1EntriesFromSlice)
+	if err != nil {
+		return
+	}
 	withdrawKeyVec := entries.WithdrawalKeys()
 	withdrawValueVec := entries.WithdrawalValues()
 	senderLock, err := GenerateSenderLock(entry)
@@ -169,12 +196,18 @@ func generateV1WithdrawKvPair(blockNumber uint64, entry biz.Entry, rp withdrawCo
 	if err != nil {
 		return
 	}
+	if err = checkPairs("withdrawal entries", withdrawKeyVec.Len(), withdrawValueVec.Len()); err != nil {
+		return
+	}
 	for i := uint(0); i < withdrawKeyVec.Len(); i++ {
 		key := withdrawKeyVec.Get(i)
 		value := withdrawValueVec.Get(i)
 		cotaId := hex.EncodeToString(key.NftId().CotaId().RawData())
 		outpointStr := hex.EncodeToString(key.OutPoint().RawData())
-		receiverLock := GenerateReceiverLock(value.ToLock().RawData())
+		var receiverLock biz.Script
+		if receiverLock, err = GenerateReceiverLock(value.ToLock().RawData()); err != nil {
+			return
+		}
 		if err = rp.FindOrCreateScript(context.TODO(), &receiverLock); err != nil {
 			return
 		}
@@ -186,10 +219,12 @@ func generateV1WithdrawKvPair(blockNumber uint64, entry biz.Entry, rp withdrawCo
 			OutPoint:             outpointStr,
 			OutPointCrc:          crc32.ChecksumIEEE([]byte(outpointStr)),
 			TxHash:               entry.TxHash.String()[2:],
+			TxIndex:              entry.TxIndex,
 			State:                value.NftInfo().State().AsSlice()[0],
 			Configure:            value.NftInfo().Configure().AsSlice()[0],
 			Characteristic:       hex.EncodeToString(value.NftInfo().Characteristic().RawData()),
 			ReceiverLockScriptId: receiverLock.ID,
+			ReceiverLockHash:     GenerateReceiverLockHash(value.ToLock().RawData()),
 			LockHash:             lockHashStr,
 			LockHashCrc:          lockHashCRC32,
 			LockScriptId:         senderLock.ID,
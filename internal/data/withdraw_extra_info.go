@@ -51,20 +51,5 @@ func (rp withdrawExtraInfoRepo) FindQueryInfos(ctx context.Context, page int, pa
 }
 
 func (rp withdrawExtraInfoRepo) FindOrCreateScript(ctx context.Context, script *biz.Script) error {
-	ht, err := hashType(script.HashType)
-	if err != nil {
-		return err
-	}
-	s := Script{}
-	if err = rp.data.db.WithContext(ctx).FirstOrCreate(&s, Script{
-		CodeHash:    script.CodeHash,
-		CodeHashCrc: crc32.ChecksumIEEE([]byte(script.CodeHash)),
-		HashType:    ht,
-		Args:        script.Args,
-		ArgsCrc:     crc32.ChecksumIEEE([]byte(script.Args)),
-	}).Error; err != nil {
-		return err
-	}
-	script.ID = s.ID
-	return nil
+	return findOrCreateScript(ctx, rp.data, script)
 }
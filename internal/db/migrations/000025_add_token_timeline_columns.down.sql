@@ -0,0 +1,7 @@
+ALTER TABLE hold_cota_nft_kv_pair_versions DROP INDEX index_hold_versions_on_cota_id_token_index;
+ALTER TABLE define_cota_nft_kv_pair_versions DROP INDEX index_define_versions_on_cota_id;
+
+ALTER TABLE claimed_cota_nft_kv_pairs DROP COLUMN `tx_index`,
+                                      DROP COLUMN `tx_hash`;
+
+ALTER TABLE withdraw_cota_nft_kv_pairs DROP COLUMN `tx_index`;
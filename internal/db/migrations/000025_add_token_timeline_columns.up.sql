@@ -0,0 +1,7 @@
+ALTER TABLE withdraw_cota_nft_kv_pairs ADD COLUMN `tx_index` int unsigned NOT NULL DEFAULT 0 AFTER `tx_hash`;
+
+ALTER TABLE claimed_cota_nft_kv_pairs ADD COLUMN `tx_hash` char(64) NOT NULL DEFAULT '' AFTER `lock_hash_crc`,
+                                      ADD COLUMN `tx_index` int unsigned NOT NULL DEFAULT 0 AFTER `tx_hash`;
+
+ALTER TABLE define_cota_nft_kv_pair_versions ADD INDEX index_define_versions_on_cota_id(cota_id);
+ALTER TABLE hold_cota_nft_kv_pair_versions ADD INDEX index_hold_versions_on_cota_id_token_index(cota_id, token_index);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS cota_events;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS cota_events (
+    id bigint NOT NULL AUTO_INCREMENT,
+    block_number bigint unsigned NOT NULL,
+    tx_index int unsigned NOT NULL,
+    tx_hash char(64) NOT NULL,
+    source tinyint unsigned NOT NULL COMMENT '0-block syncer 1-metadata syncer',
+    event_type varchar(32) NOT NULL,
+    lock_hash char(64) NOT NULL,
+    counterparty_lock_hash char(64) NOT NULL DEFAULT '',
+    cota_id char(40) NOT NULL DEFAULT '',
+    token_index int unsigned DEFAULT NULL,
+    created_at datetime(6) NOT NULL,
+    updated_at datetime(6) NOT NULL,
+    PRIMARY KEY (id),
+    KEY index_events_on_block_number_source (block_number, source),
+    KEY index_events_on_lock_hash (lock_hash, block_number, tx_index),
+    KEY index_events_on_counterparty_lock_hash (counterparty_lock_hash, block_number, tx_index)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
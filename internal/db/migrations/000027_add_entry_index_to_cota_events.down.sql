@@ -0,0 +1,5 @@
+ALTER TABLE cota_events DROP INDEX uc_events_on_position;
+
+ALTER TABLE cota_events DROP COLUMN `action_code`,
+                        DROP COLUMN `event_index`,
+                        DROP COLUMN `entry_index`;
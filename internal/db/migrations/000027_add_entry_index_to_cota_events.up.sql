@@ -0,0 +1,10 @@
+ALTER TABLE cota_events ADD COLUMN `entry_index` int unsigned NOT NULL DEFAULT 0 AFTER `tx_hash`,
+                        ADD COLUMN `event_index` int unsigned NOT NULL DEFAULT 0 AFTER `entry_index`,
+                        ADD COLUMN `action_code` tinyint unsigned NOT NULL DEFAULT 0 COMMENT 'cota entry input type, 0 for registry and metadata events' AFTER `event_index`;
+
+-- events written before the entry index existed keep entry index 0 and are numbered in insertion order
+UPDATE cota_events e JOIN (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY block_number, tx_index, event_type ORDER BY id) - 1 AS idx FROM cota_events
+) r ON e.id = r.id SET e.event_index = r.idx;
+
+ALTER TABLE cota_events ADD CONSTRAINT uc_events_on_position UNIQUE (block_number, tx_index, entry_index, event_index, event_type);
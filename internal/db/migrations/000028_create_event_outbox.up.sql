@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS event_outbox (
+    id bigint NOT NULL AUTO_INCREMENT,
+    status varchar(16) NOT NULL COMMENT 'applied or reverted',
+    block_number bigint unsigned NOT NULL,
+    payload text NOT NULL,
+    created_at datetime(6) NOT NULL,
+    updated_at datetime(6) NOT NULL,
+    PRIMARY KEY (id),
+    KEY index_outbox_on_block_number (block_number)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS webhook_cursors (
+    id bigint NOT NULL AUTO_INCREMENT,
+    endpoint varchar(255) NOT NULL,
+    outbox_id bigint unsigned NOT NULL,
+    created_at datetime(6) NOT NULL,
+    updated_at datetime(6) NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT uc_webhook_cursors_on_endpoint UNIQUE (endpoint)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+    id bigint NOT NULL AUTO_INCREMENT,
+    endpoint varchar(255) NOT NULL,
+    outbox_id bigint unsigned NOT NULL,
+    payload text NOT NULL,
+    last_error text NOT NULL,
+    attempts int NOT NULL,
+    created_at datetime(6) NOT NULL,
+    updated_at datetime(6) NOT NULL,
+    PRIMARY KEY (id),
+    KEY index_dead_letters_on_endpoint (endpoint, outbox_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
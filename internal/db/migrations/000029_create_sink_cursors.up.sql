@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS sink_cursors (
+    id bigint NOT NULL AUTO_INCREMENT,
+    sink varchar(255) NOT NULL,
+    outbox_id bigint unsigned NOT NULL,
+    created_at datetime(6) NOT NULL,
+    updated_at datetime(6) NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT uc_sink_cursors_on_sink UNIQUE (sink)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS quarantined_entries (
+    id bigint NOT NULL AUTO_INCREMENT,
+    block_number bigint unsigned NOT NULL,
+    tx_index int unsigned NOT NULL,
+    tx_hash char(64) NOT NULL,
+    entry_index int unsigned NOT NULL DEFAULT 0,
+    source tinyint unsigned NOT NULL COMMENT '0-block syncer 1-metadata syncer',
+    action tinyint unsigned NOT NULL DEFAULT 0 COMMENT 'cota entry input type, 0 when the witness is malformed',
+    raw longtext NOT NULL,
+    reason text NOT NULL,
+    created_at datetime(6) NOT NULL,
+    updated_at datetime(6) NOT NULL,
+    PRIMARY KEY (id),
+    KEY index_quarantined_entries_on_block_number_source (block_number, source)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
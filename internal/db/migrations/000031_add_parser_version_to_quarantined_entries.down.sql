@@ -0,0 +1 @@
+ALTER TABLE quarantined_entries DROP COLUMN `parser_version`;
@@ -0,0 +1 @@
+ALTER TABLE quarantined_entries ADD COLUMN `parser_version` int unsigned NOT NULL DEFAULT 1 COMMENT 'version of the parser that rejected the entry' AFTER `reason`;
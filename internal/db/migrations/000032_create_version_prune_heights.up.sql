@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS version_prune_heights (
+    id bigint NOT NULL AUTO_INCREMENT,
+    check_type tinyint unsigned NOT NULL COMMENT '0-block syncer 1-metadata syncer',
+    block_number bigint unsigned NOT NULL COMMENT 'the version rows below the block are pruned',
+    created_at datetime(6) NOT NULL,
+    updated_at datetime(6) NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT uc_version_prune_heights_on_check_type UNIQUE (check_type)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS raw_metadata (
+    id bigint NOT NULL AUTO_INCREMENT,
+    block_number bigint unsigned NOT NULL,
+    tx_index int unsigned NOT NULL,
+    lock_hash char(64) NOT NULL,
+    meta_type varchar(255) NOT NULL COMMENT 'metadata.type of the unregistered CTMeta',
+    target varchar(255) NOT NULL,
+    data longtext NOT NULL COMMENT 'metadata.data as json',
+    created_at datetime(6) NOT NULL,
+    updated_at datetime(6) NOT NULL,
+    PRIMARY KEY (id),
+    KEY index_raw_metadata_on_block_number (block_number),
+    KEY index_raw_metadata_on_meta_type (meta_type)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
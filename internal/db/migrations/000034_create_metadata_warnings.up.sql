@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS metadata_warnings (
+    id bigint NOT NULL AUTO_INCREMENT,
+    block_number bigint unsigned NOT NULL,
+    tx_index int unsigned NOT NULL,
+    entry_index int unsigned NOT NULL,
+    lock_hash char(64) NOT NULL,
+    meta_type varchar(255) NOT NULL,
+    schema_id varchar(255) NOT NULL COMMENT '$id of the versioned json schema',
+    errors text NOT NULL COMMENT 'schema errors as a json array of path and message',
+    created_at datetime(6) NOT NULL,
+    updated_at datetime(6) NOT NULL,
+    PRIMARY KEY (id),
+    KEY index_metadata_warnings_on_block_number (block_number),
+    KEY index_metadata_warnings_on_lock_hash (lock_hash)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
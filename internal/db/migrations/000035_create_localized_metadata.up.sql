@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS localized_metadata (
+    id bigint NOT NULL AUTO_INCREMENT,
+    meta_type varchar(16) NOT NULL COMMENT 'issuer or cota',
+    meta_key varchar(64) NOT NULL COMMENT 'lock hash of the issuer or cota id of the class',
+    locale varchar(64) NOT NULL,
+    uri text NOT NULL COMMENT 'localization uri with the locale',
+    localization text NOT NULL COMMENT 'localization json of the info the document was fetched for',
+    name text NOT NULL,
+    description text NOT NULL,
+    fetch_error text NOT NULL,
+    created_at datetime(6) NOT NULL,
+    updated_at datetime(6) NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uc_localized_metadata_on_meta_type_and_meta_key_and_locale (meta_type, meta_key, locale)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
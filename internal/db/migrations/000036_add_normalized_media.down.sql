@@ -0,0 +1,12 @@
+ALTER TABLE class_infos
+    DROP COLUMN `image_normalized`,
+    DROP COLUMN `image_ref`,
+    DROP COLUMN `audio_normalized`,
+    DROP COLUMN `audio_ref`,
+    DROP COLUMN `video_normalized`,
+    DROP COLUMN `video_ref`,
+    DROP COLUMN `model_normalized`,
+    DROP COLUMN `model_ref`;
+ALTER TABLE token_class_audios
+    DROP COLUMN `url_normalized`,
+    DROP COLUMN `url_ref`;
@@ -0,0 +1,12 @@
+ALTER TABLE class_infos
+    ADD COLUMN `image_normalized` varchar(1000) NOT NULL DEFAULT '' COMMENT 'image url on the gateway' AFTER `localization`,
+    ADD COLUMN `image_ref` varchar(600) NOT NULL DEFAULT '' COMMENT 'ipfs:// or ar:// reference of the image' AFTER `image_normalized`,
+    ADD COLUMN `audio_normalized` varchar(1000) NOT NULL DEFAULT '' AFTER `image_ref`,
+    ADD COLUMN `audio_ref` varchar(600) NOT NULL DEFAULT '' AFTER `audio_normalized`,
+    ADD COLUMN `video_normalized` varchar(1000) NOT NULL DEFAULT '' AFTER `audio_ref`,
+    ADD COLUMN `video_ref` varchar(600) NOT NULL DEFAULT '' AFTER `video_normalized`,
+    ADD COLUMN `model_normalized` varchar(1000) NOT NULL DEFAULT '' AFTER `video_ref`,
+    ADD COLUMN `model_ref` varchar(600) NOT NULL DEFAULT '' AFTER `model_normalized`;
+ALTER TABLE token_class_audios
+    ADD COLUMN `url_normalized` varchar(1000) NOT NULL DEFAULT '' COMMENT 'audio url on the gateway' AFTER `url`,
+    ADD COLUMN `url_ref` varchar(600) NOT NULL DEFAULT '' COMMENT 'ipfs:// or ar:// reference of the audio' AFTER `url_normalized`;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS token_traits (
+    id bigint NOT NULL AUTO_INCREMENT,
+    cota_id char(40) NOT NULL,
+    token_index int unsigned NOT NULL,
+    trait_name varchar(255) NOT NULL COMMENT 'name of the trait in the characteristic of the class',
+    trait_value varchar(255) NOT NULL COMMENT 'value decoded from the characteristic of the token',
+    created_at datetime(6) NOT NULL,
+    updated_at datetime(6) NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uc_token_traits_on_cota_id_and_token_index_and_trait_name (cota_id, token_index, trait_name),
+    KEY index_token_traits_on_cota_id_and_trait_name_and_trait_value (cota_id, trait_name, trait_value)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS metadata_conflicts (
+    id bigint NOT NULL AUTO_INCREMENT,
+    block_number bigint unsigned NOT NULL,
+    tx_index int unsigned NOT NULL,
+    entry_index int unsigned NOT NULL,
+    lock_hash char(64) NOT NULL,
+    meta_type varchar(255) NOT NULL,
+    meta_key varchar(255) NOT NULL COMMENT 'lock hash of an issuer or joy_id, cota id of a class',
+    winner_tx_index int unsigned NOT NULL COMMENT 'tx index of the document applied instead',
+    winner_entry_index int unsigned NOT NULL COMMENT 'entry index of the document applied instead',
+    reason varchar(32) NOT NULL COMMENT 'same_tx or same_block',
+    data longtext NOT NULL COMMENT 'superseded metadata document',
+    created_at datetime(6) NOT NULL,
+    updated_at datetime(6) NOT NULL,
+    PRIMARY KEY (id),
+    KEY index_metadata_conflicts_on_block_number (block_number),
+    KEY index_metadata_conflicts_on_meta_type_and_meta_key (meta_type, meta_key)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
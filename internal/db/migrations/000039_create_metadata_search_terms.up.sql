@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS metadata_search_terms (
+    id bigint NOT NULL AUTO_INCREMENT,
+    meta_type varchar(32) NOT NULL COMMENT 'cota or issuer',
+    meta_key varchar(64) NOT NULL COMMENT 'cota id of a class or lock hash of an issuer',
+    term varchar(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL COMMENT 'lower case word of the name, symbol or description',
+    weight int NOT NULL COMMENT 'weight of the heaviest field the term is found in',
+    created_at datetime(6) NOT NULL,
+    updated_at datetime(6) NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uc_metadata_search_terms_on_meta_type_and_meta_key_and_term (meta_type, meta_key, term),
+    KEY index_metadata_search_terms_on_term (term)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
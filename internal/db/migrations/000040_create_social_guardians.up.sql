@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS social_guardians (
+    id bigint NOT NULL AUTO_INCREMENT,
+    block_number bigint unsigned NOT NULL,
+    lock_hash char(64) NOT NULL COMMENT 'lock hash of the account with the social recovery',
+    position int NOT NULL COMMENT 'index of the signer in the social entry',
+    signer text NOT NULL COMMENT 'serialized lock script of the signer',
+    signer_lock_hash varchar(64) NOT NULL COMMENT 'script hash of the signer, empty for a signer that is not hex',
+    created_at datetime(6) NOT NULL,
+    updated_at datetime(6) NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uc_social_guardians_on_lock_hash_and_position (lock_hash, position),
+    KEY index_social_guardians_on_signer_lock_hash_and_lock_hash (signer_lock_hash, lock_hash)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
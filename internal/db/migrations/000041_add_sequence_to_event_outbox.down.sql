@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS outbox_sequencers;
+ALTER TABLE event_outbox DROP INDEX uc_outbox_on_sequence_number;
+ALTER TABLE event_outbox DROP COLUMN `sequence_number`;
@@ -0,0 +1,12 @@
+ALTER TABLE event_outbox ADD COLUMN `sequence_number` bigint unsigned DEFAULT NULL COMMENT 'delivery order, allocated after the row is committed' AFTER `id`;
+ALTER TABLE event_outbox ADD CONSTRAINT uc_outbox_on_sequence_number UNIQUE (sequence_number);
+UPDATE event_outbox SET sequence_number = id;
+
+CREATE TABLE IF NOT EXISTS outbox_sequencers (
+    id bigint NOT NULL,
+    last_sequence bigint unsigned NOT NULL COMMENT 'last sequence number allocated to the outbox',
+    created_at datetime(6) NOT NULL,
+    updated_at datetime(6) NOT NULL,
+    PRIMARY KEY (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+INSERT INTO outbox_sequencers (id, last_sequence, created_at, updated_at) SELECT 1, COALESCE(MAX(id), 0), NOW(6), NOW(6) FROM event_outbox;
@@ -0,0 +1,3 @@
+-- run `syncer search rebuild` to fill metadata_search_terms again
+ALTER TABLE issuer_infos DROP INDEX ft_issuer_infos_on_name_and_description;
+ALTER TABLE class_infos DROP INDEX ft_class_infos_on_name_and_symbol_and_description;
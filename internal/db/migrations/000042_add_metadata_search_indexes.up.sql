@@ -0,0 +1,8 @@
+-- the ngram parser also splits text written without spaces. The stopwords are turned off while the
+-- indexes are created, with the English list the parser drops every token containing one, like a.
+SET SESSION innodb_ft_enable_stopword = OFF;
+ALTER TABLE class_infos ADD FULLTEXT INDEX ft_class_infos_on_name_and_symbol_and_description (`name`, symbol, description) WITH PARSER ngram;
+ALTER TABLE issuer_infos ADD FULLTEXT INDEX ft_issuer_infos_on_name_and_description (`name`, description) WITH PARSER ngram;
+SET SESSION innodb_ft_enable_stopword = ON;
+-- the FULLTEXT indexes replace the search terms, which are only kept on sqlite
+DELETE FROM metadata_search_terms;
@@ -0,0 +1,29 @@
+DROP TABLE IF EXISTS check_infos;
+DROP TABLE IF EXISTS register_cota_kv_pairs;
+DROP TABLE IF EXISTS define_cota_nft_kv_pairs;
+DROP TABLE IF EXISTS define_cota_nft_kv_pair_versions;
+DROP TABLE IF EXISTS hold_cota_nft_kv_pairs;
+DROP TABLE IF EXISTS hold_cota_nft_kv_pair_versions;
+DROP TABLE IF EXISTS withdraw_cota_nft_kv_pairs;
+DROP TABLE IF EXISTS claimed_cota_nft_kv_pairs;
+DROP TABLE IF EXISTS scripts;
+DROP TABLE IF EXISTS issuer_infos;
+DROP TABLE IF EXISTS class_infos;
+DROP TABLE IF EXISTS issuer_info_versions;
+DROP TABLE IF EXISTS class_info_versions;
+DROP TABLE IF EXISTS joy_id_infos;
+DROP TABLE IF EXISTS joy_id_info_versions;
+DROP TABLE IF EXISTS sub_key_infos;
+DROP TABLE IF EXISTS sub_key_info_versions;
+DROP TABLE IF EXISTS extension_kv_pairs;
+DROP TABLE IF EXISTS extension_kv_pair_versions;
+DROP TABLE IF EXISTS sub_key_kv_pairs;
+DROP TABLE IF EXISTS sub_key_kv_pair_versions;
+DROP TABLE IF EXISTS social_kv_pairs;
+DROP TABLE IF EXISTS social_kv_pair_versions;
+DROP TABLE IF EXISTS token_class_audios;
+DROP TABLE IF EXISTS cota_events;
+DROP TABLE IF EXISTS event_outbox;
+DROP TABLE IF EXISTS webhook_cursors;
+DROP TABLE IF EXISTS webhook_dead_letters;
+DROP TABLE IF EXISTS sink_cursors;
@@ -0,0 +1,15 @@
+-- source: 0-block syncer 1-metadata syncer, action: cota entry input type, 0 when the witness is malformed
+CREATE TABLE IF NOT EXISTS quarantined_entries (
+    id bigserial PRIMARY KEY,
+    block_number bigint NOT NULL,
+    tx_index bigint NOT NULL,
+    tx_hash varchar(64) NOT NULL,
+    entry_index bigint NOT NULL DEFAULT 0,
+    source smallint NOT NULL,
+    action smallint NOT NULL DEFAULT 0,
+    raw text NOT NULL,
+    reason text NOT NULL,
+    created_at timestamp(6) NOT NULL,
+    updated_at timestamp(6) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_quarantined_entries_on_block_number_source ON quarantined_entries (block_number, source);
@@ -0,0 +1,15 @@
+-- schema_id: $id of the versioned json schema, errors: schema errors as a json array of path and message
+CREATE TABLE IF NOT EXISTS metadata_warnings (
+    id bigserial PRIMARY KEY,
+    block_number bigint NOT NULL,
+    tx_index bigint NOT NULL,
+    entry_index bigint NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    meta_type varchar(255) NOT NULL,
+    schema_id varchar(255) NOT NULL,
+    errors text NOT NULL,
+    created_at timestamp(6) NOT NULL,
+    updated_at timestamp(6) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_metadata_warnings_on_block_number ON metadata_warnings (block_number);
+CREATE INDEX IF NOT EXISTS index_metadata_warnings_on_lock_hash ON metadata_warnings (lock_hash);
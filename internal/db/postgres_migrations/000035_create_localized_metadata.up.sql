@@ -0,0 +1,15 @@
+-- meta_key: lock hash of the issuer or cota id of the class, localization: localization json of the info the document was fetched for
+CREATE TABLE IF NOT EXISTS localized_metadata (
+    id bigserial PRIMARY KEY,
+    meta_type varchar(16) NOT NULL,
+    meta_key varchar(64) NOT NULL,
+    locale varchar(64) NOT NULL,
+    uri text NOT NULL,
+    localization text NOT NULL,
+    name text NOT NULL,
+    description text NOT NULL,
+    fetch_error text NOT NULL,
+    created_at timestamp(6) NOT NULL,
+    updated_at timestamp(6) NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uc_localized_metadata_on_meta_type_and_meta_key_and_locale ON localized_metadata (meta_type, meta_key, locale);
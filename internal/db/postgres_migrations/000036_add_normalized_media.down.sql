@@ -0,0 +1,10 @@
+ALTER TABLE class_infos DROP COLUMN image_normalized;
+ALTER TABLE class_infos DROP COLUMN image_ref;
+ALTER TABLE class_infos DROP COLUMN audio_normalized;
+ALTER TABLE class_infos DROP COLUMN audio_ref;
+ALTER TABLE class_infos DROP COLUMN video_normalized;
+ALTER TABLE class_infos DROP COLUMN video_ref;
+ALTER TABLE class_infos DROP COLUMN model_normalized;
+ALTER TABLE class_infos DROP COLUMN model_ref;
+ALTER TABLE token_class_audios DROP COLUMN url_normalized;
+ALTER TABLE token_class_audios DROP COLUMN url_ref;
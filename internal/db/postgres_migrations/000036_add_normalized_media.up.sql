@@ -0,0 +1,11 @@
+-- <media>_normalized: media url on the gateway, <media>_ref: ipfs:// or ar:// reference of the media
+ALTER TABLE class_infos ADD COLUMN image_normalized text NOT NULL DEFAULT '';
+ALTER TABLE class_infos ADD COLUMN image_ref text NOT NULL DEFAULT '';
+ALTER TABLE class_infos ADD COLUMN audio_normalized text NOT NULL DEFAULT '';
+ALTER TABLE class_infos ADD COLUMN audio_ref text NOT NULL DEFAULT '';
+ALTER TABLE class_infos ADD COLUMN video_normalized text NOT NULL DEFAULT '';
+ALTER TABLE class_infos ADD COLUMN video_ref text NOT NULL DEFAULT '';
+ALTER TABLE class_infos ADD COLUMN model_normalized text NOT NULL DEFAULT '';
+ALTER TABLE class_infos ADD COLUMN model_ref text NOT NULL DEFAULT '';
+ALTER TABLE token_class_audios ADD COLUMN url_normalized text NOT NULL DEFAULT '';
+ALTER TABLE token_class_audios ADD COLUMN url_ref text NOT NULL DEFAULT '';
@@ -0,0 +1,12 @@
+-- trait_name: name of the trait in the characteristic of the class, trait_value: value decoded from the characteristic of the token
+CREATE TABLE IF NOT EXISTS token_traits (
+    id bigserial PRIMARY KEY,
+    cota_id varchar(40) NOT NULL,
+    token_index bigint NOT NULL,
+    trait_name varchar(255) NOT NULL,
+    trait_value varchar(255) NOT NULL,
+    created_at timestamp(6) NOT NULL,
+    updated_at timestamp(6) NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uc_token_traits_on_cota_id_and_token_index_and_trait_name ON token_traits (cota_id, token_index, trait_name);
+CREATE INDEX IF NOT EXISTS index_token_traits_on_cota_id_and_trait_name_and_trait_value ON token_traits (cota_id, trait_name, trait_value);
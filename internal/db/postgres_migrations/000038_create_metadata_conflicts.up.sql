@@ -0,0 +1,19 @@
+-- meta_key: lock hash of an issuer or joy_id, cota id of a class, winner_tx_index and winner_entry_index: document applied instead,
+-- reason: same_tx or same_block, data: superseded metadata document
+CREATE TABLE IF NOT EXISTS metadata_conflicts (
+    id bigserial PRIMARY KEY,
+    block_number bigint NOT NULL,
+    tx_index bigint NOT NULL,
+    entry_index bigint NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    meta_type varchar(255) NOT NULL,
+    meta_key varchar(255) NOT NULL,
+    winner_tx_index bigint NOT NULL,
+    winner_entry_index bigint NOT NULL,
+    reason varchar(32) NOT NULL,
+    data text NOT NULL,
+    created_at timestamp(6) NOT NULL,
+    updated_at timestamp(6) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_metadata_conflicts_on_block_number ON metadata_conflicts (block_number);
+CREATE INDEX IF NOT EXISTS index_metadata_conflicts_on_meta_type_and_meta_key ON metadata_conflicts (meta_type, meta_key);
@@ -0,0 +1,14 @@
+-- lock_hash: lock hash of the account with the social recovery, position: index of the signer in the social entry,
+-- signer: serialized lock script of the signer, signer_lock_hash: script hash of the signer, empty for a signer that is not hex
+CREATE TABLE IF NOT EXISTS social_guardians (
+    id bigserial PRIMARY KEY,
+    block_number bigint NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    position integer NOT NULL,
+    signer text NOT NULL,
+    signer_lock_hash varchar(64) NOT NULL,
+    created_at timestamp(6) NOT NULL,
+    updated_at timestamp(6) NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uc_social_guardians_on_lock_hash_and_position ON social_guardians (lock_hash, position);
+CREATE INDEX IF NOT EXISTS index_social_guardians_on_signer_lock_hash_and_lock_hash ON social_guardians (signer_lock_hash, lock_hash);
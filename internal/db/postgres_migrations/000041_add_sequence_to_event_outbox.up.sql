@@ -0,0 +1,13 @@
+-- sequence_number: delivery order, allocated after the row is committed
+ALTER TABLE event_outbox ADD COLUMN sequence_number bigint DEFAULT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS uc_outbox_on_sequence_number ON event_outbox (sequence_number);
+UPDATE event_outbox SET sequence_number = id;
+
+-- last_sequence: last sequence number allocated to the outbox
+CREATE TABLE IF NOT EXISTS outbox_sequencers (
+    id bigint PRIMARY KEY,
+    last_sequence bigint NOT NULL,
+    created_at timestamp(6) NOT NULL,
+    updated_at timestamp(6) NOT NULL
+);
+INSERT INTO outbox_sequencers (id, last_sequence, created_at, updated_at) SELECT 1, COALESCE(MAX(id), 0), now(), now() FROM event_outbox;
@@ -0,0 +1,5 @@
+-- run `syncer search rebuild` to fill metadata_search_terms again
+DROP INDEX IF EXISTS index_issuer_infos_on_search_vector;
+ALTER TABLE issuer_infos DROP COLUMN IF EXISTS search_vector;
+DROP INDEX IF EXISTS index_class_infos_on_search_vector;
+ALTER TABLE class_infos DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,12 @@
+-- search_vector: words of the name weighted A, of the symbol B and of the description D. The simple
+-- configuration neither stems words nor drops stopwords.
+ALTER TABLE class_infos ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', name), 'A') || setweight(to_tsvector('simple', symbol), 'B') || setweight(to_tsvector('simple', description), 'D')
+) STORED;
+CREATE INDEX IF NOT EXISTS index_class_infos_on_search_vector ON class_infos USING GIN (search_vector);
+ALTER TABLE issuer_infos ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', name), 'A') || setweight(to_tsvector('simple', description), 'D')
+) STORED;
+CREATE INDEX IF NOT EXISTS index_issuer_infos_on_search_vector ON issuer_infos USING GIN (search_vector);
+-- the tsvector indexes replace the search terms, which are only kept on sqlite
+DELETE FROM metadata_search_terms;
@@ -0,0 +1,525 @@
+-- SQLite schema equal to the MySQL migrations up to 000029. Later migrations keep the same
+-- version number in every migration directory. The cota cell id is a text column because SQLite
+-- integers are signed 64 bits.
+
+CREATE TABLE IF NOT EXISTS check_infos (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    check_type smallint NOT NULL,
+    block_number bigint NOT NULL,
+    block_hash varchar(64) NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_check_infos_on_block_number ON check_infos (block_number);
+CREATE INDEX IF NOT EXISTS index_check_type_block_number ON check_infos (check_type, block_number DESC);
+
+CREATE TABLE IF NOT EXISTS register_cota_kv_pairs (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    block_number bigint NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    lock_script_id bigint NOT NULL DEFAULT 3094967296,
+    cota_cell_id text NOT NULL DEFAULT '18446744073709551615',
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL,
+    CONSTRAINT uc_register_on_lock_hash UNIQUE (lock_hash)
+);
+CREATE INDEX IF NOT EXISTS index_register_on_block_number ON register_cota_kv_pairs (block_number);
+
+CREATE TABLE IF NOT EXISTS define_cota_nft_kv_pairs (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    block_number bigint NOT NULL,
+    cota_id varchar(40) NOT NULL,
+    total bigint NOT NULL,
+    issued bigint NOT NULL,
+    configure smallint NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    lock_hash_crc bigint NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL,
+    CONSTRAINT uc_define_on_cota_id UNIQUE (cota_id)
+);
+CREATE INDEX IF NOT EXISTS index_define_on_block_number ON define_cota_nft_kv_pairs (block_number);
+CREATE INDEX IF NOT EXISTS index_define_on_lock_hash_crc ON define_cota_nft_kv_pairs (lock_hash_crc);
+
+CREATE TABLE IF NOT EXISTS define_cota_nft_kv_pair_versions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    old_block_number bigint NOT NULL,
+    block_number bigint NOT NULL,
+    cota_id varchar(40) NOT NULL,
+    total bigint NOT NULL,
+    old_issued bigint NOT NULL,
+    issued bigint NOT NULL,
+    configure smallint NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    action_type smallint NOT NULL,
+    tx_index bigint NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_define_versions_on_block_number ON define_cota_nft_kv_pair_versions (block_number, action_type);
+CREATE INDEX IF NOT EXISTS index_define_versions_on_cota_id ON define_cota_nft_kv_pair_versions (cota_id);
+
+CREATE TABLE IF NOT EXISTS hold_cota_nft_kv_pairs (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    block_number bigint NOT NULL,
+    cota_id varchar(40) NOT NULL,
+    token_index bigint NOT NULL,
+    state smallint NOT NULL,
+    configure smallint NOT NULL,
+    characteristic varchar(40) NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    lock_hash_crc bigint NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL,
+    CONSTRAINT uc_hold_on_cota_id_and_token_index UNIQUE (cota_id, token_index)
+);
+CREATE INDEX IF NOT EXISTS index_hold_on_block_number ON hold_cota_nft_kv_pairs (block_number);
+CREATE INDEX IF NOT EXISTS index_hold_on_lock_hash_crc ON hold_cota_nft_kv_pairs (lock_hash_crc);
+
+CREATE TABLE IF NOT EXISTS hold_cota_nft_kv_pair_versions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    old_block_number bigint NOT NULL,
+    block_number bigint NOT NULL,
+    cota_id varchar(40) NOT NULL,
+    token_index bigint NOT NULL,
+    old_state smallint NOT NULL,
+    state smallint NOT NULL,
+    configure smallint NOT NULL,
+    old_characteristic varchar(40) NOT NULL,
+    characteristic varchar(40) NOT NULL,
+    old_lock_hash varchar(64) NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    action_type smallint NOT NULL,
+    tx_index bigint NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_hold_versions_on_block_number ON hold_cota_nft_kv_pair_versions (block_number, action_type);
+CREATE INDEX IF NOT EXISTS index_hold_versions_on_cota_id_token_index ON hold_cota_nft_kv_pair_versions (cota_id, token_index);
+
+CREATE TABLE IF NOT EXISTS withdraw_cota_nft_kv_pairs (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    block_number bigint NOT NULL,
+    cota_id varchar(40) NOT NULL,
+    cota_id_crc bigint NOT NULL,
+    token_index bigint NOT NULL,
+    out_point varchar(72) NOT NULL,
+    out_point_crc bigint NOT NULL,
+    tx_hash varchar(64) NOT NULL,
+    tx_index bigint NOT NULL DEFAULT 0,
+    state smallint NOT NULL,
+    configure smallint NOT NULL,
+    characteristic varchar(40) NOT NULL,
+    receiver_lock_script_id bigint NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    lock_hash_crc bigint NOT NULL,
+    lock_script_id bigint NOT NULL DEFAULT 3094967296,
+    version smallint NOT NULL DEFAULT 0,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_withdraw_on_block_number ON withdraw_cota_nft_kv_pairs (block_number);
+CREATE INDEX IF NOT EXISTS index_withdraw_on_cota_id_crc_token_index ON withdraw_cota_nft_kv_pairs (cota_id_crc, token_index);
+CREATE INDEX IF NOT EXISTS index_withdraw_on_lock_script_id ON withdraw_cota_nft_kv_pairs (receiver_lock_script_id);
+CREATE INDEX IF NOT EXISTS index_withdraw_on_out_point_crc ON withdraw_cota_nft_kv_pairs (out_point_crc);
+CREATE INDEX IF NOT EXISTS index_withdraw_on_lock_hash_crc ON withdraw_cota_nft_kv_pairs (lock_hash_crc);
+
+CREATE TABLE IF NOT EXISTS claimed_cota_nft_kv_pairs (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    block_number bigint NOT NULL,
+    cota_id varchar(40) NOT NULL,
+    cota_id_crc bigint NOT NULL,
+    token_index bigint NOT NULL,
+    out_point varchar(72) NOT NULL,
+    out_point_crc bigint NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    lock_hash_crc bigint NOT NULL,
+    tx_hash varchar(64) NOT NULL DEFAULT '',
+    tx_index bigint NOT NULL DEFAULT 0,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_claimed_on_block_number ON claimed_cota_nft_kv_pairs (block_number);
+CREATE INDEX IF NOT EXISTS index_claimed_on_cota_id_crc_token_index ON claimed_cota_nft_kv_pairs (cota_id_crc, token_index);
+CREATE INDEX IF NOT EXISTS index_claimed_on_out_point_crc ON claimed_cota_nft_kv_pairs (out_point_crc);
+CREATE INDEX IF NOT EXISTS index_claimed_on_lock_hash_crc ON claimed_cota_nft_kv_pairs (lock_hash_crc);
+
+CREATE TABLE IF NOT EXISTS scripts (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    code_hash varchar(64) NOT NULL,
+    code_hash_crc bigint NOT NULL,
+    hash_type smallint NOT NULL,
+    args text NOT NULL,
+    args_crc bigint NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_script_on_script_identifier ON scripts (code_hash_crc, hash_type, args_crc);
+
+CREATE TABLE IF NOT EXISTS issuer_infos (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    block_number bigint NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    version varchar(40) NOT NULL,
+    name varchar(255) NOT NULL,
+    avatar varchar(500) NOT NULL,
+    description varchar(1000) NOT NULL,
+    localization varchar(1000) NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL,
+    CONSTRAINT uc_issuer_infos_on_lock_hash UNIQUE (lock_hash)
+);
+CREATE INDEX IF NOT EXISTS index_issuer_infos_on_block_number ON issuer_infos (block_number);
+
+CREATE TABLE IF NOT EXISTS class_infos (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    block_number bigint NOT NULL,
+    cota_id varchar(40) NOT NULL,
+    version varchar(40) NOT NULL,
+    name varchar(255) NOT NULL,
+    symbol varchar(255) NOT NULL,
+    description varchar(1000) NOT NULL,
+    image varchar(500) NOT NULL,
+    audio varchar(500) NOT NULL,
+    video varchar(500) NOT NULL,
+    model varchar(500) NOT NULL,
+    characteristic varchar(1000) NOT NULL,
+    properties varchar(1000) NOT NULL,
+    localization varchar(1000) NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL,
+    CONSTRAINT uc_class_infos_on_cota_id UNIQUE (cota_id)
+);
+CREATE INDEX IF NOT EXISTS index_class_infos_on_block_number ON class_infos (block_number);
+
+CREATE TABLE IF NOT EXISTS issuer_info_versions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    old_block_number bigint NOT NULL,
+    block_number bigint NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    old_version varchar(40) NOT NULL,
+    version varchar(40) NOT NULL,
+    old_name varchar(255) NOT NULL,
+    name varchar(255) NOT NULL,
+    old_avatar varchar(500) NOT NULL,
+    avatar varchar(500) NOT NULL,
+    old_description varchar(1000) NOT NULL,
+    description varchar(1000) NOT NULL,
+    old_localization varchar(1000) NOT NULL,
+    localization varchar(1000) NOT NULL,
+    action_type smallint NOT NULL,
+    tx_index bigint NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_issuer_versions_on_block_number ON issuer_info_versions (block_number, action_type);
+
+CREATE TABLE IF NOT EXISTS class_info_versions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    old_block_number bigint NOT NULL,
+    block_number bigint NOT NULL,
+    cota_id varchar(40) NOT NULL,
+    old_version varchar(40) NOT NULL,
+    version varchar(40) NOT NULL,
+    old_name varchar(255) NOT NULL,
+    name varchar(255) NOT NULL,
+    old_symbol varchar(255) NOT NULL,
+    symbol varchar(255) NOT NULL,
+    old_description varchar(1000) NOT NULL,
+    description varchar(1000) NOT NULL,
+    old_image varchar(500) NOT NULL,
+    image varchar(500) NOT NULL,
+    old_audio varchar(500) NOT NULL,
+    audio varchar(500) NOT NULL,
+    old_video varchar(500) NOT NULL,
+    video varchar(500) NOT NULL,
+    old_model varchar(500) NOT NULL,
+    model varchar(500) NOT NULL,
+    old_characteristic varchar(1000) NOT NULL,
+    characteristic varchar(1000) NOT NULL,
+    old_properties varchar(1000) NOT NULL,
+    properties varchar(1000) NOT NULL,
+    old_localization varchar(1000) NOT NULL,
+    localization varchar(1000) NOT NULL,
+    action_type smallint NOT NULL,
+    tx_index bigint NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_class_versions_on_block_number ON class_info_versions (block_number, action_type);
+
+CREATE TABLE IF NOT EXISTS joy_id_infos (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    block_number bigint NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    version varchar(40) NOT NULL,
+    name varchar(255) NOT NULL,
+    avatar varchar(500) NOT NULL,
+    description varchar(1000) NOT NULL,
+    extension varchar(1000) NOT NULL,
+    pub_key varchar(128) NOT NULL,
+    credential_id varchar(1500) NOT NULL DEFAULT '',
+    alg varchar(2) NOT NULL,
+    front_end varchar(255) NOT NULL,
+    device_name varchar(255) NOT NULL,
+    device_type varchar(255) NOT NULL,
+    cota_cell_id varchar(16) NOT NULL,
+    derivation_c_id varchar(1500) NOT NULL DEFAULT '',
+    derivation_commitment varchar(64) NOT NULL DEFAULT '',
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL,
+    CONSTRAINT uc_joy_id_infos_on_lock_hash UNIQUE (lock_hash)
+);
+CREATE INDEX IF NOT EXISTS index_joy_id_infos_on_block_number ON joy_id_infos (block_number);
+
+CREATE TABLE IF NOT EXISTS joy_id_info_versions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    old_block_number bigint NOT NULL,
+    block_number bigint NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    old_version varchar(40) NOT NULL,
+    version varchar(40) NOT NULL,
+    old_name varchar(255) NOT NULL,
+    name varchar(255) NOT NULL,
+    old_avatar varchar(500) NOT NULL,
+    avatar varchar(500) NOT NULL,
+    old_description varchar(1000) NOT NULL,
+    description varchar(1000) NOT NULL,
+    old_extension varchar(1000) NOT NULL,
+    extension varchar(1000) NOT NULL,
+    pub_key varchar(128) NOT NULL,
+    credential_id varchar(1500) NOT NULL DEFAULT '',
+    alg varchar(2) NOT NULL,
+    old_front_end varchar(255) NOT NULL,
+    front_end varchar(255) NOT NULL,
+    old_device_name varchar(255) NOT NULL,
+    device_name varchar(255) NOT NULL,
+    old_device_type varchar(255) NOT NULL,
+    device_type varchar(255) NOT NULL,
+    derivation_c_id varchar(1500) NOT NULL DEFAULT '',
+    old_derivation_c_id varchar(1500) NOT NULL DEFAULT '',
+    derivation_commitment varchar(64) NOT NULL DEFAULT '',
+    old_derivation_commitment varchar(64) NOT NULL DEFAULT '',
+    cota_cell_id varchar(16) NOT NULL,
+    action_type smallint NOT NULL,
+    tx_index bigint NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_joy_id_versions_on_block_number ON joy_id_info_versions (block_number, action_type);
+
+CREATE TABLE IF NOT EXISTS sub_key_infos (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    block_number bigint NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    pub_key varchar(128) NOT NULL,
+    credential_id varchar(1500) NOT NULL DEFAULT '',
+    alg varchar(2) NOT NULL,
+    front_end varchar(255) NOT NULL,
+    device_name varchar(255) NOT NULL,
+    device_type varchar(255) NOT NULL,
+    derivation_c_id varchar(1500) NOT NULL DEFAULT '',
+    derivation_commitment varchar(64) NOT NULL DEFAULT '',
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_sub_key_infos_on_block_number ON sub_key_infos (block_number);
+CREATE INDEX IF NOT EXISTS idx_sub_key_infos_on_lock_hash ON sub_key_infos (lock_hash);
+
+CREATE TABLE IF NOT EXISTS sub_key_info_versions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    old_block_number bigint NOT NULL,
+    block_number bigint NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    pub_key varchar(128) NOT NULL,
+    credential_id varchar(1500) NOT NULL,
+    alg varchar(2) NOT NULL,
+    old_front_end varchar(255) NOT NULL,
+    front_end varchar(255) NOT NULL,
+    old_device_name varchar(255) NOT NULL,
+    device_name varchar(255) NOT NULL,
+    old_device_type varchar(255) NOT NULL,
+    device_type varchar(255) NOT NULL,
+    derivation_c_id varchar(1500) NOT NULL DEFAULT '',
+    old_derivation_c_id varchar(1500) NOT NULL DEFAULT '',
+    derivation_commitment varchar(64) NOT NULL DEFAULT '',
+    old_derivation_commitment varchar(64) NOT NULL DEFAULT '',
+    action_type smallint NOT NULL,
+    tx_index bigint NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_subkey_info_versions_on_block_number ON sub_key_info_versions (block_number, action_type);
+
+CREATE TABLE IF NOT EXISTS extension_kv_pairs (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    block_number bigint NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    lock_hash_crc bigint NOT NULL,
+    "key" varchar(64) NOT NULL,
+    "value" varchar(64) NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL,
+    CONSTRAINT uc_extension_pairs_on_key_and_lock_hash UNIQUE ("key", lock_hash)
+);
+CREATE INDEX IF NOT EXISTS index_extension_on_block_number ON extension_kv_pairs (block_number);
+CREATE INDEX IF NOT EXISTS index_extension_on_lock_hash_crc ON extension_kv_pairs (lock_hash_crc);
+
+CREATE TABLE IF NOT EXISTS extension_kv_pair_versions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    old_block_number bigint NOT NULL,
+    block_number bigint NOT NULL,
+    "key" varchar(64) NOT NULL,
+    "value" varchar(64) NOT NULL,
+    old_value varchar(64) NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    action_type smallint NOT NULL,
+    tx_index bigint NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_extension_versions_on_block_number ON extension_kv_pair_versions (block_number, action_type);
+
+CREATE TABLE IF NOT EXISTS sub_key_kv_pairs (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    block_number bigint NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    sub_type varchar(6) NOT NULL,
+    ext_data bigint NOT NULL,
+    alg_index bigint NOT NULL,
+    pubkey_hash varchar(40) NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL,
+    CONSTRAINT uc_sub_key_kv_pairs_on_lock_hash_ext_data UNIQUE (lock_hash, ext_data)
+);
+CREATE INDEX IF NOT EXISTS index_sub_key_kv_pairs_on_lock_hash ON sub_key_kv_pairs (lock_hash);
+CREATE INDEX IF NOT EXISTS index_sub_key_kv_pairs_on_block_number ON sub_key_kv_pairs (block_number);
+
+CREATE TABLE IF NOT EXISTS sub_key_kv_pair_versions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    old_block_number bigint NOT NULL,
+    block_number bigint NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    sub_type varchar(6) NOT NULL,
+    ext_data bigint NOT NULL,
+    old_alg_index bigint NOT NULL,
+    alg_index bigint NOT NULL,
+    old_pubkey_hash varchar(40) NOT NULL,
+    pubkey_hash varchar(40) NOT NULL,
+    action_type smallint NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_sub_key_kv_pair_versions_on_block_number ON sub_key_kv_pair_versions (block_number);
+
+CREATE TABLE IF NOT EXISTS social_kv_pairs (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    block_number bigint NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    lock_hash_crc bigint NOT NULL,
+    recovery_mode smallint NOT NULL,
+    must smallint NOT NULL,
+    total smallint NOT NULL,
+    signers text NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL,
+    CONSTRAINT uc_social_on_lock_hash UNIQUE (lock_hash)
+);
+CREATE INDEX IF NOT EXISTS index_social_on_lock_hash_crc ON social_kv_pairs (lock_hash_crc);
+CREATE INDEX IF NOT EXISTS index_social_on_block_number ON social_kv_pairs (block_number);
+
+-- index names are schema wide in SQLite, so the versions index gets its own name
+CREATE TABLE IF NOT EXISTS social_kv_pair_versions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    old_block_number bigint NOT NULL,
+    block_number bigint NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    old_recovery_mode smallint NOT NULL,
+    recovery_mode smallint NOT NULL,
+    old_must smallint NOT NULL,
+    must smallint NOT NULL,
+    old_total smallint NOT NULL,
+    total smallint NOT NULL,
+    old_signers text NOT NULL,
+    signers text NOT NULL,
+    action_type smallint NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_social_versions_on_block_number ON social_kv_pair_versions (block_number);
+
+CREATE TABLE IF NOT EXISTS token_class_audios (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    cota_id varchar(40) NOT NULL,
+    url varchar(255) NOT NULL DEFAULT '',
+    name varchar(255) NOT NULL DEFAULT '',
+    idx bigint NOT NULL DEFAULT 0,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL,
+    CONSTRAINT uc_cota_id_idx_on_class_audios UNIQUE (cota_id, idx)
+);
+
+-- source: 0-block syncer 1-metadata syncer, action_code: cota entry input type, 0 for registry and metadata events
+CREATE TABLE IF NOT EXISTS cota_events (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    block_number bigint NOT NULL,
+    tx_index bigint NOT NULL,
+    tx_hash varchar(64) NOT NULL,
+    entry_index bigint NOT NULL DEFAULT 0,
+    event_index bigint NOT NULL DEFAULT 0,
+    action_code smallint NOT NULL DEFAULT 0,
+    source smallint NOT NULL,
+    event_type varchar(32) NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    counterparty_lock_hash varchar(64) NOT NULL DEFAULT '',
+    cota_id varchar(40) NOT NULL DEFAULT '',
+    token_index bigint DEFAULT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL,
+    CONSTRAINT uc_events_on_position UNIQUE (block_number, tx_index, entry_index, event_index, event_type)
+);
+CREATE INDEX IF NOT EXISTS index_events_on_block_number_source ON cota_events (block_number, source);
+CREATE INDEX IF NOT EXISTS index_events_on_lock_hash ON cota_events (lock_hash, block_number, tx_index);
+CREATE INDEX IF NOT EXISTS index_events_on_counterparty_lock_hash ON cota_events (counterparty_lock_hash, block_number, tx_index);
+
+-- status: applied or reverted
+CREATE TABLE IF NOT EXISTS event_outbox (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    status varchar(16) NOT NULL,
+    block_number bigint NOT NULL,
+    payload text NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_outbox_on_block_number ON event_outbox (block_number);
+
+CREATE TABLE IF NOT EXISTS webhook_cursors (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    endpoint varchar(255) NOT NULL,
+    outbox_id bigint NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL,
+    CONSTRAINT uc_webhook_cursors_on_endpoint UNIQUE (endpoint)
+);
+
+CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    endpoint varchar(255) NOT NULL,
+    outbox_id bigint NOT NULL,
+    payload text NOT NULL,
+    last_error text NOT NULL,
+    attempts int NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_dead_letters_on_endpoint ON webhook_dead_letters (endpoint, outbox_id);
+
+CREATE TABLE IF NOT EXISTS sink_cursors (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    sink varchar(255) NOT NULL,
+    outbox_id bigint NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL,
+    CONSTRAINT uc_sink_cursors_on_sink UNIQUE (sink)
+);
+
@@ -0,0 +1,2 @@
+-- parser_version: version of the parser that rejected the entry
+ALTER TABLE quarantined_entries ADD COLUMN parser_version bigint NOT NULL DEFAULT 1;
@@ -0,0 +1,9 @@
+-- check_type: 0-block syncer 1-metadata syncer, block_number: the version rows below the block are pruned
+CREATE TABLE IF NOT EXISTS version_prune_heights (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    check_type smallint NOT NULL,
+    block_number bigint NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL,
+    CONSTRAINT uc_version_prune_heights_on_check_type UNIQUE (check_type)
+);
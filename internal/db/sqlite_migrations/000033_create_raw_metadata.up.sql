@@ -0,0 +1,14 @@
+-- meta_type: metadata.type of the unregistered CTMeta, data: metadata.data as json
+CREATE TABLE IF NOT EXISTS raw_metadata (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    block_number bigint NOT NULL,
+    tx_index bigint NOT NULL,
+    lock_hash varchar(64) NOT NULL,
+    meta_type varchar(255) NOT NULL,
+    target varchar(255) NOT NULL,
+    data text NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_raw_metadata_on_block_number ON raw_metadata (block_number);
+CREATE INDEX IF NOT EXISTS index_raw_metadata_on_meta_type ON raw_metadata (meta_type);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS localized_metadata;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS metadata_search_terms;
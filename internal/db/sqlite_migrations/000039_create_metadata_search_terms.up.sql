@@ -0,0 +1,13 @@
+-- meta_type: cota or issuer, meta_key: cota id of a class or lock hash of an issuer,
+-- term: lower case word of the name, symbol or description, weight: weight of the heaviest field the term is found in
+CREATE TABLE IF NOT EXISTS metadata_search_terms (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    meta_type varchar(32) NOT NULL,
+    meta_key varchar(64) NOT NULL,
+    term varchar(64) NOT NULL,
+    weight integer NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uc_metadata_search_terms_on_meta_type_and_meta_key_and_term ON metadata_search_terms (meta_type, meta_key, term);
+CREATE INDEX IF NOT EXISTS index_metadata_search_terms_on_term ON metadata_search_terms (term);
@@ -0,0 +1,2 @@
+-- sqlite has no native index every build ships with, it keeps searching metadata_search_terms
+SELECT 1;
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/config"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+var _ Service = (*EventSinkService)(nil)
+
+type EventSinkService struct {
+	outboxUsecase *biz.EventOutboxUsecase
+	logger        *logger.Logger
+	sink          biz.EventSink
+	conf          *config.Sink
+	cancel        context.CancelFunc
+	wg            sync.WaitGroup
+}
+
+func NewEventSinkService(outboxUsecase *biz.EventOutboxUsecase, logger *logger.Logger, sink biz.EventSink, conf *config.Sink) *EventSinkService {
+	if conf.Name == "" {
+		conf.Name = "default"
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 100
+	}
+	if conf.PollInterval <= 0 {
+		conf.PollInterval = time.Second
+	}
+	return &EventSinkService{
+		outboxUsecase: outboxUsecase,
+		logger:        logger,
+		sink:          sink,
+		conf:          conf,
+	}
+}
+
+func (s *EventSinkService) Start(ctx context.Context, _ string) error {
+	if s.sink == nil {
+		s.logger.Info(ctx, "event sink is disabled")
+		return nil
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.wg.Add(1)
+	s.logger.Info(ctx, "Successfully started the event sink service~")
+	go func() {
+		defer s.wg.Done()
+		for {
+			if err := s.publish(ctx); err != nil && ctx.Err() == nil {
+				s.logger.Errorf(ctx, "publish events to sink %s error: %v", s.conf.Name, err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(s.conf.PollInterval):
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop cancels the publish loop and waits for it, a batch interrupted before its cursor is saved is
+// published again after a restart
+func (s *EventSinkService) Stop(ctx context.Context) error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+	s.logger.Info(ctx, "Successfully closed the event sink service~")
+	return nil
+}
+
+// publish sends the outbox to the sink batch by batch in sequence order, the same read the webhook
+// dispatcher uses. The cursor is saved only after the broker acknowledges every message of a batch, so a crash
+// re-delivers that batch at least once, and a row committed late is numbered above the cursor.
+func (s *EventSinkService) publish(ctx context.Context) error {
+	cursor, err := s.outboxUsecase.SinkCursor(ctx, s.conf.Name)
+	if err != nil {
+		return err
+	}
+	for {
+		events, err := s.outboxUsecase.FindOutboxEvents(ctx, cursor, s.conf.BatchSize)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		messages := make([]biz.SinkMessage, len(events))
+		for i, event := range events {
+			if messages[i], err = biz.NewSinkMessage(event); err != nil {
+				return err
+			}
+		}
+		if err = s.sink.Publish(ctx, messages); err != nil {
+			return err
+		}
+		cursor = events[len(events)-1].Sequence
+		if err = s.outboxUsecase.SaveSinkCursor(ctx, s.conf.Name, cursor); err != nil {
+			return err
+		}
+	}
+}
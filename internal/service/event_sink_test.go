@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/config"
+	"github.com/nervina-labs/cota-syncer/internal/data"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+type memoryOutboxRepo struct {
+	mu          sync.Mutex
+	events      []biz.OutboxEvent
+	cursors     map[string]uint64
+	deliveries  map[string]uint64
+	deadLetters []biz.DeadLetter
+}
+
+func (r *memoryOutboxRepo) FindOutboxEvents(_ context.Context, afterSequence uint64, limit int) ([]biz.OutboxEvent, error) {
+	var events []biz.OutboxEvent
+	for _, event := range r.events {
+		if event.Sequence > afterSequence && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (r *memoryOutboxRepo) FindDeliveryCursor(_ context.Context, endpoint string) (uint64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.deliveries[endpoint], nil
+}
+
+func (r *memoryOutboxRepo) SaveDeliveryCursor(_ context.Context, endpoint string, sequence uint64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliveries[endpoint] = sequence
+	return nil
+}
+
+func (r *memoryOutboxRepo) CreateDeadLetter(_ context.Context, letter *biz.DeadLetter) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deadLetters = append(r.deadLetters, *letter)
+	return nil
+}
+
+func (r *memoryOutboxRepo) FindSinkCursor(_ context.Context, sink string) (uint64, error) {
+	return r.cursors[sink], nil
+}
+
+func (r *memoryOutboxRepo) SaveSinkCursor(_ context.Context, sink string, sequence uint64) error {
+	r.cursors[sink] = sequence
+	return nil
+}
+
+func (r *memoryOutboxRepo) DeleteOutboxEvents(_ context.Context, throughSequence uint64, _ int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var kept []biz.OutboxEvent
+	for _, event := range r.events {
+		if event.Sequence > throughSequence {
+			kept = append(kept, event)
+		}
+	}
+	deleted := int64(len(r.events) - len(kept))
+	r.events = kept
+	return deleted, nil
+}
+
+func TestEventSinkService_publish(t *testing.T) {
+	tokenIndex := uint32(3)
+	withdraw := biz.CotaEvent{BlockNumber: 10, TxIndex: 1, EventType: biz.CotaEventWithdraw, CotaId: "cota", TokenIndex: &tokenIndex}
+	claim := biz.CotaEvent{BlockNumber: 11, TxIndex: 2, EventType: biz.CotaEventClaim, CotaId: "cota", TokenIndex: &tokenIndex}
+	repo := &memoryOutboxRepo{
+		events: []biz.OutboxEvent{
+			{Id: 1, Sequence: 1, Status: biz.OutboxApplied, Event: withdraw},
+			{Id: 2, Sequence: 2, Status: biz.OutboxApplied, Event: claim},
+			{Id: 3, Sequence: 3, Status: biz.OutboxReverted, Event: claim},
+		},
+		cursors: map[string]uint64{},
+	}
+	broker := data.NewMemoryBroker()
+	conf := &config.Sink{Name: "test", BatchSize: 2}
+	s := NewEventSinkService(biz.NewEventOutboxUsecase(repo, nil), logger.NewLogger(io.Discard, "", 0), broker, conf)
+
+	broker.FailNext(1)
+	if err := s.publish(context.Background()); err == nil {
+		t.Fatalf("publish() expected the broker error")
+	}
+	if repo.cursors["test"] != 0 || len(broker.Messages()) != 0 {
+		t.Fatalf("a failed publish must not move the cursor, cursor = %d", repo.cursors["test"])
+	}
+
+	if err := s.publish(context.Background()); err != nil {
+		t.Fatalf("publish() error = %v", err)
+	}
+	messages := broker.Messages()
+	if len(messages) != 3 {
+		t.Fatalf("published %d messages, want 3", len(messages))
+	}
+	wantKeys := []string{withdraw.Key(), claim.Key(), claim.Key()}
+	for i, message := range messages {
+		if message.Key != wantKeys[i] {
+			t.Errorf("message %d key = %s, want %s", i, message.Key, wantKeys[i])
+		}
+	}
+	if messages[1].IsTombstone() || !messages[2].IsTombstone() {
+		t.Errorf("only the reverted claim should be a tombstone")
+	}
+	if messages[2].Headers["Cota-Status"] != string(biz.OutboxReverted) {
+		t.Errorf("tombstone status = %s", messages[2].Headers["Cota-Status"])
+	}
+	if repo.cursors["test"] != 3 {
+		t.Errorf("cursor = %d, want 3", repo.cursors["test"])
+	}
+}
+
+func TestEventSinkService_publishLateCommit(t *testing.T) {
+	tokenIndex := uint32(3)
+	define := biz.CotaEvent{BlockNumber: 10, EventType: biz.CotaEventDefine, CotaId: "cota"}
+	claim := biz.CotaEvent{BlockNumber: 11, EventType: biz.CotaEventClaim, CotaId: "cota", TokenIndex: &tokenIndex}
+	repo := &memoryOutboxRepo{
+		events:  []biz.OutboxEvent{{Id: 3, Sequence: 1, Status: biz.OutboxApplied, Event: claim}},
+		cursors: map[string]uint64{},
+	}
+	broker := data.NewMemoryBroker()
+	s := NewEventSinkService(biz.NewEventOutboxUsecase(repo, nil), logger.NewLogger(io.Discard, "", 0), broker, &config.Sink{Name: "test"})
+	if err := s.publish(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// id 2 of the metadata syncer commits after id 3 of the block syncer was published
+	repo.events = append(repo.events, biz.OutboxEvent{Id: 2, Sequence: 2, Status: biz.OutboxApplied, Event: define})
+	if err := s.publish(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	messages := broker.Messages()
+	if len(messages) != 2 || messages[1].Key != define.Key() {
+		t.Fatalf("published %+v, want the late define after the claim", messages)
+	}
+	if repo.cursors["test"] != 2 {
+		t.Errorf("cursor = %d, want sequence 2", repo.cursors["test"])
+	}
+}
+
+// blockingSink holds a Publish call until its ctx is cancelled
+type blockingSink struct {
+	started  chan struct{}
+	returned bool
+}
+
+func (s *blockingSink) Publish(ctx context.Context, _ []biz.SinkMessage) error {
+	close(s.started)
+	<-ctx.Done()
+	s.returned = true
+	return ctx.Err()
+}
+
+func TestEventSinkService_Stop(t *testing.T) {
+	tokenIndex := uint32(3)
+	claim := biz.CotaEvent{BlockNumber: 11, EventType: biz.CotaEventClaim, CotaId: "cota", TokenIndex: &tokenIndex}
+	repo := &memoryOutboxRepo{
+		events:  []biz.OutboxEvent{{Id: 1, Sequence: 1, Status: biz.OutboxApplied, Event: claim}},
+		cursors: map[string]uint64{},
+	}
+	sink := &blockingSink{started: make(chan struct{})}
+	s := NewEventSinkService(biz.NewEventOutboxUsecase(repo, nil), logger.NewLogger(io.Discard, "", 0), sink, &config.Sink{Name: "test"})
+	if err := s.Start(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	<-sink.started
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !sink.returned {
+		t.Fatal("Stop() returned before the batch in flight")
+	}
+	if repo.cursors["test"] != 0 {
+		t.Errorf("cursor = %d, an interrupted batch must not move it", repo.cursors["test"])
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/config"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+var _ Service = (*LocalizationFetcherService)(nil)
+
+type LocalizationFetcherService struct {
+	localizationUsecase *biz.LocalizationUsecase
+	logger              *logger.Logger
+	conf                *config.Localization
+	// cursors are the ids of the issuer and class infos to continue from
+	cursors map[string]uint64
+}
+
+func NewLocalizationFetcherService(localizationUsecase *biz.LocalizationUsecase, logger *logger.Logger, conf *config.Localization) *LocalizationFetcherService {
+	if conf.Interval <= 0 {
+		conf.Interval = time.Minute
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 100
+	}
+	if conf.RetryInterval <= 0 {
+		conf.RetryInterval = time.Hour
+	}
+	return &LocalizationFetcherService{
+		localizationUsecase: localizationUsecase,
+		logger:              logger,
+		conf:                conf,
+		cursors:             make(map[string]uint64),
+	}
+}
+
+func (s *LocalizationFetcherService) Start(ctx context.Context, _ string) error {
+	if !s.conf.Enabled {
+		s.logger.Info(ctx, "localization fetcher is disabled")
+		return nil
+	}
+	s.logger.Info(ctx, "Successfully started the localization fetcher~")
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(s.conf.Interval):
+				s.fetch(ctx)
+			}
+		}
+	}()
+	return nil
+}
+
+// fetch refreshes up to batch_size documents per meta type, continuing where the last round stopped
+func (s *LocalizationFetcherService) fetch(ctx context.Context) {
+	for _, metaType := range []string{biz.LocalizedIssuer, biz.LocalizedClass} {
+		next, fetched, err := s.localizationUsecase.Refresh(ctx, metaType, s.cursors[metaType], s.conf.BatchSize, s.conf.RetryInterval)
+		s.cursors[metaType] = next
+		if err != nil {
+			s.logger.Errorf(ctx, "fetch %s localizations error: %v", metaType, err)
+			continue
+		}
+		if fetched > 0 {
+			s.logger.Infof(ctx, "fetched %d %s localizations", fetched, metaType)
+		}
+	}
+}
+
+func (s *LocalizationFetcherService) Stop(ctx context.Context) error {
+	s.logger.Info(ctx, "Successfully closed the localization fetcher~")
+	return nil
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/config"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+var _ Service = (*OutboxPrunerService)(nil)
+
+// OutboxPrunerService deletes the event outbox rows every webhook endpoint and the sink have handled,
+// in the prune retention mode
+type OutboxPrunerService struct {
+	outboxUsecase *biz.EventOutboxUsecase
+	logger        *logger.Logger
+	retention     *config.Retention
+	webhook       *config.Webhook
+	sink          *config.Sink
+	cancel        context.CancelFunc
+	wg            sync.WaitGroup
+}
+
+func NewOutboxPrunerService(outboxUsecase *biz.EventOutboxUsecase, logger *logger.Logger, retention *config.Retention, webhook *config.Webhook, sink *config.Sink) *OutboxPrunerService {
+	return &OutboxPrunerService{
+		outboxUsecase: outboxUsecase,
+		logger:        logger,
+		retention:     retention,
+		webhook:       webhook,
+		sink:          sink,
+	}
+}
+
+func (s *OutboxPrunerService) Start(ctx context.Context, _ string) error {
+	if s.retention.Mode != RetentionPrune {
+		s.logger.Info(ctx, "event outbox retention is not prune, nothing is pruned")
+		return nil
+	}
+	interval, batchSize := s.retention.Interval, s.retention.BatchSize
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.wg.Add(1)
+	s.logger.Info(ctx, "Successfully started the outbox pruner~")
+	go func() {
+		defer s.wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+				s.prune(ctx, batchSize)
+			}
+		}
+	}()
+	return nil
+}
+
+// consumers returns the names of the delivery cursors of the configured endpoints and of the sink
+// when it is enabled. The cursor of a removed endpoint does not hold the outbox back.
+func (s *OutboxPrunerService) consumers() (endpoints, sinks []string) {
+	for _, endpoint := range s.webhook.Endpoints {
+		endpoints = append(endpoints, endpoint.Name)
+	}
+	if s.sink.Driver != "" {
+		name := s.sink.Name
+		if name == "" {
+			name = "default"
+		}
+		sinks = append(sinks, name)
+	}
+	return endpoints, sinks
+}
+
+func (s *OutboxPrunerService) prune(ctx context.Context, batchSize int) {
+	endpoints, sinks := s.consumers()
+	pruned, err := s.outboxUsecase.Prune(ctx, endpoints, sinks, batchSize)
+	if err != nil && ctx.Err() == nil {
+		s.logger.Errorf(ctx, "prune event outbox error: %v", err)
+		return
+	}
+	if pruned > 0 {
+		s.logger.Infof(ctx, "pruned %d event outbox rows", pruned)
+	}
+}
+
+func (s *OutboxPrunerService) Stop(ctx context.Context) error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+	s.logger.Info(ctx, "Successfully closed the outbox pruner~")
+	return nil
+}
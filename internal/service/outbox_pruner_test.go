@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/config"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+func TestOutboxPrunerService_prune(t *testing.T) {
+	ctx := context.Background()
+	log := logger.NewLogger(io.Discard, "", 0)
+	repo := &memoryOutboxRepo{
+		events:     []biz.OutboxEvent{{Id: 1, Sequence: 1}, {Id: 2, Sequence: 2}, {Id: 3, Sequence: 3}, {Id: 4, Sequence: 4}},
+		cursors:    map[string]uint64{"default": 2, "removed": 0},
+		deliveries: map[string]uint64{"app": 3},
+	}
+	sequences := func() []uint64 {
+		var sequences []uint64
+		for _, event := range repo.events {
+			sequences = append(sequences, event.Sequence)
+		}
+		return sequences
+	}
+	retention := &config.Retention{Mode: RetentionPrune}
+	webhook := &config.Webhook{Endpoints: []config.WebhookEndpoint{{Name: "app"}, {Name: "new"}}}
+	s := NewOutboxPrunerService(biz.NewEventOutboxUsecase(repo, log), log, retention, webhook, &config.Sink{Driver: "memory"})
+
+	// the endpoint new has no cursor yet and holds the whole outbox back
+	s.prune(ctx, 10)
+	if got := sequences(); len(got) != 4 {
+		t.Fatalf("outbox with an endpoint without a cursor = %v, want all 4 rows", got)
+	}
+
+	// the slowest consumer is the sink at 2, the cursor of the removed sink is ignored
+	webhook.Endpoints = webhook.Endpoints[:1]
+	s.prune(ctx, 10)
+	if got := sequences(); len(got) != 2 || got[0] != 3 {
+		t.Errorf("pruned outbox = %v, want the rows after the sink cursor 2", got)
+	}
+
+	// without a consumer nothing is pruned
+	webhook.Endpoints, s.sink = nil, &config.Sink{}
+	repo.cursors["default"] = 4
+	s.prune(ctx, 10)
+	if got := sequences(); len(got) != 2 {
+		t.Errorf("outbox without consumers = %v, want the 2 rows kept", got)
+	}
+}
@@ -0,0 +1,568 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/config"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+var _ Service = (*QueryService)(nil)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+type QueryService struct {
+	timelineUsecase     *biz.TokenTimelineUsecase
+	eventUsecase        *biz.CotaEventUsecase
+	localizationUsecase *biz.LocalizationUsecase
+	historyUsecase      *biz.MetadataHistoryUsecase
+	traitUsecase        *biz.TraitUsecase
+	searchUsecase       *biz.MetadataSearchUsecase
+	deviceUsecase       *biz.JoyIDDeviceUsecase
+	socialUsecase       *biz.SocialRecoveryUsecase
+	logger              *logger.Logger
+	server              *http.Server
+}
+
+func NewQueryService(timelineUsecase *biz.TokenTimelineUsecase, eventUsecase *biz.CotaEventUsecase, localizationUsecase *biz.LocalizationUsecase, historyUsecase *biz.MetadataHistoryUsecase, traitUsecase *biz.TraitUsecase, searchUsecase *biz.MetadataSearchUsecase, deviceUsecase *biz.JoyIDDeviceUsecase, socialUsecase *biz.SocialRecoveryUsecase, logger *logger.Logger, conf *config.Api) *QueryService {
+	s := &QueryService{
+		timelineUsecase:     timelineUsecase,
+		eventUsecase:        eventUsecase,
+		localizationUsecase: localizationUsecase,
+		historyUsecase:      historyUsecase,
+		traitUsecase:        traitUsecase,
+		searchUsecase:       searchUsecase,
+		deviceUsecase:       deviceUsecase,
+		socialUsecase:       socialUsecase,
+		logger:              logger,
+	}
+	if conf.Addr != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/api/v1/token_timeline", s.tokenTimeline)
+		mux.HandleFunc("/api/v1/account_events", s.accountEvents)
+		mux.HandleFunc("/api/v1/issuer_info", s.issuerInfo)
+		mux.HandleFunc("/api/v1/class_info", s.classInfo)
+		mux.HandleFunc("/api/v1/metadata_history", s.metadataHistory)
+		mux.HandleFunc("/api/v1/class_traits", s.classTraits)
+		mux.HandleFunc("/api/v1/trait_tokens", s.traitTokens)
+		mux.HandleFunc("/api/v1/search", s.search)
+		mux.HandleFunc("/api/v1/joyid_devices", s.joyIDDevices)
+		mux.HandleFunc("/api/v1/sub_key_authorization", s.subKeyAuthorization)
+		mux.HandleFunc("/api/v1/social_recovery", s.socialRecovery)
+		mux.HandleFunc("/api/v1/social_recovery_history", s.socialRecoveryHistory)
+		mux.HandleFunc("/api/v1/guarded_accounts", s.guardedAccounts)
+		s.server = &http.Server{
+			Addr:              conf.Addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+	}
+	return s
+}
+
+func (s *QueryService) Start(ctx context.Context, _ string) error {
+	if s.server == nil {
+		s.logger.Info(ctx, "query service is disabled")
+		return nil
+	}
+	s.logger.Infof(ctx, "query service listening on %s", s.server.Addr)
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *QueryService) Stop(ctx context.Context) error {
+	if s.server == nil {
+		return nil
+	}
+	s.logger.Info(ctx, "query service stopped")
+	return s.server.Shutdown(ctx)
+}
+
+// tokenTimeline serves GET /api/v1/token_timeline?cota_id=<hex>&token_index=<uint32>
+func (s *QueryService) tokenTimeline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query := r.URL.Query()
+	cotaId := remove0x(query.Get("cota_id"))
+	if len(cotaId) != 40 {
+		writeError(w, http.StatusBadRequest, "invalid cota_id")
+		return
+	}
+	tokenIndex, err := strconv.ParseUint(query.Get("token_index"), 10, 32)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid token_index")
+		return
+	}
+	timeline, err := s.timelineUsecase.Timeline(r.Context(), cotaId, uint32(tokenIndex))
+	if errors.Is(err, biz.ErrTimelineNotBackfilled) {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		s.logger.Errorf(r.Context(), "query token timeline error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, timeline)
+}
+
+type accountEvent struct {
+	biz.CotaEvent
+	Direction string `json:"direction"`
+}
+
+type accountEventsResponse struct {
+	Events     []accountEvent `json:"events"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// accountEvents serves GET /api/v1/account_events?lock_hash=<hex>&cursor=<cursor>&limit=<n>
+// from the newest event to the oldest.
+func (s *QueryService) accountEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query := r.URL.Query()
+	lockHash := remove0x(query.Get("lock_hash"))
+	if len(lockHash) != 64 {
+		writeError(w, http.StatusBadRequest, "invalid lock_hash")
+		return
+	}
+	limit := defaultPageLimit
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 || n > maxPageLimit {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = n
+	}
+	var cursor *biz.CotaEventCursor
+	if c := query.Get("cursor"); c != "" {
+		var err error
+		if cursor, err = biz.ParseCotaEventCursor(c); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+	}
+	events, next, err := s.eventUsecase.AccountFeed(r.Context(), lockHash, cursor, limit)
+	if err != nil {
+		s.logger.Errorf(r.Context(), "query account events error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	resp := accountEventsResponse{Events: make([]accountEvent, len(events))}
+	for i, event := range events {
+		resp.Events[i] = accountEvent{CotaEvent: event, Direction: event.Direction(lockHash)}
+	}
+	if next != nil {
+		resp.NextCursor = next.String()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// issuerInfo serves GET /api/v1/issuer_info?lock_hash=<hex>&locale=<locale>
+func (s *QueryService) issuerInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query := r.URL.Query()
+	lockHash := remove0x(query.Get("lock_hash"))
+	if len(lockHash) != 64 {
+		writeError(w, http.StatusBadRequest, "invalid lock_hash")
+		return
+	}
+	info, err := s.localizationUsecase.IssuerInfo(r.Context(), lockHash, query.Get("locale"))
+	s.writeInfo(w, r, info, err)
+}
+
+// classInfo serves GET /api/v1/class_info?cota_id=<hex>&locale=<locale>
+func (s *QueryService) classInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query := r.URL.Query()
+	cotaId := remove0x(query.Get("cota_id"))
+	if len(cotaId) != 40 {
+		writeError(w, http.StatusBadRequest, "invalid cota_id")
+		return
+	}
+	info, err := s.localizationUsecase.ClassInfo(r.Context(), cotaId, query.Get("locale"))
+	s.writeInfo(w, r, info, err)
+}
+
+// metadataHistory serves GET /api/v1/metadata_history?type=<issuer|cota|joy_id>&key=<hex>, the key is the
+// cota id of a class or the lock hash of an issuer or a JoyID account
+func (s *QueryService) metadataHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query := r.URL.Query()
+	metaType, key := query.Get("type"), remove0x(query.Get("key"))
+	keyLen := 64
+	switch metaType {
+	case biz.MetadataHistoryClass:
+		keyLen = 40
+	case biz.MetadataHistoryIssuer, biz.MetadataHistoryJoyID:
+	default:
+		writeError(w, http.StatusBadRequest, "invalid type")
+		return
+	}
+	if len(key) != keyLen {
+		writeError(w, http.StatusBadRequest, "invalid key")
+		return
+	}
+	history, err := s.historyUsecase.History(r.Context(), metaType, key)
+	if err != nil {
+		s.logger.Errorf(r.Context(), "query metadata history error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+// classTraits serves GET /api/v1/class_traits?cota_id=<hex>
+func (s *QueryService) classTraits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	cotaId := remove0x(r.URL.Query().Get("cota_id"))
+	if len(cotaId) != 40 {
+		writeError(w, http.StatusBadRequest, "invalid cota_id")
+		return
+	}
+	traits, err := s.traitUsecase.ClassTraits(r.Context(), cotaId)
+	if err != nil {
+		s.logger.Errorf(r.Context(), "query class traits error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, traits)
+}
+
+type traitTokensResponse struct {
+	TokenIndexes []uint32 `json:"token_indexes"`
+	NextCursor   string   `json:"next_cursor,omitempty"`
+}
+
+// traitTokens serves GET /api/v1/trait_tokens?cota_id=<hex>&trait=<name>:<value>&cursor=<cursor>&limit=<n>,
+// a token matches when it has every trait given
+func (s *QueryService) traitTokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query := r.URL.Query()
+	cotaId := remove0x(query.Get("cota_id"))
+	if len(cotaId) != 40 {
+		writeError(w, http.StatusBadRequest, "invalid cota_id")
+		return
+	}
+	var traits []biz.TokenTrait
+	for _, trait := range query["trait"] {
+		name, value, ok := strings.Cut(trait, ":")
+		if !ok || name == "" {
+			writeError(w, http.StatusBadRequest, "invalid trait")
+			return
+		}
+		traits = append(traits, biz.TokenTrait{Name: name, Value: value})
+	}
+	limit := defaultPageLimit
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 || n > maxPageLimit {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = n
+	}
+	afterIndex := int64(-1)
+	if c := query.Get("cursor"); c != "" {
+		n, err := strconv.ParseUint(c, 10, 32)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		afterIndex = int64(n)
+	}
+	tokenIndexes, err := s.traitUsecase.TokensByTraits(r.Context(), cotaId, traits, afterIndex, limit)
+	if err != nil {
+		s.logger.Errorf(r.Context(), "query trait tokens error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	resp := traitTokensResponse{TokenIndexes: tokenIndexes}
+	if resp.TokenIndexes == nil {
+		resp.TokenIndexes = []uint32{}
+	}
+	if len(tokenIndexes) == limit {
+		resp.NextCursor = strconv.FormatUint(uint64(tokenIndexes[len(tokenIndexes)-1]), 10)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type searchResponse struct {
+	Results    []biz.SearchResult `json:"results"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+// search serves GET /api/v1/search?q=<query>&type=<cota|issuer>&cursor=<cursor>&limit=<n>, the classes
+// and issuers matching every word of the query from the best ranked down
+func (s *QueryService) search(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query := r.URL.Query()
+	limit := defaultPageLimit
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 || n > maxPageLimit {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = n
+	}
+	var cursor *biz.SearchCursor
+	if c := query.Get("cursor"); c != "" {
+		var err error
+		if cursor, err = biz.ParseSearchCursor(c); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+	}
+	results, next, err := s.searchUsecase.Search(r.Context(), query.Get("q"), query.Get("type"), cursor, limit)
+	if errors.Is(err, biz.ErrEmptySearchQuery) {
+		writeError(w, http.StatusBadRequest, "invalid q")
+		return
+	}
+	if errors.Is(err, biz.ErrUnknownSearchType) {
+		writeError(w, http.StatusBadRequest, "invalid type")
+		return
+	}
+	if err != nil {
+		s.logger.Errorf(r.Context(), "search metadata error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	resp := searchResponse{Results: results}
+	if resp.Results == nil {
+		resp.Results = []biz.SearchResult{}
+	}
+	if next != nil {
+		resp.NextCursor = next.String()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// joyIDDevices serves GET /api/v1/joyid_devices?lock_hash=<hex>, the keys of the JoyID metadata of a
+// lock joined with its sub key SMT
+func (s *QueryService) joyIDDevices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	lockHash := remove0x(r.URL.Query().Get("lock_hash"))
+	if len(lockHash) != 64 {
+		writeError(w, http.StatusBadRequest, "invalid lock_hash")
+		return
+	}
+	registry, err := s.deviceUsecase.Registry(r.Context(), lockHash)
+	if errors.Is(err, biz.ErrJoyIDNotFound) {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if err != nil {
+		s.logger.Errorf(r.Context(), "query joyid devices error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, registry)
+}
+
+// subKeyAuthorization serves GET /api/v1/sub_key_authorization?lock_hash=<hex>&pubkey_hash=<hex>&block_number=<n>,
+// the latest synced state without block_number
+func (s *QueryService) subKeyAuthorization(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query := r.URL.Query()
+	lockHash, pubkeyHash := remove0x(query.Get("lock_hash")), remove0x(query.Get("pubkey_hash"))
+	if len(lockHash) != 64 {
+		writeError(w, http.StatusBadRequest, "invalid lock_hash")
+		return
+	}
+	if len(pubkeyHash) != 40 {
+		writeError(w, http.StatusBadRequest, "invalid pubkey_hash")
+		return
+	}
+	var blockNumber *uint64
+	if b := query.Get("block_number"); b != "" {
+		n, err := strconv.ParseUint(b, 10, 63)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid block_number")
+			return
+		}
+		blockNumber = &n
+	}
+	authorization, err := s.deviceUsecase.Authorization(r.Context(), lockHash, strings.ToLower(pubkeyHash), blockNumber)
+	if errors.Is(err, biz.ErrQueryBeyondRetention) {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err != nil {
+		s.logger.Errorf(r.Context(), "query sub key authorization error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, authorization)
+}
+
+// socialRecovery serves GET /api/v1/social_recovery?lock_hash=<hex>, the social recovery of an account
+// with its guardians and the issues of its threshold
+func (s *QueryService) socialRecovery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	lockHash := remove0x(r.URL.Query().Get("lock_hash"))
+	if len(lockHash) != 64 {
+		writeError(w, http.StatusBadRequest, "invalid lock_hash")
+		return
+	}
+	config, err := s.socialUsecase.Config(r.Context(), lockHash)
+	if errors.Is(err, biz.ErrSocialNotFound) {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if err != nil {
+		s.logger.Errorf(r.Context(), "query social recovery error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, config)
+}
+
+// socialRecoveryHistory serves GET /api/v1/social_recovery_history?lock_hash=<hex>, the retained versions
+// of the social recovery of an account in chronological order
+func (s *QueryService) socialRecoveryHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	lockHash := remove0x(r.URL.Query().Get("lock_hash"))
+	if len(lockHash) != 64 {
+		writeError(w, http.StatusBadRequest, "invalid lock_hash")
+		return
+	}
+	history, err := s.socialUsecase.History(r.Context(), lockHash)
+	if err != nil {
+		s.logger.Errorf(r.Context(), "query social recovery history error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+type guardedAccountsResponse struct {
+	Guardians  []biz.Guardian `json:"guardians"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// guardedAccounts serves GET /api/v1/guarded_accounts?guardian_lock_hash=<hex>&cursor=<lock hash>&limit=<n>,
+// the accounts listing the guardian as a signer of their social recovery. lock_script=<hex> can replace
+// guardian_lock_hash with the serialized lock script of the guardian.
+func (s *QueryService) guardedAccounts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query := r.URL.Query()
+	guardianLockHash := strings.ToLower(remove0x(query.Get("guardian_lock_hash")))
+	if script := remove0x(query.Get("lock_script")); guardianLockHash == "" && script != "" {
+		var err error
+		if guardianLockHash, err = biz.GuardianLockHash(strings.ToLower(script)); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid lock_script")
+			return
+		}
+	}
+	if len(guardianLockHash) != 64 {
+		writeError(w, http.StatusBadRequest, "invalid guardian_lock_hash")
+		return
+	}
+	limit := defaultPageLimit
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 || n > maxPageLimit {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = n
+	}
+	cursor := remove0x(query.Get("cursor"))
+	if cursor != "" && len(cursor) != 64 {
+		writeError(w, http.StatusBadRequest, "invalid cursor")
+		return
+	}
+	guardians, err := s.socialUsecase.GuardedAccounts(r.Context(), guardianLockHash, cursor, limit)
+	if err != nil {
+		s.logger.Errorf(r.Context(), "query guarded accounts error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	resp := guardedAccountsResponse{Guardians: guardians}
+	if len(guardians) == limit {
+		resp.NextCursor = guardians[len(guardians)-1].LockHash
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *QueryService) writeInfo(w http.ResponseWriter, r *http.Request, info any, err error) {
+	if errors.Is(err, biz.ErrInfoNotFound) {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if err != nil {
+		s.logger.Errorf(r.Context(), "query info error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func remove0x(str string) string {
+	if len(str) >= 2 && str[:2] == "0x" {
+		return str[2:]
+	}
+	return str
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
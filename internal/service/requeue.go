@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/data"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+// RequeueService parses the quarantined entries again after a parser fix. It is run by the requeue
+// command and is not one of the services of the app.
+//
+// An entry is not applied on its own on top of the current rows, the blocks after it may have changed
+// the same keys and their versions would be built on a state that never was. The syncer is rolled back
+// to the block before the first requeued entry instead, and parses every block from there again with
+// the current parser. The rollback goes through the check infos the running syncer writes, so the
+// syncer must be stopped while the command runs.
+type RequeueService struct {
+	quarantinedEntryUsecase *biz.QuarantinedEntryUsecase
+	checkInfoUsecase        *biz.CheckInfoUsecase
+	versionRetentionUsecase *biz.VersionRetentionUsecase
+	logger                  *logger.Logger
+	blockSyncer             data.BlockSyncer
+	metadataSyncer          data.MetadataSyncer
+}
+
+type RequeueResult struct {
+	Entries int
+	// Heights are the check infos the syncers were rolled back to, only the syncers with requeued
+	// entries are rolled back
+	Heights map[biz.CheckType]uint64
+}
+
+func NewRequeueService(quarantinedEntryUsecase *biz.QuarantinedEntryUsecase, checkInfoUsecase *biz.CheckInfoUsecase, versionRetentionUsecase *biz.VersionRetentionUsecase,
+	logger *logger.Logger, blockSyncer data.BlockSyncer, metadataSyncer data.MetadataSyncer) *RequeueService {
+	return &RequeueService{
+		quarantinedEntryUsecase: quarantinedEntryUsecase,
+		checkInfoUsecase:        checkInfoUsecase,
+		versionRetentionUsecase: versionRetentionUsecase,
+		logger:                  logger,
+		blockSyncer:             blockSyncer,
+		metadataSyncer:          metadataSyncer,
+	}
+}
+
+// Requeue rolls each syncer back to the block before its first entry quarantined by an older parser
+// version, or before its first quarantined entry when all is set. The rollback is refused before it
+// starts when the versions of that block were pruned.
+func (s *RequeueService) Requeue(ctx context.Context, all bool) (RequeueResult, error) {
+	result := RequeueResult{Heights: map[biz.CheckType]uint64{}}
+	entries, err := s.quarantinedEntryUsecase.FindRequeueEntries(ctx, all)
+	if err != nil {
+		return result, err
+	}
+	result.Entries = len(entries)
+	// the entries are in block order, the first one of a source is its lowest block
+	from := make(map[biz.CheckType]uint64)
+	for _, entry := range entries {
+		if _, ok := from[entry.Source]; !ok {
+			from[entry.Source] = entry.BlockNumber
+		}
+	}
+	for _, checkType := range []biz.CheckType{biz.SyncBlock, biz.SyncMetadata} {
+		blockNumber, ok := from[checkType]
+		if !ok {
+			continue
+		}
+		pruneHeight, err := s.versionRetentionUsecase.PruneHeight(ctx, checkType)
+		if err != nil {
+			return result, err
+		}
+		if blockNumber < pruneHeight {
+			return result, fmt.Errorf("%w: %s block %d, the versions are kept from block %d", biz.ErrRollbackBeyondRetention, checkType.String(), blockNumber, pruneHeight)
+		}
+		if result.Heights[checkType], err = s.rollbackTo(ctx, checkType, blockNumber); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// rollbackTo rolls the syncer back block by block while its check info is at or after the block, and
+// returns the check info left
+func (s *RequeueService) rollbackTo(ctx context.Context, checkType biz.CheckType, blockNumber uint64) (uint64, error) {
+	rollback := s.blockSyncer.Rollback
+	if checkType == biz.SyncMetadata {
+		rollback = s.metadataSyncer.Rollback
+	}
+	for {
+		checkInfo := biz.CheckInfo{CheckType: checkType}
+		if err := s.checkInfoUsecase.LastCheckInfo(ctx, &checkInfo); err != nil {
+			return 0, err
+		}
+		if checkInfo.Id == 0 || checkInfo.BlockNumber < blockNumber {
+			return checkInfo.BlockNumber, nil
+		}
+		if err := rollback(ctx, checkInfo.BlockNumber); err != nil {
+			return 0, err
+		}
+		s.logger.Infof(ctx, "requeue rolled back %s block %d", checkType.String(), checkInfo.BlockNumber)
+	}
+}
@@ -6,12 +6,15 @@ import (
 
 	"github.com/google/wire"
 	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/config"
 	"github.com/nervina-labs/cota-syncer/internal/data"
 	"github.com/nervina-labs/cota-syncer/internal/logger"
 	ckbTypes "github.com/nervosnetwork/ckb-sdk-go/types"
 )
 
-var ProviderSet = wire.NewSet(NewBlockSyncService, NewCheckInfoService, NewMetadataSyncService, NewInvalidDataService, NewWithdrawExtraInfoService, NewRegisterLockService)
+var ProviderSet = wire.NewSet(NewBlockSyncService, NewCheckInfoService, NewMetadataSyncService, NewInvalidDataService, NewWithdrawExtraInfoService, NewRegisterLockService,
+	NewQueryService, NewWebhookDispatcher, NewEventSinkService, NewRequeueService, NewVersionPrunerService, NewLocalizationFetcherService,
+	NewTimelineBackfillService, NewOutboxPrunerService)
 
 type BlockSyncService struct {
 	checkInfoUsecase *biz.CheckInfoUsecase
@@ -20,6 +23,7 @@ type BlockSyncService struct {
 	status           chan struct{}
 	systemScripts    data.SystemScripts
 	blockSyncer      data.BlockSyncer
+	conf             *config.Sync
 }
 
 func (s *BlockSyncService) Start(ctx context.Context, mode string) error {
@@ -79,6 +83,13 @@ func (s *BlockSyncService) sync(ctx context.Context) {
 		}
 		return
 	}
+	if s.conf.BulkThreshold > 0 && tipBlockNumber-checkInfo.BlockNumber > s.conf.BulkThreshold {
+		err = s.syncBulk(ctx, targetBlock, tipBlockNumber)
+		if err != nil {
+			s.logger.Errorf(ctx, "save %s kv pairs in bulk error: %v", checkInfo.CheckType.String(), err)
+		}
+		return
+	}
 	// save key pairs
 	checkInfo.BlockNumber = targetBlockNumber
 	checkInfo.BlockHash = targetBlock.Header.Hash.String()[2:]
@@ -88,6 +99,27 @@ func (s *BlockSyncService) sync(ctx context.Context) {
 	}
 }
 
+// syncBulk writes up to bulk_blocks blocks from the target block in one transaction. The batch ends
+// before a block that does not extend the previous one, the next sync rolls back the fork.
+func (s *BlockSyncService) syncBulk(ctx context.Context, targetBlock *ckbTypes.Block, tipBlockNumber uint64) error {
+	blocks := []*ckbTypes.Block{targetBlock}
+	for len(blocks) < s.conf.BulkBlocks && targetBlock.Header.Number+uint64(len(blocks)) <= tipBlockNumber {
+		block, err := s.client.Rpc.GetBlockByNumber(ctx, targetBlock.Header.Number+uint64(len(blocks)))
+		if err != nil {
+			return err
+		}
+		if block.Header.ParentHash != blocks[len(blocks)-1].Header.Hash {
+			break
+		}
+		blocks = append(blocks, block)
+	}
+	checkInfos := make([]biz.CheckInfo, len(blocks))
+	for i, block := range blocks {
+		checkInfos[i] = biz.CheckInfo{BlockNumber: block.Header.Number, BlockHash: block.Header.Hash.String()[2:], CheckType: biz.SyncBlock}
+	}
+	return s.blockSyncer.SyncBlocks(ctx, blocks, checkInfos, s.systemScripts)
+}
+
 func isForked(checkInfo biz.CheckInfo, targetBlock *ckbTypes.Block) bool {
 	if checkInfo.BlockHash == "" {
 		return false
@@ -116,7 +148,10 @@ func (s *BlockSyncService) Stop(ctx context.Context) error {
 	}
 }
 
-func NewBlockSyncService(checkInfoUsecase *biz.CheckInfoUsecase, logger *logger.Logger, client *data.CkbNodeClient, systemScripts data.SystemScripts, blockSyncer data.BlockSyncer) *BlockSyncService {
+func NewBlockSyncService(checkInfoUsecase *biz.CheckInfoUsecase, logger *logger.Logger, client *data.CkbNodeClient, systemScripts data.SystemScripts, blockSyncer data.BlockSyncer, conf *config.Sync) *BlockSyncService {
+	if conf.BulkBlocks <= 0 {
+		conf.BulkBlocks = 50
+	}
 	return &BlockSyncService{
 		checkInfoUsecase: checkInfoUsecase,
 		logger:           logger,
@@ -124,6 +159,7 @@ func NewBlockSyncService(checkInfoUsecase *biz.CheckInfoUsecase, logger *logger.
 		status:           make(chan struct{}, 1),
 		systemScripts:    systemScripts,
 		blockSyncer:      blockSyncer,
+		conf:             conf,
 	}
 }
 
@@ -0,0 +1,437 @@
+package service
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nervina-labs/cota-smt-go/smt"
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/ckbtest"
+	"github.com/nervina-labs/cota-syncer/internal/config"
+	"github.com/nervina-labs/cota-syncer/internal/data"
+	"github.com/nervina-labs/cota-syncer/internal/data/blockchain"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+	ckbTypes "github.com/nervosnetwork/ckb-sdk-go/types"
+)
+
+// pendingLockScriptId marks a register whose lock script the register lock service has not found yet
+const pendingLockScriptId = 3094967296
+
+// e2e wires the services the way wire_gen.go does, against a fake ckb node and an in-memory sqlite
+// database
+type e2e struct {
+	chain            *ckbtest.Chain
+	systemScripts    data.SystemScripts
+	checkInfoUsecase *biz.CheckInfoUsecase
+	eventUsecase     *biz.CotaEventUsecase
+	kvPairUsecase    *biz.SyncKvPairUsecase
+	lockUsecase      *biz.RegisterLockScriptUsecase
+	extraInfoUsecase *biz.WithdrawExtraInfoUsecase
+	blockSync        *BlockSyncService
+	metadataSync     *MetadataSyncService
+	registerLock     *RegisterLockService
+	withdrawExtra    *WithdrawExtraInfoService
+	quarantined      *biz.QuarantinedEntryUsecase
+	requeue          *RequeueService
+}
+
+func newE2E(t *testing.T) *e2e {
+	t.Helper()
+	log := logger.NewLogger(io.Discard, "", 0)
+	chain := ckbtest.NewChain("ckb_testnet")
+	server := ckbtest.NewServer(chain)
+	t.Cleanup(server.Close)
+
+	dsn := "file:" + strings.ReplaceAll(t.Name(), "/", "_") + "?mode=memory&cache=shared"
+	dataData, cleanup, err := data.NewData(&config.Database{Driver: data.DriverSqlite, Dsn: dsn, MaxIdleConns: 1, MaxOpenConns: 2}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanup)
+	// the migrations are read relative to the repository root
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir("../.."); err != nil {
+		t.Fatal(err)
+	}
+	err = data.NewDBMigration(dataData, log).Up()
+	if chdirErr := os.Chdir(wd); chdirErr != nil {
+		t.Fatal(chdirErr)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := data.NewCkbNodeClient(&config.CkbNode{RpcUrl: server.URL}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	systemScripts := data.NewSystemScripts(client, log)
+	checkInfoUsecase := biz.NewCheckInfoUsecase(data.NewCheckInfoRepo(dataData, log), log)
+	parser := data.NewCotaWitnessArgsParser(client)
+	issuerInfoUsecase := biz.NewIssuerInfoUsecase(data.NewIssuerInfoRepo(dataData, log), log)
+	classInfoUsecase := biz.NewClassInfoUsecase(data.NewClassInfoRepo(dataData, log), log)
+	joyIDInfoUsecase := biz.NewJoyIDInfoUsecase(data.NewJoyIDInfoRepo(dataData, log), log)
+	metadata, err := data.NewMetadataRegistry(data.NewMetadataHandlers(issuerInfoUsecase, classInfoUsecase, joyIDInfoUsecase, data.NewMediaNormalizer(&config.Media{})), &config.Metadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kvPairUsecase := biz.NewSyncKvPairUsecase(data.NewKvPairRepo(dataData, metadata, log), log)
+	blockSyncer := data.NewBlockSyncer(
+		biz.NewClaimedCotaNftKvPairUsecase(data.NewClaimedCotaNftKvPairRepo(dataData, log), log),
+		biz.NewDefineCotaNftKvPairUsecase(data.NewDefineCotaNftKvPairRepo(dataData, log), log),
+		biz.NewHoldCotaNftKvPairUsecase(data.NewHoldCotaNftKvPairRepo(dataData, log), log),
+		biz.NewRegisterCotaKvPairUsecase(data.NewRegisterCotaKvPairRepo(dataData, log), log),
+		biz.NewWithdrawCotaNftKvPairUsecase(data.NewWithdrawCotaNftKvPairRepo(dataData, log), log),
+		parser, kvPairUsecase,
+		biz.NewMintCotaKvPairUsecase(data.NewMintCotaKvPairRepo(dataData, log), log),
+		biz.NewTransferCotaKvPairUsecase(data.NewTransferCotaKvPairRepo(dataData, log), log),
+		issuerInfoUsecase, classInfoUsecase, joyIDInfoUsecase,
+		biz.NewExtensionPairUsecase(data.NewExtensionKvPairRepo(dataData, log), log),
+		biz.NewSubKeyPairRepoUsecase(data.NewSubKeyKvPairRepo(dataData, log), log),
+	)
+	metadataSyncer := data.NewMetadataSyncer(kvPairUsecase, parser, metadata)
+	lockUsecase := biz.NewRegisterLockScriptUsecase(data.NewRegisterLockScriptRepo(dataData, log), log)
+	extraInfoUsecase := biz.NewWithdrawExtraInfoUsecase(data.NewWithdrawExtraInfoRepo(dataData, log), log)
+	quarantined := biz.NewQuarantinedEntryUsecase(data.NewQuarantinedEntryRepo(dataData, log), log)
+	versionRetentionUsecase := biz.NewVersionRetentionUsecase(data.NewVersionRetentionRepo(dataData, log), log)
+	return &e2e{
+		chain:            chain,
+		systemScripts:    systemScripts,
+		checkInfoUsecase: checkInfoUsecase,
+		eventUsecase:     biz.NewCotaEventUsecase(data.NewCotaEventRepo(dataData, log), log),
+		kvPairUsecase:    kvPairUsecase,
+		lockUsecase:      lockUsecase,
+		extraInfoUsecase: extraInfoUsecase,
+		blockSync:        NewBlockSyncService(checkInfoUsecase, log, client, systemScripts, blockSyncer, &config.Sync{}),
+		metadataSync:     NewMetadataSyncService(checkInfoUsecase, log, client, systemScripts, metadataSyncer),
+		registerLock:     NewRegisterLockService(lockUsecase, log, client),
+		withdrawExtra:    NewWithdrawExtraInfoService(extraInfoUsecase, log, client),
+		quarantined:      quarantined,
+		requeue:          NewRequeueService(quarantined, checkInfoUsecase, versionRetentionUsecase, log, blockSyncer, metadataSyncer),
+	}
+}
+
+// syncToTip runs sync rounds until the check info of the type is the tip of the chain
+func (e *e2e) syncToTip(t *testing.T, checkType biz.CheckType, sync func(context.Context)) {
+	t.Helper()
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		checkInfo := e.checkInfo(t, checkType)
+		tip := e.chain.Block(e.chain.Tip()).Header
+		if checkInfo.BlockNumber == tip.Number && checkInfo.BlockHash == tip.Hash.String()[2:] {
+			return
+		}
+		sync(ctx)
+	}
+	t.Fatalf("%s did not reach the tip %d", checkType.String(), e.chain.Tip())
+}
+
+func (e *e2e) checkInfo(t *testing.T, checkType biz.CheckType) biz.CheckInfo {
+	t.Helper()
+	checkInfo := biz.CheckInfo{CheckType: checkType}
+	if err := e.checkInfoUsecase.LastCheckInfo(context.Background(), &checkInfo); err != nil {
+		t.Fatal(err)
+	}
+	return checkInfo
+}
+
+func (e *e2e) registrations(t *testing.T, lockHash string) int {
+	t.Helper()
+	events, _, err := e.eventUsecase.AccountFeed(context.Background(), lockHash, nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for _, event := range events {
+		if event.EventType == biz.CotaEventRegister {
+			count++
+		}
+	}
+	return count
+}
+
+func testLock(args byte) *ckbTypes.Script {
+	return &ckbTypes.Script{CodeHash: ckbTypes.HexToHash("0x9bd7e06f3ecf4be0f2fcd2188b23f1b9fcc88e5d4b65a8637b17723bbda3cce8"), HashType: ckbTypes.HashTypeType, Args: []byte{args}}
+}
+
+func lockHash(t *testing.T, lock *ckbTypes.Script) string {
+	t.Helper()
+	hash, err := lock.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash.String()[2:]
+}
+
+// moleculeBytes serializes the molecule bytes of the data
+func moleculeBytes(data []byte) []byte {
+	bytes := make([]byte, 4, 4+len(data))
+	binary.LittleEndian.PutUint32(bytes, uint32(len(data)))
+	return append(bytes, data...)
+}
+
+// cellTx spends nothing and creates a cell of the lock, the next transactions spend it
+func cellTx(lock *ckbTypes.Script) *ckbTypes.Transaction {
+	return &ckbTypes.Transaction{
+		CellDeps:    []*ckbTypes.CellDep{},
+		HeaderDeps:  []ckbTypes.Hash{},
+		Inputs:      []*ckbTypes.CellInput{},
+		Outputs:     []*ckbTypes.CellOutput{{Capacity: 1000, Lock: lock}},
+		OutputsData: [][]byte{{}},
+		Witnesses:   [][]byte{},
+	}
+}
+
+// registryTx spends the cell and registers the lock, it creates the registry cell and a cota cell of
+// the lock
+func (e *e2e) registryTx(t *testing.T, cell *ckbTypes.Transaction, lock *ckbTypes.Script, cotaCellId uint64) *ckbTypes.Transaction {
+	t.Helper()
+	hash, err := lock.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := make([]byte, 32)
+	binary.BigEndian.PutUint64(state, cotaCellId)
+	registry := smt.NewRegistryBuilder().
+		LockHash(*smt.Byte32FromSliceUnchecked(hash.Bytes())).
+		State(*smt.Byte32FromSliceUnchecked(state)).
+		Build()
+	entries := smt.NewCotaNFTRegistryEntriesBuilder().
+		Registries(smt.NewRegistryVecBuilder().Push(registry).Build()).
+		Build()
+	witness := blockchain.NewWitnessArgsBuilder().
+		InputType(blockchain.NewBytesOptBuilder().Set(*blockchain.BytesFromSliceUnchecked(moleculeBytes(entries.AsSlice()))).Build()).
+		Build()
+	registryType := e.systemScripts.CotaRegistryType
+	cotaType := e.systemScripts.CotaType
+	return &ckbTypes.Transaction{
+		CellDeps:   []*ckbTypes.CellDep{{OutPoint: &registryType.OutPoint, DepType: registryType.DepType}},
+		HeaderDeps: []ckbTypes.Hash{},
+		Inputs:     []*ckbTypes.CellInput{{PreviousOutput: &ckbTypes.OutPoint{TxHash: cell.Hash, Index: 0}}},
+		Outputs: []*ckbTypes.CellOutput{
+			{Capacity: 500, Lock: testLock(0), Type: &ckbTypes.Script{CodeHash: registryType.CodeHash, HashType: registryType.HashType, Args: registryType.Args}},
+			{Capacity: 500, Lock: lock, Type: &ckbTypes.Script{CodeHash: cotaType.CodeHash, HashType: cotaType.HashType, Args: hash.Bytes()[:20]}},
+		},
+		OutputsData: [][]byte{{}, {0x02}},
+		Witnesses:   [][]byte{witness.AsSlice()},
+	}
+}
+
+func TestBlockSyncService_e2e(t *testing.T) {
+	e := newE2E(t)
+	alice, bob := testLock(1), testLock(2)
+
+	aliceCell := cellTx(alice)
+	e.chain.AddBlock(aliceCell)
+	e.chain.AddBlock(e.registryTx(t, aliceCell, alice, 1))
+	e.syncToTip(t, biz.SyncBlock, e.blockSync.sync)
+	if got := e.registrations(t, lockHash(t, alice)); got != 1 {
+		t.Fatalf("alice registrations = %d, want 1", got)
+	}
+
+	// the block registering alice is replaced by a block registering bob
+	e.chain.Fork(1)
+	bobCell := cellTx(bob)
+	e.chain.AddBlock(bobCell)
+	e.chain.AddBlock(e.registryTx(t, bobCell, bob, 2))
+	e.syncToTip(t, biz.SyncBlock, e.blockSync.sync)
+	if got := e.registrations(t, lockHash(t, alice)); got != 0 {
+		t.Errorf("alice registrations after the reorg = %d, want 0", got)
+	}
+	if got := e.registrations(t, lockHash(t, bob)); got != 1 {
+		t.Errorf("bob registrations after the reorg = %d, want 1", got)
+	}
+
+	// the sync stops while the node is down and continues once it is back
+	e.chain.SetDown(true)
+	e.chain.AddBlock()
+	before := e.checkInfo(t, biz.SyncBlock)
+	e.blockSync.sync(context.Background())
+	if after := e.checkInfo(t, biz.SyncBlock); after != before {
+		t.Errorf("check info moved while the node was down: %+v", after)
+	}
+	e.chain.SetDown(false)
+	e.syncToTip(t, biz.SyncBlock, e.blockSync.sync)
+}
+
+func TestBlockSyncService_e2eBulk(t *testing.T) {
+	e := newE2E(t)
+	e.blockSync.conf = &config.Sync{BulkThreshold: 2, BulkBlocks: 3}
+	alice := testLock(1)
+
+	aliceCell := cellTx(alice)
+	e.chain.AddBlock(aliceCell)
+	e.chain.AddBlock(e.registryTx(t, aliceCell, alice, 1))
+	for i := 0; i < 6; i++ {
+		e.chain.AddBlock()
+	}
+	// one round commits three blocks while the syncer is more than two blocks behind the tip
+	e.blockSync.sync(context.Background())
+	if got := e.checkInfo(t, biz.SyncBlock); got.BlockNumber != 3 || got.BlockHash != e.chain.Block(3).Header.Hash.String()[2:] {
+		t.Fatalf("check info after a bulk round = %+v, want block 3", got)
+	}
+	if got := e.registrations(t, lockHash(t, alice)); got != 1 {
+		t.Errorf("alice registrations = %d, want 1", got)
+	}
+	// the last blocks are synced one by one
+	e.syncToTip(t, biz.SyncBlock, e.blockSync.sync)
+}
+
+func TestRequeueService_e2e(t *testing.T) {
+	ctx := context.Background()
+	e := newE2E(t)
+	alice, bob := testLock(1), testLock(2)
+	aliceCell, bobCell := cellTx(alice), cellTx(bob)
+	e.chain.AddBlock(aliceCell)
+	e.chain.AddBlock(e.registryTx(t, aliceCell, alice, 1))
+	e.chain.AddBlock(bobCell)
+	broken := e.registryTx(t, bobCell, bob, 2)
+	broken.Witnesses = [][]byte{{0x01, 0x02}}
+	e.chain.AddBlock(broken)
+	e.chain.AddBlock()
+	e.syncToTip(t, biz.SyncBlock, e.blockSync.sync)
+	entries, err := e.quarantined.FindRequeueEntries(ctx, true)
+	if err != nil || len(entries) != 1 || entries[0].BlockNumber != 4 {
+		t.Fatalf("quarantined entries = %+v, %v, want the broken registry of block 4", entries, err)
+	}
+
+	// nothing was quarantined by an older parser
+	if result, err := e.requeue.Requeue(ctx, false); err != nil || result.Entries != 0 || len(result.Heights) != 0 {
+		t.Errorf("Requeue() = %+v, %v, want nothing requeued", result, err)
+	}
+	if checkInfo := e.checkInfo(t, biz.SyncBlock); checkInfo.BlockNumber != 5 {
+		t.Fatalf("block check info = %d, want 5", checkInfo.BlockNumber)
+	}
+
+	// the blocks from the quarantined entry on are rolled back for the syncer to parse them again
+	result, err := e.requeue.Requeue(ctx, true)
+	if err != nil || result.Entries != 1 || result.Heights[biz.SyncBlock] != 3 {
+		t.Fatalf("Requeue(all) = %+v, %v, want the block syncer rolled back to block 3", result, err)
+	}
+	if _, ok := result.Heights[biz.SyncMetadata]; ok {
+		t.Errorf("Requeue(all) rolled back the metadata syncer without quarantined metadata")
+	}
+	if checkInfo := e.checkInfo(t, biz.SyncBlock); checkInfo.BlockNumber != 3 {
+		t.Errorf("block check info after the requeue = %d, want 3", checkInfo.BlockNumber)
+	}
+	if entries, err = e.quarantined.FindRequeueEntries(ctx, true); err != nil || len(entries) != 0 {
+		t.Errorf("quarantined entries after the requeue = %+v, %v, want them rolled back", entries, err)
+	}
+	if got := e.registrations(t, lockHash(t, alice)); got != 1 {
+		t.Errorf("alice registrations after the requeue = %d, want the block before kept", got)
+	}
+
+	e.syncToTip(t, biz.SyncBlock, e.blockSync.sync)
+	if entries, err = e.quarantined.FindRequeueEntries(ctx, true); err != nil || len(entries) != 1 || entries[0].BlockNumber != 4 {
+		t.Errorf("quarantined entries after the resync = %+v, %v, want the registry parsed again", entries, err)
+	}
+}
+
+func TestMetadataSyncService_e2e(t *testing.T) {
+	e := newE2E(t)
+	for i := 0; i < 3; i++ {
+		e.chain.AddBlock(cellTx(testLock(byte(i))))
+	}
+	e.syncToTip(t, biz.SyncMetadata, e.metadataSync.sync)
+
+	// a reorg deeper than one block rolls back block by block
+	e.chain.Fork(1)
+	e.chain.AddBlock()
+	e.chain.AddBlock()
+	e.chain.AddBlock()
+	e.syncToTip(t, biz.SyncMetadata, e.metadataSync.sync)
+	if checkInfo := e.checkInfo(t, biz.SyncBlock); checkInfo.BlockNumber != 0 {
+		t.Errorf("the metadata sync moved the block check info to %d", checkInfo.BlockNumber)
+	}
+
+	e.chain.SetDown(true)
+	e.chain.AddBlock()
+	e.metadataSync.sync(context.Background())
+	if checkInfo := e.checkInfo(t, biz.SyncMetadata); checkInfo.BlockNumber != 4 {
+		t.Errorf("metadata check info while the node was down = %d, want 4", checkInfo.BlockNumber)
+	}
+	e.chain.SetDown(false)
+	e.syncToTip(t, biz.SyncMetadata, e.metadataSync.sync)
+}
+
+func TestRegisterLockService_e2e(t *testing.T) {
+	ctx := context.Background()
+	e := newE2E(t)
+	alice := testLock(1)
+	aliceCell := cellTx(alice)
+	e.chain.AddBlock(aliceCell)
+	block := e.chain.AddBlock(e.registryTx(t, aliceCell, alice, 1))
+	// registers synced before the lock scripts were stored
+	if err := e.kvPairUsecase.CreateCotaEntryKvPairs(ctx, biz.CheckInfo{BlockNumber: block.Header.Number, BlockHash: block.Header.Hash.String()[2:]}, &biz.KvPair{
+		Registers: []biz.RegisterCotaKvPair{{BlockNumber: block.Header.Number, LockHash: lockHash(t, alice), CotaCellID: 1, LockScriptId: pendingLockScriptId}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	e.chain.SetDown(true)
+	if err := e.registerLock.Start(ctx, "normal"); err == nil {
+		t.Error("register lock service started while the node was down, want an error")
+	}
+	e.chain.SetDown(false)
+	if err := e.registerLock.Start(ctx, "normal"); err != nil {
+		t.Fatal(err)
+	}
+	if done, err := e.lockUsecase.IsAllHaveLock(ctx); err != nil || !done {
+		t.Errorf("all registers have a lock script = %v, %v, want true", done, err)
+	}
+}
+
+func TestWithdrawExtraInfoService_e2e(t *testing.T) {
+	ctx := context.Background()
+	e := newE2E(t)
+	alice, bob := testLock(1), testLock(2)
+	aliceCell := cellTx(alice)
+	e.chain.AddBlock(aliceCell)
+	withdrawTx := &ckbTypes.Transaction{
+		CellDeps:    []*ckbTypes.CellDep{},
+		HeaderDeps:  []ckbTypes.Hash{},
+		Inputs:      []*ckbTypes.CellInput{{PreviousOutput: &ckbTypes.OutPoint{TxHash: aliceCell.Hash, Index: 0}}},
+		Outputs:     []*ckbTypes.CellOutput{{Capacity: 1000, Lock: alice}},
+		OutputsData: [][]byte{{}},
+		Witnesses:   [][]byte{},
+	}
+	block := e.chain.AddBlock(withdrawTx)
+	// the out point of a withdrawal is the last 20 bytes of the spent tx hash and the index
+	outPoint := aliceCell.Hash.String()[26:] + "00000000"
+	const cotaId = "ea9a54ae1a9fea5a5c3ab7b6e0df0a7b0fea5bbd"
+	// withdrawals synced before the tx hashes were stored
+	if err := e.kvPairUsecase.CreateCotaEntryKvPairs(ctx, biz.CheckInfo{BlockNumber: block.Header.Number, BlockHash: block.Header.Hash.String()[2:]}, &biz.KvPair{
+		WithdrawCotas: []biz.WithdrawCotaNftKvPair{{
+			BlockNumber:      block.Header.Number,
+			CotaId:           cotaId,
+			CotaIdCRC:        crc32.ChecksumIEEE([]byte(cotaId)),
+			OutPoint:         outPoint,
+			OutPointCrc:      crc32.ChecksumIEEE([]byte(outPoint)),
+			LockHash:         lockHash(t, alice),
+			LockHashCrc:      crc32.ChecksumIEEE([]byte(lockHash(t, alice))),
+			ReceiverLockHash: lockHash(t, bob),
+		}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	e.chain.SetDown(true)
+	if err := e.withdrawExtra.Start(ctx, "normal"); err == nil {
+		t.Error("withdraw extra info service started while the node was down, want an error")
+	}
+	e.chain.SetDown(false)
+	if err := e.withdrawExtra.Start(ctx, "normal"); err != nil {
+		t.Fatal(err)
+	}
+	if infos, err := e.extraInfoUsecase.FindQueryInfos(ctx, 0, pageSize); err != nil || len(infos) != 0 {
+		t.Errorf("withdrawals without a tx hash = %+v, %v, want none", infos, err)
+	}
+}
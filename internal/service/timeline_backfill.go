@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/data"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+// TimelineBackfillService fills the tx index and hash of the withdrawals and claims synced before
+// migration 25 kept them. It is run by the timeline backfill command and is not one of the services of
+// the app. Each block with unfilled rows is fetched from the node and parsed again, the rows are matched
+// to the parsed pairs and only their tx columns are written, so it can run next to the syncer.
+type TimelineBackfillService struct {
+	timelineUsecase *biz.TokenTimelineUsecase
+	logger          *logger.Logger
+	client          *data.CkbNodeClient
+	systemScripts   data.SystemScripts
+	blockSyncer     data.BlockSyncer
+}
+
+func NewTimelineBackfillService(timelineUsecase *biz.TokenTimelineUsecase, logger *logger.Logger, client *data.CkbNodeClient, systemScripts data.SystemScripts, blockSyncer data.BlockSyncer) *TimelineBackfillService {
+	return &TimelineBackfillService{
+		timelineUsecase: timelineUsecase,
+		logger:          logger,
+		client:          client,
+		systemScripts:   systemScripts,
+		blockSyncer:     blockSyncer,
+	}
+}
+
+// Backfill fills the unfilled rows block by block in block order, batch blocks are read at a time. It
+// returns the number of blocks parsed and of rows filled.
+func (s *TimelineBackfillService) Backfill(ctx context.Context, batch int) (blocks int, rows int64, err error) {
+	var afterBlock uint64
+	for {
+		numbers, err := s.timelineUsecase.UnfilledBlocks(ctx, afterBlock, batch)
+		if err != nil || len(numbers) == 0 {
+			return blocks, rows, err
+		}
+		for _, number := range numbers {
+			block, err := s.client.Rpc.GetBlockByNumber(ctx, number)
+			if err != nil {
+				return blocks, rows, err
+			}
+			kvPair, err := s.blockSyncer.ParseBlock(ctx, block, s.systemScripts)
+			if err != nil {
+				return blocks, rows, err
+			}
+			filled, err := s.timelineUsecase.FillTxs(ctx, kvPair.WithdrawCotas, kvPair.ClaimedCotas)
+			if err != nil {
+				return blocks, rows, err
+			}
+			if filled == 0 {
+				s.logger.Errorf(ctx, "timeline backfill found no pairs of the unfilled rows of block %d", number)
+			}
+			blocks++
+			rows += filled
+			afterBlock = number
+		}
+	}
+}
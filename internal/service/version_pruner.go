@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/config"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+const (
+	RetentionArchive = "archive"
+	RetentionPrune   = "prune"
+)
+
+var _ Service = (*VersionPrunerService)(nil)
+
+type VersionPrunerService struct {
+	retentionUsecase *biz.VersionRetentionUsecase
+	logger           *logger.Logger
+	conf             *config.Retention
+}
+
+func NewVersionPrunerService(retentionUsecase *biz.VersionRetentionUsecase, logger *logger.Logger, conf *config.Retention) *VersionPrunerService {
+	if conf.Mode == "" {
+		conf.Mode = RetentionArchive
+	}
+	if conf.KeepBlocks == 0 {
+		conf.KeepBlocks = 1000
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 1000
+	}
+	if conf.Interval <= 0 {
+		conf.Interval = 10 * time.Minute
+	}
+	return &VersionPrunerService{
+		retentionUsecase: retentionUsecase,
+		logger:           logger,
+		conf:             conf,
+	}
+}
+
+func (s *VersionPrunerService) Start(ctx context.Context, _ string) error {
+	switch s.conf.Mode {
+	case RetentionArchive:
+		s.logger.Info(ctx, "version history retention is archive, nothing is pruned")
+		return nil
+	case RetentionPrune:
+	default:
+		return fmt.Errorf("unknown retention mode %q", s.conf.Mode)
+	}
+	s.logger.Infof(ctx, "Successfully started the version pruner, keeping %d blocks~", s.conf.KeepBlocks)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(s.conf.Interval):
+				s.prune(ctx)
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *VersionPrunerService) prune(ctx context.Context) {
+	for _, checkType := range []biz.CheckType{biz.SyncBlock, biz.SyncMetadata} {
+		pruned, err := s.retentionUsecase.Prune(ctx, checkType, s.conf.KeepBlocks, s.conf.BatchSize)
+		if err != nil {
+			s.logger.Errorf(ctx, "prune %s versions error: %v", checkType.String(), err)
+			continue
+		}
+		if pruned > 0 {
+			s.logger.Infof(ctx, "pruned %d %s version rows", pruned, checkType.String())
+		}
+	}
+}
+
+func (s *VersionPrunerService) Stop(ctx context.Context) error {
+	s.logger.Info(ctx, "Successfully closed the version pruner~")
+	return nil
+}
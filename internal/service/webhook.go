@@ -0,0 +1,262 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/config"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+var _ Service = (*WebhookDispatcher)(nil)
+
+const (
+	outboxBatchSize    = 100
+	minWebhookBackoff  = time.Second
+	maxWebhookBackoff  = time.Minute
+	webhookHTTPTimeout = 10 * time.Second
+)
+
+type webhookPayload struct {
+	Id     uint64           `json:"id"`
+	Status biz.OutboxStatus `json:"status"`
+	Event  biz.CotaEvent    `json:"event"`
+}
+
+type WebhookDispatcher struct {
+	outboxUsecase *biz.EventOutboxUsecase
+	logger        *logger.Logger
+	conf          *config.Webhook
+	client        *http.Client
+	backoff       time.Duration
+	cancel        context.CancelFunc
+	wg            sync.WaitGroup
+}
+
+func NewWebhookDispatcher(outboxUsecase *biz.EventOutboxUsecase, logger *logger.Logger, conf *config.Webhook) *WebhookDispatcher {
+	if conf.PollInterval <= 0 {
+		conf.PollInterval = 2 * time.Second
+	}
+	if conf.MaxAttempts <= 0 {
+		conf.MaxAttempts = 5
+	}
+	return &WebhookDispatcher{
+		outboxUsecase: outboxUsecase,
+		logger:        logger,
+		conf:          conf,
+		client:        &http.Client{Timeout: webhookHTTPTimeout},
+		backoff:       minWebhookBackoff,
+	}
+}
+
+// Start runs a dispatch loop per endpoint. The endpoint name keys the delivery cursor, so an empty or
+// repeated name is rejected instead of sharing a cursor between endpoints.
+func (s *WebhookDispatcher) Start(ctx context.Context, _ string) error {
+	if len(s.conf.Endpoints) == 0 {
+		s.logger.Info(ctx, "webhook dispatcher has no endpoints")
+		return nil
+	}
+	if err := validateWebhookEndpoints(s.conf.Endpoints); err != nil {
+		return err
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+	for _, endpoint := range s.conf.Endpoints {
+		s.wg.Add(1)
+		go func(endpoint config.WebhookEndpoint) {
+			defer s.wg.Done()
+			s.dispatch(ctx, endpoint)
+		}(endpoint)
+	}
+	s.logger.Info(ctx, "Successfully started the webhook dispatcher~")
+	return nil
+}
+
+// Stop cancels the dispatch loops and waits for them, an interrupted delivery is retried after a restart
+func (s *WebhookDispatcher) Stop(ctx context.Context) error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+	s.logger.Info(ctx, "Successfully closed the webhook dispatcher~")
+	return nil
+}
+
+func validateWebhookEndpoints(endpoints []config.WebhookEndpoint) error {
+	names := make(map[string]bool, len(endpoints))
+	for _, endpoint := range endpoints {
+		if endpoint.Name == "" {
+			return fmt.Errorf("webhook endpoint %q has no name", endpoint.Url)
+		}
+		if names[endpoint.Name] {
+			return fmt.Errorf("webhook endpoint name %q is repeated", endpoint.Name)
+		}
+		names[endpoint.Name] = true
+	}
+	return nil
+}
+
+// dispatch delivers the outbox to one endpoint in order. The cursor only moves forward once an
+// event is delivered, filtered out or dead-lettered, so a restart resumes where it stopped.
+func (s *WebhookDispatcher) dispatch(ctx context.Context, endpoint config.WebhookEndpoint) {
+	filter := newWebhookFilter(endpoint)
+	for {
+		cursor, err := s.outboxUsecase.DeliveryCursor(ctx, endpoint.Name)
+		if err == nil {
+			err = s.dispatchBatch(ctx, endpoint, filter, cursor)
+		}
+		if err != nil && ctx.Err() == nil {
+			s.logger.Errorf(ctx, "webhook %s dispatch error: %v", endpoint.Name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.conf.PollInterval):
+		}
+	}
+}
+
+func (s *WebhookDispatcher) dispatchBatch(ctx context.Context, endpoint config.WebhookEndpoint, filter webhookFilter, cursor uint64) error {
+	for {
+		events, err := s.outboxUsecase.FindOutboxEvents(ctx, cursor, outboxBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		for _, event := range events {
+			if filter.match(event.Event) {
+				if err = s.deliverWithRetry(ctx, endpoint, event); err != nil {
+					return err
+				}
+			}
+			cursor = event.Sequence
+			if err = s.outboxUsecase.SaveDeliveryCursor(ctx, endpoint.Name, cursor); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *WebhookDispatcher) deliverWithRetry(ctx context.Context, endpoint config.WebhookEndpoint, event biz.OutboxEvent) error {
+	body, err := json.Marshal(webhookPayload{Id: event.Id, Status: event.Status, Event: event.Event})
+	if err != nil {
+		return err
+	}
+	backoff := s.backoff
+	for attempt := 1; ; attempt++ {
+		err = s.deliver(ctx, endpoint, event.Id, body)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if attempt >= s.conf.MaxAttempts {
+			s.logger.Errorf(ctx, "webhook %s gave up on outbox event %d: %v", endpoint.Name, event.Id, err)
+			return s.outboxUsecase.CreateDeadLetter(ctx, &biz.DeadLetter{
+				Endpoint:  endpoint.Name,
+				OutboxId:  event.Id,
+				Payload:   string(body),
+				LastError: err.Error(),
+				Attempts:  attempt,
+			})
+		}
+		s.logger.Warnf(ctx, "webhook %s outbox event %d attempt %d failed: %v", endpoint.Name, event.Id, attempt, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = nextWebhookBackoff(backoff)
+	}
+}
+
+// nextWebhookBackoff doubles the wait between attempts up to maxWebhookBackoff
+func nextWebhookBackoff(backoff time.Duration) time.Duration {
+	if backoff *= 2; backoff > maxWebhookBackoff {
+		return maxWebhookBackoff
+	}
+	return backoff
+}
+
+func (s *WebhookDispatcher) deliver(ctx context.Context, endpoint config.WebhookEndpoint, id uint64, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("X-Cota-Delivery", strconv.FormatUint(id, 10))
+	req.Header.Set("X-Cota-Timestamp", timestamp)
+	req.Header.Set("X-Cota-Signature", "sha256="+signWebhook(endpoint.Secret, timestamp, body))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// signWebhook signs the timestamp of the attempt with the body, so a receiver that rejects old
+// timestamps cannot be sent a captured delivery again
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type webhookFilter struct {
+	eventTypes map[string]struct{}
+	cotaIds    map[string]struct{}
+	lockHashes map[string]struct{}
+}
+
+func newWebhookFilter(endpoint config.WebhookEndpoint) webhookFilter {
+	return webhookFilter{
+		eventTypes: stringSet(endpoint.EventTypes),
+		cotaIds:    stringSet(endpoint.CotaIds),
+		lockHashes: stringSet(endpoint.LockHashes),
+	}
+}
+
+// match reports whether the event passes every configured filter, an empty filter matches all
+func (f webhookFilter) match(event biz.CotaEvent) bool {
+	if len(f.eventTypes) > 0 && !contains(f.eventTypes, string(event.EventType)) {
+		return false
+	}
+	if len(f.cotaIds) > 0 && !contains(f.cotaIds, event.CotaId) {
+		return false
+	}
+	if len(f.lockHashes) > 0 && !contains(f.lockHashes, event.LockHash) && !contains(f.lockHashes, event.CounterpartyLockHash) {
+		return false
+	}
+	return true
+}
+
+func stringSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		set[remove0x(value)] = struct{}{}
+	}
+	return set
+}
+
+func contains(set map[string]struct{}, value string) bool {
+	_, ok := set[value]
+	return ok
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nervina-labs/cota-syncer/internal/biz"
+	"github.com/nervina-labs/cota-syncer/internal/config"
+	"github.com/nervina-labs/cota-syncer/internal/logger"
+)
+
+func TestWebhookDispatcher_dispatchBatch(t *testing.T) {
+	const secret = "secret"
+	var (
+		mu       sync.Mutex
+		received []webhookPayload
+	)
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp := r.Header.Get("X-Cota-Timestamp")
+		sent, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || time.Since(time.Unix(sent, 0)) > time.Minute {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(timestamp + "." + string(body)))
+		if r.Header.Get("X-Cota-Signature") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var payload webhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil || r.Header.Get("X-Cota-Delivery") != strconv.FormatUint(payload.Id, 10) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		received = append(received, payload)
+		mu.Unlock()
+	}))
+	defer good.Close()
+	var failures int32
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&failures, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	withdraw := biz.CotaEvent{BlockNumber: 10, EventType: biz.CotaEventWithdraw, CotaId: "c1"}
+	claim := biz.CotaEvent{BlockNumber: 11, EventType: biz.CotaEventClaim, CotaId: "c2"}
+	revertedClaim := biz.CotaEvent{BlockNumber: 12, EventType: biz.CotaEventClaim, CotaId: "c1"}
+	// the ids differ from the sequences, the cursors must follow the sequences
+	repo := &memoryOutboxRepo{
+		events: []biz.OutboxEvent{
+			{Id: 11, Sequence: 1, Status: biz.OutboxApplied, Event: withdraw},
+			{Id: 13, Sequence: 2, Status: biz.OutboxApplied, Event: claim},
+			{Id: 12, Sequence: 3, Status: biz.OutboxReverted, Event: revertedClaim},
+		},
+		cursors:    map[string]uint64{},
+		deliveries: map[string]uint64{},
+	}
+	conf := &config.Webhook{MaxAttempts: 3, Endpoints: []config.WebhookEndpoint{
+		{Name: "claims", Url: good.URL, Secret: secret, EventTypes: []string{string(biz.CotaEventClaim)}},
+		{Name: "broken", Url: broken.URL, Secret: secret, CotaIds: []string{"0xc1"}},
+	}}
+	s := NewWebhookDispatcher(biz.NewEventOutboxUsecase(repo, nil), logger.NewLogger(io.Discard, "", 0), conf)
+	s.backoff = time.Millisecond
+	dispatch := func() {
+		t.Helper()
+		for _, endpoint := range conf.Endpoints {
+			cursor, _ := repo.FindDeliveryCursor(context.Background(), endpoint.Name)
+			if err := s.dispatchBatch(context.Background(), endpoint, newWebhookFilter(endpoint), cursor); err != nil {
+				t.Fatalf("dispatchBatch(%s) error = %v", endpoint.Name, err)
+			}
+		}
+	}
+
+	dispatch()
+	if len(received) != 2 || received[0].Id != 13 || received[1].Id != 12 || received[1].Status != biz.OutboxReverted {
+		t.Errorf("claims received %+v, want the claim and the reverted claim", received)
+	}
+	// the broken endpoint matches the withdraw and the reverted claim of c1
+	if failures != 6 || len(repo.deadLetters) != 2 {
+		t.Fatalf("broken endpoint got %d attempts and %d dead letters, want 6 and 2", failures, len(repo.deadLetters))
+	}
+	for i, id := range []uint64{11, 12} {
+		letter := repo.deadLetters[i]
+		if letter.Endpoint != "broken" || letter.OutboxId != id || letter.Attempts != 3 || letter.LastError == "" {
+			t.Errorf("dead letter %d = %+v, want outbox event %d after 3 attempts", i, letter, id)
+		}
+	}
+	if repo.deliveries["claims"] != 3 || repo.deliveries["broken"] != 3 {
+		t.Errorf("cursors = %v, want both at sequence 3", repo.deliveries)
+	}
+
+	// each endpoint resumes from its own cursor
+	repo.events = append(repo.events, biz.OutboxEvent{Id: 14, Sequence: 4, Status: biz.OutboxApplied, Event: claim})
+	dispatch()
+	if len(received) != 3 || received[2].Id != 14 {
+		t.Errorf("claims received %+v, want only the new claim", received[2:])
+	}
+	if failures != 6 || repo.deliveries["broken"] != 4 {
+		t.Errorf("broken endpoint got %d attempts with cursor %d, want the new claim filtered out", failures, repo.deliveries["broken"])
+	}
+}
+
+func TestWebhookDispatcher_StartStop(t *testing.T) {
+	log := logger.NewLogger(io.Discard, "", 0)
+	for _, endpoints := range [][]config.WebhookEndpoint{
+		{{Url: "http://localhost/a"}},
+		{{Name: "a", Url: "http://localhost/a"}, {Name: "a", Url: "http://localhost/b"}},
+	} {
+		s := NewWebhookDispatcher(biz.NewEventOutboxUsecase(&memoryOutboxRepo{}, nil), log, &config.Webhook{Endpoints: endpoints})
+		if err := s.Start(context.Background(), ""); err == nil {
+			t.Errorf("Start(%+v) expected an endpoint name error", endpoints)
+		}
+	}
+
+	repo := &memoryOutboxRepo{deliveries: map[string]uint64{}}
+	conf := &config.Webhook{PollInterval: time.Millisecond, Endpoints: []config.WebhookEndpoint{{Name: "a", Url: "http://localhost/a"}}}
+	s := NewWebhookDispatcher(biz.NewEventOutboxUsecase(repo, nil), log, conf)
+	if err := s.Start(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		_ = s.Stop(context.Background())
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop() did not stop the dispatch loops")
+	}
+}
+
+func Test_nextWebhookBackoff(t *testing.T) {
+	for _, tt := range []struct{ backoff, want time.Duration }{
+		{time.Second, 2 * time.Second},
+		{40 * time.Second, maxWebhookBackoff},
+		{maxWebhookBackoff, maxWebhookBackoff},
+	} {
+		if got := nextWebhookBackoff(tt.backoff); got != tt.want {
+			t.Errorf("nextWebhookBackoff(%v) = %v, want %v", tt.backoff, got, tt.want)
+		}
+	}
+}